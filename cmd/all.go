@@ -3,9 +3,9 @@ package cmd
 import (
 	"time"
 
-	"github.com/microcost/microcost/internal/analyzer"
 	"github.com/microcost/microcost/internal/collector"
 	"github.com/microcost/microcost/internal/costengine"
+	"github.com/microcost/microcost/internal/graph"
 	"github.com/microcost/microcost/internal/visualizer"
 	"github.com/microcost/microcost/pkg/config"
 	"github.com/microcost/microcost/pkg/models"
@@ -17,15 +17,19 @@ var allCmd = &cobra.Command{
 	Short: "Run complete pipeline: analyze, collect, calculate",
 	Long: `Executes the full workflow: 
 1. Analyzes code to build dependency graph
-2. Collects metrics from Prometheus
+2. Collects metrics from the configured metrics source
 3. Calculates costs with attribution
 4. Generates comprehensive report`,
 	RunE: runAll,
 }
 
 var (
-	allDuration string
-	allOutput   string
+	allDuration    string
+	allOutput      string
+	allStrict      bool
+	allMinCoverage float64
+	allRecord      string
+	allReplay      string
 )
 
 func init() {
@@ -33,6 +37,10 @@ func init() {
 
 	allCmd.Flags().StringVarP(&allDuration, "duration", "d", "1h", "Time window for metrics")
 	allCmd.Flags().StringVarP(&allOutput, "output", "o", "./output", "Output directory")
+	allCmd.Flags().BoolVar(&allStrict, "strict", false, "Fail when a metric query fails or coverage is below --min-coverage")
+	allCmd.Flags().StringVar(&allRecord, "record", "", "Save every query and response to this directory as replay fixtures")
+	allCmd.Flags().StringVar(&allReplay, "replay", "", "Answer queries from fixtures recorded with --record instead of Prometheus")
+	allCmd.Flags().Float64Var(&allMinCoverage, "min-coverage", 0.8, "Minimum fraction of services and endpoints with data in strict mode")
 }
 
 func runAll(cmd *cobra.Command, args []string) error {
@@ -51,19 +59,12 @@ func runAll(cmd *cobra.Command, args []string) error {
 		cfg.Output.OutputPath = allOutput
 	}
 
-	// Step 1: Analyze code
-	logger.Info("Step 1/3: Analyzing codebase...")
-	graphBuilder := analyzer.NewGraphBuilder(&cfg.Analysis, logger)
-	callGraph, g, err := graphBuilder.Build()
+	stopReplay, err := applyFixtureFlags(cfg, allRecord, allReplay, logger)
 	if err != nil {
-		logger.WithError(err).Error("Error building dependency graph")
+		logger.WithError(err).Error("Error setting up fixtures")
 		return err
 	}
-	logger.Infof("✓ Found %d services, %d dependencies",
-		len(callGraph.Services), len(callGraph.Dependencies))
-
-	// Step 2: Collect metrics
-	logger.Info("Step 2/3: Collecting metrics from Prometheus...")
+	defer stopReplay()
 
 	duration, err := time.ParseDuration(allDuration)
 	if err != nil {
@@ -78,23 +79,49 @@ func runAll(cmd *cobra.Command, args []string) error {
 		End:   endTime,
 	}
 
-	promCollector, err := collector.NewPrometheusCollector(&cfg.Prometheus, logger)
+	// Step 1: Analyze code, or the service mesh over the collection time range so
+	// that dependency weights and metrics cover the same traffic
+	logger.Info("Step 1/3: Analyzing dependencies...")
+	callGraph, g, err := buildCallGraph(cmd.Context(), cfg, timeRange, logger)
+	if err != nil {
+		logger.WithError(err).Error("Error building dependency graph")
+		return err
+	}
+	logger.Infof("✓ Found %d services, %d dependencies",
+		len(callGraph.Services), len(callGraph.Dependencies))
+
+	// Step 2: Collect metrics
+	logger.Info("Step 2/3: Collecting metrics...")
+
+	source, err := collector.NewMetricsSource(cfg, logger)
 	if err != nil {
-		logger.WithError(err).Error("Error creating Prometheus collector")
+		logger.WithError(err).Error("Error creating metrics source")
 		return err
 	}
 
-	metricsSnapshot, err := promCollector.CollectMetrics(callGraph.Services, timeRange)
+	metricsSnapshot, err := source.CollectMetrics(cmd.Context(), callGraph.Services, timeRange)
 	if err != nil {
 		logger.WithError(err).Error("Error collecting metrics")
 		return err
 	}
+	if err := checkCoverage(logger, metricsSnapshot, allStrict, allMinCoverage); err != nil {
+		logger.WithError(err).Error("Collection incomplete")
+		return err
+	}
 	logger.Infof("✓ Collected metrics for %d services", len(metricsSnapshot.Services))
 
 	// Step 3: Calculate costs
 	logger.Info("Step 3/3: Calculating costs...")
-	calculator := costengine.NewCalculator(&cfg.CostModel, g, logger)
-	costReport, err := calculator.CalculateCosts(callGraph, metricsSnapshot, timeRange)
+	if len(metricsSnapshot.Edges) > 0 {
+		applyEdgeMetrics(logger, callGraph, metricsSnapshot)
+		g = graph.FromCallGraph(callGraph)
+	}
+	calculator, err := costengine.NewCalculator(&cfg.CostModel, g, logger)
+	if err != nil {
+		logger.WithError(err).Error("Error creating cost calculator")
+		return err
+	}
+	costReport, err := calculator.CalculateCosts(callGraph, metricsSnapshot, metricsSnapshot.TimeRange)
 	if err != nil {
 		logger.WithError(err).Error("Error calculating costs")
 		return err
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// TestRunAllReplay runs analyze, collect and calculate on the services in
+// testdata/pipeline with metrics replayed from recorded fixtures. Queries
+// without a fixture replay an empty result.
+func TestRunAllReplay(t *testing.T) {
+	output := t.TempDir()
+
+	cfgFile = "testdata/pipeline/config.yaml"
+	allOutput = output
+	allDuration = "1h"
+	allReplay = "testdata/pipeline/fixtures"
+	defer func() { cfgFile, allReplay = "", "" }()
+
+	GetLogger().SetLevel(logrus.WarnLevel)
+	allCmd.SetContext(context.Background())
+	allCmd.SetOut(io.Discard)
+	if err := runAll(allCmd, nil); err != nil {
+		t.Fatalf("runAll failed: %v", err)
+	}
+
+	callGraph, err := models.LoadCallGraph(filepath.Join(output, "callgraph.json"))
+	if err != nil {
+		t.Fatalf("Failed to load call graph: %v", err)
+	}
+	if len(callGraph.Dependencies) != 1 || callGraph.Dependencies[0].ToService != "cart" {
+		t.Errorf("Expected frontend to call cart, got %v", callGraph.Dependencies)
+	}
+
+	data, err := os.ReadFile(filepath.Join(output, "cost-report.json"))
+	if err != nil {
+		t.Fatalf("Failed to read cost report: %v", err)
+	}
+	var report models.CostReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to parse cost report: %v", err)
+	}
+
+	// 1 and 2 core-hours at $0.05, 0.5 and 1 GB-hours at $0.01, and 1000 requests
+	// each at the default $0.0000002
+	tests := []struct {
+		service  string
+		expected float64
+	}{
+		{"frontend", 0.05 + 0.005 + 0.0002},
+		{"cart", 0.1 + 0.01 + 0.0002},
+	}
+	for _, tt := range tests {
+		sc, exists := report.Services[tt.service]
+		if !exists {
+			t.Errorf("Expected %s in the cost report", tt.service)
+			continue
+		}
+		if math.Abs(sc.DirectCost-tt.expected) > 1e-9 {
+			t.Errorf("Expected %s direct cost %f, got %f", tt.service, tt.expected, sc.DirectCost)
+		}
+	}
+	if math.Abs(report.TotalCost-0.1654) > 1e-9 {
+		t.Errorf("Expected total cost 0.1654, got %f", report.TotalCost)
+	}
+}
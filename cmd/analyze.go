@@ -1,9 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/microcost/microcost/internal/analyzer"
+	"github.com/microcost/microcost/internal/collector"
+	"github.com/microcost/microcost/internal/graph"
 	"github.com/microcost/microcost/internal/visualizer"
 	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -11,7 +19,11 @@ var analyzeCmd = &cobra.Command{
 	Use:   "analyze",
 	Short: "Analyze codebase and build dependency graph",
 	Long: `Scans your Go codebase to discover services, detect HTTP and gRPC calls,
-and build a complete dependency graph of your microservices architecture.`,
+and build a complete dependency graph of your microservices architecture.
+
+With --source mesh, the graph is built from Istio or Linkerd telemetry instead:
+every workload seen in the mesh becomes a service and every pair of workloads
+exchanging traffic a dependency weighted by the measured calls.`,
 	RunE: runAnalyze,
 }
 
@@ -20,6 +32,7 @@ var (
 	analyzeOutput    string
 	analyzeFormat    string
 	analyzeVisualize bool
+	analyzeSource    string
 )
 
 func init() {
@@ -29,6 +42,7 @@ func init() {
 	analyzeCmd.Flags().StringVarP(&analyzeOutput, "output", "o", "callgraph.json", "Output file path")
 	analyzeCmd.Flags().StringVarP(&analyzeFormat, "format", "f", "json", "Output format (json, yaml)")
 	analyzeCmd.Flags().BoolVarP(&analyzeVisualize, "visualize", "v", true, "Show ASCII visualization")
+	analyzeCmd.Flags().StringVar(&analyzeSource, "source", "", "Dependency source (code, mesh); overrides analysis.source")
 }
 
 func runAnalyze(cmd *cobra.Command, args []string) error {
@@ -42,14 +56,18 @@ func runAnalyze(cmd *cobra.Command, args []string) error {
 		cfg = config.DefaultConfig()
 	}
 
-	// Override paths if provided
+	// Override paths and source if provided
 	if len(analyzePaths) > 0 {
 		cfg.Analysis.Paths = analyzePaths
 	}
+	if analyzeSource != "" {
+		cfg.Analysis.Source = analyzeSource
+	}
 
-	// Build dependency graph
-	graphBuilder := analyzer.NewGraphBuilder(&cfg.Analysis, logger)
-	callGraph, _, err := graphBuilder.Build()
+	// Build dependency graph, from the traffic of the last mesh window for mesh analysis
+	endTime := time.Now()
+	timeRange := models.TimeRange{Start: endTime.Add(-cfg.Analysis.Mesh.Window), End: endTime}
+	callGraph, _, err := buildCallGraph(cmd.Context(), cfg, timeRange, logger)
 	if err != nil {
 		logger.WithError(err).Error("Error building dependency graph")
 		return err
@@ -88,3 +106,26 @@ func runAnalyze(cmd *cobra.Command, args []string) error {
 	logger.Info("✓ Analysis complete")
 	return nil
 }
+
+// buildCallGraph builds the dependency graph from the configured analysis source:
+// the code under the analysis paths, or the service mesh telemetry of the time
+// range
+func buildCallGraph(ctx context.Context, cfg *config.Config, timeRange models.TimeRange, logger *logrus.Logger) (*models.CallGraph, *graph.Graph, error) {
+	switch cfg.Analysis.Source {
+	case "", "code":
+		return analyzer.NewGraphBuilder(&cfg.Analysis, logger).Build()
+	case "mesh":
+		meshCollector, err := collector.NewMeshCollector(cfg, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		callGraph, err := meshCollector.BuildCallGraph(ctx, timeRange)
+		if err != nil {
+			return nil, nil, err
+		}
+		return callGraph, graph.FromCallGraph(callGraph), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown analysis source: %s", cfg.Analysis.Source)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/microcost/microcost/internal/costengine"
@@ -9,6 +10,7 @@ import (
 	"github.com/microcost/microcost/internal/visualizer"
 	"github.com/microcost/microcost/pkg/config"
 	"github.com/microcost/microcost/pkg/models"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -21,11 +23,12 @@ for every API endpoint, including downstream service costs.`,
 }
 
 var (
-	calculateCallGraph string
-	calculateMetrics   string
-	calculateOutput    string
-	calculateFormat    string
-	calculateVisualize bool
+	calculateCallGraph   string
+	calculateMetrics     string
+	calculateOutput      string
+	calculateFormat      string
+	calculateVisualize   bool
+	calculateEnvironment string
 )
 
 func init() {
@@ -36,6 +39,7 @@ func init() {
 	calculateCmd.Flags().StringVarP(&calculateOutput, "output", "o", "cost-report.json", "Output file path")
 	calculateCmd.Flags().StringVarP(&calculateFormat, "format", "f", "json", "Output format (json, yaml, ascii)")
 	calculateCmd.Flags().BoolVarP(&calculateVisualize, "visualize", "v", true, "Show ASCII visualization")
+	calculateCmd.Flags().StringVarP(&calculateEnvironment, "environment", "e", "", "Only calculate costs for this namespace or cluster of a split metrics file")
 }
 
 func runCalculate(cmd *cobra.Command, args []string) error {
@@ -50,7 +54,7 @@ func runCalculate(cmd *cobra.Command, args []string) error {
 	}
 
 	// Load call graph
-	callGraph, err := loadCallGraph(calculateCallGraph)
+	callGraph, err := models.LoadCallGraph(calculateCallGraph)
 	if err != nil {
 		logger.WithError(err).Error("Error loading call graph")
 		return err
@@ -63,11 +67,29 @@ func runCalculate(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Create graph structure
-	g := graph.NewGraph()
+	// Restrict to a single environment
+	if calculateEnvironment != "" {
+		envSnapshot, exists := metricsSnapshot.Environments[calculateEnvironment]
+		if !exists {
+			err := fmt.Errorf("environment %s not found in metrics (collect with --split-by)", calculateEnvironment)
+			logger.WithError(err).Error("Error selecting environment")
+			return err
+		}
+		metricsSnapshot = envSnapshot
+	}
+
+	// Replace static dependency weights with the traffic measured between services
+	applyEdgeMetrics(logger, callGraph, metricsSnapshot)
+
+	// Build the endpoint graph costs are propagated over
+	g := graph.FromCallGraph(callGraph)
 
 	// Create cost calculator
-	calculator := costengine.NewCalculator(&cfg.CostModel, g, logger)
+	calculator, err := costengine.NewCalculator(&cfg.CostModel, g, logger)
+	if err != nil {
+		logger.WithError(err).Error("Error creating cost calculator")
+		return err
+	}
 
 	// Calculate costs
 	costReport, err := calculator.CalculateCosts(callGraph, metricsSnapshot, metricsSnapshot.TimeRange)
@@ -106,20 +128,18 @@ func runCalculate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// loadCallGraph loads a call graph from a file
-func loadCallGraph(path string) (*models.CallGraph, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// applyEdgeMetrics applies the measured calls and bytes between services to the
+// dependencies of the call graph
+func applyEdgeMetrics(logger *logrus.Logger, callGraph *models.CallGraph, snapshot *models.MetricsSnapshot) {
+	if len(snapshot.Edges) == 0 {
+		return
 	}
-	defer file.Close()
 
-	var cg models.CallGraph
-	if err := json.NewDecoder(file).Decode(&cg); err != nil {
-		return nil, err
+	unmatched := callGraph.ApplyEdgeMetrics(snapshot)
+	logger.Infof("Applied measured traffic of %d dependency edges", len(snapshot.Edges)-len(unmatched))
+	for _, em := range unmatched {
+		logger.Debugf("No dependency from %s to %s%s for %.0f measured calls", em.From, em.To, em.Endpoint, em.Calls)
 	}
-
-	return &cg, nil
 }
 
 // loadMetrics loads metrics from a file
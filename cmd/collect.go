@@ -1,27 +1,40 @@
 package cmd
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/microcost/microcost/internal/collector"
 	"github.com/microcost/microcost/internal/visualizer"
 	"github.com/microcost/microcost/pkg/config"
 	"github.com/microcost/microcost/pkg/models"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var collectCmd = &cobra.Command{
 	Use:   "collect",
 	Short: "Collect runtime metrics from Prometheus",
-	Long: `Queries Prometheus to collect CPU, memory, network, latency, and request metrics
-for all discovered services and endpoints.`,
+	Long: `Queries the configured metrics source (Prometheus, a federated set of
+Prometheus instances, VictoriaMetrics, or offline snapshot files) to collect CPU,
+memory, network, latency, and request metrics for all discovered services and endpoints.`,
 	RunE: runCollect,
 }
 
 var (
-	collectCallGraph string
-	collectOutput    string
-	collectDuration  string
+	collectCallGraph  string
+	collectOutput     string
+	collectDuration   string
+	collectNamespaces []string
+	collectClusters   []string
+	collectSplitBy    string
+	collectResolution time.Duration
+	collectStrict     bool
+	collectMinCover   float64
+	collectRecord     string
+	collectReplay     string
 )
 
 func init() {
@@ -30,6 +43,14 @@ func init() {
 	collectCmd.Flags().StringVarP(&collectCallGraph, "callgraph", "g", "callgraph.json", "Call graph input file")
 	collectCmd.Flags().StringVarP(&collectOutput, "output", "o", "metrics.json", "Output file path")
 	collectCmd.Flags().StringVarP(&collectDuration, "duration", "d", "1h", "Time window for metrics (e.g., 1h, 30m)")
+	collectCmd.Flags().StringSliceVar(&collectNamespaces, "namespace", nil, "Only collect metrics from these namespaces")
+	collectCmd.Flags().StringSliceVar(&collectClusters, "cluster", nil, "Only collect metrics from these clusters")
+	collectCmd.Flags().StringVar(&collectSplitBy, "split-by", "", "Collect each namespace or cluster separately (namespace, cluster)")
+	collectCmd.Flags().BoolVar(&collectStrict, "strict", false, "Fail when a metric query fails or coverage is below --min-coverage")
+	collectCmd.Flags().Float64Var(&collectMinCover, "min-coverage", 0.8, "Minimum fraction of services and endpoints with data in strict mode")
+	collectCmd.Flags().StringVar(&collectRecord, "record", "", "Save every query and response to this directory as replay fixtures")
+	collectCmd.Flags().StringVar(&collectReplay, "replay", "", "Answer queries from fixtures recorded with --record instead of Prometheus")
+	collectCmd.Flags().DurationVar(&collectResolution, "resolution", 0, "Keep time series with one point per bucket of this size (e.g. 1h)")
 }
 
 func runCollect(cmd *cobra.Command, args []string) error {
@@ -43,13 +64,35 @@ func runCollect(cmd *cobra.Command, args []string) error {
 		cfg = config.DefaultConfig()
 	}
 
+	// Apply scope flags
+	if cmd.Flags().Changed("namespace") {
+		cfg.MetricsSource.Scope.Namespaces = collectNamespaces
+	}
+	if cmd.Flags().Changed("cluster") {
+		cfg.MetricsSource.Scope.Clusters = collectClusters
+	}
+	if cmd.Flags().Changed("split-by") {
+		cfg.MetricsSource.Scope.SplitBy = collectSplitBy
+	}
+	if cmd.Flags().Changed("resolution") {
+		cfg.MetricsSource.Resolution = collectResolution
+	}
+
+	stopReplay, err := applyFixtureFlags(cfg, collectRecord, collectReplay, logger)
+	if err != nil {
+		logger.WithError(err).Error("Error setting up fixtures")
+		return err
+	}
+	defer stopReplay()
+
 	// Load call graph
-	exporter := visualizer.NewExporter(logger)
-	var callGraph models.CallGraph
-	// For simplicity, we'll create a mock call graph here
-	// In production, you'd load it from the file using JSON/YAML unmarshaling
+	callGraph, err := models.LoadCallGraph(collectCallGraph)
+	if err != nil {
+		logger.WithError(err).Error("Error loading call graph")
+		return err
+	}
 
-	logger.Info("Call graph loaded")
+	logger.Infof("Call graph loaded: %d services", len(callGraph.Services))
 
 	// Parse duration
 	duration, err := time.ParseDuration(collectDuration)
@@ -66,23 +109,33 @@ func runCollect(cmd *cobra.Command, args []string) error {
 		End:   endTime,
 	}
 
-	// Create Prometheus collector
-	promCollector, err := collector.NewPrometheusCollector(&cfg.Prometheus, logger)
+	// Create metrics source
+	source, err := collector.NewMetricsSource(cfg, logger)
 	if err != nil {
-		logger.WithError(err).Error("Error creating Prometheus collector")
+		logger.WithError(err).Error("Error creating metrics source")
 		return err
 	}
 
 	// Collect metrics
-	metricsSnapshot, err := promCollector.CollectMetrics(callGraph.Services, timeRange)
+	metricsSnapshot, err := source.CollectMetrics(cmd.Context(), callGraph.Services, timeRange)
 	if err != nil {
 		logger.WithError(err).Error("Error collecting metrics")
 		return err
 	}
 
 	logger.Infof("Metrics collected for %d services", len(metricsSnapshot.Services))
+	if len(metricsSnapshot.Edges) > 0 {
+		logger.Infof("Measured traffic on %d edges between services", len(metricsSnapshot.Edges))
+	}
+
+	// A snapshot rejected in strict mode is not exported
+	if err := checkCoverage(logger, metricsSnapshot, collectStrict, collectMinCover); err != nil {
+		logger.WithError(err).Error("Collection incomplete")
+		return err
+	}
 
 	// Export metrics
+	exporter := visualizer.NewExporter(logger)
 	err = exporter.ExportMetricsJSON(metricsSnapshot, collectOutput)
 	if err != nil {
 		logger.WithError(err).Error("Error exporting metrics")
@@ -90,6 +143,85 @@ func runCollect(cmd *cobra.Command, args []string) error {
 	}
 
 	logger.Infof("Metrics exported to: %s", collectOutput)
+
 	logger.Info("✓ Collection complete")
 	return nil
 }
+
+// checkCoverage logs which metrics failed or came back empty and how many
+// services and endpoints received data. In strict mode it fails when any
+// metric failed or coverage is below the minimum.
+func checkCoverage(logger *logrus.Logger, snapshot *models.MetricsSnapshot, strict bool, minCoverage float64) error {
+	coverage := snapshot.Coverage()
+	percent := func(covered, total int) string {
+		if total == 0 {
+			return fmt.Sprintf("%d/%d", covered, total)
+		}
+		return fmt.Sprintf("%d/%d (%.0f%%)", covered, total, float64(covered)/float64(total)*100)
+	}
+
+	logger.Info("Coverage:")
+	logger.Infof("  Services with CPU data:      %s", percent(coverage.ServicesWithCPU, coverage.Services))
+	logger.Infof("  Services with memory data:   %s", percent(coverage.ServicesWithMemory, coverage.Services))
+	logger.Infof("  Endpoints with request data: %s", percent(coverage.EndpointsWithRequests, coverage.Endpoints))
+	logger.Infof("  Endpoints with latency data: %s", percent(coverage.EndpointsWithLatency, coverage.Endpoints))
+
+	names := make([]string, 0, len(snapshot.Status))
+	for name := range snapshot.Status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		status := snapshot.Status[name]
+		switch status.State {
+		case models.MetricError:
+			logger.Warnf("  %s: failed: %s", name, status.Error)
+		case models.MetricEmpty:
+			logger.Warnf("  %s: no data", name)
+		}
+	}
+
+	if !strict {
+		return nil
+	}
+
+	if failed := snapshot.FailedMetrics(); len(failed) > 0 {
+		return fmt.Errorf("%d metric queries failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	if lowest := coverage.Min(); lowest < minCoverage {
+		return fmt.Errorf("coverage %.0f%% is below the minimum of %.0f%%", lowest*100, minCoverage*100)
+	}
+
+	return nil
+}
+
+// applyFixtureFlags enables recording of queries, or points the configuration at
+// an in-process server replaying recorded fixtures. The returned function stops
+// the replay server.
+func applyFixtureFlags(cfg *config.Config, record, replay string, logger *logrus.Logger) (func(), error) {
+	if record != "" && replay != "" {
+		return nil, fmt.Errorf("--record and --replay are mutually exclusive")
+	}
+
+	if record != "" {
+		cfg.Prometheus.RecordDir = record
+		logger.Infof("Recording queries to %s", record)
+	}
+
+	if replay == "" {
+		return func() {}, nil
+	}
+
+	server, err := collector.NewReplayServer(replay, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	server.Configure(cfg)
+
+	return func() {
+		if err := server.Close(); err != nil {
+			logger.WithError(err).Debug("Error stopping replay server")
+		}
+	}, nil
+}
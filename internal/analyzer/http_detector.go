@@ -44,16 +44,15 @@ func (d *HTTPDetector) DetectInFile(filePath, serviceName string) ([]*models.Dep
 
 	d.dependencies = make([]*models.Dependency, 0)
 
-	ast.Inspect(node, func(n ast.Node) bool {
-		d.inspectNode(n, fset, serviceName)
-		return true
+	inspectCalls(node, func(n ast.Node, caller *models.Endpoint) {
+		d.inspectNode(n, fset, serviceName, caller)
 	})
 
 	return d.dependencies, nil
 }
 
-// inspectNode inspects an AST node for HTTP calls
-func (d *HTTPDetector) inspectNode(n ast.Node, fset *token.FileSet, fromService string) {
+// inspectNode inspects an AST node for HTTP calls made by the caller endpoint, if any
+func (d *HTTPDetector) inspectNode(n ast.Node, fset *token.FileSet, fromService string, caller *models.Endpoint) {
 	callExpr, ok := n.(*ast.CallExpr)
 	if !ok {
 		return
@@ -73,12 +72,18 @@ func (d *HTTPDetector) inspectNode(n ast.Node, fset *token.FileSet, fromService
 				FromService: fromService,
 				ToService:   targetService,
 				ToEndpoint:  endpoint,
+				ToMethod:    d.extractMethod(callExpr),
 				CallType:    "http",
 				Weight:      1.0,
 				DetectedAt:  pos.Filename,
 				LineNumber:  pos.Line,
 			}
 
+			if caller != nil {
+				dep.FromEndpoint = caller.Path
+				dep.FromMethod = caller.Method
+			}
+
 			d.dependencies = append(d.dependencies, dep)
 			d.logger.Debugf("Detected HTTP call: %s -> %s%s", fromService, targetService, endpoint)
 		}
@@ -108,6 +113,22 @@ func (d *HTTPDetector) isHTTPCall(call *ast.CallExpr) bool {
 	return false
 }
 
+// extractMethod returns the HTTP method of a call named after it (http.Get,
+// client.Post), or "" when the method is not known (client.Do)
+func (d *HTTPDetector) extractMethod(call *ast.CallExpr) string {
+	fun, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+
+	switch fun.Sel.Name {
+	case "Get", "Post", "Put", "Delete", "Head", "Patch":
+		return strings.ToUpper(fun.Sel.Name)
+	default:
+		return ""
+	}
+}
+
 // extractURL extracts the URL from an HTTP call
 func (d *HTTPDetector) extractURL(call *ast.CallExpr) string {
 	if len(call.Args) == 0 {
@@ -1,6 +1,8 @@
 package analyzer
 
 import (
+	"go/ast"
+	"go/parser"
 	"testing"
 
 	"github.com/sirupsen/logrus"
@@ -117,3 +119,26 @@ func TestGenerateDependencyID(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractMethod(t *testing.T) {
+	detector := NewHTTPDetector(logrus.New())
+
+	tests := []struct {
+		call string
+		want string
+	}{
+		{`http.Get("http://inventory/items")`, "GET"},
+		{`client.Post("http://payments/charge", "application/json", body)`, "POST"},
+		{`client.Do(req)`, ""},
+	}
+
+	for _, tt := range tests {
+		expr, err := parser.ParseExpr(tt.call)
+		if err != nil {
+			t.Fatalf("ParseExpr failed: %v", err)
+		}
+		if result := detector.extractMethod(expr.(*ast.CallExpr)); result != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.call, tt.want, result)
+		}
+	}
+}
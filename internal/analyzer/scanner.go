@@ -119,13 +119,13 @@ func (s *Scanner) analyzeFunction(fn *ast.FuncDecl, fileName, basePath string) {
 	funcName := fn.Name.Name
 
 	// Check if this looks like an HTTP handler
-	if s.isHTTPHandler(fn) {
+	if isHTTPHandler(fn) {
 		s.logger.Debugf("Found HTTP handler: %s in %s", funcName, fileName)
 		s.registerEndpoint(funcName, "HTTP", fileName, basePath, fn)
 	}
 
 	// Check if this looks like a gRPC method
-	if s.isGRPCMethod(fn) {
+	if isGRPCMethod(fn) {
 		s.logger.Debugf("Found gRPC method: %s in %s", funcName, fileName)
 		s.registerEndpoint(funcName, "gRPC", fileName, basePath, fn)
 	}
@@ -151,7 +151,7 @@ func (s *Scanner) analyzeTypeDecl(typeSpec *ast.TypeSpec, fileName, basePath str
 }
 
 // isHTTPHandler checks if a function is an HTTP handler
-func (s *Scanner) isHTTPHandler(fn *ast.FuncDecl) bool {
+func isHTTPHandler(fn *ast.FuncDecl) bool {
 	if fn.Type == nil || fn.Type.Params == nil {
 		return false
 	}
@@ -171,7 +171,7 @@ func (s *Scanner) isHTTPHandler(fn *ast.FuncDecl) bool {
 }
 
 // isGRPCMethod checks if a function is a gRPC method
-func (s *Scanner) isGRPCMethod(fn *ast.FuncDecl) bool {
+func isGRPCMethod(fn *ast.FuncDecl) bool {
 	if fn.Type == nil || fn.Type.Params == nil {
 		return false
 	}
@@ -216,14 +216,53 @@ func (s *Scanner) registerEndpoint(funcName, endpointType, fileName, basePath st
 
 	service := s.services[serviceName]
 
-	// Create endpoint
+	endpoint := newHandlerEndpoint(funcName, endpointType)
+	endpoint.Service = service
+	service.AddEndpoint(endpoint)
+}
+
+// newHandlerEndpoint creates the endpoint served by an HTTP handler or gRPC method
+func newHandlerEndpoint(funcName, endpointType string) *models.Endpoint {
 	endpoint := &models.Endpoint{
-		Path:    "/" + strings.ToLower(funcName),
-		Method:  "GET", // Default, can be refined with more analysis
-		Service: service,
+		Path:   "/" + strings.ToLower(funcName),
+		Method: "GET", // Default, can be refined with more analysis
+		Type:   models.EndpointHTTP,
 	}
+	if endpointType == "gRPC" {
+		// gRPC metrics are keyed by the method name, which keeps its case
+		endpoint.Path = "/" + funcName
+		endpoint.Type = models.EndpointGRPC
+	}
+	return endpoint
+}
 
-	service.AddEndpoint(endpoint)
+// callerEndpoint returns the endpoint served by the function making a call, or
+// nil when the function is not a handler. A function that is both serves its
+// HTTP endpoint.
+func callerEndpoint(fn *ast.FuncDecl) *models.Endpoint {
+	if fn == nil || fn.Name == nil {
+		return nil
+	}
+	switch {
+	case isHTTPHandler(fn):
+		return newHandlerEndpoint(fn.Name.Name, "HTTP")
+	case isGRPCMethod(fn):
+		return newHandlerEndpoint(fn.Name.Name, "gRPC")
+	}
+	return nil
+}
+
+// inspectCalls walks a file and reports every node with the endpoint of the
+// enclosing handler, nil outside of handlers
+func inspectCalls(file *ast.File, visit func(n ast.Node, caller *models.Endpoint)) {
+	for _, decl := range file.Decls {
+		fn, _ := decl.(*ast.FuncDecl)
+		caller := callerEndpoint(fn)
+		ast.Inspect(decl, func(n ast.Node) bool {
+			visit(n, caller)
+			return true
+		})
+	}
 }
 
 // extractServiceName extracts a service name from file path
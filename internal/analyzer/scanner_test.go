@@ -1,11 +1,14 @@
 package analyzer
 
 import (
+	"go/parser"
+	"go/token"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
 	"github.com/sirupsen/logrus"
 )
 
@@ -145,3 +148,49 @@ func (m *mockFileInfo) Mode() os.FileMode  { return 0 }
 func (m *mockFileInfo) ModTime() time.Time { return time.Time{} }
 func (m *mockFileInfo) IsDir() bool        { return false }
 func (m *mockFileInfo) Sys() interface{}   { return nil }
+
+func TestEndpointTypes(t *testing.T) {
+	src := `package catalog
+
+import (
+	"context"
+	"net/http"
+)
+
+func ListProducts(w http.ResponseWriter, r *http.Request) {}
+
+func GetProduct(ctx context.Context, req *Request) (*Response, error) { return nil, nil }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "catalog/handlers.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse source: %v", err)
+	}
+
+	scanner := NewScanner(&config.AnalysisConfig{}, logrus.New())
+	scanner.analyzeFile(file, "catalog/handlers.go", ".")
+
+	service := scanner.GetServices()["catalog"]
+	if service == nil {
+		t.Fatal("Expected catalog service")
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/listproducts", models.EndpointHTTP},
+		{"/GetProduct", models.EndpointGRPC},
+	}
+
+	for _, tt := range tests {
+		endpoint, exists := service.GetEndpoint(tt.path, "GET")
+		if !exists {
+			t.Errorf("Expected endpoint %s", tt.path)
+			continue
+		}
+		if endpoint.Type != tt.expected {
+			t.Errorf("Expected %s to be %s, got %s", tt.path, tt.expected, endpoint.Type)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package billing
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// curAmortizedFees are line item types whose cost the CUR also spreads over the
+// usage they cover, as effective cost; counting both would count commitments twice
+var curAmortizedFees = map[string]bool{
+	"RIFee":                   true,
+	"SavingsPlanRecurringFee": true,
+	"SavingsPlanUpfrontFee":   true,
+	"SavingsPlanNegation":     true,
+}
+
+// parseCUR reads the records of an AWS Cost and Usage Report in CSV or Parquet,
+// with legacy ("lineItem/UnblendedCost", "resourceTags/user:service") or CUR 2.0
+// ("line_item_unblended_cost", "resource_tags") column names. Usage covered by
+// reservations and savings plans is counted at its effective cost, so that costs
+// compare with the discounted model.
+func parseCUR(records [][]string, tag string) ([]lineItem, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	cols := newColumns(records[0])
+	if !cols.has("lineitemunblendedcost") {
+		return nil, fmt.Errorf("no lineItem/UnblendedCost column, is this a Cost and Usage Report?")
+	}
+
+	key := normalize(tag)
+	tagColumns := []string{"resourcetagsuser" + key, "resourcetags" + key}
+
+	items := make([]lineItem, 0, len(records)-1)
+	for i, record := range records[1:] {
+		itemType := cols.get(record, "lineitemlineitemtype")
+		if curAmortizedFees[itemType] {
+			continue
+		}
+
+		column := "lineitemunblendedcost"
+		switch itemType {
+		case "SavingsPlanCoveredUsage":
+			column = "savingsplansavingsplaneffectivecost"
+		case "DiscountedUsage":
+			column = "reservationeffectivecost"
+		}
+		value := cols.get(record, column, "lineitemunblendedcost")
+		if value == "" {
+			continue
+		}
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cost: %w", i+2, err)
+		}
+
+		item := lineItem{
+			cost:     cost,
+			start:    parseTime(cols.get(record, "lineitemusagestartdate")),
+			end:      parseTime(cols.get(record, "lineitemusageenddate")),
+			currency: cols.get(record, "lineitemcurrencycode"),
+			tag:      cols.get(record, tagColumns...),
+		}
+		if item.tag == "" {
+			item.tag = tagFromJSON(cols.get(record, "resourcetags"), "user"+key, key)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
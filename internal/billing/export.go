@@ -0,0 +1,279 @@
+package billing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// Billing export formats
+const (
+	FormatAWSCUR     = "aws_cur"
+	FormatGCPBilling = "gcp_billing"
+)
+
+// Export is the spend of a billing export, summed by the value of the tag or
+// label naming the service
+type Export struct {
+	Format   string             `json:"format"`
+	Currency string             `json:"currency,omitempty"`
+	Services map[string]float64 `json:"services"` // tag value -> cost
+	Untagged float64            `json:"untagged"` // cost of lines without the tag
+	Lines    int                `json:"lines"`    // line items counted
+}
+
+// lineItem is one cost line of a billing export
+type lineItem struct {
+	tag      string
+	cost     float64
+	start    time.Time
+	end      time.Time
+	currency string
+}
+
+// Load reads a billing export and sums its cost by the value of tag. Lines are
+// prorated to the part of their usage period inside window; lines without a
+// usage period, or a zero window, count in full. Gzip-compressed files are read
+// transparently, and Cost and Usage Reports may be delivered as Parquet.
+func Load(path, format, tag string, window models.TimeRange) (*Export, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading billing export: %w", err)
+	}
+
+	name := path
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing billing export %s: %w", path, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("error decompressing billing export %s: %w", path, err)
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	// Parquet is read into records like CSV
+	var records [][]string
+	if isParquet(data) || strings.EqualFold(filepath.Ext(name), ".parquet") {
+		if records, err = readParquet(data); err != nil {
+			return nil, fmt.Errorf("error reading parquet billing export %s: %w", path, err)
+		}
+	}
+
+	if format == "" || format == "auto" {
+		if records != nil {
+			format = detectFormatFromHeader(records[0])
+		} else {
+			format = detectFormat(name, data)
+		}
+	}
+
+	var items []lineItem
+	switch format {
+	case FormatAWSCUR:
+		if records == nil {
+			records, err = readCSV(data)
+		}
+		if err == nil {
+			items, err = parseCUR(records, tag)
+		}
+	case FormatGCPBilling:
+		if records != nil {
+			return nil, fmt.Errorf("parquet billing exports are only read for %s, extract %s as JSON", FormatAWSCUR, path)
+		}
+		items, err = parseGCP(data, tag)
+	default:
+		return nil, fmt.Errorf("unknown billing export format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing billing export %s: %w", path, err)
+	}
+
+	export := &Export{
+		Format:   format,
+		Services: make(map[string]float64),
+	}
+	for _, item := range items {
+		cost := item.cost * overlap(item.start, item.end, window)
+		if cost == 0 {
+			continue
+		}
+		if export.Currency == "" {
+			export.Currency = item.currency
+		}
+		if item.tag == "" {
+			export.Untagged += cost
+		} else {
+			export.Services[item.tag] += cost
+		}
+		export.Lines++
+	}
+
+	return export, nil
+}
+
+// detectFormat guesses the format of an export from its name and header
+func detectFormat(name string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".jsonl", ".ndjson":
+		return FormatGCPBilling
+	}
+
+	header, err := csv.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		return ""
+	}
+	return detectFormatFromHeader(header)
+}
+
+// detectFormatFromHeader guesses the format of an export from its column names
+func detectFormatFromHeader(header []string) string {
+	for _, column := range header {
+		if strings.HasPrefix(normalize(column), "lineitem") {
+			return FormatAWSCUR
+		}
+	}
+	return FormatGCPBilling
+}
+
+// readCSV reads the header and records of a CSV export
+func readCSV(data []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// overlap returns the fraction of the usage period [start, end) inside window
+func overlap(start, end time.Time, window models.TimeRange) float64 {
+	if window.Start.IsZero() || window.End.IsZero() || start.IsZero() {
+		return 1
+	}
+	if !end.After(start) {
+		if start.Before(window.Start) || !start.Before(window.End) {
+			return 0
+		}
+		return 1
+	}
+
+	from, to := start, end
+	if window.Start.After(from) {
+		from = window.Start
+	}
+	if window.End.Before(to) {
+		to = window.End
+	}
+	if !to.After(from) {
+		return 0
+	}
+	return float64(to.Sub(from)) / float64(end.Sub(start))
+}
+
+// normalize folds a column or tag name so that the spellings of different
+// export versions match: "lineItem/UnblendedCost", "line_item_unblended_cost"
+// and "resourceTags/user:service", "resource_tags_user_service"
+func normalize(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// columns indexes a CSV header by normalized column name
+type columns map[string]int
+
+// newColumns indexes header
+func newColumns(header []string) columns {
+	cols := make(columns, len(header))
+	for i, name := range header {
+		cols[normalize(name)] = i
+	}
+	return cols
+}
+
+// get returns the value of the first of names present in record
+func (c columns) get(record []string, names ...string) string {
+	for _, name := range names {
+		if i, exists := c[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+	}
+	return ""
+}
+
+// has reports whether any of names is a column
+func (c columns) has(names ...string) bool {
+	for _, name := range names {
+		if _, exists := c[name]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// tagFromJSON returns the value of a tag from a JSON encoded tag set, either an
+// object ({"user_service": "checkout"}) or a list of key/value pairs
+// ([{"key": "service", "value": "checkout"}]), matching keys by their normalized
+// name with or without prefix
+func tagFromJSON(value string, keys ...string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	pairs := make(map[string]string)
+	if value[0] == '[' {
+		var list []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(value), &list); err != nil {
+			return ""
+		}
+		for _, kv := range list {
+			pairs[normalize(kv.Key)] = kv.Value
+		}
+	} else {
+		var object map[string]string
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			return ""
+		}
+		for k, v := range object {
+			pairs[normalize(k)] = v
+		}
+	}
+
+	for _, key := range keys {
+		if v, exists := pairs[key]; exists {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseTime parses the timestamps of billing exports: RFC 3339, BigQuery's
+// "2006-01-02 15:04:05 UTC" and CUR interval strings ("start/end", start is used)
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if start, _, found := strings.Cut(s, "/"); found {
+		s = start
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05.999999 MST", "2006-01-02 15:04:05", "2006-01-02T15:04Z", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
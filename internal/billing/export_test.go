@@ -0,0 +1,198 @@
+package billing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+const testCUR = `identity/LineItemId,lineItem/LineItemType,lineItem/UsageStartDate,lineItem/UsageEndDate,lineItem/CurrencyCode,lineItem/UnblendedCost,reservation/EffectiveCost,savingsPlan/SavingsPlanEffectiveCost,resourceTags/user:service
+1,Usage,2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,USD,10,,,checkout
+2,SavingsPlanCoveredUsage,2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,USD,8,,5,checkout
+3,SavingsPlanNegation,2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,USD,-8,,,checkout
+4,DiscountedUsage,2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,USD,0,3,,search
+5,RIFee,2024-01-01T00:00:00Z,2024-02-01T00:00:00Z,USD,700,,,
+6,Usage,2024-01-01T00:00:00Z,2024-01-01T02:00:00Z,USD,4,,,
+7,Usage,2024-01-02T00:00:00Z,2024-01-02T01:00:00Z,USD,100,,,checkout
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	window := models.TimeRange{
+		Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(testCUR))
+	zw.Close()
+
+	// testCUR as CUR 2.0 delivers it in Parquet, with typed columns and a tag map
+	type curRow struct {
+		ID          string            `parquet:"identity_line_item_id"`
+		Type        string            `parquet:"line_item_line_item_type"`
+		Start       time.Time         `parquet:"line_item_usage_start_date,timestamp(millisecond)"`
+		End         time.Time         `parquet:"line_item_usage_end_date,timestamp(millisecond)"`
+		Currency    string            `parquet:"line_item_currency_code"`
+		Cost        float64           `parquet:"line_item_unblended_cost"`
+		Reservation *float64          `parquet:"reservation_effective_cost,optional"`
+		SavingsPlan *float64          `parquet:"savings_plan_savings_plan_effective_cost,optional"`
+		Tags        map[string]string `parquet:"resource_tags"`
+	}
+	hour := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cost := func(v float64) *float64 { return &v }
+	checkout := map[string]string{"user_service": "checkout"}
+	var pq bytes.Buffer
+	err := parquet.Write(&pq, []curRow{
+		{"1", "Usage", hour, hour.Add(time.Hour), "USD", 10, nil, nil, checkout},
+		{"2", "SavingsPlanCoveredUsage", hour, hour.Add(time.Hour), "USD", 8, nil, cost(5), checkout},
+		{"3", "SavingsPlanNegation", hour, hour.Add(time.Hour), "USD", -8, nil, nil, checkout},
+		{"4", "DiscountedUsage", hour, hour.Add(time.Hour), "USD", 0, cost(3), nil, map[string]string{"user_service": "search"}},
+		{"5", "RIFee", hour, hour.AddDate(0, 1, 0), "USD", 700, nil, nil, nil},
+		{"6", "Usage", hour, hour.Add(2 * time.Hour), "USD", 4, nil, nil, nil},
+		{"7", "Usage", hour.Add(24 * time.Hour), hour.Add(25 * time.Hour), "USD", 100, nil, nil, checkout},
+	})
+	if err != nil {
+		t.Fatalf("Failed to write parquet: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		file         string
+		content      []byte
+		wantFormat   string
+		wantServices map[string]float64
+		wantUntagged float64
+	}{
+		{
+			name:         "aws cur with commitments",
+			file:         "cur.csv",
+			content:      []byte(testCUR),
+			wantFormat:   FormatAWSCUR,
+			wantServices: map[string]float64{"checkout": 15, "search": 3},
+			wantUntagged: 2, // half of the two-hour line
+		},
+		{
+			name:         "gzipped aws cur",
+			file:         "cur.csv.gz",
+			content:      gz.Bytes(),
+			wantFormat:   FormatAWSCUR,
+			wantServices: map[string]float64{"checkout": 15, "search": 3},
+			wantUntagged: 2,
+		},
+		{
+			name:         "aws cur 2.0 in parquet",
+			file:         "cur2.snappy.parquet",
+			content:      pq.Bytes(),
+			wantFormat:   FormatAWSCUR,
+			wantServices: map[string]float64{"checkout": 15, "search": 3},
+			wantUntagged: 2,
+		},
+		{
+			name: "aws cur 2.0 with tag map",
+			file: "cur2.csv",
+			content: []byte(`line_item_line_item_type,line_item_usage_start_date,line_item_usage_end_date,line_item_unblended_cost,resource_tags
+Usage,2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,6,"{""user_service"":""checkout""}"
+Usage,2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,1,{}
+`),
+			wantFormat:   FormatAWSCUR,
+			wantServices: map[string]float64{"checkout": 6},
+			wantUntagged: 1,
+		},
+		{
+			name: "gcp export as newline-delimited json",
+			file: "billing.json",
+			content: []byte(`{"cost": 12, "currency": "USD", "usage_start_time": "2024-01-01 00:00:00 UTC", "usage_end_time": "2024-01-01 01:00:00 UTC", "credits": [{"name": "SUD", "amount": -2}], "labels": [{"key": "service", "value": "checkout"}]}
+{"cost": 5, "currency": "USD", "usage_start_time": "2024-01-01 00:00:00 UTC", "usage_end_time": "2024-01-01 01:00:00 UTC", "labels": []}
+`),
+			wantFormat:   FormatGCPBilling,
+			wantServices: map[string]float64{"checkout": 10},
+			wantUntagged: 5,
+		},
+		{
+			name: "gcp export queried into csv",
+			file: "billing.csv",
+			content: []byte(`usage_start_time,usage_end_time,cost,credits,labels.service
+2024-01-01 00:00:00 UTC,2024-01-01 01:00:00 UTC,7,-1,search
+2023-12-31 00:00:00 UTC,2023-12-31 01:00:00 UTC,50,0,search
+`),
+			wantFormat:   FormatGCPBilling,
+			wantServices: map[string]float64{"search": 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, dir, tt.file, tt.content)
+			export, err := Load(path, "auto", "service", window)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+
+			if export.Format != tt.wantFormat {
+				t.Errorf("Expected format %s, got %s", tt.wantFormat, export.Format)
+			}
+			if len(export.Services) != len(tt.wantServices) {
+				t.Errorf("Expected %d services, got %v", len(tt.wantServices), export.Services)
+			}
+			for service, want := range tt.wantServices {
+				if got := export.Services[service]; math.Abs(got-want) > 1e-9 {
+					t.Errorf("Expected %s cost %.2f, got %.2f", service, want, got)
+				}
+			}
+			if math.Abs(export.Untagged-tt.wantUntagged) > 1e-9 {
+				t.Errorf("Expected untagged cost %.2f, got %.2f", tt.wantUntagged, export.Untagged)
+			}
+		})
+	}
+}
+
+func TestLoadParquetErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// BigQuery exports nest credits in records, which are not read from Parquet
+	type gcpRow struct {
+		Cost float64 `parquet:"cost"`
+	}
+	var pq bytes.Buffer
+	if err := parquet.Write(&pq, []gcpRow{{Cost: 1}}); err != nil {
+		t.Fatalf("Failed to write parquet: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		format  string
+	}{
+		{"truncated file", "cur.parquet", []byte("PAR1"), "auto"},
+		{"gcp export", "billing.parquet", pq.Bytes(), FormatGCPBilling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, dir, tt.file, tt.content)
+			if _, err := Load(path, tt.format, "service", models.TimeRange{}); err == nil {
+				t.Error("Expected error for the parquet export")
+			}
+		})
+	}
+}
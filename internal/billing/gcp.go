@@ -0,0 +1,144 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// gcpRow is the part of a BigQuery billing export row the reconciliation uses
+type gcpRow struct {
+	Cost           float64 `json:"cost"`
+	Currency       string  `json:"currency"`
+	UsageStartTime string  `json:"usage_start_time"`
+	UsageEndTime   string  `json:"usage_end_time"`
+	Credits        []struct {
+		Amount float64 `json:"amount"`
+	} `json:"credits"`
+	Labels []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"labels"`
+}
+
+// parseGCP reads a dump of the Cloud Billing BigQuery export: newline-delimited
+// JSON or a JSON array of rows as BigQuery extracts them, or CSV from a query that
+// flattens the label into a column ("labels.service", "label_service" or the label
+// name). Credits (sustained and committed use discounts, promotions) are netted
+// against the cost of their row.
+func parseGCP(data []byte, label string) ([]lineItem, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return parseGCPJSON(trimmed, label)
+	}
+	return parseGCPCSV(data, label)
+}
+
+// parseGCPJSON reads rows of the BigQuery export in JSON
+func parseGCPJSON(data []byte, label string) ([]lineItem, error) {
+	var rows []gcpRow
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var row gcpRow
+			if err := decoder.Decode(&row); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("row %d: %w", len(rows)+1, err)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	key := normalize(label)
+	items := make([]lineItem, 0, len(rows))
+	for _, row := range rows {
+		item := lineItem{
+			cost:     row.Cost,
+			start:    parseTime(row.UsageStartTime),
+			end:      parseTime(row.UsageEndTime),
+			currency: row.Currency,
+		}
+		for _, credit := range row.Credits {
+			item.cost += credit.Amount
+		}
+		for _, kv := range row.Labels {
+			if normalize(kv.Key) == key {
+				item.tag = kv.Value
+				break
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseGCPCSV reads rows of the BigQuery export queried into CSV. BigQuery cannot
+// extract repeated fields to CSV, so the query must flatten the label and credits.
+func parseGCPCSV(data []byte, label string) ([]lineItem, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	cols := newColumns(records[0])
+	if !cols.has("cost") {
+		return nil, fmt.Errorf("no cost column, is this a billing export?")
+	}
+
+	key := normalize(label)
+	labelColumns := []string{"labels" + key, "label" + key, key}
+
+	items := make([]lineItem, 0, len(records)-1)
+	for i, record := range records[1:] {
+		cost, err := strconv.ParseFloat(cols.get(record, "cost"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cost: %w", i+2, err)
+		}
+
+		// Credits are either a total or the JSON encoded repeated field
+		if credits := cols.get(record, "credits"); credits != "" {
+			if amount, err := strconv.ParseFloat(credits, 64); err == nil {
+				cost += amount
+			} else {
+				var list []struct {
+					Amount float64 `json:"amount"`
+				}
+				if err := json.Unmarshal([]byte(credits), &list); err != nil {
+					return nil, fmt.Errorf("line %d: invalid credits: %w", i+2, err)
+				}
+				for _, credit := range list {
+					cost += credit.Amount
+				}
+			}
+		}
+
+		item := lineItem{
+			cost:     cost,
+			start:    parseTime(cols.get(record, "usagestarttime")),
+			end:      parseTime(cols.get(record, "usageendtime")),
+			currency: cols.get(record, "currency"),
+			tag:      cols.get(record, labelColumns...),
+		}
+		if item.tag == "" {
+			item.tag = tagFromJSON(cols.get(record, "labels"), key)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,146 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetMagic starts and ends every Parquet file
+var parquetMagic = []byte("PAR1")
+
+// julianUnixEpoch is the Julian day number of 1970-01-01, the epoch of INT96 timestamps
+const julianUnixEpoch = 2440588
+
+// readParquet reads a Parquet export into a header and records of string
+// values, the way a CSV export reads. Timestamps are formatted as RFC 3339 and
+// map columns, such as the resource_tags of CUR 2.0, as JSON objects.
+func readParquet(data []byte) ([][]string, error) {
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	schema := file.Schema()
+
+	// Leaf columns are flat values or the keys and values of a map, which
+	// make up one column named after the map
+	leaves := schema.Columns()
+	header := make([]string, 0, len(leaves))
+	index := make(map[string]int, len(leaves))
+	formatters := make([]func(parquet.Value) string, len(leaves))
+	for i, path := range leaves {
+		if _, exists := index[path[0]]; !exists {
+			index[path[0]] = len(header)
+			header = append(header, path[0])
+		}
+		leaf, _ := schema.Lookup(path...)
+		formatters[i] = parquetFormatter(leaf.Node.Type())
+	}
+
+	records := [][]string{header}
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 64)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, row := range rows[:n] {
+			record := make([]string, len(header))
+			maps := make(map[int]map[string]string)
+			var key string
+
+			for _, value := range row {
+				path := leaves[value.Column()]
+				i := index[path[0]]
+				if len(path) == 1 {
+					if !value.IsNull() {
+						record[i] = formatters[value.Column()](value)
+					}
+					continue
+				}
+
+				// Map entries are a key column followed by a value column
+				switch path[len(path)-1] {
+				case "key":
+					key = formatters[value.Column()](value)
+				case "value":
+					if value.IsNull() {
+						continue
+					}
+					if maps[i] == nil {
+						maps[i] = make(map[string]string)
+					}
+					maps[i][key] = formatters[value.Column()](value)
+				}
+			}
+
+			for i, m := range maps {
+				encoded, err := json.Marshal(m)
+				if err != nil {
+					return nil, err
+				}
+				record[i] = string(encoded)
+			}
+			records = append(records, record)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parquetFormatter returns a function formatting the values of a column type
+func parquetFormatter(t parquet.Type) func(parquet.Value) string {
+	if logical := t.LogicalType(); logical != nil && logical.Timestamp != nil {
+		unit := logical.Timestamp.Unit
+		return func(v parquet.Value) string {
+			var ts time.Time
+			switch {
+			case unit.Millis != nil:
+				ts = time.UnixMilli(v.Int64())
+			case unit.Micros != nil:
+				ts = time.UnixMicro(v.Int64())
+			default:
+				ts = time.Unix(0, v.Int64())
+			}
+			return ts.UTC().Format(time.RFC3339)
+		}
+	}
+
+	switch t.Kind() {
+	case parquet.Boolean:
+		return func(v parquet.Value) string { return strconv.FormatBool(v.Boolean()) }
+	case parquet.Int32:
+		return func(v parquet.Value) string { return strconv.FormatInt(int64(v.Int32()), 10) }
+	case parquet.Int64:
+		return func(v parquet.Value) string { return strconv.FormatInt(v.Int64(), 10) }
+	case parquet.Int96:
+		// Legacy timestamps: nanoseconds of the day and a Julian day
+		return func(v parquet.Value) string {
+			i := v.Int96()
+			nanos := int64(i[1])<<32 | int64(i[0])
+			days := int64(i[2]) - julianUnixEpoch
+			return time.Unix(days*86400, nanos).UTC().Format(time.RFC3339)
+		}
+	case parquet.Float:
+		return func(v parquet.Value) string { return strconv.FormatFloat(float64(v.Float()), 'g', -1, 32) }
+	case parquet.Double:
+		return func(v parquet.Value) string { return strconv.FormatFloat(v.Double(), 'g', -1, 64) }
+	default:
+		return func(v parquet.Value) string { return string(v.ByteArray()) }
+	}
+}
+
+// isParquet reports whether data is a Parquet file
+func isParquet(data []byte) bool {
+	return len(data) >= 2*len(parquetMagic) && bytes.HasPrefix(data, parquetMagic) && bytes.HasSuffix(data, parquetMagic)
+}
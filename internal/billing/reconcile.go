@@ -0,0 +1,132 @@
+package billing
+
+import (
+	"math"
+	"sort"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// Reconcile compares the direct cost of every service in the report with the
+// cost the export bills to it. Tag values are mapped to services through the
+// configured services, or used as service names.
+func Reconcile(report *models.CostReport, export *Export, cfg *config.ReconcileConfig) *models.BillReconciliation {
+	rec := &models.BillReconciliation{
+		Format:       export.Format,
+		Tag:          cfg.Tag,
+		Currency:     export.Currency,
+		TimeRange:    report.TimeRange,
+		Tolerance:    cfg.Tolerance,
+		UntaggedCost: export.Untagged,
+		Unmodelled:   make(map[string]float64),
+		Services:     make([]*models.ServiceVariance, 0, len(report.Services)),
+	}
+
+	billed := make(map[string]float64, len(export.Services))
+	for value, cost := range export.Services {
+		service := value
+		if mapped, exists := cfg.Services[value]; exists {
+			service = mapped
+		}
+		if _, modelled := report.Services[service]; !modelled {
+			rec.Unmodelled[service] += cost
+			rec.UnmodelledCost += cost
+			continue
+		}
+		billed[service] += cost
+	}
+
+	for name, sc := range report.Services {
+		sv := &models.ServiceVariance{
+			Service:      name,
+			ModelledCost: sc.DirectCost,
+			BilledCost:   billed[name],
+			Variance:     sc.DirectCost - billed[name],
+		}
+		sv.VariancePercent = percent(sv.Variance, sv.BilledCost)
+		sv.OutOfTolerance = sv.BilledCost == 0 || math.Abs(sv.VariancePercent) > cfg.Tolerance
+		rec.Services = append(rec.Services, sv)
+
+		rec.ModelledCost += sv.ModelledCost
+		rec.BilledCost += sv.BilledCost
+	}
+	rec.Variance = rec.ModelledCost - rec.BilledCost
+	rec.VariancePercent = percent(rec.Variance, rec.BilledCost)
+
+	sort.Slice(rec.Services, func(i, j int) bool {
+		vi, vj := math.Abs(rec.Services[i].Variance), math.Abs(rec.Services[j].Variance)
+		if vi != vj {
+			return vi > vj
+		}
+		return rec.Services[i].Service < rec.Services[j].Service
+	})
+
+	return rec
+}
+
+// Calibrate scales the unit rates of the report's cost model by the ratio of
+// billed to modelled cost of the services found in the bill. Costs that do not
+// follow the unit rates are taken out of both sides, taking them to be billed as
+// modelled, so that calculating again with the calibrated rates makes the
+// modelled total of those services match the bill. Services the bill has no cost
+// for are left out, since their spend is usually untagged rather than zero. It
+// returns nil when no service is in the bill or all of its cost is fixed.
+func Calibrate(rec *models.BillReconciliation, report *models.CostReport) *models.Calibration {
+	modelled, billed, fixed := 0.0, 0.0, 0.0
+	for _, sv := range rec.Services {
+		if sv.BilledCost == 0 {
+			continue
+		}
+		modelled += sv.ModelledCost
+		billed += sv.BilledCost
+		if sc, exists := report.Services[sv.Service]; exists {
+			fixed += fixedCost(sc)
+		}
+	}
+	if modelled-fixed <= 0 || billed-fixed <= 0 || report.CostModel == nil {
+		return nil
+	}
+
+	factor := (billed - fixed) / (modelled - fixed)
+	calibrated := *report.CostModel
+	calibrated.CPUCostPerCoreHour *= factor
+	calibrated.MemoryCostPerGBHour *= factor
+	calibrated.NetworkCostPerGB *= factor
+	calibrated.DiskCostPerGBHour *= factor
+	calibrated.RequestCost *= factor
+
+	return &models.Calibration{
+		Factor:    factor,
+		FixedCost: fixed,
+		CostModel: &calibrated,
+	}
+}
+
+// fixedCost returns the part of a service's direct cost that does not follow the
+// unit rates of the cost model: the monthly cost of a fixed-price service, and the
+// compute of a serverless service, which is priced per GB-second and invocation
+func fixedCost(sc *models.ServiceCost) float64 {
+	fixed := 0.0
+	for _, ec := range sc.Endpoints {
+		cb := ec.CostBreakdown
+		if cb == nil {
+			continue
+		}
+		switch sc.ComputeModel {
+		case models.ComputeFixedMonthly:
+			fixed += cb.FixedCost
+		case models.ComputeServerless:
+			fixed += cb.CPUCost + cb.MemoryCost + cb.RequestCost
+		}
+	}
+	return fixed
+}
+
+// percent returns part as a percentage of whole, or 0 when whole is 0
+func percent(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole * 100
+}
@@ -0,0 +1,120 @@
+package billing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestReconcile(t *testing.T) {
+	report := models.NewCostReport(&models.CostModel{CPUCostPerCoreHour: 0.04, MemoryCostPerGBHour: 0.005}, models.TimeRange{})
+	report.AddServiceCost(&models.ServiceCost{ServiceName: "checkout", DirectCost: 10, TotalCost: 14})
+	report.AddServiceCost(&models.ServiceCost{ServiceName: "search", DirectCost: 4, TotalCost: 4})
+	report.AddServiceCost(&models.ServiceCost{ServiceName: "cache", DirectCost: 1, TotalCost: 1})
+
+	export := &Export{
+		Format: FormatAWSCUR,
+		Services: map[string]float64{
+			"checkout-svc": 12,
+			"search":       4.2,
+			"batch":        7,
+		},
+		Untagged: 3,
+	}
+	cfg := &config.ReconcileConfig{
+		Tag:       "service",
+		Services:  map[string]string{"checkout-svc": "checkout"},
+		Tolerance: 10,
+	}
+
+	rec := Reconcile(report, export, cfg)
+
+	if rec.ModelledCost != 15 {
+		t.Errorf("Expected modelled cost 15, got %.2f", rec.ModelledCost)
+	}
+	if math.Abs(rec.BilledCost-16.2) > 1e-9 {
+		t.Errorf("Expected billed cost 16.2, got %.2f", rec.BilledCost)
+	}
+	if rec.UnmodelledCost != 7 || rec.Unmodelled["batch"] != 7 {
+		t.Errorf("Expected batch unmodelled at 7, got %v", rec.Unmodelled)
+	}
+	if rec.UntaggedCost != 3 {
+		t.Errorf("Expected untagged cost 3, got %.2f", rec.UntaggedCost)
+	}
+
+	want := []struct {
+		service        string
+		variance       float64
+		outOfTolerance bool
+	}{
+		{"checkout", -2, true},
+		{"cache", 1, true}, // not in the bill
+		{"search", -0.2, false},
+	}
+	if len(rec.Services) != len(want) {
+		t.Fatalf("Expected %d services, got %d", len(want), len(rec.Services))
+	}
+	for i, w := range want {
+		sv := rec.Services[i]
+		if sv.Service != w.service {
+			t.Errorf("Expected service %d to be %s, got %s", i, w.service, sv.Service)
+		}
+		if math.Abs(sv.Variance-w.variance) > 1e-9 {
+			t.Errorf("Expected %s variance %.2f, got %.2f", w.service, w.variance, sv.Variance)
+		}
+		if sv.OutOfTolerance != w.outOfTolerance {
+			t.Errorf("Expected %s out of tolerance %v, got %v", w.service, w.outOfTolerance, sv.OutOfTolerance)
+		}
+	}
+
+	// Calibration leaves out cache, which the bill has no cost for
+	cal := Calibrate(rec, report)
+	if cal == nil {
+		t.Fatal("Expected calibration")
+	}
+	if wantFactor := 16.2 / 14; math.Abs(cal.Factor-wantFactor) > 1e-9 {
+		t.Errorf("Expected factor %.4f, got %.4f", wantFactor, cal.Factor)
+	}
+	if math.Abs(cal.CostModel.CPUCostPerCoreHour-0.04*cal.Factor) > 1e-12 {
+		t.Errorf("Expected calibrated CPU rate %.5f, got %.5f", 0.04*cal.Factor, cal.CostModel.CPUCostPerCoreHour)
+	}
+	if report.CostModel.CPUCostPerCoreHour != 0.04 {
+		t.Errorf("Expected the report's cost model unchanged, got %.5f", report.CostModel.CPUCostPerCoreHour)
+	}
+}
+
+func TestCalibrateFixedMonthly(t *testing.T) {
+	report := models.NewCostReport(&models.CostModel{CPUCostPerCoreHour: 0.04}, models.TimeRange{})
+	report.AddServiceCost(&models.ServiceCost{ServiceName: "checkout", DirectCost: 10, TotalCost: 10})
+	// ledger pays 5 for its reserved VM, whatever the rates, and 1 for network
+	report.AddServiceCost(&models.ServiceCost{
+		ServiceName:  "ledger",
+		DirectCost:   6,
+		TotalCost:    6,
+		ComputeModel: models.ComputeFixedMonthly,
+		Endpoints: map[string]*models.EndpointCost{
+			"/:GET": {DirectCost: 6, CostBreakdown: &models.CostBreakdown{FixedCost: 5, NetworkCost: 1, Total: 6}},
+		},
+	})
+
+	export := &Export{Format: FormatAWSCUR, Services: map[string]float64{"checkout": 12, "ledger": 6.2}}
+	rec := Reconcile(report, export, &config.ReconcileConfig{Tag: "service", Tolerance: 10})
+
+	cal := Calibrate(rec, report)
+	if cal == nil {
+		t.Fatal("Expected calibration")
+	}
+	if cal.FixedCost != 5 {
+		t.Errorf("Expected fixed cost 5, got %.2f", cal.FixedCost)
+	}
+
+	// Scaling the 11 that follows the rates to 13.2 makes the total match the bill
+	if math.Abs(cal.Factor-1.2) > 1e-9 {
+		t.Errorf("Expected factor 1.2, got %.4f", cal.Factor)
+	}
+	if recalculated := 10*cal.Factor + 5 + 1*cal.Factor; math.Abs(recalculated-rec.BilledCost) > 1e-9 {
+		t.Errorf("Expected recalculated cost %.2f to match the bill %.2f", recalculated, rec.BilledCost)
+	}
+}
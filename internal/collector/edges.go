@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// edgeConvention describes how client-side or service mesh metrics name the calls
+// from one service to another and the bytes they carry
+type edgeConvention struct {
+	sourceLabel   model.LabelName // calling service
+	targetLabel   model.LabelName // called service, host or address
+	endpointLabel model.LabelName // called endpoint, empty when not exported
+	methodLabel   model.LabelName
+	filter        model.LabelSet // labels every series must have, e.g. the reporting side
+	calls         string         // counter of calls
+	requestBytes  string         // counter of bytes sent by the caller
+	responseBytes string         // counter of bytes received from the callee
+}
+
+// edgeConventions are the supported edge metric conventions by configuration name
+var edgeConventions = map[string]edgeConvention{
+	// HTTP client instrumentation labelled like the server metrics
+	"http_client": {
+		sourceLabel:   "service",
+		targetLabel:   "target",
+		endpointLabel: "endpoint",
+		methodLabel:   "method",
+		calls:         "http_client_requests_total",
+		requestBytes:  "http_client_request_size_bytes_sum",
+		responseBytes: "http_client_response_size_bytes_sum",
+	},
+	// Istio standard metrics, as reported by the sidecar of the caller
+	"istio": {
+		sourceLabel:   "source_workload",
+		targetLabel:   "destination_workload",
+		filter:        model.LabelSet{"reporter": "source"},
+		calls:         "istio_requests_total",
+		requestBytes:  "istio_request_bytes_sum",
+		responseBytes: "istio_response_bytes_sum",
+	},
+	// Linkerd proxy metrics of outbound traffic; bytes are counted per TCP connection
+	"linkerd": {
+		sourceLabel:   "deployment",
+		targetLabel:   "dst_deployment",
+		filter:        model.LabelSet{"direction": "outbound"},
+		calls:         "response_total",
+		requestBytes:  "tcp_write_bytes_total",
+		responseBytes: "tcp_read_bytes_total",
+	},
+}
+
+// newEdgeConvention returns the named edge metric convention, or nil when edge
+// metrics are not collected
+func newEdgeConvention(name string) (*edgeConvention, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+
+	conv, exists := edgeConventions[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown edge_metrics convention: %s", name)
+	}
+	return &conv, nil
+}
+
+// selector returns the PromQL label matchers restricting edge series to calls
+// made by the given services, or by any workload when services is nil
+func (c *edgeConvention) selector(services map[string]*models.Service) string {
+	return workloadSelector(c.sourceLabel, services, c.filter)
+}
+
+// matches reports whether a series records calls made by one of the services
+func (c *edgeConvention) matches(metric model.Metric, services map[string]*models.Service) bool {
+	return workloadMatches(metric, c.sourceLabel, services, c.filter)
+}
+
+// workloadSelector returns PromQL label matchers restricting the label to the
+// given services, if any, and requiring the labels of filter
+func workloadSelector(label model.LabelName, services map[string]*models.Service, filter model.LabelSet) string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+
+	matchers := make([]string, 0, len(filter))
+	for name, value := range filter {
+		matchers = append(matchers, fmt.Sprintf(`%s=%q`, name, value))
+	}
+	sort.Strings(matchers)
+	if len(names) > 0 {
+		matchers = append([]string{strings.TrimPrefix(labelMatcher(string(label), names), ",")}, matchers...)
+	}
+	return strings.Join(matchers, ",")
+}
+
+// workloadMatches reports whether the label of a series names one of the services
+// and the series has the labels of filter
+func workloadMatches(metric model.Metric, label model.LabelName, services map[string]*models.Service, filter model.LabelSet) bool {
+	if _, exists := services[string(metric[label])]; !exists {
+		return false
+	}
+	for name, value := range filter {
+		if metric[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// groupBy returns the labels edge series are grouped by
+func (c *edgeConvention) groupBy() []model.LabelName {
+	by := []model.LabelName{c.sourceLabel, c.targetLabel}
+	if c.endpointLabel != "" {
+		by = append(by, c.endpointLabel, c.methodLabel)
+	}
+	return by
+}
+
+// edgeQueries returns the calls and bytes per edge between services
+func edgeQueries(conv *edgeConvention, selector string, timeRange models.TimeRange) []*metricQuery {
+	window := promDuration(timeRange.Duration())
+	labels := conv.groupBy()
+	by := make([]string, len(labels))
+	for i, label := range labels {
+		by[i] = string(label)
+	}
+
+	increase := func(metric string) string {
+		return fmt.Sprintf(`sum by (%s) (increase(%s{%s}[%s]))`, strings.Join(by, ", "), metric, selector, window)
+	}
+
+	return []*metricQuery{
+		{
+			name:  "edge_calls",
+			kind:  instantQuery,
+			query: increase(conv.calls),
+			edge:  func(em *models.EdgeMetrics, v float64) { em.Calls += v },
+		},
+		{
+			name:  "edge_request_bytes",
+			kind:  instantQuery,
+			query: increase(conv.requestBytes),
+			edge:  func(em *models.EdgeMetrics, v float64) { em.RequestBytes += v },
+		},
+		{
+			name:  "edge_response_bytes",
+			kind:  instantQuery,
+			query: increase(conv.responseBytes),
+			edge:  func(em *models.EdgeMetrics, v float64) { em.ResponseBytes += v },
+		},
+	}
+}
+
+// applyEdgeValues adds an edge metric to the snapshot's edges. Calls to the same
+// service under different addresses are added up.
+func applyEdgeValues(mq *metricQuery, values []seriesValue, conv *edgeConvention, services map[string]*models.Service, snapshot *models.MetricsSnapshot) {
+	for _, series := range values {
+		from := string(series.labels[conv.sourceLabel])
+		if _, exists := services[from]; !exists {
+			continue
+		}
+		// Istio reports calls to workloads outside the mesh as unknown
+		to := edgeTarget(string(series.labels[conv.targetLabel]), services)
+		if to == "" || to == "unknown" {
+			continue
+		}
+
+		endpoint, method := "", ""
+		if conv.endpointLabel != "" {
+			endpoint = string(series.labels[conv.endpointLabel])
+			method = strings.ToUpper(string(series.labels[conv.methodLabel]))
+		}
+		mq.edge(snapshot.Edge(from, to, endpoint, method), series.value)
+	}
+}
+
+// edgeTarget resolves the target of a call to a service name. Targets may be
+// service names, host:port addresses, cluster DNS names or URLs; hosts that are
+// not a known service, nor the first label of one, are kept as they are.
+func edgeTarget(target string, services map[string]*models.Service) string {
+	host := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if _, exists := services[host]; exists {
+		return host
+	}
+	if i := strings.Index(host, "."); i > 0 {
+		if _, exists := services[host[:i]]; exists {
+			return host[:i]
+		}
+	}
+	return host
+}
@@ -0,0 +1,310 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// clusterLabel is added to every series of a federated snapshot
+const clusterLabel = "cluster"
+
+// FederatedCollector collects metrics from several Prometheus instances, typically
+// one per cluster, and merges them into a single snapshot
+type FederatedCollector struct {
+	members []*federatedMember
+	logger  *logrus.Logger
+	scope   scope
+}
+
+// federatedMember is a single instance of a federated source
+type federatedMember struct {
+	name      string
+	collector *PrometheusCollector
+}
+
+// NewFederatedCollector creates a collector for every configured member. Settings
+// not given for a member are inherited from the prometheus section.
+func NewFederatedCollector(promCfg *config.PrometheusConfig, members []config.FederatedMemberConfig, logger *logrus.Logger) (*FederatedCollector, error) {
+	fc := &FederatedCollector{logger: logger}
+
+	for i, member := range members {
+		cfg := *promCfg
+		if member.URL != "" {
+			cfg.URL = member.URL
+		}
+		if member.TenantID != "" {
+			cfg.TenantID = member.TenantID
+		}
+		if member.BearerTokenFile != "" {
+			cfg.BearerToken = ""
+			cfg.BearerTokenFile = member.BearerTokenFile
+		}
+
+		name := memberName(i, member)
+		if cfg.RecordDir != "" {
+			cfg.RecordDir = filepath.Join(cfg.RecordDir, name)
+		}
+
+		pc, err := NewPrometheusCollector(&cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("error creating collector for %s: %w", name, err)
+		}
+		pc.name = name
+
+		fc.members = append(fc.members, &federatedMember{name: name, collector: pc})
+	}
+
+	return fc, nil
+}
+
+// memberName returns the name of the i-th federated member, which labels its
+// series and names its fixture directory
+func memberName(i int, member config.FederatedMemberConfig) string {
+	if member.Name != "" {
+		return member.Name
+	}
+	return fmt.Sprintf("member-%d", i)
+}
+
+// setScope restricts collection to a scope. Clusters select members by name;
+// namespaces are passed on to every member.
+func (fc *FederatedCollector) setScope(sc scope) {
+	fc.scope = sc
+
+	members := make([]*federatedMember, 0, len(fc.members))
+	for _, member := range fc.members {
+		if len(sc.clusters) > 0 && !contains(sc.clusters, member.name) {
+			continue
+		}
+		member.collector.scope = scope{namespaces: sc.namespaces}
+		members = append(members, member)
+	}
+
+	if len(members) == 0 {
+		fc.logger.Warnf("No federated members match clusters %v", sc.clusters)
+	}
+	fc.members = members
+}
+
+// setResolution sets the time series resolution of every member
+func (fc *FederatedCollector) setResolution(resolution time.Duration) {
+	for _, member := range fc.members {
+		member.collector.resolution = resolution
+	}
+}
+
+// setRPCConvention sets the gRPC metric convention of every member
+func (fc *FederatedCollector) setRPCConvention(rpc rpcConvention) {
+	for _, member := range fc.members {
+		member.collector.rpc = rpc
+	}
+}
+
+// setEdgeConvention sets the edge metric convention of every member
+func (fc *FederatedCollector) setEdgeConvention(edges *edgeConvention) {
+	for _, member := range fc.members {
+		member.collector.edges = edges
+	}
+}
+
+// setMeshConvention sets the service mesh convention of every member
+func (fc *FederatedCollector) setMeshConvention(mesh meshConvention) {
+	for _, member := range fc.members {
+		member.collector.mesh = mesh
+	}
+}
+
+// setZones sets whether every member queries the zones of services
+func (fc *FederatedCollector) setZones(zones bool) {
+	for _, member := range fc.members {
+		member.collector.zones = zones
+	}
+}
+
+// Name returns the name of the metrics source
+func (fc *FederatedCollector) Name() string {
+	return "federated"
+}
+
+// CollectMetrics collects metrics from all members concurrently and merges them.
+// A failing member is logged and skipped; collection only fails if every member fails.
+func (fc *FederatedCollector) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	snapshots := make([]*models.MetricsSnapshot, len(fc.members))
+	errs := make([]error, len(fc.members))
+
+	var wg sync.WaitGroup
+	for i, member := range fc.members {
+		wg.Add(1)
+		go func(i int, member *federatedMember) {
+			defer wg.Done()
+			snapshots[i], errs[i] = member.collector.CollectMetrics(ctx, services, timeRange)
+		}(i, member)
+	}
+	wg.Wait()
+
+	merged := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+	succeeded := 0
+	for i, member := range fc.members {
+		if errs[i] != nil {
+			fc.logger.WithError(errs[i]).Warnf("Error collecting metrics from %s", member.name)
+			continue
+		}
+		mergeSnapshot(merged, snapshots[i], clusterLabel, member.name)
+		succeeded++
+	}
+	applyDimensions(merged, fc.scope.dimensions())
+
+	if succeeded == 0 && len(fc.members) > 0 {
+		return nil, fmt.Errorf("error collecting metrics: all %d federated members failed", len(fc.members))
+	}
+
+	return merged, nil
+}
+
+// mergeSnapshot adds the metrics of src into dst. Resource totals, counts and
+// rates are summed. Latencies are weighted by request rate, which is exact for
+// averages and an approximation for percentiles. Series are tagged with the
+// given label (e.g. the member's cluster) so the breakdown is preserved.
+func mergeSnapshot(dst, src *models.MetricsSnapshot, label, value string) {
+	if src.Resolution > 0 {
+		dst.Resolution = src.Resolution
+	}
+	for name, status := range src.Status {
+		dst.RecordStatus(name, *status)
+	}
+
+	for _, em := range src.Edges {
+		edge := dst.Edge(em.From, em.To, em.Endpoint, em.Method)
+		edge.Calls += em.Calls
+		edge.RequestBytes += em.RequestBytes
+		edge.ResponseBytes += em.ResponseBytes
+	}
+
+	if src.Cluster != nil {
+		if dst.Cluster == nil {
+			dst.Cluster = &models.ClusterMetrics{}
+		}
+		dst.Cluster.NodeHours += src.Cluster.NodeHours
+		dst.Cluster.CPUCapacityCoreHours += src.Cluster.CPUCapacityCoreHours
+		dst.Cluster.MemoryCapacityGBHours += src.Cluster.MemoryCapacityGBHours
+	}
+
+	for serviceName, sm := range src.Services {
+		target, exists := dst.Services[serviceName]
+		if !exists {
+			target = &models.ServiceMetrics{
+				ServiceName: serviceName,
+				Endpoints:   make(map[string]*models.EndpointMetrics),
+				TimeRange:   sm.TimeRange,
+			}
+			dst.AddServiceMetrics(target)
+		}
+
+		if sm.Aggregate != nil {
+			if target.Aggregate == nil {
+				target.Aggregate = &models.ResourceMetrics{Timestamp: sm.Aggregate.Timestamp}
+			}
+			addResources(target.Aggregate, sm.Aggregate)
+		}
+
+		target.TimeSeries = mergeTimeSeries(target.TimeSeries, sm.TimeSeries)
+
+		for metric, series := range sm.Series {
+			if target.Series == nil {
+				target.Series = make(map[string][]models.SeriesValue)
+			}
+			for _, sv := range series {
+				labels := make(map[string]string, len(sv.Labels)+1)
+				for k, v := range sv.Labels {
+					labels[k] = v
+				}
+				labels[label] = value
+				target.Series[metric] = append(target.Series[metric], models.SeriesValue{Labels: labels, Value: sv.Value})
+			}
+		}
+
+		for key, em := range sm.Endpoints {
+			existing, exists := target.Endpoints[key]
+			if !exists {
+				copied := *em
+				if em.Performance != nil {
+					perf := *em.Performance
+					copied.Performance = &perf
+				}
+				if em.Resource != nil {
+					res := *em.Resource
+					copied.Resource = &res
+				}
+				copied.TimeSeries = mergeTimeSeries(nil, em.TimeSeries)
+				target.Endpoints[key] = &copied
+				continue
+			}
+
+			existing.TimeSeries = mergeTimeSeries(existing.TimeSeries, em.TimeSeries)
+
+			if em.Resource != nil {
+				if existing.Resource == nil {
+					existing.Resource = &models.ResourceMetrics{Timestamp: em.Resource.Timestamp}
+				}
+				addResources(existing.Resource, em.Resource)
+			}
+			if em.Performance != nil {
+				if existing.Performance == nil {
+					existing.Performance = &models.PerformanceMetrics{Timestamp: em.Performance.Timestamp}
+				}
+				addPerformance(existing.Performance, em.Performance)
+			}
+		}
+	}
+}
+
+// addResources adds the resource usage of src to dst
+func addResources(dst, src *models.ResourceMetrics) {
+	dst.CPUCores += src.CPUCores
+	dst.CPUCoreHours += src.CPUCoreHours
+	dst.MemoryMB += src.MemoryMB
+	dst.MemoryGBHours += src.MemoryGBHours
+	dst.NetworkInMB += src.NetworkInMB
+	dst.NetworkOutMB += src.NetworkOutMB
+	dst.DiskReadMB += src.DiskReadMB
+	dst.DiskWriteMB += src.DiskWriteMB
+	dst.CPURequestCores += src.CPURequestCores
+	dst.CPURequestCoreHours += src.CPURequestCoreHours
+	dst.CPULimitCores += src.CPULimitCores
+	dst.MemoryRequestMB += src.MemoryRequestMB
+	dst.MemoryRequestGBHours += src.MemoryRequestGBHours
+	dst.MemoryLimitMB += src.MemoryLimitMB
+	dst.Replicas += src.Replicas
+}
+
+// addPerformance adds the traffic of src to dst, weighting latencies by request rate
+func addPerformance(dst, src *models.PerformanceMetrics) {
+	total := dst.RequestRate + src.RequestRate
+	weighted := func(a, b time.Duration) time.Duration {
+		if total == 0 {
+			if a > b {
+				return a
+			}
+			return b
+		}
+		return time.Duration((float64(a)*dst.RequestRate + float64(b)*src.RequestRate) / total)
+	}
+
+	dst.LatencyAvg = weighted(dst.LatencyAvg, src.LatencyAvg)
+	dst.LatencyP50 = weighted(dst.LatencyP50, src.LatencyP50)
+	dst.LatencyP95 = weighted(dst.LatencyP95, src.LatencyP95)
+	dst.LatencyP99 = weighted(dst.LatencyP99, src.LatencyP99)
+
+	dst.RequestRate = total
+	dst.RequestCount += src.RequestCount
+	dst.ErrorRate += src.ErrorRate
+	dst.ErrorCount += src.ErrorCount
+}
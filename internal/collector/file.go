@@ -0,0 +1,689 @@
+package collector
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// FileSource reads metrics from offline snapshots instead of a live backend.
+// Each Prometheus text exposition file is one scrape; samples without an
+// explicit timestamp take the file's modification time. CSV files hold one
+// sample per row with the columns timestamp,metric,labels,value.
+type FileSource struct {
+	config     *config.FileSourceConfig
+	logger     *logrus.Logger
+	series     map[model.Fingerprint]*model.SampleStream
+	scope      scope
+	resolution time.Duration
+	rpc        rpcConvention
+	edges      *edgeConvention
+	mesh       meshConvention
+	zones      bool // evaluate the zones of services for the topology network model
+}
+
+// NewFileSource creates a metrics source that reads offline snapshot files
+func NewFileSource(cfg *config.FileSourceConfig, logger *logrus.Logger) (*FileSource, error) {
+	fs := newFileSource(cfg, logger)
+
+	files, err := fs.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if err := fs.loadFile(file); err != nil {
+			return nil, fmt.Errorf("error loading metrics file %s: %w", file, err)
+		}
+	}
+	fs.sortSamples()
+
+	logger.Debugf("Loaded %d series from %d metrics files", len(fs.series), len(files))
+	return fs, nil
+}
+
+// newFileSource creates a file source without samples
+func newFileSource(cfg *config.FileSourceConfig, logger *logrus.Logger) *FileSource {
+	return &FileSource{
+		config: cfg,
+		logger: logger,
+		series: make(map[model.Fingerprint]*model.SampleStream),
+		rpc:    rpcConventions["go-grpc-prometheus"],
+		mesh:   meshConventions["istio"],
+	}
+}
+
+// sortSamples orders the samples of every series by time
+func (fs *FileSource) sortSamples() {
+	for _, stream := range fs.series {
+		sort.Slice(stream.Values, func(i, j int) bool {
+			return stream.Values[i].Timestamp.Before(stream.Values[j].Timestamp)
+		})
+	}
+}
+
+// Name returns the name of the metrics source
+func (fs *FileSource) Name() string {
+	return "file"
+}
+
+// CollectMetrics evaluates the offline samples for all services. When the
+// requested time range contains no samples, the full extent of the files is
+// used instead, and the snapshot records the range actually covered.
+func (fs *FileSource) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	fs.logger.Info("Collecting metrics from offline snapshots...")
+
+	extent, ok := fs.extent()
+	if !ok {
+		return nil, fmt.Errorf("no samples found in metrics files")
+	}
+
+	if timeRange.End.Before(extent.Start) || timeRange.Start.After(extent.End) {
+		fs.logger.Infof("Requested time range has no samples, using snapshot range %s to %s",
+			extent.Start.Format(time.RFC3339), extent.End.Format(time.RFC3339))
+		timeRange = extent
+	}
+
+	snapshot := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+	serviceMetrics := newServiceMetricsIndex(services, timeRange)
+	selector := serviceSelector(services)
+
+	evaluate := func(mq *metricQuery) []seriesValue {
+		values := fs.evaluate(mq, services, timeRange)
+		snapshot.RecordStatus(statusKey(mq), queryStatus(len(values), nil))
+		return values
+	}
+
+	for _, mq := range resourceQueries(selector, timeRange) {
+		applyServiceValues(mq, evaluate(mq), serviceMetrics)
+	}
+	if fs.zones {
+		for _, mq := range zoneQueries(selector) {
+			applyZoneValues(mq, evaluate(mq), serviceMetrics)
+		}
+	}
+	hasHTTP, hasGRPC, hasMesh := endpointTypes(services)
+	if hasHTTP {
+		for _, mq := range performanceQueries(selector, timeRange) {
+			applyEndpointValues(mq, evaluate(mq), serviceMetrics)
+		}
+	}
+	if hasGRPC {
+		for _, mq := range grpcQueries(selector, timeRange, fs.rpc) {
+			applyEndpointValues(mq, evaluate(mq), serviceMetrics)
+		}
+	}
+	if hasMesh {
+		for _, mq := range meshQueries(fs.mesh, fs.mesh.selector(services), timeRange) {
+			applyEndpointValues(mq, evaluate(mq), serviceMetrics)
+		}
+	}
+
+	if fs.edges != nil {
+		for _, mq := range edgeQueries(fs.edges, fs.edges.selector(services), timeRange) {
+			applyEdgeValues(mq, evaluate(mq), fs.edges, services, snapshot)
+		}
+	}
+
+	cluster := &models.ClusterMetrics{}
+	for _, mq := range clusterQueries("") {
+		applyClusterValues(mq, evaluate(mq), cluster)
+	}
+	snapshot.Cluster = clusterOrNil(cluster)
+
+	if buckets := timeBuckets(timeRange, fs.resolution); len(buckets) > 0 {
+		evaluateBuckets := func(mq *metricQuery) []seriesPoints {
+			series := fs.evaluateBuckets(mq, services, buckets)
+			snapshot.RecordStatus(statusKey(mq), queryStatus(len(series), nil))
+			return series
+		}
+
+		for _, mq := range resourceSeriesQueries(selector, fs.resolution) {
+			applyServiceSeries(mq, evaluateBuckets(mq), serviceMetrics)
+		}
+		for _, mq := range performanceSeriesQueries(selector, fs.resolution) {
+			applyEndpointSeries(mq, evaluateBuckets(mq), serviceMetrics)
+		}
+		snapshot.Resolution = fs.resolution
+	}
+
+	for _, sm := range serviceMetrics {
+		snapshot.AddServiceMetrics(sm)
+	}
+	applyDimensions(snapshot, fs.scope.dimensions())
+
+	fs.logger.Info("Metrics collection complete")
+	return snapshot, nil
+}
+
+// evaluate computes the offline equivalent of a metric query
+func (fs *FileSource) evaluate(mq *metricQuery, services map[string]*models.Service, tr models.TimeRange) []seriesValue {
+	known := func(m model.Metric) bool {
+		_, exists := services[string(m["service"])]
+		return exists && fs.scope.matches(m)
+	}
+	serverErrors := func(m model.Metric) bool {
+		return known(m) && strings.HasPrefix(string(m["status"]), "5")
+	}
+	anySeries := fs.scope.matchesCluster
+	pods := []model.LabelName{"service", "pod"}
+	endpoints := []model.LabelName{"service", "endpoint", "method"}
+	rpcMethods := []model.LabelName{"service", fs.rpc.serviceLabel, fs.rpc.methodLabel}
+	rpcErrors := func(m model.Metric) bool {
+		return known(m) && fs.rpc.isError(m)
+	}
+	// Edge queries are only evaluated with an edge convention
+	calls := func(m model.Metric) bool {
+		return fs.edges.matches(m, services) && fs.scope.matches(m)
+	}
+	workloads := []model.LabelName{fs.mesh.workloadLabel}
+	inbound := func(m model.Metric) bool {
+		return fs.mesh.matches(m, services) && fs.scope.matches(m)
+	}
+	meshFailure := fs.mesh.errorMatcher()
+	meshErrors := func(m model.Metric) bool {
+		return inbound(m) && meshFailure(m)
+	}
+
+	switch mq.name {
+	case "cpu":
+		return fs.increase("container_cpu_usage_seconds_total", pods, known, tr)
+	case "memory":
+		return fs.integral("container_memory_usage_bytes", pods, known, tr)
+	case "network_in":
+		return fs.increase("container_network_receive_bytes_total", pods, known, tr)
+	case "network_out":
+		return fs.increase("container_network_transmit_bytes_total", pods, known, tr)
+	case "cpu_request":
+		return fs.integral("kube_pod_container_resource_requests", pods, withLabel(known, "resource", "cpu"), tr)
+	case "memory_request":
+		return fs.integral("kube_pod_container_resource_requests", pods, withLabel(known, "resource", "memory"), tr)
+	case "cpu_limit":
+		return fs.integral("kube_pod_container_resource_limits", pods, withLabel(known, "resource", "cpu"), tr)
+	case "memory_limit":
+		return fs.integral("kube_pod_container_resource_limits", pods, withLabel(known, "resource", "memory"), tr)
+	case "replicas":
+		return fs.integral("kube_pod_status_phase", []model.LabelName{"service"}, withLabel(known, "phase", "Running"), tr)
+	case "node_hours":
+		return fs.integral("kube_node_info", nil, anySeries, tr)
+	case "cpu_capacity":
+		return fs.integral("kube_node_status_capacity", nil, withLabel(anySeries, "resource", "cpu"), tr)
+	case "memory_capacity":
+		return fs.integral("kube_node_status_capacity", nil, withLabel(anySeries, "resource", "memory"), tr)
+	case "requests":
+		return fs.increase("http_requests_total", endpoints, known, tr)
+	case "errors":
+		return fs.increase("http_requests_total", endpoints, serverErrors, tr)
+	case "latency_p50":
+		return fs.quantile(0.50, "http_request_duration_seconds_bucket", endpoints, known, tr)
+	case "latency_p95":
+		return fs.quantile(0.95, "http_request_duration_seconds_bucket", endpoints, known, tr)
+	case "latency_p99":
+		return fs.quantile(0.99, "http_request_duration_seconds_bucket", endpoints, known, tr)
+	case "latency_avg":
+		return ratio(
+			fs.increase("http_request_duration_seconds_sum", endpoints, known, tr),
+			fs.increase("http_request_duration_seconds_count", endpoints, known, tr),
+			endpoints,
+		)
+	case "grpc_requests":
+		return fs.increase(fs.rpc.handled, rpcMethods, known, tr)
+	case "grpc_errors":
+		return fs.increase(fs.rpc.handled, rpcMethods, rpcErrors, tr)
+	case "grpc_latency_p50":
+		return fs.quantile(0.50, fs.rpc.histogram+"_bucket", rpcMethods, known, tr)
+	case "grpc_latency_p95":
+		return fs.quantile(0.95, fs.rpc.histogram+"_bucket", rpcMethods, known, tr)
+	case "grpc_latency_p99":
+		return fs.quantile(0.99, fs.rpc.histogram+"_bucket", rpcMethods, known, tr)
+	case "grpc_latency_avg":
+		return ratio(
+			fs.increase(fs.rpc.histogram+"_sum", rpcMethods, known, tr),
+			fs.increase(fs.rpc.histogram+"_count", rpcMethods, known, tr),
+			rpcMethods,
+		)
+	case "edge_calls":
+		return fs.increase(fs.edges.calls, fs.edges.groupBy(), calls, tr)
+	case "edge_request_bytes":
+		return fs.increase(fs.edges.requestBytes, fs.edges.groupBy(), calls, tr)
+	case "edge_response_bytes":
+		return fs.increase(fs.edges.responseBytes, fs.edges.groupBy(), calls, tr)
+	case "mesh_requests":
+		return withServiceLabel(fs.increase(fs.mesh.requests, workloads, inbound, tr), fs.mesh.workloadLabel)
+	case "mesh_errors":
+		return withServiceLabel(fs.increase(fs.mesh.requests, workloads, meshErrors, tr), fs.mesh.workloadLabel)
+	case "mesh_latency_p50":
+		return withServiceLabel(fs.quantile(0.50, fs.mesh.histogram+"_bucket", workloads, inbound, tr), fs.mesh.workloadLabel)
+	case "mesh_latency_p95":
+		return withServiceLabel(fs.quantile(0.95, fs.mesh.histogram+"_bucket", workloads, inbound, tr), fs.mesh.workloadLabel)
+	case "mesh_latency_p99":
+		return withServiceLabel(fs.quantile(0.99, fs.mesh.histogram+"_bucket", workloads, inbound, tr), fs.mesh.workloadLabel)
+	case "mesh_latency_avg":
+		return withServiceLabel(ratio(
+			fs.increase(fs.mesh.histogram+"_sum", workloads, inbound, tr),
+			fs.increase(fs.mesh.histogram+"_count", workloads, inbound, tr),
+			workloads,
+		), fs.mesh.workloadLabel)
+	default:
+		fs.logger.Debugf("No offline evaluation for %s", mq.name)
+		return nil
+	}
+}
+
+// evaluateBuckets evaluates a query separately for every time bucket
+func (fs *FileSource) evaluateBuckets(mq *metricQuery, services map[string]*models.Service, buckets []models.TimeRange) []seriesPoints {
+	return bucketPoints(buckets, mq.scale, func(bucket models.TimeRange) []seriesValue {
+		return fs.evaluate(mq, services, bucket)
+	})
+}
+
+// increase sums the counter increase of every matching series within the time
+// range, grouped by the given labels. Counter resets are handled.
+func (fs *FileSource) increase(name string, by []model.LabelName, match func(model.Metric) bool, tr models.TimeRange) []seriesValue {
+	groups := make(map[model.Fingerprint]*seriesValue)
+
+	for _, stream := range fs.matching(name, match) {
+		samples := window(stream.Values, tr)
+		total := 0.0
+		for i := 1; i < len(samples); i++ {
+			delta := float64(samples[i].Value - samples[i-1].Value)
+			if delta < 0 {
+				// Counter reset: the new value is the increase since the reset
+				delta = float64(samples[i].Value)
+			}
+			total += delta
+		}
+		addToGroup(groups, stream.Metric, by, total)
+	}
+
+	return groupValues(groups)
+}
+
+// integral integrates every matching gauge over the time range, grouped by the given labels
+func (fs *FileSource) integral(name string, by []model.LabelName, match func(model.Metric) bool, tr models.TimeRange) []seriesValue {
+	groups := make(map[model.Fingerprint]*seriesValue)
+
+	for _, stream := range fs.matching(name, match) {
+		clipped := model.Matrix{&model.SampleStream{Metric: stream.Metric, Values: window(stream.Values, tr)}}
+		for _, sv := range seriesIntegrals(clipped, 0) {
+			addToGroup(groups, stream.Metric, by, sv.value)
+		}
+	}
+
+	return groupValues(groups)
+}
+
+// quantile estimates a quantile from histogram bucket increases, like histogram_quantile
+func (fs *FileSource) quantile(q float64, name string, by []model.LabelName, match func(model.Metric) bool, tr models.TimeRange) []seriesValue {
+	buckets := fs.increase(name, append(append([]model.LabelName{}, by...), model.BucketLabel), match, tr)
+
+	type histogram struct {
+		labels  model.Metric
+		buckets []bucket
+	}
+	histograms := make(map[model.Fingerprint]*histogram)
+
+	for _, b := range buckets {
+		upper, err := strconv.ParseFloat(string(b.labels[model.BucketLabel]), 64)
+		if err != nil {
+			continue
+		}
+
+		labels := b.labels.Clone()
+		delete(labels, model.BucketLabel)
+		fp := labels.Fingerprint()
+		if histograms[fp] == nil {
+			histograms[fp] = &histogram{labels: labels}
+		}
+		histograms[fp].buckets = append(histograms[fp].buckets, bucket{upperBound: upper, count: b.value})
+	}
+
+	values := make([]seriesValue, 0, len(histograms))
+	for _, h := range histograms {
+		v := bucketQuantile(q, h.buckets)
+		if math.IsNaN(v) {
+			continue
+		}
+		values = append(values, seriesValue{labels: h.labels, value: v})
+	}
+
+	return values
+}
+
+// matching returns all series with the given metric name accepted by match
+func (fs *FileSource) matching(name string, match func(model.Metric) bool) []*model.SampleStream {
+	streams := make([]*model.SampleStream, 0)
+	for _, stream := range fs.series {
+		if string(stream.Metric[model.MetricNameLabel]) == name && match(stream.Metric) {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// extent returns the time range covered by all loaded samples
+func (fs *FileSource) extent() (models.TimeRange, bool) {
+	var tr models.TimeRange
+	found := false
+
+	for _, stream := range fs.series {
+		for _, sample := range stream.Values {
+			t := sample.Timestamp.Time()
+			if !found || t.Before(tr.Start) {
+				tr.Start = t
+			}
+			if !found || t.After(tr.End) {
+				tr.End = t
+			}
+			found = true
+		}
+	}
+
+	return tr, found
+}
+
+// listFiles expands the configured paths into a sorted list of files
+func (fs *FileSource) listFiles() ([]string, error) {
+	files := make([]string, 0)
+
+	for _, path := range fs.config.Paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading metrics path: %w", err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading metrics directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadFile loads samples from a single file in the configured or detected format
+func (fs *FileSource) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format := fs.config.Format
+	if format == "" || format == "auto" {
+		format = "text"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+
+	switch format {
+	case "csv":
+		return fs.loadCSV(file)
+	case "text":
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		return fs.loadText(file, model.TimeFromUnixNano(info.ModTime().UnixNano()))
+	default:
+		return fmt.Errorf("unknown metrics file format: %s", format)
+	}
+}
+
+// loadText loads a Prometheus text exposition snapshot
+func (fs *FileSource) loadText(r io.Reader, defaultTime model.Time) error {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return err
+	}
+
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := model.Metric{}
+			for _, lp := range m.GetLabel() {
+				labels[model.LabelName(lp.GetName())] = model.LabelValue(lp.GetValue())
+			}
+
+			ts := defaultTime
+			if m.TimestampMs != nil {
+				ts = model.Time(m.GetTimestampMs())
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				fs.addSample(name, labels, ts, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				fs.addSample(name, labels, ts, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				fs.addSample(name, labels, ts, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					bucketLabels := labels.Clone()
+					bucketLabels[model.BucketLabel] = model.LabelValue(formatFloat(b.GetUpperBound()))
+					fs.addSample(name+"_bucket", bucketLabels, ts, float64(b.GetCumulativeCount()))
+				}
+				infLabels := labels.Clone()
+				infLabels[model.BucketLabel] = "+Inf"
+				fs.addSample(name+"_bucket", infLabels, ts, float64(h.GetSampleCount()))
+				fs.addSample(name+"_sum", labels, ts, h.GetSampleSum())
+				fs.addSample(name+"_count", labels, ts, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				fs.addSample(name+"_sum", labels, ts, s.GetSampleSum())
+				fs.addSample(name+"_count", labels, ts, float64(s.GetSampleCount()))
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadCSV loads samples from a CSV file with the columns timestamp,metric,labels,value.
+// Timestamps are RFC 3339 or Unix seconds; labels are written as k=v;k=v.
+func (fs *FileSource) loadCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		if i == 0 && record[0] == "timestamp" {
+			continue // header
+		}
+
+		ts, err := parseTimestamp(record[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		labels := model.Metric{}
+		for _, pair := range strings.Split(record[2], ";") {
+			if k, v, ok := strings.Cut(pair, "="); ok {
+				labels[model.LabelName(strings.TrimSpace(k))] = model.LabelValue(strings.TrimSpace(v))
+			}
+		}
+
+		value, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid value: %w", i+1, err)
+		}
+
+		fs.addSample(record[1], labels, model.TimeFromUnixNano(ts.UnixNano()), value)
+	}
+
+	return nil
+}
+
+// addSample appends a sample to the series identified by name and labels
+func (fs *FileSource) addSample(name string, labels model.Metric, ts model.Time, value float64) {
+	metric := labels.Clone()
+	metric[model.MetricNameLabel] = model.LabelValue(name)
+
+	fp := metric.Fingerprint()
+	stream, exists := fs.series[fp]
+	if !exists {
+		stream = &model.SampleStream{Metric: metric}
+		fs.series[fp] = stream
+	}
+	stream.Values = append(stream.Values, model.SamplePair{Timestamp: ts, Value: model.SampleValue(value)})
+}
+
+// bucket is a single cumulative histogram bucket
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// bucketQuantile estimates the q-quantile of cumulative buckets using linear
+// interpolation within the bucket, following Prometheus' histogram_quantile
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	if len(buckets) < 2 {
+		return math.NaN()
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].upperBound < buckets[j].upperBound })
+	if !math.IsInf(buckets[len(buckets)-1].upperBound, 1) {
+		return math.NaN()
+	}
+
+	total := buckets[len(buckets)-1].count
+	if total == 0 {
+		return math.NaN()
+	}
+
+	rank := q * total
+	i := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].count >= rank })
+	if i == len(buckets)-1 {
+		return buckets[len(buckets)-2].upperBound
+	}
+
+	lower, prevCount := 0.0, 0.0
+	if i > 0 {
+		lower = buckets[i-1].upperBound
+		prevCount = buckets[i-1].count
+	} else if buckets[0].upperBound <= 0 {
+		return buckets[0].upperBound
+	}
+
+	inBucket := buckets[i].count - prevCount
+	if inBucket == 0 {
+		return buckets[i].upperBound
+	}
+	return lower + (buckets[i].upperBound-lower)*(rank-prevCount)/inBucket
+}
+
+// withLabel narrows a series matcher to series with the given label value
+func withLabel(match func(model.Metric) bool, name model.LabelName, value model.LabelValue) func(model.Metric) bool {
+	return func(m model.Metric) bool {
+		return match(m) && m[name] == value
+	}
+}
+
+// ratio divides numerator by denominator series with identical grouping labels
+func ratio(numerator, denominator []seriesValue, by []model.LabelName) []seriesValue {
+	denominators := make(map[model.Fingerprint]float64, len(denominator))
+	for _, d := range denominator {
+		denominators[d.labels.Fingerprint()] = d.value
+	}
+
+	values := make([]seriesValue, 0, len(numerator))
+	for _, n := range numerator {
+		if d := denominators[n.labels.Fingerprint()]; d > 0 {
+			values = append(values, seriesValue{labels: n.labels, value: n.value / d})
+		}
+	}
+	return values
+}
+
+// addToGroup adds value to the group identified by the given labels of metric
+func addToGroup(groups map[model.Fingerprint]*seriesValue, metric model.Metric, by []model.LabelName, value float64) {
+	labels := model.Metric{}
+	for _, name := range by {
+		if v, ok := metric[name]; ok {
+			labels[name] = v
+		}
+	}
+
+	fp := labels.Fingerprint()
+	if groups[fp] == nil {
+		groups[fp] = &seriesValue{labels: labels}
+	}
+	groups[fp].value += value
+}
+
+// groupValues flattens grouped values into a slice
+func groupValues(groups map[model.Fingerprint]*seriesValue) []seriesValue {
+	values := make([]seriesValue, 0, len(groups))
+	for _, g := range groups {
+		values = append(values, *g)
+	}
+	return values
+}
+
+// window returns the samples that fall within the time range
+func window(samples []model.SamplePair, tr models.TimeRange) []model.SamplePair {
+	start := model.TimeFromUnixNano(tr.Start.UnixNano())
+	end := model.TimeFromUnixNano(tr.End.UnixNano())
+
+	clipped := make([]model.SamplePair, 0, len(samples))
+	for _, s := range samples {
+		if !s.Timestamp.Before(start) && !s.Timestamp.After(end) {
+			clipped = append(clipped, s)
+		}
+	}
+	return clipped
+}
+
+// parseTimestamp parses an RFC 3339 timestamp or Unix seconds
+func parseTimestamp(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", s)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), nil
+}
+
+// formatFloat formats a bucket bound like the Prometheus client libraries
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,291 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func newTestServices() map[string]*models.Service {
+	return map[string]*models.Service{
+		"checkout": {
+			Name: "checkout",
+			Endpoints: []*models.Endpoint{
+				{Path: "/checkout", Method: "POST"},
+			},
+		},
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestFileSourceTextSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "00.prom", `# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{service="checkout",pod="a"} 100 1700000000000
+# TYPE http_requests_total counter
+http_requests_total{service="checkout",endpoint="/checkout",method="POST",status="200"} 1000 1700000000000
+http_requests_total{service="checkout",endpoint="/checkout",method="POST",status="500"} 10 1700000000000
+`)
+	writeFile(t, dir, "01.prom", `# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{service="checkout",pod="a"} 3700 1700003600000
+# TYPE http_requests_total counter
+http_requests_total{service="checkout",endpoint="/checkout",method="POST",status="200"} 4600 1700003600000
+http_requests_total{service="checkout",endpoint="/checkout",method="POST",status="500"} 46 1700003600000
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{dir}, Format: "auto"}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+
+	// The requested range has no samples, so the snapshot extent is used
+	snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), models.TimeRange{
+		Start: time.Unix(0, 0),
+		End:   time.Unix(3600, 0),
+	})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	if snapshot.TimeRange.Duration() != time.Hour {
+		t.Errorf("Expected snapshot range of 1h, got %s", snapshot.TimeRange.Duration())
+	}
+
+	sm, exists := snapshot.GetServiceMetrics("checkout")
+	if !exists {
+		t.Fatal("Expected metrics for checkout")
+	}
+
+	if math.Abs(sm.Aggregate.CPUCoreHours-1.0) > 1e-9 {
+		t.Errorf("Expected 1 CPU core-hour, got %f", sm.Aggregate.CPUCoreHours)
+	}
+
+	perf := sm.Endpoints["/checkout:POST"].Performance
+	if perf.RequestCount != 3636 {
+		t.Errorf("Expected 3636 requests, got %f", perf.RequestCount)
+	}
+	if perf.ErrorCount != 36 {
+		t.Errorf("Expected 36 errors, got %f", perf.ErrorCount)
+	}
+
+	if status := snapshot.Status["cpu"]; status.State != models.MetricOK || status.Series != 1 {
+		t.Errorf("Expected cpu status ok with 1 series, got %+v", status)
+	}
+	if status := snapshot.Status["memory"]; status.State != models.MetricEmpty {
+		t.Errorf("Expected memory status empty, got %+v", status)
+	}
+}
+
+func TestFileSourceCSV(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,container_memory_usage_bytes,service=checkout;pod=a,1073741824
+2024-01-01T01:00:00Z,container_memory_usage_bytes,service=checkout;pod=a,1073741824
+2024-01-01T00:00:00Z,http_request_duration_seconds_sum,service=checkout;endpoint=/checkout;method=POST,0
+2024-01-01T01:00:00Z,http_request_duration_seconds_sum,service=checkout;endpoint=/checkout;method=POST,50
+2024-01-01T00:00:00Z,http_request_duration_seconds_count,service=checkout;endpoint=/checkout;method=POST,0
+2024-01-01T01:00:00Z,http_request_duration_seconds_count,service=checkout;endpoint=/checkout;method=POST,500
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{path}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	sm := snapshot.Services["checkout"]
+	if math.Abs(sm.Aggregate.MemoryGBHours-1.0) > 1e-9 {
+		t.Errorf("Expected 1 GB-hour, got %f", sm.Aggregate.MemoryGBHours)
+	}
+
+	if latency := sm.Endpoints["/checkout:POST"].Performance.LatencyAvg; latency != 100*time.Millisecond {
+		t.Errorf("Expected average latency 100ms, got %s", latency)
+	}
+}
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := []bucket{
+		{upperBound: 0.1, count: 50},
+		{upperBound: 0.5, count: 90},
+		{upperBound: math.Inf(1), count: 100},
+	}
+
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{0.5, 0.1},
+		{0.7, 0.3},
+		{0.99, 0.5},
+	}
+
+	for _, tt := range tests {
+		if got := bucketQuantile(tt.q, buckets); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("Expected quantile %.2f to be %f, got %f", tt.q, tt.expected, got)
+		}
+	}
+}
+
+func TestMergeSnapshotSumsMembers(t *testing.T) {
+	member := func(cpu, rate float64, latency time.Duration) *models.MetricsSnapshot {
+		snapshot := models.NewMetricsSnapshot(time.Unix(0, 0), time.Unix(3600, 0))
+		snapshot.AddServiceMetrics(&models.ServiceMetrics{
+			ServiceName: "checkout",
+			Aggregate:   &models.ResourceMetrics{CPUCoreHours: cpu},
+			Series: map[string][]models.SeriesValue{
+				"cpu": {{Labels: map[string]string{"pod": "a"}, Value: cpu * 3600}},
+			},
+			Endpoints: map[string]*models.EndpointMetrics{
+				"/checkout:POST": {Performance: &models.PerformanceMetrics{RequestRate: rate, LatencyAvg: latency}},
+			},
+		})
+		return snapshot
+	}
+
+	merged := models.NewMetricsSnapshot(time.Unix(0, 0), time.Unix(3600, 0))
+	mergeSnapshot(merged, member(1, 10, 100*time.Millisecond), clusterLabel, "eu")
+	mergeSnapshot(merged, member(2, 30, 200*time.Millisecond), clusterLabel, "us")
+
+	sm := merged.Services["checkout"]
+	if sm.Aggregate.CPUCoreHours != 3 {
+		t.Errorf("Expected 3 CPU core-hours, got %f", sm.Aggregate.CPUCoreHours)
+	}
+
+	perf := sm.Endpoints["/checkout:POST"].Performance
+	if perf.RequestRate != 40 {
+		t.Errorf("Expected request rate 40, got %f", perf.RequestRate)
+	}
+	if perf.LatencyAvg != 175*time.Millisecond {
+		t.Errorf("Expected weighted latency 175ms, got %s", perf.LatencyAvg)
+	}
+
+	if len(sm.Series["cpu"]) != 2 || sm.Series["cpu"][1].Labels[clusterLabel] != "us" {
+		t.Errorf("Expected cpu series tagged by cluster, got %v", sm.Series["cpu"])
+	}
+}
+
+func TestFileSourceTimeSeries(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,container_cpu_usage_seconds_total,service=checkout;pod=a,0
+2024-01-01T01:00:00Z,container_cpu_usage_seconds_total,service=checkout;pod=a,3600
+2024-01-01T02:00:00Z,container_cpu_usage_seconds_total,service=checkout;pod=a,14400
+2024-01-01T00:00:00Z,http_requests_total,service=checkout;endpoint=/checkout;method=POST,0
+2024-01-01T01:00:00Z,http_requests_total,service=checkout;endpoint=/checkout;method=POST,100
+2024-01-01T02:00:00Z,http_requests_total,service=checkout;endpoint=/checkout;method=POST,400
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{path}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+	source.resolution = time.Hour
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), models.TimeRange{Start: start, End: start.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	if snapshot.Resolution != time.Hour {
+		t.Errorf("Expected resolution 1h, got %s", snapshot.Resolution)
+	}
+
+	cpu := snapshot.Services["checkout"].TimeSeries["cpu"]
+	if len(cpu) != 2 || cpu[0].Value != 1 || cpu[1].Value != 3 {
+		t.Fatalf("Expected CPU buckets of 1 and 3 core-hours, got %v", cpu)
+	}
+	if !cpu[1].Timestamp.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected second bucket to start at %s, got %s", start.Add(time.Hour), cpu[1].Timestamp)
+	}
+
+	requests := snapshot.Services["checkout"].Endpoints["/checkout:POST"].TimeSeries["requests"]
+	if len(requests) != 2 || requests[0].Value != 100 || requests[1].Value != 300 {
+		t.Errorf("Expected request buckets of 100 and 300, got %v", requests)
+	}
+}
+
+func TestFileSourceEdgeMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "00.prom", `# TYPE istio_requests_total counter
+istio_requests_total{reporter="source",source_workload="checkout",destination_workload="payments",response_code="200"} 0 1700000000000
+istio_requests_total{reporter="source",source_workload="checkout",destination_workload="payments",response_code="503"} 0 1700000000000
+istio_requests_total{reporter="destination",source_workload="checkout",destination_workload="payments",response_code="200"} 0 1700000000000
+istio_requests_total{reporter="source",source_workload="checkout",destination_workload="unknown",response_code="200"} 0 1700000000000
+# TYPE istio_response_bytes_sum counter
+istio_response_bytes_sum{reporter="source",source_workload="checkout",destination_workload="payments"} 0 1700000000000
+`)
+	writeFile(t, dir, "01.prom", `# TYPE istio_requests_total counter
+istio_requests_total{reporter="source",source_workload="checkout",destination_workload="payments",response_code="200"} 190 1700003600000
+istio_requests_total{reporter="source",source_workload="checkout",destination_workload="payments",response_code="503"} 10 1700003600000
+istio_requests_total{reporter="destination",source_workload="checkout",destination_workload="payments",response_code="200"} 190 1700003600000
+istio_requests_total{reporter="source",source_workload="checkout",destination_workload="unknown",response_code="200"} 40 1700003600000
+# TYPE istio_response_bytes_sum counter
+istio_response_bytes_sum{reporter="source",source_workload="checkout",destination_workload="payments"} 51200 1700003600000
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{dir}, Format: "auto"}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+	source.edges, _ = newEdgeConvention("istio")
+
+	snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), models.TimeRange{
+		Start: time.Unix(1700000000, 0),
+		End:   time.Unix(1700003600, 0),
+	})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	// Calls reported by the destination and to workloads outside the mesh are left out
+	if len(snapshot.Edges) != 1 {
+		t.Fatalf("Expected 1 edge, got %d", len(snapshot.Edges))
+	}
+	em := snapshot.Edges[0]
+	if em.From != "checkout" || em.To != "payments" || em.Calls != 200 || em.ResponseBytes != 51200 {
+		t.Errorf("Expected 200 calls and 51200 bytes from checkout to payments, got %+v", em)
+	}
+}
+
+func TestEdgeTarget(t *testing.T) {
+	services := map[string]*models.Service{"payments": {Name: "payments"}}
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"payments", "payments"},
+		{"payments:8080", "payments"},
+		{"payments.shop.svc.cluster.local", "payments"},
+		{"http://payments.shop:8080/charge", "payments"},
+		{"api.stripe.com", "api.stripe.com"},
+	}
+
+	for _, tt := range tests {
+		if got := edgeTarget(tt.target, services); got != tt.expected {
+			t.Errorf("Expected %s to resolve to %s, got %s", tt.target, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// rpcConvention describes how a gRPC instrumentation library names its server
+// metrics and labels
+type rpcConvention struct {
+	serviceLabel model.LabelName // fully qualified gRPC service, e.g. shop.ProductService
+	methodLabel  model.LabelName // RPC method name
+	codeLabel    model.LabelName // status code of a handled call
+	errorCodes   []string        // status codes counted as server errors
+	handled      string          // counter of handled calls
+	histogram    string          // handling time histogram, without _bucket/_sum/_count
+	scale        float64         // converts the histogram unit to seconds
+}
+
+// rpcConventions are the supported gRPC metric conventions by configuration name
+var rpcConventions = map[string]rpcConvention{
+	// go-grpc-prometheus; the histogram requires EnableHandlingTimeHistogram
+	"go-grpc-prometheus": {
+		serviceLabel: "grpc_service",
+		methodLabel:  "grpc_method",
+		codeLabel:    "grpc_code",
+		errorCodes:   []string{"Unknown", "DeadlineExceeded", "Unimplemented", "Internal", "Unavailable", "DataLoss"},
+		handled:      "grpc_server_handled_total",
+		histogram:    "grpc_server_handling_seconds",
+		scale:        1,
+	},
+	// OpenTelemetry RPC semantic conventions as exported to Prometheus
+	"otel": {
+		serviceLabel: "rpc_service",
+		methodLabel:  "rpc_method",
+		codeLabel:    "rpc_grpc_status_code",
+		errorCodes:   []string{"2", "4", "12", "13", "14", "15"},
+		handled:      "rpc_server_duration_milliseconds_count",
+		histogram:    "rpc_server_duration_milliseconds",
+		scale:        0.001,
+	},
+}
+
+// newRPCConvention returns the named gRPC metric convention; empty selects go-grpc-prometheus
+func newRPCConvention(name string) (rpcConvention, error) {
+	if name == "" {
+		name = "go-grpc-prometheus"
+	}
+
+	conv, exists := rpcConventions[name]
+	if !exists {
+		return rpcConvention{}, fmt.Errorf("unknown grpc_metrics convention: %s", name)
+	}
+	return conv, nil
+}
+
+// errorMatcher returns the PromQL matcher selecting server errors
+func (c rpcConvention) errorMatcher() string {
+	return fmt.Sprintf(`%s=~"%s"`, c.codeLabel, strings.Join(c.errorCodes, "|"))
+}
+
+// isError reports whether a series counts server errors
+func (c rpcConvention) isError(metric model.Metric) bool {
+	return contains(c.errorCodes, string(metric[c.codeLabel]))
+}
+
+// matches reports whether a series belongs to a gRPC endpoint. The endpoint path
+// is the method name, optionally qualified as /package.Service/Method, in which
+// case the gRPC service must match too.
+func (c rpcConvention) matches(em *models.EndpointMetrics, metric model.Metric) bool {
+	if em.Type != models.EndpointGRPC {
+		return false
+	}
+
+	path := strings.TrimPrefix(em.Endpoint, "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		if !strings.EqualFold(path[:i], string(metric[c.serviceLabel])) {
+			return false
+		}
+		path = path[i+1:]
+	}
+
+	return strings.EqualFold(path, string(metric[c.methodLabel]))
+}
+
+// endpointTypes reports whether any of the services have HTTP, gRPC and mesh endpoints
+func endpointTypes(services map[string]*models.Service) (hasHTTP, hasGRPC, hasMesh bool) {
+	for _, service := range services {
+		for _, endpoint := range service.Endpoints {
+			switch {
+			case endpoint.IsGRPC():
+				hasGRPC = true
+			case endpoint.IsMesh():
+				hasMesh = true
+			default:
+				hasHTTP = true
+			}
+		}
+	}
+	return hasHTTP, hasGRPC, hasMesh
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestRPCConventionMatches(t *testing.T) {
+	conv := rpcConventions["go-grpc-prometheus"]
+	series := model.Metric{"grpc_service": "shop.ProductService", "grpc_method": "GetProduct"}
+
+	tests := []struct {
+		name     string
+		endpoint models.EndpointMetrics
+		expected bool
+	}{
+		{"method name", models.EndpointMetrics{Endpoint: "/GetProduct", Type: models.EndpointGRPC}, true},
+		{"case insensitive", models.EndpointMetrics{Endpoint: "/getproduct", Type: models.EndpointGRPC}, true},
+		{"qualified", models.EndpointMetrics{Endpoint: "/shop.ProductService/GetProduct", Type: models.EndpointGRPC}, true},
+		{"other service", models.EndpointMetrics{Endpoint: "/shop.CartService/GetProduct", Type: models.EndpointGRPC}, false},
+		{"other method", models.EndpointMetrics{Endpoint: "/ListProducts", Type: models.EndpointGRPC}, false},
+		{"http endpoint", models.EndpointMetrics{Endpoint: "/GetProduct"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := conv.matches(&tt.endpoint, series); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestFileSourceGRPCMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,rpc_server_duration_milliseconds_count,service=catalog;rpc_service=shop.ProductService;rpc_method=GetProduct;rpc_grpc_status_code=0,0
+2024-01-01T01:00:00Z,rpc_server_duration_milliseconds_count,service=catalog;rpc_service=shop.ProductService;rpc_method=GetProduct;rpc_grpc_status_code=0,990
+2024-01-01T00:00:00Z,rpc_server_duration_milliseconds_count,service=catalog;rpc_service=shop.ProductService;rpc_method=GetProduct;rpc_grpc_status_code=14,0
+2024-01-01T01:00:00Z,rpc_server_duration_milliseconds_count,service=catalog;rpc_service=shop.ProductService;rpc_method=GetProduct;rpc_grpc_status_code=14,10
+2024-01-01T00:00:00Z,rpc_server_duration_milliseconds_sum,service=catalog;rpc_service=shop.ProductService;rpc_method=GetProduct,0
+2024-01-01T01:00:00Z,rpc_server_duration_milliseconds_sum,service=catalog;rpc_service=shop.ProductService;rpc_method=GetProduct,20000
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{path}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+	source.rpc = rpcConventions["otel"]
+
+	services := map[string]*models.Service{
+		"catalog": {
+			Name: "catalog",
+			Endpoints: []*models.Endpoint{
+				{Path: "/GetProduct", Method: "GET", Type: models.EndpointGRPC},
+			},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), services, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	perf := snapshot.Services["catalog"].Endpoints["/GetProduct:GET"].Performance
+	if perf.RequestCount != 1000 {
+		t.Errorf("Expected 1000 calls, got %f", perf.RequestCount)
+	}
+	if perf.ErrorCount != 10 {
+		t.Errorf("Expected 10 errors, got %f", perf.ErrorCount)
+	}
+	if perf.LatencyAvg != 20*time.Millisecond {
+		t.Errorf("Expected average latency 20ms, got %s", perf.LatencyAvg)
+	}
+
+	if _, queried := snapshot.Status["requests"]; queried {
+		t.Error("Expected no HTTP queries for a gRPC-only service")
+	}
+}
@@ -0,0 +1,384 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// meshConvention describes the telemetry of a service mesh: the calls between
+// workloads, and the inbound requests, errors and latency of every workload
+type meshConvention struct {
+	name          string
+	edges         edgeConvention
+	workloadLabel model.LabelName // workload receiving inbound requests
+	inbound       model.LabelSet  // labels of inbound series
+	requests      string          // counter of inbound requests
+	errorLabel    model.LabelName // label whose value marks a failed request
+	errorPattern  string          // regular expression of failed values
+	histogram     string          // inbound latency histogram, without _bucket/_sum/_count
+	scale         float64         // converts the histogram unit to seconds
+}
+
+// meshConventions are the supported service meshes by configuration name
+var meshConventions = map[string]meshConvention{
+	"istio": {
+		name:          "istio",
+		edges:         edgeConventions["istio"],
+		workloadLabel: "destination_workload",
+		inbound:       model.LabelSet{"reporter": "destination"},
+		requests:      "istio_requests_total",
+		errorLabel:    "response_code",
+		errorPattern:  "5..",
+		histogram:     "istio_request_duration_milliseconds",
+		scale:         0.001,
+	},
+	"linkerd": {
+		name:          "linkerd",
+		edges:         edgeConventions["linkerd"],
+		workloadLabel: "deployment",
+		inbound:       model.LabelSet{"direction": "inbound"},
+		requests:      "response_total",
+		errorLabel:    "classification",
+		errorPattern:  "failure",
+		histogram:     "response_latency_ms",
+		scale:         0.001,
+	},
+}
+
+// newMeshConvention returns the named service mesh convention; empty selects istio
+func newMeshConvention(name string) (meshConvention, error) {
+	if name == "" {
+		name = "istio"
+	}
+
+	conv, exists := meshConventions[name]
+	if !exists {
+		return meshConvention{}, fmt.Errorf("unknown mesh type: %s", name)
+	}
+	return conv, nil
+}
+
+// selector returns the PromQL label matchers restricting series to the inbound
+// requests of the given services
+func (c meshConvention) selector(services map[string]*models.Service) string {
+	return workloadSelector(c.workloadLabel, services, c.inbound)
+}
+
+// matches reports whether a series records inbound requests of one of the services
+func (c meshConvention) matches(metric model.Metric, services map[string]*models.Service) bool {
+	return workloadMatches(metric, c.workloadLabel, services, c.inbound)
+}
+
+// errorMatcher returns a function reporting whether a series counts failed requests
+func (c meshConvention) errorMatcher() func(model.Metric) bool {
+	pattern := regexp.MustCompile("^(?:" + c.errorPattern + ")$")
+	return func(metric model.Metric) bool {
+		return pattern.MatchString(string(metric[c.errorLabel]))
+	}
+}
+
+// matchesMesh reports whether a series applies to an endpoint: mesh telemetry
+// covers all traffic of a workload, which its mesh endpoint stands for
+func matchesMesh(em *models.EndpointMetrics, labels model.Metric) bool {
+	return em.Type == models.EndpointMesh
+}
+
+// meshRequestsQuery returns the inbound requests of every workload
+func meshRequestsQuery(conv meshConvention, selector string, timeRange models.TimeRange) *metricQuery {
+	window := promDuration(timeRange.Duration())
+	windowSeconds := timeRange.Duration().Seconds()
+
+	return &metricQuery{
+		name: "mesh_requests",
+		kind: instantQuery,
+		query: conv.asService(fmt.Sprintf(`sum by (%s) (increase(%s{%s}[%s]))`,
+			conv.workloadLabel, conv.requests, selector, window)),
+		endpoint: func(em *models.EndpointMetrics, v float64) {
+			em.Performance.RequestCount = v
+			em.Performance.RequestRate = v / windowSeconds
+		},
+		match: matchesMesh,
+	}
+}
+
+// meshQueries returns the inbound request, error, and latency queries of the
+// mesh endpoints of workloads
+func meshQueries(conv meshConvention, selector string, timeRange models.TimeRange) []*metricQuery {
+	window := promDuration(timeRange.Duration())
+	windowSeconds := timeRange.Duration().Seconds()
+	by := string(conv.workloadLabel)
+
+	quantile := func(q float64) string {
+		return conv.asService(fmt.Sprintf(`histogram_quantile(%.2f, sum by (%s, le) (increase(%s_bucket{%s}[%s])))`,
+			q, by, conv.histogram, selector, window))
+	}
+	latency := func(set func(perf *models.PerformanceMetrics, d time.Duration)) func(*models.EndpointMetrics, float64) {
+		return func(em *models.EndpointMetrics, v float64) { set(em.Performance, seconds(v*conv.scale)) }
+	}
+
+	return []*metricQuery{
+		meshRequestsQuery(conv, selector, timeRange),
+		{
+			name: "mesh_errors",
+			kind: instantQuery,
+			query: conv.asService(fmt.Sprintf(`sum by (%s) (increase(%s{%s,%s=~"%s"}[%s]))`,
+				by, conv.requests, selector, conv.errorLabel, conv.errorPattern, window)),
+			endpoint: func(em *models.EndpointMetrics, v float64) {
+				em.Performance.ErrorCount = v
+				em.Performance.ErrorRate = v / windowSeconds
+			},
+			match: matchesMesh,
+		},
+		{
+			name:     "mesh_latency_p50",
+			kind:     instantQuery,
+			query:    quantile(0.50),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyP50 = d }),
+			match:    matchesMesh,
+		},
+		{
+			name:     "mesh_latency_p95",
+			kind:     instantQuery,
+			query:    quantile(0.95),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyP95 = d }),
+			match:    matchesMesh,
+		},
+		{
+			name:     "mesh_latency_p99",
+			kind:     instantQuery,
+			query:    quantile(0.99),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyP99 = d }),
+			match:    matchesMesh,
+		},
+		{
+			name: "mesh_latency_avg",
+			kind: instantQuery,
+			query: conv.asService(fmt.Sprintf(`sum by (%s) (increase(%s_sum{%s}[%s])) / sum by (%s) (increase(%s_count{%s}[%s]))`,
+				by, conv.histogram, selector, window, by, conv.histogram, selector, window)),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyAvg = d }),
+			match:    matchesMesh,
+		},
+	}
+}
+
+// asService copies the workload label of a query's series into the service label
+// that results are fanned out by
+func (c meshConvention) asService(query string) string {
+	return fmt.Sprintf(`label_replace(%s, "service", "$1", "%s", "(.+)")`, query, c.workloadLabel)
+}
+
+// withServiceLabel copies a label of every series into the service label, the
+// offline equivalent of asService
+func withServiceLabel(values []seriesValue, label model.LabelName) []seriesValue {
+	for i, sv := range values {
+		labels := sv.labels.Clone()
+		labels["service"] = sv.labels[label]
+		values[i].labels = labels
+	}
+	return values
+}
+
+// MeshCollector builds the call graph from service mesh telemetry, for services
+// whose code cannot be analyzed or whose calls go to URLs built at runtime
+type MeshCollector struct {
+	collectors []*PrometheusCollector
+	mesh       meshConvention
+	config     *config.MeshConfig
+	logger     *logrus.Logger
+}
+
+// NewMeshCollector creates a mesh collector querying the configured metrics
+// source, restricted to its scope: Prometheus, VictoriaMetrics, or every member
+// of a federation. Sources that do not query Prometheus (file, otlp) leave the
+// telemetry to the prometheus section.
+func NewMeshCollector(cfg *config.Config, logger *logrus.Logger) (*MeshCollector, error) {
+	mesh, err := newMeshConvention(cfg.Analysis.Mesh.Type)
+	if err != nil {
+		return nil, err
+	}
+	sc := newScope(&cfg.MetricsSource.Scope)
+
+	mc := &MeshCollector{
+		mesh:   mesh,
+		config: &cfg.Analysis.Mesh,
+		logger: logger,
+	}
+
+	switch cfg.MetricsSource.Type {
+	case "federated":
+		fc, err := NewFederatedCollector(&cfg.Prometheus, cfg.MetricsSource.Federated, logger)
+		if err != nil {
+			return nil, err
+		}
+		fc.setScope(sc)
+		for _, member := range fc.members {
+			mc.collectors = append(mc.collectors, member.collector)
+		}
+	case "victoriametrics":
+		pc, err := NewVictoriaMetricsCollector(&cfg.Prometheus, &cfg.MetricsSource.VictoriaMetrics, logger)
+		if err != nil {
+			return nil, err
+		}
+		pc.scope = sc
+		mc.collectors = append(mc.collectors, pc)
+	default:
+		pc, err := NewPrometheusCollector(&cfg.Prometheus, logger)
+		if err != nil {
+			return nil, err
+		}
+		pc.name = mesh.name
+		pc.scope = sc
+		mc.collectors = append(mc.collectors, pc)
+	}
+
+	return mc, nil
+}
+
+// query runs the queries built for the scope of every collector and returns the
+// values of each query, summed across collectors for series with the same labels
+func (mc *MeshCollector) query(ctx context.Context, timeRange models.TimeRange, build func(scope string) []*metricQuery) ([]*metricQuery, [][]seriesValue, error) {
+	var queries []*metricQuery
+	var values [][]seriesValue
+
+	for _, pc := range mc.collectors {
+		results := pc.runQueries(ctx, build(pc.scope.selector()), timeRange)
+		if queries == nil {
+			queries = make([]*metricQuery, len(results))
+			values = make([][]seriesValue, len(results))
+		}
+		for i, result := range results {
+			if result.err != nil {
+				return nil, nil, fmt.Errorf("error querying %s from %s: %w", result.query.name, pc.Name(), result.err)
+			}
+			queries[i] = result.query
+			values[i] = append(values[i], pc.reduce(result)...)
+		}
+	}
+
+	for i := range values {
+		values[i] = sumSeries(values[i])
+	}
+	return queries, values, nil
+}
+
+// sumSeries adds up the values of series with the same labels
+func sumSeries(values []seriesValue) []seriesValue {
+	index := make(map[model.Fingerprint]int, len(values))
+	summed := make([]seriesValue, 0, len(values))
+	for _, sv := range values {
+		fp := sv.labels.Fingerprint()
+		if i, exists := index[fp]; exists {
+			summed[i].value += sv.value
+			continue
+		}
+		index[fp] = len(summed)
+		summed = append(summed, sv)
+	}
+	return summed
+}
+
+// BuildCallGraph discovers the workloads that sent or received traffic over the
+// time range and the calls between them. Every workload becomes a service with a
+// single mesh endpoint, and every pair of workloads a dependency weighted by the
+// calls per inbound request of the caller, with the bytes per call.
+func (mc *MeshCollector) BuildCallGraph(ctx context.Context, timeRange models.TimeRange) (*models.CallGraph, error) {
+	mc.logger.Infof("Building call graph from %s telemetry...", mc.mesh.name)
+	edges := mc.mesh.edges
+
+	queries, values, err := mc.query(ctx, timeRange, func(scope string) []*metricQuery {
+		return edgeQueries(&edges, strings.TrimPrefix(edges.selector(nil)+scope, ","), timeRange)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every workload that sends or receives traffic is a service
+	services := make(map[string]*models.Service)
+	for _, list := range values {
+		for _, series := range list {
+			for _, label := range []model.LabelName{edges.sourceLabel, edges.targetLabel} {
+				name := string(series.labels[label])
+				if _, exists := services[name]; !exists && name != "" && name != "unknown" {
+					services[name] = newMeshService(name, mc.mesh.name)
+				}
+			}
+		}
+	}
+
+	snapshot := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+	for i, mq := range queries {
+		applyEdgeValues(mq, values[i], &edges, services, snapshot)
+	}
+
+	// Inbound requests turn the calls of an edge into calls per request of the caller
+	serviceMetrics := newServiceMetricsIndex(services, timeRange)
+	queries, values, err = mc.query(ctx, timeRange, func(scope string) []*metricQuery {
+		return []*metricQuery{meshRequestsQuery(mc.mesh, strings.TrimPrefix(mc.mesh.selector(nil)+scope, ","), timeRange)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, mq := range queries {
+		applyEndpointValues(mq, values[i], serviceMetrics)
+	}
+	for _, sm := range serviceMetrics {
+		snapshot.AddServiceMetrics(sm)
+	}
+
+	callGraph := models.NewCallGraph()
+	callGraph.Metadata["source"] = mc.mesh.name
+	for _, service := range services {
+		callGraph.AddService(service)
+	}
+
+	sort.Slice(snapshot.Edges, func(i, j int) bool {
+		a, b := snapshot.Edges[i], snapshot.Edges[j]
+		return a.From < b.From || (a.From == b.From && a.To < b.To)
+	})
+	for _, em := range snapshot.Edges {
+		if em.Calls <= 0 || em.Calls < mc.config.MinCalls {
+			continue
+		}
+		callGraph.AddDependency(&models.Dependency{
+			ID:           em.From + "->" + em.To,
+			FromService:  em.From,
+			FromEndpoint: models.MeshEndpointPath,
+			ToService:    em.To,
+			ToEndpoint:   models.MeshEndpointPath,
+			ToMethod:     models.MeshEndpointPath,
+			CallType:     "http",
+			Weight:       1.0,
+			DetectedAt:   mc.mesh.name,
+		})
+	}
+	callGraph.ApplyEdgeMetrics(snapshot)
+
+	mc.logger.Infof("Found %d services and %d dependencies in %s telemetry",
+		len(callGraph.Services), len(callGraph.Dependencies), mc.mesh.name)
+	return callGraph, nil
+}
+
+// newMeshService creates a service with the single endpoint mesh telemetry can
+// observe
+func newMeshService(name, mesh string) *models.Service {
+	service := &models.Service{
+		Name:     name,
+		Metadata: map[string]string{"source": mesh},
+	}
+	service.AddEndpoint(&models.Endpoint{
+		Path:   models.MeshEndpointPath,
+		Method: models.MeshEndpointPath,
+		Type:   models.EndpointMesh,
+	})
+	return service
+}
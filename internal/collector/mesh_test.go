@@ -0,0 +1,304 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// newFakeIstio answers the Istio edge and inbound request queries of a frontend
+// calling cart, which calls redis
+func newFakeIstio(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse query: %v", err)
+		}
+		query := r.Form.Get("query")
+		w.Header().Set("Content-Type", "application/json")
+
+		edge := func(from, to string, value float64) string {
+			return fmt.Sprintf(`{"metric":{"source_workload":%q,"destination_workload":%q},"value":[1700000000,"%g"]}`, from, to, value)
+		}
+
+		var series []string
+		switch {
+		case strings.Contains(query, `istio_requests_total{reporter="source"`):
+			series = []string{edge("frontend", "cart", 2000), edge("frontend", "unknown", 5), edge("cart", "redis", 10)}
+		case strings.Contains(query, "istio_request_bytes_sum"):
+			series = []string{edge("frontend", "cart", 2000*100)}
+		case strings.Contains(query, "istio_response_bytes_sum"):
+			series = []string{edge("frontend", "cart", 2000*500)}
+		case strings.Contains(query, `istio_requests_total{reporter="destination"`):
+			series = []string{
+				`{"metric":{"service":"frontend","destination_workload":"frontend"},"value":[1700000000,"1000"]}`,
+				`{"metric":{"service":"cart","destination_workload":"cart"},"value":[1700000000,"2000"]}`,
+			}
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(series, ","))
+	}))
+}
+
+func TestMeshCollectorBuildCallGraph(t *testing.T) {
+	server := newFakeIstio(t)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Prometheus = newTestPrometheusConfig(server.URL)
+	cfg.Analysis.Source = "mesh"
+	cfg.Analysis.Mesh.MinCalls = 50
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	mc, err := NewMeshCollector(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewMeshCollector failed: %v", err)
+	}
+
+	end := time.Now()
+	callGraph, err := mc.BuildCallGraph(context.Background(), models.TimeRange{Start: end.Add(-time.Hour), End: end})
+	if err != nil {
+		t.Fatalf("BuildCallGraph failed: %v", err)
+	}
+
+	for _, name := range []string{"frontend", "cart", "redis"} {
+		service, exists := callGraph.Services[name]
+		if !exists {
+			t.Errorf("Expected service %s", name)
+			continue
+		}
+		if len(service.Endpoints) != 1 || !service.Endpoints[0].IsMesh() {
+			t.Errorf("Expected %s to have a single mesh endpoint, got %v", name, service.Endpoints)
+		}
+	}
+	if len(callGraph.Services) != 3 {
+		t.Errorf("Expected 3 services, got %d", len(callGraph.Services))
+	}
+
+	// cart->redis has fewer calls than the minimum
+	if len(callGraph.Dependencies) != 1 {
+		t.Fatalf("Expected 1 dependency, got %d", len(callGraph.Dependencies))
+	}
+	dep := callGraph.Dependencies[0]
+	if dep.FromService != "frontend" || dep.ToService != "cart" {
+		t.Errorf("Expected frontend->cart, got %s->%s", dep.FromService, dep.ToService)
+	}
+	// 2000 calls for 1000 requests of frontend
+	if math.Abs(dep.Weight-2) > 1e-9 || !dep.Measured {
+		t.Errorf("Expected measured weight 2, got %f (measured %v)", dep.Weight, dep.Measured)
+	}
+	if dep.RequestBytes != 100 || dep.ResponseBytes != 500 {
+		t.Errorf("Expected 100 and 500 bytes per call, got %f and %f", dep.RequestBytes, dep.ResponseBytes)
+	}
+}
+
+// newFakeLinkerd answers the Linkerd edge and inbound request queries of a
+// frontend calling cart, with the given share of the traffic
+func newFakeLinkerd(t *testing.T, share float64) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse query: %v", err)
+		}
+		query := r.Form.Get("query")
+		w.Header().Set("Content-Type", "application/json")
+
+		edge := func(from, to string, value float64) string {
+			return fmt.Sprintf(`{"metric":{"deployment":%q,"dst_deployment":%q},"value":[1700000000,"%g"]}`, from, to, value*share)
+		}
+		inbound := func(name string, value float64) string {
+			return fmt.Sprintf(`{"metric":{"service":%q,"deployment":%q},"value":[1700000000,"%g"]}`, name, name, value*share)
+		}
+
+		var series []string
+		switch {
+		case strings.Contains(query, `response_total{direction="outbound"`):
+			// Calls leaving the mesh have no destination deployment
+			series = []string{edge("frontend", "cart", 2000), edge("frontend", "", 30)}
+		case strings.Contains(query, `tcp_write_bytes_total{direction="outbound"`):
+			series = []string{edge("frontend", "cart", 2000*100)}
+		case strings.Contains(query, `tcp_read_bytes_total{direction="outbound"`):
+			series = []string{edge("frontend", "cart", 2000*500)}
+		case strings.Contains(query, `response_total{direction="inbound"`):
+			series = []string{inbound("frontend", 1000), inbound("cart", 2000)}
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(series, ","))
+	}))
+}
+
+func TestMeshCollectorLinkerd(t *testing.T) {
+	whole := newFakeLinkerd(t, 1)
+	defer whole.Close()
+	eu := newFakeLinkerd(t, 0.5)
+	defer eu.Close()
+	us := newFakeLinkerd(t, 0.5)
+	defer us.Close()
+
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+	}{
+		{
+			name: "prometheus",
+			configure: func(cfg *config.Config) {
+				cfg.Prometheus = newTestPrometheusConfig(whole.URL)
+			},
+		},
+		{
+			// Each cluster sees half of the traffic
+			name: "federated",
+			configure: func(cfg *config.Config) {
+				cfg.Prometheus = newTestPrometheusConfig(eu.URL)
+				cfg.MetricsSource.Type = "federated"
+				cfg.MetricsSource.Federated = []config.FederatedMemberConfig{
+					{Name: "eu", URL: eu.URL},
+					{Name: "us", URL: us.URL},
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Analysis.Source = "mesh"
+			cfg.Analysis.Mesh.Type = "linkerd"
+			tt.configure(cfg)
+
+			logger := logrus.New()
+			logger.SetLevel(logrus.WarnLevel)
+
+			mc, err := NewMeshCollector(cfg, logger)
+			if err != nil {
+				t.Fatalf("NewMeshCollector failed: %v", err)
+			}
+
+			end := time.Now()
+			callGraph, err := mc.BuildCallGraph(context.Background(), models.TimeRange{Start: end.Add(-time.Hour), End: end})
+			if err != nil {
+				t.Fatalf("BuildCallGraph failed: %v", err)
+			}
+
+			if len(callGraph.Services) != 2 || callGraph.Services["frontend"] == nil || callGraph.Services["cart"] == nil {
+				t.Errorf("Expected services frontend and cart, got %v", callGraph.Services)
+			}
+			if source := callGraph.Metadata["source"]; source != "linkerd" {
+				t.Errorf("Expected source linkerd, got %v", source)
+			}
+
+			if len(callGraph.Dependencies) != 1 {
+				t.Fatalf("Expected 1 dependency, got %d", len(callGraph.Dependencies))
+			}
+			dep := callGraph.Dependencies[0]
+			if dep.FromService != "frontend" || dep.ToService != "cart" {
+				t.Errorf("Expected frontend->cart, got %s->%s", dep.FromService, dep.ToService)
+			}
+			// 2000 calls for 1000 requests of frontend
+			if math.Abs(dep.Weight-2) > 1e-9 || !dep.Measured {
+				t.Errorf("Expected measured weight 2, got %f (measured %v)", dep.Weight, dep.Measured)
+			}
+			if math.Abs(dep.RequestBytes-100) > 1e-9 || math.Abs(dep.ResponseBytes-500) > 1e-9 {
+				t.Errorf("Expected 100 and 500 bytes per call, got %f and %f", dep.RequestBytes, dep.ResponseBytes)
+			}
+		})
+	}
+}
+
+func TestFileSourceMeshMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,istio_requests_total,reporter=destination;destination_workload=cart;response_code=200,0
+2024-01-01T01:00:00Z,istio_requests_total,reporter=destination;destination_workload=cart;response_code=200,980
+2024-01-01T00:00:00Z,istio_requests_total,reporter=destination;destination_workload=cart;response_code=503,0
+2024-01-01T01:00:00Z,istio_requests_total,reporter=destination;destination_workload=cart;response_code=503,20
+2024-01-01T00:00:00Z,istio_requests_total,reporter=source;source_workload=frontend;destination_workload=cart;response_code=200,0
+2024-01-01T01:00:00Z,istio_requests_total,reporter=source;source_workload=frontend;destination_workload=cart;response_code=200,1000
+2024-01-01T00:00:00Z,istio_request_duration_milliseconds_sum,reporter=destination;destination_workload=cart,0
+2024-01-01T01:00:00Z,istio_request_duration_milliseconds_sum,reporter=destination;destination_workload=cart,50000
+2024-01-01T00:00:00Z,istio_request_duration_milliseconds_count,reporter=destination;destination_workload=cart,0
+2024-01-01T01:00:00Z,istio_request_duration_milliseconds_count,reporter=destination;destination_workload=cart,1000
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{path}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+
+	services := map[string]*models.Service{"cart": newMeshService("cart", "istio")}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), services, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	// Calls reported by frontend's sidecar are not inbound requests of cart
+	perf := snapshot.Services["cart"].Endpoints["*:*"].Performance
+	if perf.RequestCount != 1000 {
+		t.Errorf("Expected 1000 requests, got %f", perf.RequestCount)
+	}
+	if perf.ErrorCount != 20 {
+		t.Errorf("Expected 20 errors, got %f", perf.ErrorCount)
+	}
+	if perf.LatencyAvg != 50*time.Millisecond {
+		t.Errorf("Expected average latency 50ms, got %s", perf.LatencyAvg)
+	}
+}
+
+func TestFileSourceLinkerdMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,response_total,direction=inbound;deployment=cart;classification=success,0
+2024-01-01T01:00:00Z,response_total,direction=inbound;deployment=cart;classification=success,980
+2024-01-01T00:00:00Z,response_total,direction=inbound;deployment=cart;classification=failure,0
+2024-01-01T01:00:00Z,response_total,direction=inbound;deployment=cart;classification=failure,20
+2024-01-01T00:00:00Z,response_total,direction=outbound;deployment=frontend;dst_deployment=cart;classification=success,0
+2024-01-01T01:00:00Z,response_total,direction=outbound;deployment=frontend;dst_deployment=cart;classification=success,1000
+2024-01-01T00:00:00Z,response_latency_ms_sum,direction=inbound;deployment=cart,0
+2024-01-01T01:00:00Z,response_latency_ms_sum,direction=inbound;deployment=cart,50000
+2024-01-01T00:00:00Z,response_latency_ms_count,direction=inbound;deployment=cart,0
+2024-01-01T01:00:00Z,response_latency_ms_count,direction=inbound;deployment=cart,1000
+`)
+
+	source, err := NewFileSource(&config.FileSourceConfig{Paths: []string{path}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+	source.mesh, err = newMeshConvention("linkerd")
+	if err != nil {
+		t.Fatalf("newMeshConvention failed: %v", err)
+	}
+
+	services := map[string]*models.Service{"cart": newMeshService("cart", "linkerd")}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), services, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	// Responses observed by frontend's proxy are not inbound requests of cart
+	perf := snapshot.Services["cart"].Endpoints["*:*"].Performance
+	if perf.RequestCount != 1000 {
+		t.Errorf("Expected 1000 requests, got %f", perf.RequestCount)
+	}
+	if perf.ErrorCount != 20 {
+		t.Errorf("Expected 20 errors, got %f", perf.ErrorCount)
+	}
+	if perf.LatencyAvg != 50*time.Millisecond {
+		t.Errorf("Expected average latency 50ms, got %s", perf.LatencyAvg)
+	}
+}
@@ -0,0 +1,432 @@
+package collector
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// maxOTLPRequestSize limits the size of a decompressed OTLP/HTTP request body
+const maxOTLPRequestSize = 64 << 20
+
+// OTLPSource ingests OpenTelemetry metrics from OTLP export files or an OTLP/HTTP
+// receiver. Metrics following the semantic conventions are mapped onto the
+// Prometheus series the file source evaluates, so both sources share one query
+// implementation:
+//
+//	http.server.request.duration -> http_request_duration_seconds, http_requests_total
+//	rpc.server.duration          -> rpc_server_duration_milliseconds (otel gRPC convention)
+//	process.cpu.time             -> container_cpu_usage_seconds_total
+//	container.memory.usage       -> container_memory_usage_bytes
+type OTLPSource struct {
+	config   *config.OTLPSourceConfig
+	logger   *logrus.Logger
+	store    *FileSource
+	mu       sync.Mutex
+	deltas   map[model.Fingerprint]*model.SampleStream
+	starts   map[model.Fingerprint]model.Time
+	received int
+
+	// ingest receives and finalizes metrics once, however many scopes evaluate them
+	ingest    sync.Once
+	ingestErr error
+}
+
+// NewOTLPSource creates a metrics source that reads OTLP export files and, if a
+// listen address is configured, receives OTLP/HTTP when metrics are collected
+func NewOTLPSource(cfg *config.OTLPSourceConfig, logger *logrus.Logger) (*OTLPSource, error) {
+	store := newFileSource(&config.FileSourceConfig{Paths: cfg.Paths}, logger)
+	store.rpc = rpcConventions["otel"]
+
+	ots := &OTLPSource{
+		config: cfg,
+		logger: logger,
+		store:  store,
+		deltas: make(map[model.Fingerprint]*model.SampleStream),
+		starts: make(map[model.Fingerprint]model.Time),
+	}
+
+	files, err := store.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading OTLP file %s: %w", file, err)
+		}
+
+		metrics, err := decodeOTLP(data)
+		if err != nil {
+			return nil, fmt.Errorf("error loading OTLP file %s: %w", file, err)
+		}
+		ots.addMetrics(metrics)
+	}
+
+	logger.Debugf("Loaded %d series from %d OTLP files", len(store.series)+len(ots.deltas), len(files))
+	return ots, nil
+}
+
+// Name returns the name of the metrics source
+func (ots *OTLPSource) Name() string {
+	return "otlp"
+}
+
+// CollectMetrics receives OTLP metrics for the configured window, if listening,
+// and evaluates everything ingested for all services
+func (ots *OTLPSource) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	if err := ots.ingestOnce(ctx); err != nil {
+		return nil, err
+	}
+	return ots.store.CollectMetrics(ctx, services, timeRange)
+}
+
+// ingestOnce runs the receiver, if listening, and finalizes the ingested series
+// on the first collection
+func (ots *OTLPSource) ingestOnce(ctx context.Context) error {
+	ots.ingest.Do(func() {
+		if ots.config.Listen != "" {
+			if err := ots.receive(ctx); err != nil {
+				ots.ingestErr = err
+				return
+			}
+		}
+
+		ots.finalize()
+		if _, ok := ots.store.extent(); !ok {
+			ots.ingestErr = fmt.Errorf("no OTLP metrics received")
+		}
+	})
+	return ots.ingestErr
+}
+
+// withScope returns a metrics source evaluating the metrics of this source within
+// another scope. Every scope shares one receiver window and one decode of the files.
+func (ots *OTLPSource) withScope(sc scope) MetricsSource {
+	store := *ots.store
+	store.scope = sc
+	return &scopedOTLPSource{source: ots, store: &store}
+}
+
+// scopedOTLPSource evaluates the metrics ingested by a shared OTLP source within
+// one namespace or cluster
+type scopedOTLPSource struct {
+	source *OTLPSource
+	store  *FileSource
+}
+
+// Name returns the name of the metrics source
+func (s *scopedOTLPSource) Name() string {
+	return s.source.Name()
+}
+
+// CollectMetrics ingests the shared metrics, if not done yet, and evaluates them
+// within the scope
+func (s *scopedOTLPSource) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	if err := s.source.ingestOnce(ctx); err != nil {
+		return nil, err
+	}
+	return s.store.CollectMetrics(ctx, services, timeRange)
+}
+
+// receive runs the OTLP/HTTP receiver for the configured window, or until the
+// context is cancelled
+func (ots *OTLPSource) receive(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ots.config.Listen)
+	if err != nil {
+		return fmt.Errorf("error starting OTLP receiver: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/metrics", ots.handleExport)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ots.logger.WithError(err).Error("OTLP receiver stopped")
+		}
+	}()
+
+	ots.logger.Infof("Receiving OTLP metrics on %s for %s...", listener.Addr(), ots.config.Window)
+	select {
+	case <-ctx.Done():
+	case <-time.After(ots.config.Window):
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error stopping OTLP receiver: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("OTLP receiver interrupted: %w", err)
+	}
+
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+	ots.logger.Infof("Received %d OTLP export requests", ots.received)
+	return nil
+}
+
+// handleExport handles an OTLP/HTTP metrics export request in protobuf or JSON
+func (ots *OTLPSource) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxOTLPRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	decode := decodeOTLPProto
+	if isJSON {
+		decode = decodeOTLPJSON
+	}
+
+	metrics, err := decode(data)
+	if err != nil {
+		ots.logger.WithError(err).Debug("Rejected OTLP export request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ots.mu.Lock()
+	ots.received++
+	ots.mu.Unlock()
+	ots.addMetrics(metrics)
+
+	// An empty ExportMetricsServiceResponse reports full success
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// addMetrics maps OTLP metrics onto Prometheus series. Metrics without a
+// mapping are ignored.
+func (ots *OTLPSource) addMetrics(metrics []otlpMetric) {
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+
+	for _, m := range metrics {
+		resource := resourceLabels(m.resource)
+
+		switch m.name {
+		case "http.server.request.duration", "http.server.duration":
+			if m.kind != otlpHistogram {
+				continue
+			}
+			scale := secondsPerUnit(m.unit)
+			for _, p := range m.points {
+				labels := httpLabels(resource, p.attributes)
+				ots.addHistogram(m, "http_request_duration_seconds", labels, p, scale)
+				ots.add(m, "http_requests_total", labels, p, p.count)
+			}
+		case "rpc.server.duration", "rpc.server.call.duration":
+			if m.kind != otlpHistogram {
+				continue
+			}
+			scale := secondsPerUnit(m.unit) * 1000
+			for _, p := range m.points {
+				ots.addHistogram(m, "rpc_server_duration_milliseconds", rpcLabels(resource, p.attributes), p, scale)
+			}
+		case "process.cpu.time", "container.cpu.time":
+			for _, p := range m.points {
+				ots.add(m, "container_cpu_usage_seconds_total", withAttributes(resource, p.attributes), p, p.value*secondsPerUnit(m.unit))
+			}
+		case "container.memory.usage", "process.memory.usage":
+			for _, p := range m.points {
+				ots.add(m, "container_memory_usage_bytes", withAttributes(resource, p.attributes), p, p.value)
+			}
+		}
+	}
+}
+
+// addHistogram adds an OTLP histogram point as cumulative _bucket, _sum and _count
+// series, scaling bounds and sum by scale
+func (ots *OTLPSource) addHistogram(m otlpMetric, name string, labels model.Metric, p otlpPoint, scale float64) {
+	cumulative := 0.0
+	for i, bound := range p.bounds {
+		if i < len(p.buckets) {
+			cumulative += p.buckets[i]
+		}
+		bucketLabels := labels.Clone()
+		bucketLabels[model.BucketLabel] = model.LabelValue(formatFloat(bound * scale))
+		ots.add(m, name+"_bucket", bucketLabels, p, cumulative)
+	}
+
+	infLabels := labels.Clone()
+	infLabels[model.BucketLabel] = "+Inf"
+	ots.add(m, name+"_bucket", infLabels, p, p.count)
+	ots.add(m, name+"_sum", labels, p, p.sum*scale)
+	ots.add(m, name+"_count", labels, p, p.count)
+}
+
+// add adds a sample of a mapped metric. Delta sums and histograms are kept apart
+// until finalize turns them into cumulative counters.
+func (ots *OTLPSource) add(m otlpMetric, name string, labels model.Metric, p otlpPoint, value float64) {
+	ts := model.TimeFromUnixNano(p.time.UnixNano())
+	if !m.delta || m.kind == otlpGauge {
+		ots.store.addSample(name, labels, ts, value)
+		return
+	}
+
+	metric := labels.Clone()
+	metric[model.MetricNameLabel] = model.LabelValue(name)
+
+	fp := metric.Fingerprint()
+	stream, exists := ots.deltas[fp]
+	if !exists {
+		stream = &model.SampleStream{Metric: metric}
+		ots.deltas[fp] = stream
+	}
+	stream.Values = append(stream.Values, model.SamplePair{Timestamp: ts, Value: model.SampleValue(value)})
+
+	if p.start.UnixNano() > 0 {
+		start := model.TimeFromUnixNano(p.start.UnixNano())
+		if earliest, exists := ots.starts[fp]; !exists || start.Before(earliest) {
+			ots.starts[fp] = start
+		}
+	}
+}
+
+// finalize accumulates delta series into counters, starting from zero at the
+// start time of their first point, and orders all samples by time
+func (ots *OTLPSource) finalize() {
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+
+	for fp, stream := range ots.deltas {
+		deltas := append([]model.SamplePair(nil), stream.Values...)
+		sort.Slice(deltas, func(i, j int) bool { return deltas[i].Timestamp.Before(deltas[j].Timestamp) })
+
+		values := make([]model.SamplePair, 0, len(deltas)+1)
+		if start, exists := ots.starts[fp]; exists && start.Before(deltas[0].Timestamp) {
+			values = append(values, model.SamplePair{Timestamp: start})
+		}
+
+		total := model.SampleValue(0)
+		for _, sample := range deltas {
+			total += sample.Value
+			values = append(values, model.SamplePair{Timestamp: sample.Timestamp, Value: total})
+		}
+		ots.store.series[fp] = &model.SampleStream{Metric: stream.Metric, Values: values}
+	}
+
+	ots.store.sortSamples()
+}
+
+// resourceLabels maps OTLP resource attributes onto the service, namespace,
+// cluster and pod labels
+func resourceLabels(resource map[string]string) model.Metric {
+	labels := model.Metric{"service": model.LabelValue(resource["service.name"])}
+	set := func(name model.LabelName, keys ...string) {
+		if v := firstAttribute(resource, keys...); v != "" {
+			labels[name] = model.LabelValue(v)
+		}
+	}
+
+	set(namespaceLabel, "k8s.namespace.name")
+	set(clusterLabel, "k8s.cluster.name")
+	set("pod", "k8s.pod.name", "service.instance.id")
+	return labels
+}
+
+// httpLabels maps the attributes of an HTTP server metric, in current or legacy
+// semantic conventions, onto the endpoint, method and status labels
+func httpLabels(resource model.Metric, attributes map[string]string) model.Metric {
+	labels := resource.Clone()
+	labels["endpoint"] = model.LabelValue(firstAttribute(attributes, "http.route", "url.path", "http.target"))
+	labels["method"] = model.LabelValue(firstAttribute(attributes, "http.request.method", "http.method"))
+	labels["status"] = model.LabelValue(firstAttribute(attributes, "http.response.status_code", "http.status_code"))
+	return labels
+}
+
+// rpcLabels maps the attributes of an RPC server metric onto the otel convention labels
+func rpcLabels(resource model.Metric, attributes map[string]string) model.Metric {
+	conv := rpcConventions["otel"]
+	labels := resource.Clone()
+	labels[conv.serviceLabel] = model.LabelValue(attributes["rpc.service"])
+	labels[conv.methodLabel] = model.LabelValue(attributes["rpc.method"])
+	labels[conv.codeLabel] = model.LabelValue(attributes["rpc.grpc.status_code"])
+	return labels
+}
+
+// withAttributes adds point attributes, e.g. the CPU mode, as labels so the
+// points of one metric stay separate series
+func withAttributes(resource model.Metric, attributes map[string]string) model.Metric {
+	labels := resource.Clone()
+	for key, value := range attributes {
+		name := model.LabelName(strings.Map(func(r rune) rune {
+			if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, key))
+		if _, exists := labels[name]; !exists {
+			labels[name] = model.LabelValue(value)
+		}
+	}
+	return labels
+}
+
+// firstAttribute returns the first non-empty attribute of the given keys
+func firstAttribute(attributes map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := attributes[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// secondsPerUnit converts a UCUM time unit to seconds; unknown units are taken as seconds
+func secondsPerUnit(unit string) float64 {
+	switch unit {
+	case "ms":
+		return 1e-3
+	case "us":
+		return 1e-6
+	case "ns":
+		return 1e-9
+	case "min":
+		return 60
+	default:
+		return 1
+	}
+}
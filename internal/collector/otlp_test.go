@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// protoMessage appends a length-delimited field to b
+func protoMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// protoAttribute encodes a KeyValue with a string value
+func protoAttribute(key, value string) []byte {
+	var anyValue []byte
+	anyValue = protoMessage(anyValue, fieldAnyString, []byte(value))
+
+	var kv []byte
+	kv = protoMessage(kv, fieldKeyValueKey, []byte(key))
+	return protoMessage(kv, fieldKeyValueValue, anyValue)
+}
+
+// protoHistogramPoint encodes a HistogramDataPoint
+func protoHistogramPoint(ts time.Time, count uint64, sum float64, bounds []float64, buckets []uint64, attrs ...[]byte) []byte {
+	var p []byte
+	for _, attr := range attrs {
+		p = protoMessage(p, fieldHistogramAttributes, attr)
+	}
+	p = protowire.AppendTag(p, fieldHistogramTime, protowire.Fixed64Type)
+	p = protowire.AppendFixed64(p, uint64(ts.UnixNano()))
+	p = protowire.AppendTag(p, fieldHistogramCount, protowire.Fixed64Type)
+	p = protowire.AppendFixed64(p, count)
+	p = protowire.AppendTag(p, fieldHistogramSum, protowire.Fixed64Type)
+	p = protowire.AppendFixed64(p, math.Float64bits(sum))
+
+	var packed []byte
+	for _, c := range buckets {
+		packed = protowire.AppendFixed64(packed, c)
+	}
+	p = protoMessage(p, fieldHistogramBuckets, packed)
+
+	packed = nil
+	for _, b := range bounds {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(b))
+	}
+	return protoMessage(p, fieldHistogramBounds, packed)
+}
+
+// protoNumberPoint encodes a NumberDataPoint with a double value
+func protoNumberPoint(ts time.Time, value float64) []byte {
+	var p []byte
+	p = protowire.AppendTag(p, fieldNumberTime, protowire.Fixed64Type)
+	p = protowire.AppendFixed64(p, uint64(ts.UnixNano()))
+	p = protowire.AppendTag(p, fieldNumberAsDouble, protowire.Fixed64Type)
+	return protowire.AppendFixed64(p, math.Float64bits(value))
+}
+
+// protoMetric encodes a cumulative metric of the given data field
+func protoMetric(name, unit string, dataField protowire.Number, points ...[]byte) []byte {
+	var data []byte
+	for _, p := range points {
+		data = protoMessage(data, fieldDataPoints, p)
+	}
+	data = protowire.AppendTag(data, fieldTemporality, protowire.VarintType)
+	data = protowire.AppendVarint(data, 2)
+
+	var m []byte
+	m = protoMessage(m, fieldMetricName, []byte(name))
+	m = protoMessage(m, fieldMetricUnit, []byte(unit))
+	return protoMessage(m, dataField, data)
+}
+
+func TestOTLPReceiverProtobuf(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	route := [][]byte{
+		protoAttribute("http.route", "/users"),
+		protoAttribute("http.request.method", "GET"),
+		protoAttribute("http.response.status_code", "200"),
+	}
+
+	var scope []byte
+	scope = protoMessage(scope, fieldScopeMetricsMetrics, protoMetric("http.server.request.duration", "ms", fieldMetricHistogram,
+		protoHistogramPoint(start, 0, 0, []float64{10, 100}, []uint64{0, 0, 0}, route...),
+		protoHistogramPoint(end, 100, 5000, []float64{10, 100}, []uint64{50, 40, 10}, route...),
+	))
+	scope = protoMessage(scope, fieldScopeMetricsMetrics, protoMetric("process.cpu.time", "s", fieldMetricSum,
+		protoNumberPoint(start, 100),
+		protoNumberPoint(end, 1900),
+	))
+
+	var resource []byte
+	resource = protoMessage(resource, fieldResourceAttributes, protoAttribute("service.name", "api"))
+	resource = protoMessage(resource, fieldResourceAttributes, protoAttribute("k8s.pod.name", "api-1"))
+
+	// The resource is encoded after its scope to check that field order does not matter
+	var rm []byte
+	rm = protoMessage(rm, fieldResourceMetricsScope, scope)
+	rm = protoMessage(rm, fieldResourceMetricsResource, resource)
+	request := protoMessage(nil, fieldRequestResourceMetrics, rm)
+
+	source, err := NewOTLPSource(&config.OTLPSourceConfig{}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewOTLPSource failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(request))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	source.handleExport(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	services := map[string]*models.Service{
+		"api": {Name: "api", Endpoints: []*models.Endpoint{{Path: "/users", Method: "GET"}}},
+	}
+
+	snapshot, err := source.CollectMetrics(context.Background(), services, models.TimeRange{Start: start, End: end})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	sm := snapshot.Services["api"]
+	if sm.Aggregate.CPUCoreHours != 0.5 {
+		t.Errorf("Expected 0.5 core hours, got %f", sm.Aggregate.CPUCoreHours)
+	}
+
+	perf := sm.Endpoints["/users:GET"].Performance
+	if perf.RequestCount != 100 {
+		t.Errorf("Expected 100 requests, got %f", perf.RequestCount)
+	}
+	if perf.LatencyAvg != 50*time.Millisecond {
+		t.Errorf("Expected average latency 50ms, got %s", perf.LatencyAvg)
+	}
+	if perf.LatencyP50 != 10*time.Millisecond {
+		t.Errorf("Expected p50 latency 10ms, got %s", perf.LatencyP50)
+	}
+}
+
+func TestOTLPSourceJSONDelta(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "metrics.json", `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"catalog"}}]},"scopeMetrics":[{"metrics":[{"name":"rpc.server.duration","unit":"ms","histogram":{"aggregationTemporality":"AGGREGATION_TEMPORALITY_DELTA","dataPoints":[
+{"attributes":[{"key":"rpc.service","value":{"stringValue":"shop.ProductService"}},{"key":"rpc.method","value":{"stringValue":"GetProduct"}},{"key":"rpc.grpc.status_code","value":{"intValue":"0"}}],"startTimeUnixNano":"1704067200000000000","timeUnixNano":"1704069000000000000","count":"50","sum":1000,"bucketCounts":["50"]},
+{"attributes":[{"key":"rpc.service","value":{"stringValue":"shop.ProductService"}},{"key":"rpc.method","value":{"stringValue":"GetProduct"}},{"key":"rpc.grpc.status_code","value":{"intValue":"14"}}],"startTimeUnixNano":"1704067200000000000","timeUnixNano":"1704069000000000000","count":"10","sum":220,"bucketCounts":["10"]}]}}]}]}]}
+{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"catalog"}}]},"scopeMetrics":[{"metrics":[{"name":"rpc.server.duration","unit":"ms","histogram":{"aggregationTemporality":1,"dataPoints":[
+{"attributes":[{"key":"rpc.service","value":{"stringValue":"shop.ProductService"}},{"key":"rpc.method","value":{"stringValue":"GetProduct"}},{"key":"rpc.grpc.status_code","value":{"intValue":"0"}}],"startTimeUnixNano":"1704069000000000000","timeUnixNano":"1704070800000000000","count":"50","sum":1200,"bucketCounts":["50"]}]}}]}]}]}
+`)
+
+	source, err := NewOTLPSource(&config.OTLPSourceConfig{Paths: []string{dir}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewOTLPSource failed: %v", err)
+	}
+
+	services := map[string]*models.Service{
+		"catalog": {
+			Name:      "catalog",
+			Endpoints: []*models.Endpoint{{Path: "/GetProduct", Method: "GET", Type: models.EndpointGRPC}},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), services, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	perf := snapshot.Services["catalog"].Endpoints["/GetProduct:GET"].Performance
+	if perf.RequestCount != 110 {
+		t.Errorf("Expected 110 calls, got %f", perf.RequestCount)
+	}
+	if perf.ErrorCount != 10 {
+		t.Errorf("Expected 10 errors, got %f", perf.ErrorCount)
+	}
+	if perf.LatencyAvg != 22*time.Millisecond {
+		t.Errorf("Expected average latency 22ms, got %s", perf.LatencyAvg)
+	}
+}
+
+func TestOTLPSplitSharesReceiver(t *testing.T) {
+	dir := t.TempDir()
+	cpu := func(namespace string, seconds int) string {
+		return `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}},{"key":"k8s.namespace.name","value":{"stringValue":"` + namespace + `"}}]},"scopeMetrics":[{"metrics":[{"name":"process.cpu.time","unit":"s","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[
+{"timeUnixNano":"1704067200000000000","asDouble":0},{"timeUnixNano":"1704070800000000000","asDouble":` + strconv.Itoa(seconds) + `}]}}]}]}]}
+`
+	}
+	writeFile(t, dir, "metrics.json", cpu("prod", 7200)+cpu("staging", 3600))
+
+	cfg := config.DefaultConfig()
+	cfg.MetricsSource.Type = "otlp"
+	cfg.MetricsSource.OTLP = config.OTLPSourceConfig{Paths: []string{dir}, Listen: "127.0.0.1:0", Window: 50 * time.Millisecond}
+	cfg.MetricsSource.Scope = config.ScopeConfig{Namespaces: []string{"prod", "staging"}, SplitBy: "namespace"}
+
+	source, err := NewMetricsSource(cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("NewMetricsSource failed: %v", err)
+	}
+
+	// Every environment evaluates the metrics of one receiver
+	split := source.(*SplitSource)
+	prod, staging := split.sources["prod"].(*scopedOTLPSource), split.sources["staging"].(*scopedOTLPSource)
+	if prod.source != staging.source {
+		t.Fatal("Expected environments to share one OTLP source")
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	if total := snapshot.Services["checkout"].Aggregate.CPUCoreHours; math.Abs(total-3) > 1e-9 {
+		t.Errorf("Expected 3 core-hours across prod and staging, got %f", total)
+	}
+	if hours := snapshot.Environments["staging"].Services["checkout"].Aggregate.CPUCoreHours; math.Abs(hours-1) > 1e-9 {
+		t.Errorf("Expected 1 core-hour in staging, got %f", hours)
+	}
+}
@@ -0,0 +1,566 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpKind is the data type of an OTLP metric
+type otlpKind int
+
+const (
+	otlpGauge otlpKind = iota
+	otlpSum
+	otlpHistogram
+)
+
+// otlpMetric is a decoded OTLP metric with the attributes of its resource
+type otlpMetric struct {
+	name     string
+	unit     string
+	kind     otlpKind
+	delta    bool
+	resource map[string]string
+	points   []otlpPoint
+}
+
+// otlpPoint is a number or histogram data point. Histogram bucket counts are
+// per bucket, as in OTLP, with one more bucket than bounds.
+type otlpPoint struct {
+	attributes map[string]string
+	start      time.Time
+	time       time.Time
+	value      float64
+	count      float64
+	sum        float64
+	bounds     []float64
+	buckets    []float64
+}
+
+// otlpDeltaTemporality is AGGREGATION_TEMPORALITY_DELTA
+const otlpDeltaTemporality = 1
+
+// decodeOTLP decodes OTLP metric export data. JSON holds one or more
+// ExportMetricsServiceRequest objects, e.g. one per line as written by the
+// collector's file exporter. Protobuf holds a single request, or a sequence of
+// requests each prefixed with its length as a 4-byte big-endian integer.
+func decodeOTLP(data []byte) ([]otlpMetric, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return decodeOTLPJSON(trimmed)
+	}
+
+	if messages, ok := splitLengthPrefixed(data); ok {
+		metrics := make([]otlpMetric, 0)
+		for _, message := range messages {
+			decoded, err := decodeOTLPProto(message)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, decoded...)
+		}
+		return metrics, nil
+	}
+
+	return decodeOTLPProto(data)
+}
+
+// splitLengthPrefixed splits data into length-prefixed messages if the prefixes
+// tile it exactly
+func splitLengthPrefixed(data []byte) ([][]byte, bool) {
+	messages := make([][]byte, 0)
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, false
+		}
+		size := binary.BigEndian.Uint32(data)
+		if uint64(size) > uint64(len(data)-4) {
+			return nil, false
+		}
+		messages = append(messages, data[4:4+size])
+		data = data[4+size:]
+	}
+	return messages, len(messages) > 0
+}
+
+// OTLP JSON encoding. 64-bit integers are encoded as strings and enums may be
+// given by number or name.
+
+type otlpJSONRequest struct {
+	ResourceMetrics []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeMetrics []struct {
+			Metrics []otlpJSONMetric `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string      `json:"stringValue"`
+		BoolValue   *bool        `json:"boolValue"`
+		IntValue    *otlpJSONInt `json:"intValue"`
+		DoubleValue *float64     `json:"doubleValue"`
+	} `json:"value"`
+}
+
+type otlpJSONMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit"`
+	Gauge *struct {
+		DataPoints []otlpJSONPoint `json:"dataPoints"`
+	} `json:"gauge"`
+	Sum *struct {
+		DataPoints             []otlpJSONPoint `json:"dataPoints"`
+		AggregationTemporality otlpJSONEnum    `json:"aggregationTemporality"`
+	} `json:"sum"`
+	Histogram *struct {
+		DataPoints             []otlpJSONPoint `json:"dataPoints"`
+		AggregationTemporality otlpJSONEnum    `json:"aggregationTemporality"`
+	} `json:"histogram"`
+}
+
+type otlpJSONPoint struct {
+	Attributes        []otlpJSONKeyValue `json:"attributes"`
+	StartTimeUnixNano otlpJSONInt        `json:"startTimeUnixNano"`
+	TimeUnixNano      otlpJSONInt        `json:"timeUnixNano"`
+	AsDouble          *float64           `json:"asDouble"`
+	AsInt             *otlpJSONInt       `json:"asInt"`
+	Count             otlpJSONInt        `json:"count"`
+	Sum               float64            `json:"sum"`
+	BucketCounts      []otlpJSONInt      `json:"bucketCounts"`
+	ExplicitBounds    []float64          `json:"explicitBounds"`
+}
+
+// otlpJSONInt is a 64-bit integer encoded as a JSON string or number
+type otlpJSONInt int64
+
+// UnmarshalJSON implements json.Unmarshaler
+func (i *otlpJSONInt) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s: %w", data, err)
+	}
+	*i = otlpJSONInt(v)
+	return nil
+}
+
+// otlpJSONEnum is an enum encoded as a JSON number or name
+type otlpJSONEnum int
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *otlpJSONEnum) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	switch s {
+	case "AGGREGATION_TEMPORALITY_DELTA":
+		*e = otlpDeltaTemporality
+		return nil
+	case "AGGREGATION_TEMPORALITY_CUMULATIVE":
+		*e = 2
+		return nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid enum %s: %w", data, err)
+	}
+	*e = otlpJSONEnum(v)
+	return nil
+}
+
+// decodeOTLPJSON decodes a stream of JSON export requests
+func decodeOTLPJSON(data []byte) ([]otlpMetric, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	metrics := make([]otlpMetric, 0)
+
+	for {
+		var request otlpJSONRequest
+		if err := decoder.Decode(&request); err != nil {
+			if errors.Is(err, io.EOF) {
+				return metrics, nil
+			}
+			return nil, fmt.Errorf("error decoding OTLP JSON: %w", err)
+		}
+
+		for _, rm := range request.ResourceMetrics {
+			resource := jsonAttributes(rm.Resource.Attributes)
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					metrics = append(metrics, jsonMetric(m, resource))
+				}
+			}
+		}
+	}
+}
+
+// jsonMetric converts a JSON metric
+func jsonMetric(m otlpJSONMetric, resource map[string]string) otlpMetric {
+	metric := otlpMetric{name: m.Name, unit: m.Unit, resource: resource}
+
+	var points []otlpJSONPoint
+	switch {
+	case m.Gauge != nil:
+		metric.kind = otlpGauge
+		points = m.Gauge.DataPoints
+	case m.Sum != nil:
+		metric.kind = otlpSum
+		metric.delta = m.Sum.AggregationTemporality == otlpDeltaTemporality
+		points = m.Sum.DataPoints
+	case m.Histogram != nil:
+		metric.kind = otlpHistogram
+		metric.delta = m.Histogram.AggregationTemporality == otlpDeltaTemporality
+		points = m.Histogram.DataPoints
+	}
+
+	for _, p := range points {
+		point := otlpPoint{
+			attributes: jsonAttributes(p.Attributes),
+			start:      time.Unix(0, int64(p.StartTimeUnixNano)),
+			time:       time.Unix(0, int64(p.TimeUnixNano)),
+			count:      float64(p.Count),
+			sum:        p.Sum,
+			bounds:     p.ExplicitBounds,
+		}
+		switch {
+		case p.AsDouble != nil:
+			point.value = *p.AsDouble
+		case p.AsInt != nil:
+			point.value = float64(*p.AsInt)
+		}
+		for _, c := range p.BucketCounts {
+			point.buckets = append(point.buckets, float64(c))
+		}
+		metric.points = append(metric.points, point)
+	}
+
+	return metric
+}
+
+// jsonAttributes converts JSON attributes with scalar values into a string map
+func jsonAttributes(kvs []otlpJSONKeyValue) map[string]string {
+	attributes := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		switch v := kv.Value; {
+		case v.StringValue != nil:
+			attributes[kv.Key] = *v.StringValue
+		case v.BoolValue != nil:
+			attributes[kv.Key] = strconv.FormatBool(*v.BoolValue)
+		case v.IntValue != nil:
+			attributes[kv.Key] = strconv.FormatInt(int64(*v.IntValue), 10)
+		case v.DoubleValue != nil:
+			attributes[kv.Key] = formatFloat(*v.DoubleValue)
+		}
+	}
+	return attributes
+}
+
+// OTLP protobuf field numbers, from opentelemetry/proto/metrics/v1/metrics.proto
+// and opentelemetry/proto/common/v1/common.proto
+const (
+	fieldRequestResourceMetrics = 1
+
+	fieldResourceMetricsResource = 1
+	fieldResourceMetricsScope    = 2
+	fieldResourceAttributes      = 1
+	fieldScopeMetricsMetrics     = 2
+
+	fieldMetricName      = 1
+	fieldMetricUnit      = 3
+	fieldMetricGauge     = 5
+	fieldMetricSum       = 7
+	fieldMetricHistogram = 9
+
+	fieldDataPoints  = 1
+	fieldTemporality = 2
+
+	fieldPointStartTime = 2
+
+	fieldNumberTime       = 3
+	fieldNumberAsDouble   = 4
+	fieldNumberAsInt      = 6
+	fieldNumberAttributes = 7
+
+	fieldHistogramTime       = 3
+	fieldHistogramCount      = 4
+	fieldHistogramSum        = 5
+	fieldHistogramBuckets    = 6
+	fieldHistogramBounds     = 7
+	fieldHistogramAttributes = 9
+
+	fieldKeyValueKey   = 1
+	fieldKeyValueValue = 2
+	fieldAnyString     = 1
+	fieldAnyBool       = 2
+	fieldAnyInt        = 3
+	fieldAnyDouble     = 4
+)
+
+// wireFields calls fn for every field of a protobuf message. Length-delimited
+// fields are passed in data; varint and fixed-width fields in v.
+func wireFields(b []byte, fn func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var (
+			data []byte
+			v    uint64
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			v = uint64(v32)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, data, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeOTLPProto decodes a protobuf ExportMetricsServiceRequest
+func decodeOTLPProto(b []byte) ([]otlpMetric, error) {
+	metrics := make([]otlpMetric, 0)
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+		if num != fieldRequestResourceMetrics || typ != protowire.BytesType {
+			return nil
+		}
+		decoded, err := decodeResourceMetrics(data)
+		metrics = append(metrics, decoded...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding OTLP protobuf: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// decodeResourceMetrics decodes the metrics of one resource
+func decodeResourceMetrics(b []byte) ([]otlpMetric, error) {
+	resource := make(map[string]string)
+	scopes := make([][]byte, 0)
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case fieldResourceMetricsResource:
+			return wireFields(data, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+				if num == fieldResourceAttributes && typ == protowire.BytesType {
+					return decodeKeyValue(data, resource)
+				}
+				return nil
+			})
+		case fieldResourceMetricsScope:
+			scopes = append(scopes, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The resource may follow its scopes on the wire, so metrics are decoded last
+	metrics := make([]otlpMetric, 0)
+	for _, scope := range scopes {
+		err := wireFields(scope, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+			if num != fieldScopeMetricsMetrics || typ != protowire.BytesType {
+				return nil
+			}
+			metric, err := decodeMetric(data, resource)
+			metrics = append(metrics, metric)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// decodeMetric decodes a gauge, sum or histogram metric
+func decodeMetric(b []byte, resource map[string]string) (otlpMetric, error) {
+	metric := otlpMetric{resource: resource}
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case fieldMetricName:
+			metric.name = string(data)
+		case fieldMetricUnit:
+			metric.unit = string(data)
+		case fieldMetricGauge:
+			metric.kind = otlpGauge
+			return decodeDataPoints(data, &metric, decodeNumberPoint)
+		case fieldMetricSum:
+			metric.kind = otlpSum
+			return decodeDataPoints(data, &metric, decodeNumberPoint)
+		case fieldMetricHistogram:
+			metric.kind = otlpHistogram
+			return decodeDataPoints(data, &metric, decodeHistogramPoint)
+		}
+		return nil
+	})
+
+	return metric, err
+}
+
+// decodeDataPoints decodes the data points and temporality of a gauge, sum or histogram
+func decodeDataPoints(b []byte, metric *otlpMetric, decodePoint func([]byte) (otlpPoint, error)) error {
+	return wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error {
+		switch {
+		case num == fieldDataPoints && typ == protowire.BytesType:
+			point, err := decodePoint(data)
+			if err != nil {
+				return err
+			}
+			metric.points = append(metric.points, point)
+		case num == fieldTemporality && typ == protowire.VarintType:
+			metric.delta = v == otlpDeltaTemporality
+		}
+		return nil
+	})
+}
+
+// decodeNumberPoint decodes a NumberDataPoint
+func decodeNumberPoint(b []byte) (otlpPoint, error) {
+	point := otlpPoint{attributes: make(map[string]string)}
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error {
+		switch num {
+		case fieldPointStartTime:
+			point.start = time.Unix(0, int64(v))
+		case fieldNumberTime:
+			point.time = time.Unix(0, int64(v))
+		case fieldNumberAsDouble:
+			point.value = math.Float64frombits(v)
+		case fieldNumberAsInt:
+			point.value = float64(int64(v))
+		case fieldNumberAttributes:
+			if typ == protowire.BytesType {
+				return decodeKeyValue(data, point.attributes)
+			}
+		}
+		return nil
+	})
+
+	return point, err
+}
+
+// decodeHistogramPoint decodes a HistogramDataPoint. Repeated fields may be packed or not.
+func decodeHistogramPoint(b []byte) (otlpPoint, error) {
+	point := otlpPoint{attributes: make(map[string]string)}
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error {
+		switch num {
+		case fieldPointStartTime:
+			point.start = time.Unix(0, int64(v))
+		case fieldHistogramTime:
+			point.time = time.Unix(0, int64(v))
+		case fieldHistogramCount:
+			point.count = float64(v)
+		case fieldHistogramSum:
+			point.sum = math.Float64frombits(v)
+		case fieldHistogramBuckets:
+			return appendFixed64(&point.buckets, typ, data, v, func(u uint64) float64 { return float64(u) })
+		case fieldHistogramBounds:
+			return appendFixed64(&point.bounds, typ, data, v, math.Float64frombits)
+		case fieldHistogramAttributes:
+			if typ == protowire.BytesType {
+				return decodeKeyValue(data, point.attributes)
+			}
+		}
+		return nil
+	})
+
+	return point, err
+}
+
+// appendFixed64 appends a packed or unpacked repeated fixed64 or double field
+func appendFixed64(dst *[]float64, typ protowire.Type, data []byte, v uint64, convert func(uint64) float64) error {
+	if typ != protowire.BytesType {
+		*dst = append(*dst, convert(v))
+		return nil
+	}
+
+	for len(data) > 0 {
+		u, n := protowire.ConsumeFixed64(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		*dst = append(*dst, convert(u))
+		data = data[n:]
+	}
+	return nil
+}
+
+// decodeKeyValue decodes an attribute with a scalar value into attributes
+func decodeKeyValue(b []byte, attributes map[string]string) error {
+	var key, value string
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+		switch num {
+		case fieldKeyValueKey:
+			key = string(data)
+		case fieldKeyValueValue:
+			return wireFields(data, func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error {
+				switch num {
+				case fieldAnyString:
+					value = string(data)
+				case fieldAnyBool:
+					value = strconv.FormatBool(v != 0)
+				case fieldAnyInt:
+					value = strconv.FormatInt(int64(v), 10)
+				case fieldAnyDouble:
+					value = formatFloat(math.Float64frombits(v))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if key != "" {
+		attributes[key] = value
+	}
+	return nil
+}
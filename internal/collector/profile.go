@@ -0,0 +1,395 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// cpuProfile is the CPU time of a pprof profile per sample label set
+type cpuProfile struct {
+	service  string // service the profile file belongs to
+	start    time.Time
+	duration time.Duration
+	samples  []profileSample
+}
+
+// profileSample is the CPU time of one pprof sample and its string labels
+type profileSample struct {
+	labels     map[string]string
+	cpuSeconds float64
+}
+
+// overlaps reports whether the profile was taken within the time range. Profiles
+// without a timestamp match any range.
+func (p *cpuProfile) overlaps(tr models.TimeRange) bool {
+	if p.start.IsZero() {
+		return true
+	}
+	return !p.start.After(tr.End) && !p.start.Add(p.duration).Before(tr.Start)
+}
+
+// ProfiledSource adds the CPU time sampled by pprof profiles to the endpoints of
+// the snapshots collected by another source, for the profile allocation method
+type ProfiledSource struct {
+	source   MetricsSource
+	profiles []*cpuProfile
+	label    string
+	logger   *logrus.Logger
+}
+
+// NewProfiledSource loads the configured CPU profiles and wraps source
+func NewProfiledSource(source MetricsSource, cfg *config.ProfilesConfig, logger *logrus.Logger) (*ProfiledSource, error) {
+	files, err := listProfiles(cfg.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &ProfiledSource{
+		source: source,
+		label:  cfg.EndpointLabel,
+		logger: logger,
+	}
+	if ps.label == "" {
+		ps.label = "endpoint"
+	}
+
+	for _, file := range files {
+		profile, err := loadProfile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading profile %s: %w", file.path, err)
+		}
+		profile.service = file.service
+		ps.profiles = append(ps.profiles, profile)
+	}
+
+	logger.Debugf("Loaded %d CPU profiles", len(ps.profiles))
+	return ps, nil
+}
+
+// Name returns the name of the metrics source
+func (ps *ProfiledSource) Name() string {
+	return ps.source.Name() + " with profiles"
+}
+
+// CollectMetrics collects metrics from the wrapped source and attributes the
+// profiled CPU time to endpoints
+func (ps *ProfiledSource) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	snapshot, err := ps.source.CollectMetrics(ctx, services, timeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := ps.selectProfiles(snapshot.TimeRange)
+	ps.attribute(snapshot, profiles)
+	for _, env := range snapshot.Environments {
+		ps.attribute(env, profiles)
+	}
+
+	return snapshot, nil
+}
+
+// selectProfiles returns the profiles taken within the time range, or all
+// profiles when none were
+func (ps *ProfiledSource) selectProfiles(tr models.TimeRange) []*cpuProfile {
+	selected := make([]*cpuProfile, 0, len(ps.profiles))
+	for _, p := range ps.profiles {
+		if p.overlaps(tr) {
+			selected = append(selected, p)
+		}
+	}
+
+	if len(selected) == 0 && len(ps.profiles) > 0 {
+		ps.logger.Info("No CPU profiles were taken in the collected time range, using all profiles")
+		return ps.profiles
+	}
+	return selected
+}
+
+// attribute adds the CPU time of every sample to its service and, if labelled,
+// to the matching endpoints. CPU time of a label that matches several endpoints
+// (a path without method) is split evenly between them.
+func (ps *ProfiledSource) attribute(snapshot *models.MetricsSnapshot, profiles []*cpuProfile) {
+	labelled := make(map[string]float64)
+
+	for _, p := range profiles {
+		for _, sample := range p.samples {
+			service := firstAttribute(sample.labels, "service", "service_name")
+			if service == "" {
+				service = p.service
+			}
+			sm, exists := snapshot.GetServiceMetrics(service)
+			if !exists {
+				continue
+			}
+			sm.ProfileCPUSeconds += sample.cpuSeconds
+
+			endpoints := profileEndpoints(sm, sample.labels[ps.label], sample.labels["method"])
+			for _, em := range endpoints {
+				em.ProfileCPUSeconds += sample.cpuSeconds / float64(len(endpoints))
+			}
+			if len(endpoints) > 0 {
+				labelled[service] += sample.cpuSeconds
+			}
+		}
+	}
+
+	for _, sm := range snapshot.Services {
+		if sm.ProfileCPUSeconds > 0 {
+			ps.logger.Debugf("Profiles attribute %.0f%% of the sampled CPU of %s to endpoints",
+				labelled[sm.ServiceName]/sm.ProfileCPUSeconds*100, sm.ServiceName)
+		}
+	}
+}
+
+// profileEndpoints returns the endpoints named by an endpoint label, written as a
+// path or as "METHOD path"
+func profileEndpoints(sm *models.ServiceMetrics, value, method string) []*models.EndpointMetrics {
+	if value == "" {
+		return nil
+	}
+	if m, path, ok := strings.Cut(value, " "); ok {
+		method, value = m, strings.TrimSpace(path)
+	}
+
+	endpoints := make([]*models.EndpointMetrics, 0, 1)
+	for _, em := range sm.Endpoints {
+		if em.Endpoint == value && (method == "" || strings.EqualFold(em.Method, method)) {
+			endpoints = append(endpoints, em)
+		}
+	}
+	return endpoints
+}
+
+// profileFile is a profile and the service its location names
+type profileFile struct {
+	path    string
+	service string
+}
+
+// listProfiles expands the configured paths into profile files. A directory holds
+// profiles named after their service (checkout.cpu.pb.gz) or one subdirectory per
+// service.
+func listProfiles(paths []string) ([]profileFile, error) {
+	files := make([]profileFile, 0)
+	serviceOf := func(name string) string {
+		service, _, _ := strings.Cut(name, ".")
+		return service
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading profile path: %w", err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, profileFile{path: path, service: serviceOf(filepath.Base(path))})
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading profile directory: %w", err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if !entry.IsDir() {
+				files = append(files, profileFile{path: filepath.Join(path, entry.Name()), service: serviceOf(entry.Name())})
+				continue
+			}
+
+			dir := filepath.Join(path, entry.Name())
+			subEntries, err := os.ReadDir(dir)
+			if err != nil {
+				return nil, fmt.Errorf("error reading profile directory: %w", err)
+			}
+			for _, sub := range subEntries {
+				if !sub.IsDir() && !strings.HasPrefix(sub.Name(), ".") {
+					files = append(files, profileFile{path: filepath.Join(dir, sub.Name()), service: entry.Name()})
+				}
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// loadProfile reads a pprof profile, gzip-compressed or not
+func loadProfile(path string) (*cpuProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		if data, err = io.ReadAll(gz); err != nil {
+			return nil, err
+		}
+	}
+
+	return decodeProfile(data)
+}
+
+// pprof protobuf field numbers, from github.com/google/pprof/proto/profile.proto
+const (
+	fieldProfileSampleType  = 1
+	fieldProfileSample      = 2
+	fieldProfileStringTable = 6
+	fieldProfileTimeNanos   = 9
+	fieldProfileDuration    = 10
+
+	fieldValueTypeType = 1
+	fieldValueTypeUnit = 2
+
+	fieldSampleValue = 2
+	fieldSampleLabel = 3
+
+	fieldLabelKey = 1
+	fieldLabelStr = 2
+)
+
+// decodeProfile decodes the CPU time and string labels of every sample of a pprof profile
+func decodeProfile(b []byte) (*cpuProfile, error) {
+	var (
+		table       []string
+		sampleTypes [][2]uint64 // type and unit string indexes
+		rawSamples  [][]byte
+		profile     = &cpuProfile{}
+	)
+
+	err := wireFields(b, func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error {
+		switch num {
+		case fieldProfileSampleType:
+			var st [2]uint64
+			err := wireFields(data, func(num protowire.Number, _ protowire.Type, _ []byte, v uint64) error {
+				switch num {
+				case fieldValueTypeType:
+					st[0] = v
+				case fieldValueTypeUnit:
+					st[1] = v
+				}
+				return nil
+			})
+			sampleTypes = append(sampleTypes, st)
+			return err
+		case fieldProfileSample:
+			rawSamples = append(rawSamples, data)
+		case fieldProfileStringTable:
+			table = append(table, string(data))
+		case fieldProfileTimeNanos:
+			if v > 0 {
+				profile.start = time.Unix(0, int64(v))
+			}
+		case fieldProfileDuration:
+			profile.duration = time.Duration(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding pprof profile: %w", err)
+	}
+
+	str := func(i uint64) string {
+		if i < uint64(len(table)) {
+			return table[i]
+		}
+		return ""
+	}
+
+	valueIndex, scale := -1, 0.0
+	for i, st := range sampleTypes {
+		if str(st[0]) == "cpu" {
+			valueIndex, scale = i, secondsPerUnit(profileUnit(str(st[1])))
+		}
+	}
+	if valueIndex < 0 {
+		return nil, fmt.Errorf("profile has no cpu sample type")
+	}
+
+	for _, raw := range rawSamples {
+		var values []uint64
+		labels := make(map[string]string)
+
+		err := wireFields(raw, func(num protowire.Number, typ protowire.Type, data []byte, v uint64) error {
+			switch num {
+			case fieldSampleValue:
+				if typ != protowire.BytesType {
+					values = append(values, v)
+					return nil
+				}
+				for len(data) > 0 {
+					value, n := protowire.ConsumeVarint(data)
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+					values = append(values, value)
+					data = data[n:]
+				}
+			case fieldSampleLabel:
+				var key, value uint64
+				err := wireFields(data, func(num protowire.Number, _ protowire.Type, _ []byte, v uint64) error {
+					switch num {
+					case fieldLabelKey:
+						key = v
+					case fieldLabelStr:
+						value = v
+					}
+					return nil
+				})
+				if err == nil && value != 0 {
+					labels[str(key)] = str(value)
+				}
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error decoding pprof sample: %w", err)
+		}
+
+		if valueIndex < len(values) {
+			profile.samples = append(profile.samples, profileSample{
+				labels:     labels,
+				cpuSeconds: float64(int64(values[valueIndex])) * scale,
+			})
+		}
+	}
+
+	return profile, nil
+}
+
+// profileUnit maps pprof unit names onto the UCUM units of secondsPerUnit
+func profileUnit(unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return "ns"
+	case "microseconds":
+		return "us"
+	case "milliseconds":
+		return "ms"
+	default:
+		return "s"
+	}
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// protoVarint appends a varint field to b
+func protoVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// buildProfile encodes a CPU profile with samples/count and cpu/nanoseconds values.
+// Each sample is given as its CPU nanoseconds and endpoint label ("" for none).
+func buildProfile(samples map[string]int64) []byte {
+	table := []string{"", "samples", "count", "cpu", "nanoseconds", "endpoint"}
+	index := func(s string) uint64 {
+		for i, t := range table {
+			if t == s {
+				return uint64(i)
+			}
+		}
+		table = append(table, s)
+		return uint64(len(table) - 1)
+	}
+
+	var b []byte
+	b = protoMessage(b, fieldProfileSampleType, protoVarint(protoVarint(nil, fieldValueTypeType, 1), fieldValueTypeUnit, 2))
+	b = protoMessage(b, fieldProfileSampleType, protoVarint(protoVarint(nil, fieldValueTypeType, 3), fieldValueTypeUnit, 4))
+
+	for endpoint, nanos := range samples {
+		var values []byte
+		values = protowire.AppendVarint(values, 1)
+		values = protowire.AppendVarint(values, uint64(nanos))
+
+		var sample []byte
+		sample = protoMessage(sample, fieldSampleValue, values)
+		if endpoint != "" {
+			label := protoVarint(protoVarint(nil, fieldLabelKey, index("endpoint")), fieldLabelStr, index(endpoint))
+			sample = protoMessage(sample, fieldSampleLabel, label)
+		}
+		b = protoMessage(b, fieldProfileSample, sample)
+	}
+
+	for _, s := range table {
+		b = protoMessage(b, fieldProfileStringTable, []byte(s))
+	}
+	return b
+}
+
+func TestProfiledSource(t *testing.T) {
+	dir := t.TempDir()
+	metrics := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,container_cpu_usage_seconds_total,service=checkout;pod=checkout-1,0
+2024-01-01T01:00:00Z,container_cpu_usage_seconds_total,service=checkout;pod=checkout-1,3600
+`)
+
+	profiles := filepath.Join(dir, "profiles")
+	if err := os.Mkdir(profiles, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(buildProfile(map[string]int64{
+		"POST /checkout": 3e9,
+		"/cart":          1e9,
+		"":               1e9,
+	}))
+	gz.Close()
+	if err := os.WriteFile(filepath.Join(profiles, "checkout.cpu.pb.gz"), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewFileSource(&config.FileSourceConfig{Paths: []string{metrics}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+	source, err := NewProfiledSource(fs, &config.ProfilesConfig{Paths: []string{profiles}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewProfiledSource failed: %v", err)
+	}
+
+	services := map[string]*models.Service{
+		"checkout": {
+			Name: "checkout",
+			Endpoints: []*models.Endpoint{
+				{Path: "/checkout", Method: "POST"},
+				{Path: "/cart", Method: "GET"},
+			},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), services, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	sm := snapshot.Services["checkout"]
+	if sm.ProfileCPUSeconds != 5 {
+		t.Errorf("Expected 5 profiled CPU seconds, got %f", sm.ProfileCPUSeconds)
+	}
+
+	tests := []struct {
+		key      string
+		expected float64
+	}{
+		{"/checkout:POST", 3},
+		{"/cart:GET", 1},
+	}
+	for _, tt := range tests {
+		if got := sm.Endpoints[tt.key].ProfileCPUSeconds; got != tt.expected {
+			t.Errorf("%s: expected %f CPU seconds, got %f", tt.key, tt.expected, got)
+		}
+	}
+}
+
+func TestDecodeProfileWithoutCPU(t *testing.T) {
+	var b []byte
+	b = protoMessage(b, fieldProfileSampleType, protoVarint(protoVarint(nil, fieldValueTypeType, 1), fieldValueTypeUnit, 2))
+	for _, s := range []string{"", "alloc_space", "bytes"} {
+		b = protoMessage(b, fieldProfileStringTable, []byte(s))
+	}
+
+	if _, err := decodeProfile(b); err == nil {
+		t.Error("Expected error for a profile without cpu samples")
+	}
+}
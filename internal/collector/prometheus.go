@@ -3,6 +3,10 @@ package collector
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/api"
@@ -16,209 +20,263 @@ import (
 
 // PrometheusCollector collects metrics from Prometheus
 type PrometheusCollector struct {
-	config *config.PrometheusConfig
-	logger *logrus.Logger
-	client v1.API
+	name       string
+	config     *config.PrometheusConfig
+	logger     *logrus.Logger
+	client     v1.API
+	scope      scope
+	resolution time.Duration
+	rpc        rpcConvention
+	edges      *edgeConvention
+	mesh       meshConvention
+	zones      bool // query the zones of services for the topology network model
+}
+
+// queryResult holds the outcome of a metricQuery
+type queryResult struct {
+	query *metricQuery
+	value model.Value
+	err   error
 }
 
 // NewPrometheusCollector creates a new Prometheus collector
 func NewPrometheusCollector(cfg *config.PrometheusConfig, logger *logrus.Logger) (*PrometheusCollector, error) {
+	roundTripper, err := newRoundTripper(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring Prometheus transport: %w", err)
+	}
+
 	client, err := api.NewClient(api.Config{
-		Address: cfg.URL,
+		Address:      cfg.URL,
+		RoundTripper: roundTripper,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating Prometheus client: %w", err)
 	}
 
 	return &PrometheusCollector{
+		name:   "prometheus",
 		config: cfg,
 		logger: logger,
 		client: v1.NewAPI(client),
+		rpc:    rpcConventions["go-grpc-prometheus"],
+		mesh:   meshConventions["istio"],
 	}, nil
 }
 
 // CollectMetrics collects metrics for all services
-func (pc *PrometheusCollector) CollectMetrics(services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
-	pc.logger.Info("Collecting metrics from Prometheus...")
+func (pc *PrometheusCollector) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	pc.logger.Infof("Collecting metrics from %s...", pc.name)
 
 	snapshot := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+	if len(services) == 0 {
+		pc.logger.Info("Metrics collection complete")
+		return snapshot, nil
+	}
 
-	for serviceName, service := range services {
-		pc.logger.Debugf("Collecting metrics for service: %s", serviceName)
-
-		serviceMetrics := &models.ServiceMetrics{
-			ServiceName: serviceName,
-			Endpoints:   make(map[string]*models.EndpointMetrics),
-			TimeRange:   timeRange,
-		}
+	serviceMetrics := newServiceMetricsIndex(services, timeRange)
 
-		// Collect metrics for each endpoint
-		for _, endpoint := range service.Endpoints {
-			endpointMetrics, err := pc.collectEndpointMetrics(serviceName, endpoint, timeRange)
-			if err != nil {
-				pc.logger.WithError(err).Warnf("Error collecting metrics for %s%s", serviceName, endpoint.Path)
-				continue
-			}
+	selector := serviceSelector(services) + pc.scope.selector()
 
-			key := fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)
-			serviceMetrics.Endpoints[key] = endpointMetrics
+	resourceResults := pc.runQueries(ctx, resourceQueries(selector, timeRange), timeRange)
+	for _, result := range pc.succeeded(resourceResults, snapshot) {
+		applyServiceValues(result.query, pc.reduce(result), serviceMetrics)
+	}
+	if pc.zones {
+		zoneResults := pc.runQueries(ctx, zoneQueries(selector), timeRange)
+		for _, result := range pc.succeeded(zoneResults, snapshot) {
+			applyZoneValues(result.query, pc.reduce(result), serviceMetrics)
 		}
+	}
 
-		// Calculate aggregate service metrics
-		serviceMetrics.Aggregate = pc.aggregateServiceMetrics(serviceMetrics.Endpoints)
-
-		snapshot.AddServiceMetrics(serviceMetrics)
+	// Endpoint metrics follow the endpoint types present: HTTP, gRPC, mesh, or several
+	hasHTTP, hasGRPC, hasMesh := endpointTypes(services)
+	if hasHTTP {
+		performanceResults := pc.runQueries(ctx, performanceQueries(selector, timeRange), timeRange)
+		for _, result := range pc.succeeded(performanceResults, snapshot) {
+			applyEndpointValues(result.query, pc.reduce(result), serviceMetrics)
+		}
+	}
+	if hasGRPC {
+		grpcResults := pc.runQueries(ctx, grpcQueries(selector, timeRange, pc.rpc), timeRange)
+		for _, result := range pc.succeeded(grpcResults, snapshot) {
+			applyEndpointValues(result.query, pc.reduce(result), serviceMetrics)
+		}
+	}
+	if hasMesh {
+		meshSelector := strings.TrimPrefix(pc.mesh.selector(services)+pc.scope.selector(), ",")
+		meshResults := pc.runQueries(ctx, meshQueries(pc.mesh, meshSelector, timeRange), timeRange)
+		for _, result := range pc.succeeded(meshResults, snapshot) {
+			applyEndpointValues(result.query, pc.reduce(result), serviceMetrics)
+		}
 	}
 
-	pc.logger.Info("Metrics collection complete")
-	return snapshot, nil
-}
+	if pc.edges != nil {
+		edgeResults := pc.runQueries(ctx, edgeQueries(pc.edges, pc.edges.selector(services)+pc.scope.selector(), timeRange), timeRange)
+		for _, result := range pc.succeeded(edgeResults, snapshot) {
+			applyEdgeValues(result.query, pc.reduce(result), pc.edges, services, snapshot)
+		}
+	}
 
-// collectEndpointMetrics collects metrics for a specific endpoint
-func (pc *PrometheusCollector) collectEndpointMetrics(service string, endpoint *models.Endpoint, timeRange models.TimeRange) (*models.EndpointMetrics, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), pc.config.Timeout)
-	defer cancel()
+	cluster := &models.ClusterMetrics{}
+	clusterResults := pc.runQueries(ctx, clusterQueries(strings.TrimPrefix(pc.scope.clusterSelector(), ",")), timeRange)
+	for _, result := range pc.succeeded(clusterResults, snapshot) {
+		applyClusterValues(result.query, pc.reduce(result), cluster)
+	}
+	snapshot.Cluster = clusterOrNil(cluster)
 
-	metrics := &models.EndpointMetrics{
-		Service:   service,
-		Endpoint:  endpoint.Path,
-		Method:    endpoint.Method,
-		TimeRange: timeRange,
+	if pc.resolution > 0 {
+		pc.collectTimeSeries(ctx, selector, timeRange, serviceMetrics, snapshot)
 	}
 
-	// Collect resource metrics
-	resourceMetrics, err := pc.collectResourceMetrics(ctx, service, endpoint, timeRange)
-	if err != nil {
-		return nil, fmt.Errorf("error collecting resource metrics: %w", err)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("error collecting metrics from %s: %w", pc.name, err)
 	}
-	metrics.Resource = resourceMetrics
 
-	// Collect performance metrics
-	perfMetrics, err := pc.collectPerformanceMetrics(ctx, service, endpoint, timeRange)
-	if err != nil {
-		return nil, fmt.Errorf("error collecting performance metrics: %w", err)
+	for _, sm := range serviceMetrics {
+		snapshot.AddServiceMetrics(sm)
 	}
-	metrics.Performance = perfMetrics
+	applyDimensions(snapshot, pc.scope.dimensions())
 
-	return metrics, nil
+	pc.logger.Info("Metrics collection complete")
+	return snapshot, nil
 }
 
-// collectResourceMetrics collects CPU, memory, and network metrics
-func (pc *PrometheusCollector) collectResourceMetrics(ctx context.Context, service string, endpoint *models.Endpoint, timeRange models.TimeRange) (*models.ResourceMetrics, error) {
-	rm := &models.ResourceMetrics{
-		Timestamp: time.Now(),
+// collectTimeSeries adds downsampled time series at the configured resolution
+func (pc *PrometheusCollector) collectTimeSeries(ctx context.Context, selector string, timeRange models.TimeRange, serviceMetrics map[string]*models.ServiceMetrics, snapshot *models.MetricsSnapshot) {
+	if len(timeBuckets(timeRange, pc.resolution)) == 0 {
+		pc.logger.Warnf("Time range is shorter than the %s resolution, skipping time series", pc.resolution)
+		return
 	}
+	snapshot.Resolution = pc.resolution
 
-	// CPU usage query
-	cpuQuery := fmt.Sprintf(`avg(rate(container_cpu_usage_seconds_total{service="%s"}[%s]))`,
-		service, pc.config.QueryInterval)
-	cpuResult, warnings, err := pc.queryRange(ctx, cpuQuery, timeRange)
-	if err == nil && cpuResult != nil {
-		if len(warnings) > 0 {
-			pc.logger.Debugf("CPU query warnings: %v", warnings)
-		}
-		rm.CPUCores = pc.avgValue(cpuResult)
+	resourceResults := pc.runQueries(ctx, resourceSeriesQueries(selector, pc.resolution), timeRange)
+	for _, result := range pc.succeeded(resourceResults, snapshot) {
+		applyServiceSeries(result.query, matrixPoints(result.value, pc.resolution, result.query.scale), serviceMetrics)
 	}
 
-	// Memory usage query
-	memQuery := fmt.Sprintf(`avg(container_memory_usage_bytes{service="%s"})`, service)
-	memResult, warnings, err := pc.queryRange(ctx, memQuery, timeRange)
-	if err == nil && memResult != nil {
-		if len(warnings) > 0 {
-			pc.logger.Debugf("Memory query warnings: %v", warnings)
-		}
-		rm.MemoryMB = pc.avgValue(memResult) / (1024 * 1024) // Convert to MB
+	performanceResults := pc.runQueries(ctx, performanceSeriesQueries(selector, pc.resolution), timeRange)
+	for _, result := range pc.succeeded(performanceResults, snapshot) {
+		applyEndpointSeries(result.query, matrixPoints(result.value, pc.resolution, result.query.scale), serviceMetrics)
 	}
+}
 
-	// Network in query
-	netInQuery := fmt.Sprintf(`sum(rate(container_network_receive_bytes_total{service="%s"}[%s]))`,
-		service, pc.config.QueryInterval)
-	netInResult, warnings, err := pc.queryRange(ctx, netInQuery, timeRange)
-	if err == nil && netInResult != nil {
-		if len(warnings) > 0 {
-			pc.logger.Debugf("Network in query warnings: %v", warnings)
+// succeeded records the status of every query on the snapshot and returns the
+// results of the queries that did not fail
+func (pc *PrometheusCollector) succeeded(results []queryResult, snapshot *models.MetricsSnapshot) []queryResult {
+	ok := make([]queryResult, 0, len(results))
+	for _, result := range results {
+		if result.err != nil {
+			pc.logger.WithError(result.err).Debugf("Error querying %s", statusKey(result.query))
+			snapshot.RecordStatus(statusKey(result.query), queryStatus(0, result.err))
+			continue
 		}
-		rm.NetworkInMB = pc.avgValue(netInResult) / (1024 * 1024) // Convert to MB
-	}
 
-	// Network out query
-	netOutQuery := fmt.Sprintf(`sum(rate(container_network_transmit_bytes_total{service="%s"}[%s]))`,
-		service, pc.config.QueryInterval)
-	netOutResult, warnings, err := pc.queryRange(ctx, netOutQuery, timeRange)
-	if err == nil && netOutResult != nil {
-		if len(warnings) > 0 {
-			pc.logger.Debugf("Network out query warnings: %v", warnings)
-		}
-		rm.NetworkOutMB = pc.avgValue(netOutResult) / (1024 * 1024) // Convert to MB
+		snapshot.RecordStatus(statusKey(result.query), queryStatus(seriesCount(result.value), nil))
+		ok = append(ok, result)
 	}
+	return ok
+}
 
-	return rm, nil
+// Name returns the name of the metrics source
+func (pc *PrometheusCollector) Name() string {
+	return pc.name
 }
 
-// collectPerformanceMetrics collects request rate, latency, and error metrics
-func (pc *PrometheusCollector) collectPerformanceMetrics(ctx context.Context, service string, endpoint *models.Endpoint, timeRange models.TimeRange) (*models.PerformanceMetrics, error) {
-	pm := &models.PerformanceMetrics{
-		Timestamp: time.Now(),
+// reduce converts a query result into one value per series
+func (pc *PrometheusCollector) reduce(result queryResult) []seriesValue {
+	if result.query.kind == integralQuery {
+		return seriesIntegrals(result.value, pc.config.QueryInterval)
 	}
+	return instantValues(result.value)
+}
 
-	// Request rate query
-	rateQuery := fmt.Sprintf(`sum(rate(http_requests_total{service="%s",endpoint="%s"}[%s]))`,
-		service, endpoint.Path, pc.config.QueryInterval)
-	rateResult, _, err := pc.queryRange(ctx, rateQuery, timeRange)
-	if err == nil && rateResult != nil {
-		pm.RequestRate = pc.avgValue(rateResult)
+// runQueries executes queries concurrently using a bounded worker pool
+func (pc *PrometheusCollector) runQueries(ctx context.Context, queries []*metricQuery, timeRange models.TimeRange) []queryResult {
+	workers := pc.config.MaxConcurrency
+	if workers < 1 {
+		workers = 1
 	}
 
-	// Error rate query
-	errorQuery := fmt.Sprintf(`sum(rate(http_requests_total{service="%s",endpoint="%s",status=~"5.."}[%s]))`,
-		service, endpoint.Path, pc.config.QueryInterval)
-	errorResult, _, err := pc.queryRange(ctx, errorQuery, timeRange)
-	if err == nil && errorResult != nil {
-		pm.ErrorRate = pc.avgValue(errorResult)
+	results := make([]queryResult, len(queries))
+	jobs := make(chan int)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for w := 0; w < workers && w < len(queries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				value, err := pc.queryWithRetry(ctx, queries[i], timeRange)
+				results[i] = queryResult{query: queries[i], value: value, err: err}
+
+				mu.Lock()
+				done++
+				pc.logger.Debugf("Queried %s from %s (%d/%d)", statusKey(queries[i]), pc.name, done, len(queries))
+				mu.Unlock()
+			}
+		}()
 	}
 
-	// Latency metrics
-	latencyQuery := fmt.Sprintf(`histogram_quantile(0.50, rate(http_request_duration_seconds_bucket{service="%s",endpoint="%s"}[%s]))`,
-		service, endpoint.Path, pc.config.QueryInterval)
-	p50Result, _, err := pc.queryRange(ctx, latencyQuery, timeRange)
-	if err == nil && p50Result != nil {
-		pm.LatencyP50 = time.Duration(pc.avgValue(p50Result) * float64(time.Second))
+	for i := range queries {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
 
-	latencyP95Query := fmt.Sprintf(`histogram_quantile(0.95, rate(http_request_duration_seconds_bucket{service="%s",endpoint="%s"}[%s]))`,
-		service, endpoint.Path, pc.config.QueryInterval)
-	p95Result, _, err := pc.queryRange(ctx, latencyP95Query, timeRange)
-	if err == nil && p95Result != nil {
-		pm.LatencyP95 = time.Duration(pc.avgValue(p95Result) * float64(time.Second))
-	}
+	return results
+}
 
-	latencyP99Query := fmt.Sprintf(`histogram_quantile(0.99, rate(http_request_duration_seconds_bucket{service="%s",endpoint="%s"}[%s]))`,
-		service, endpoint.Path, pc.config.QueryInterval)
-	p99Result, _, err := pc.queryRange(ctx, latencyP99Query, timeRange)
-	if err == nil && p99Result != nil {
-		pm.LatencyP99 = time.Duration(pc.avgValue(p99Result) * float64(time.Second))
-	}
+// queryWithRetry executes a query, retrying with exponential backoff on failure
+func (pc *PrometheusCollector) queryWithRetry(ctx context.Context, mq *metricQuery, timeRange models.TimeRange) (model.Value, error) {
+	backoff := pc.config.RetryBackoff
+	var lastErr error
+
+	for attempt := 0; attempt <= pc.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			pc.logger.Debugf("Retrying %s query (attempt %d): %v", mq.name, attempt+1, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("query %s cancelled: %w", mq.name, ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
 
-	// Average latency
-	avgQuery := fmt.Sprintf(`avg(rate(http_request_duration_seconds_sum{service="%s",endpoint="%s"}[%s]) / rate(http_request_duration_seconds_count{service="%s",endpoint="%s"}[%s]))`,
-		service, endpoint.Path, pc.config.QueryInterval, service, endpoint.Path, pc.config.QueryInterval)
-	avgResult, _, err := pc.queryRange(ctx, avgQuery, timeRange)
-	if err == nil && avgResult != nil {
-		pm.LatencyAvg = time.Duration(pc.avgValue(avgResult) * float64(time.Second))
+		queryCtx, cancel := context.WithTimeout(ctx, pc.config.Timeout)
+		result, warnings, err := pc.query(queryCtx, mq, timeRange)
+		cancel()
+
+		if len(warnings) > 0 {
+			pc.logger.Debugf("%s query warnings: %v", mq.name, warnings)
+		}
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("query %s cancelled: %w", mq.name, ctx.Err())
+		}
+		lastErr = err
 	}
 
-	return pm, nil
+	return nil, fmt.Errorf("query %s failed after %d attempts: %w", mq.name, pc.config.MaxRetries+1, lastErr)
 }
 
-// queryRange executes a range query against Prometheus
-func (pc *PrometheusCollector) queryRange(ctx context.Context, query string, timeRange models.TimeRange) (model.Value, []string, error) {
-	r := v1.Range{
-		Start: timeRange.Start,
-		End:   timeRange.End,
-		Step:  pc.config.QueryInterval,
+// query evaluates a metric query according to its kind
+func (pc *PrometheusCollector) query(ctx context.Context, mq *metricQuery, timeRange models.TimeRange) (model.Value, []string, error) {
+	switch mq.kind {
+	case integralQuery:
+		return pc.queryRange(ctx, mq.query, v1.Range{Start: timeRange.Start, End: timeRange.End, Step: pc.config.QueryInterval})
+	case bucketQuery:
+		// Each point covers the bucket ending at it, so the first point is one step in
+		return pc.queryRange(ctx, mq.query, v1.Range{Start: timeRange.Start.Add(pc.resolution), End: timeRange.End, Step: pc.resolution})
 	}
 
-	result, warnings, err := pc.client.QueryRange(ctx, query, r)
+	result, warnings, err := pc.client.Query(ctx, mq.query, timeRange.End)
 	if err != nil {
 		return nil, warnings, err
 	}
@@ -226,54 +284,24 @@ func (pc *PrometheusCollector) queryRange(ctx context.Context, query string, tim
 	return result, warnings, nil
 }
 
-// avgValue calculates the average value from a Prometheus result
-func (pc *PrometheusCollector) avgValue(value model.Value) float64 {
-	if value == nil {
-		return 0.0
-	}
-
-	matrix, ok := value.(model.Matrix)
-	if !ok {
-		return 0.0
-	}
-
-	if len(matrix) == 0 {
-		return 0.0
-	}
-
-	sum := 0.0
-	count := 0
-
-	for _, stream := range matrix {
-		for _, sample := range stream.Values {
-			sum += float64(sample.Value)
-			count++
-		}
-	}
-
-	if count == 0 {
-		return 0.0
+// queryRange executes a range query against Prometheus
+func (pc *PrometheusCollector) queryRange(ctx context.Context, query string, r v1.Range) (model.Value, []string, error) {
+	result, warnings, err := pc.client.QueryRange(ctx, query, r)
+	if err != nil {
+		return nil, warnings, err
 	}
 
-	return sum / float64(count)
+	return result, warnings, nil
 }
 
-// aggregateServiceMetrics aggregates endpoint metrics to service level
-func (pc *PrometheusCollector) aggregateServiceMetrics(endpoints map[string]*models.EndpointMetrics) *models.ResourceMetrics {
-	aggregate := &models.ResourceMetrics{
-		Timestamp: time.Now(),
-	}
-
-	for _, em := range endpoints {
-		if em.Resource != nil {
-			aggregate.CPUCores += em.Resource.CPUCores
-			aggregate.MemoryMB += em.Resource.MemoryMB
-			aggregate.NetworkInMB += em.Resource.NetworkInMB
-			aggregate.NetworkOutMB += em.Resource.NetworkOutMB
-			aggregate.DiskReadMB += em.Resource.DiskReadMB
-			aggregate.DiskWriteMB += em.Resource.DiskWriteMB
-		}
+// serviceSelector builds a label matcher restricting queries to the given services
+func serviceSelector(services map[string]*models.Service) string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		// Backslashes from QuoteMeta must themselves be escaped inside a PromQL string
+		names = append(names, strings.ReplaceAll(regexp.QuoteMeta(name), `\`, `\\`))
 	}
+	sort.Strings(names)
 
-	return aggregate
+	return fmt.Sprintf(`service=~"%s"`, strings.Join(names, "|"))
 }
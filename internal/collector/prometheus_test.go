@@ -0,0 +1,353 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// newFakePrometheus answers CPU and request queries for the checkout service and
+// returns empty results for everything else
+func newFakePrometheus(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse query: %v", err)
+		}
+		query := r.Form.Get("query")
+		w.Header().Set("Content-Type", "application/json")
+
+		var result string
+		switch {
+		case strings.HasSuffix(r.URL.Path, "query_range"):
+			result = `{"resultType":"matrix","result":[]}`
+		case strings.Contains(query, "container_cpu_usage_seconds_total"):
+			result = `{"resultType":"vector","result":[{"metric":{"service":"checkout","pod":"a"},"value":[1700000000,"3600"]}]}`
+		case strings.Contains(query, "http_requests_total") && !strings.Contains(query, "5.."):
+			result = `{"resultType":"vector","result":[{"metric":{"service":"checkout","endpoint":"/checkout","method":"POST"},"value":[1700000000,"100"]}]}`
+		default:
+			result = `{"resultType":"vector","result":[]}`
+		}
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, result)
+	}))
+}
+
+func newTestPrometheusConfig(url string) config.PrometheusConfig {
+	cfg := config.DefaultConfig().Prometheus
+	cfg.URL = url
+	cfg.MaxRetries = 0
+	return cfg
+}
+
+func collectFrom(t *testing.T, cfg config.PrometheusConfig, timeRange models.TimeRange) *models.MetricsSnapshot {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	pc, err := NewPrometheusCollector(&cfg, logger)
+	if err != nil {
+		t.Fatalf("NewPrometheusCollector failed: %v", err)
+	}
+
+	snapshot, err := pc.CollectMetrics(context.Background(), newTestServices(), timeRange)
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+	return snapshot
+}
+
+func assertCheckoutMetrics(t *testing.T, snapshot *models.MetricsSnapshot) {
+	t.Helper()
+
+	sm := snapshot.Services["checkout"]
+	if sm.Aggregate.CPUCoreHours != 1 {
+		t.Errorf("Expected 1 CPU core-hour, got %f", sm.Aggregate.CPUCoreHours)
+	}
+	if count := sm.Endpoints["/checkout:POST"].Performance.RequestCount; count != 100 {
+		t.Errorf("Expected 100 requests, got %f", count)
+	}
+
+	if status := snapshot.Status["cpu"]; status.State != models.MetricOK {
+		t.Errorf("Expected cpu status ok, got %+v", status)
+	}
+	if status := snapshot.Status["memory"]; status.State != models.MetricEmpty {
+		t.Errorf("Expected memory status empty, got %+v", status)
+	}
+}
+
+func TestPrometheusCollectorRecordAndReplay(t *testing.T) {
+	var calls int32
+	upstream := newFakePrometheus(t, &calls)
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cfg := newTestPrometheusConfig(upstream.URL)
+	cfg.RecordDir = dir
+	assertCheckoutMetrics(t, collectFrom(t, cfg, models.TimeRange{Start: start, End: start.Add(time.Hour)}))
+
+	recorded := atomic.LoadInt32(&calls)
+	if recorded == 0 {
+		t.Fatal("Expected queries to reach the upstream server")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	replay, err := NewReplayServer(dir, logger)
+	if err != nil {
+		t.Fatalf("NewReplayServer failed: %v", err)
+	}
+	defer replay.Close()
+
+	// Fixtures replay for any time range of the same duration
+	later := start.Add(24 * time.Hour)
+	assertCheckoutMetrics(t, collectFrom(t, newTestPrometheusConfig(replay.URL()), models.TimeRange{Start: later, End: later.Add(time.Hour)}))
+
+	if atomic.LoadInt32(&calls) != recorded {
+		t.Errorf("Expected replay not to reach the upstream server, got %d extra queries", atomic.LoadInt32(&calls)-recorded)
+	}
+}
+
+func TestZonesFollowNetworkModel(t *testing.T) {
+	var calls int32
+	server := newFakePrometheus(t, &calls)
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	end := time.Now()
+	timeRange := models.TimeRange{Start: end.Add(-time.Hour), End: end}
+
+	for _, model := range []string{"flat", "topology"} {
+		cfg := config.DefaultConfig()
+		cfg.Prometheus = newTestPrometheusConfig(server.URL)
+		cfg.CostModel.Network.Model = model
+
+		source, err := NewMetricsSource(cfg, logger)
+		if err != nil {
+			t.Fatalf("NewMetricsSource failed: %v", err)
+		}
+		snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), timeRange)
+		if err != nil {
+			t.Fatalf("CollectMetrics failed: %v", err)
+		}
+
+		// Zones are only queried when the network model prices them
+		_, queried := snapshot.Status["zones"]
+		if queried != (model == "topology") {
+			t.Errorf("Expected zones queried %v with the %s network model, got %v", model == "topology", model, queried)
+		}
+	}
+}
+
+func TestPrometheusCollectorQueryErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := collectFrom(t, newTestPrometheusConfig(server.URL), models.TimeRange{Start: start, End: start.Add(time.Hour)})
+
+	if failed := snapshot.FailedMetrics(); len(failed) != len(snapshot.Status) || len(failed) == 0 {
+		t.Errorf("Expected every metric to fail, got %d of %d", len(failed), len(snapshot.Status))
+	}
+
+	if cpu := snapshot.Services["checkout"].Aggregate.CPUCoreHours; cpu != 0 {
+		t.Errorf("Expected no CPU data, got %f", cpu)
+	}
+}
+
+func TestQueryWithRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"status":"error","errorType":"unavailable","error":"overloaded"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	defer server.Close()
+
+	cfg := newTestPrometheusConfig(server.URL)
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = time.Millisecond
+	pc, err := NewPrometheusCollector(&cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("NewPrometheusCollector failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mq := &metricQuery{name: "up", kind: instantQuery, query: "up"}
+	if _, err := pc.queryWithRetry(context.Background(), mq, models.TimeRange{Start: start, End: start.Add(time.Hour)}); err != nil {
+		t.Errorf("Expected the retry to succeed, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 attempts, got %d", got)
+	}
+}
+
+func TestQueryWithRetryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"status":"error","errorType":"unavailable","error":"overloaded"}`)
+	}))
+	defer server.Close()
+
+	cfg := newTestPrometheusConfig(server.URL)
+	cfg.MaxRetries = 5
+	cfg.RetryBackoff = time.Hour
+	pc, err := NewPrometheusCollector(&cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("NewPrometheusCollector failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	began := time.Now()
+	mq := &metricQuery{name: "up", kind: instantQuery, query: "up"}
+	_, err = pc.queryWithRetry(ctx, mq, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(began); elapsed > 5*time.Second {
+		t.Errorf("Expected cancellation to interrupt the backoff, took %s", elapsed)
+	}
+}
+
+func TestRunQueriesBoundsConcurrency(t *testing.T) {
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	defer server.Close()
+
+	cfg := newTestPrometheusConfig(server.URL)
+	cfg.MaxConcurrency = 2
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	pc, err := NewPrometheusCollector(&cfg, logger)
+	if err != nil {
+		t.Fatalf("NewPrometheusCollector failed: %v", err)
+	}
+
+	queries := make([]*metricQuery, 8)
+	for i := range queries {
+		queries[i] = &metricQuery{name: fmt.Sprintf("q%d", i), kind: instantQuery, query: "up"}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := pc.runQueries(context.Background(), queries, models.TimeRange{Start: start, End: start.Add(time.Hour)})
+
+	for i, result := range results {
+		if result.query != queries[i] || result.err != nil {
+			t.Errorf("Expected result %d for %s without error, got %s: %v", i, queries[i].name, result.query.name, result.err)
+		}
+	}
+	if got := atomic.LoadInt32(&peak); got > 2 {
+		t.Errorf("Expected at most 2 concurrent queries, got %d", got)
+	}
+}
+
+func TestFederatedRecordAndReplay(t *testing.T) {
+	var calls int32
+	eu := newFakePrometheus(t, &calls)
+	defer eu.Close()
+	us := newFakePrometheus(t, &calls)
+	defer us.Close()
+
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeRange := models.TimeRange{Start: start, End: start.Add(time.Hour)}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	newConfig := func() *config.Config {
+		cfg := config.DefaultConfig()
+		cfg.Prometheus = newTestPrometheusConfig(eu.URL)
+		cfg.MetricsSource.Type = "federated"
+		cfg.MetricsSource.Federated = []config.FederatedMemberConfig{
+			{Name: "eu", URL: eu.URL},
+			{Name: "us", URL: us.URL},
+		}
+		return cfg
+	}
+	collect := func(cfg *config.Config) *models.MetricsSnapshot {
+		t.Helper()
+		source, err := NewMetricsSource(cfg, logger)
+		if err != nil {
+			t.Fatalf("NewMetricsSource failed: %v", err)
+		}
+		snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), timeRange)
+		if err != nil {
+			t.Fatalf("CollectMetrics failed: %v", err)
+		}
+		return snapshot
+	}
+
+	recordCfg := newConfig()
+	recordCfg.Prometheus.RecordDir = dir
+	recorded := collect(recordCfg)
+	upstreamCalls := atomic.LoadInt32(&calls)
+
+	replay, err := NewReplayServer(dir, logger)
+	if err != nil {
+		t.Fatalf("NewReplayServer failed: %v", err)
+	}
+	defer replay.Close()
+
+	replayCfg := newConfig()
+	replay.Configure(replayCfg)
+	if replayCfg.MetricsSource.Type != "federated" {
+		t.Errorf("Expected replay to keep the federated source, got %s", replayCfg.MetricsSource.Type)
+	}
+	replayed := collect(replayCfg)
+
+	if atomic.LoadInt32(&calls) != upstreamCalls {
+		t.Errorf("Expected replay not to reach the upstream servers, got %d extra queries", atomic.LoadInt32(&calls)-upstreamCalls)
+	}
+
+	// Both members replay their own recording and are merged again
+	for name, snapshot := range map[string]*models.MetricsSnapshot{"recorded": recorded, "replayed": replayed} {
+		sm := snapshot.Services["checkout"]
+		if sm.Aggregate.CPUCoreHours != 2 {
+			t.Errorf("Expected %s CPU of both members, 2 core-hours, got %f", name, sm.Aggregate.CPUCoreHours)
+		}
+		if count := sm.Endpoints["/checkout:POST"].Performance.RequestCount; count != 200 {
+			t.Errorf("Expected %s requests of both members, 200, got %f", name, count)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+const (
+	bytesPerMB = 1024 * 1024
+	bytesPerGB = 1024 * 1024 * 1024
+)
+
+// queryKind determines how a metric query is evaluated and reduced
+type queryKind int
+
+const (
+	// instantQuery evaluates the expression once at the end of the time range.
+	// Counters use increase() over the whole window so the result is an exact total.
+	instantQuery queryKind = iota
+	// integralQuery evaluates a gauge as a range query and integrates each
+	// series over time, yielding value-seconds
+	integralQuery
+	// bucketQuery evaluates the expression as a range query with one point per
+	// time bucket, each covering the bucket that ends at the point
+	bucketQuery
+)
+
+// metricQuery is a single fleet-wide PromQL query whose result is fanned out
+// to every service, endpoint or edge matching the series labels. Exactly one of
+// service, endpoint, cluster or edge is set, depending on the query's grouping;
+// zone queries set none and keep their series as they are.
+type metricQuery struct {
+	name     string
+	kind     queryKind
+	query    string
+	service  func(target *models.ResourceMetrics, value float64)
+	endpoint func(target *models.EndpointMetrics, value float64)
+	cluster  func(target *models.ClusterMetrics, value float64)
+	edge     func(target *models.EdgeMetrics, value float64)
+	scale    float64 // converts bucket query points to time series units
+	// match selects the endpoints a series applies to; nil matches HTTP endpoints
+	// by path and method
+	match func(target *models.EndpointMetrics, labels model.Metric) bool
+}
+
+// matchesEndpoint reports whether a series of an endpoint query applies to an
+// endpoint. Series without a method label apply to every method of the path.
+func (mq *metricQuery) matchesEndpoint(em *models.EndpointMetrics, labels model.Metric) bool {
+	if mq.match != nil {
+		return mq.match(em, labels)
+	}
+	if em.Type == models.EndpointGRPC || em.Type == models.EndpointMesh || em.Endpoint != string(labels["endpoint"]) {
+		return false
+	}
+
+	method := string(labels["method"])
+	return method == "" || strings.EqualFold(em.Method, method)
+}
+
+// resourceQueries returns the per-service CPU, memory, and network usage queries,
+// and the resource requests, limits and replica counts from kube-state-metrics.
+// Series are grouped by pod so each service keeps a per-pod breakdown.
+func resourceQueries(selector string, timeRange models.TimeRange) []*metricQuery {
+	window := promDuration(timeRange.Duration())
+	windowSeconds := timeRange.Duration().Seconds()
+	by := "service, pod"
+
+	return []*metricQuery{
+		{
+			name:  "cpu",
+			kind:  instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(container_cpu_usage_seconds_total{%s}[%s]))`, by, selector, window),
+			service: func(rm *models.ResourceMetrics, coreSeconds float64) {
+				rm.CPUCoreHours = coreSeconds / 3600
+				rm.CPUCores = coreSeconds / windowSeconds
+			},
+		},
+		{
+			name:  "memory",
+			kind:  integralQuery,
+			query: fmt.Sprintf(`sum by (%s) (container_memory_usage_bytes{%s})`, by, selector),
+			service: func(rm *models.ResourceMetrics, byteSeconds float64) {
+				rm.MemoryGBHours = byteSeconds / bytesPerGB / 3600
+				rm.MemoryMB = byteSeconds / windowSeconds / bytesPerMB
+			},
+		},
+		{
+			name:    "network_in",
+			kind:    instantQuery,
+			query:   fmt.Sprintf(`sum by (%s) (increase(container_network_receive_bytes_total{%s}[%s]))`, by, selector, window),
+			service: func(rm *models.ResourceMetrics, v float64) { rm.NetworkInMB = v / bytesPerMB },
+		},
+		{
+			name:    "network_out",
+			kind:    instantQuery,
+			query:   fmt.Sprintf(`sum by (%s) (increase(container_network_transmit_bytes_total{%s}[%s]))`, by, selector, window),
+			service: func(rm *models.ResourceMetrics, v float64) { rm.NetworkOutMB = v / bytesPerMB },
+		},
+		{
+			name:  "cpu_request",
+			kind:  integralQuery,
+			query: fmt.Sprintf(`sum by (%s) (kube_pod_container_resource_requests{%s,resource="cpu"})`, by, selector),
+			service: func(rm *models.ResourceMetrics, coreSeconds float64) {
+				rm.CPURequestCoreHours = coreSeconds / 3600
+				rm.CPURequestCores = coreSeconds / windowSeconds
+			},
+		},
+		{
+			name:  "memory_request",
+			kind:  integralQuery,
+			query: fmt.Sprintf(`sum by (%s) (kube_pod_container_resource_requests{%s,resource="memory"})`, by, selector),
+			service: func(rm *models.ResourceMetrics, byteSeconds float64) {
+				rm.MemoryRequestGBHours = byteSeconds / bytesPerGB / 3600
+				rm.MemoryRequestMB = byteSeconds / windowSeconds / bytesPerMB
+			},
+		},
+		{
+			name:    "cpu_limit",
+			kind:    integralQuery,
+			query:   fmt.Sprintf(`sum by (%s) (kube_pod_container_resource_limits{%s,resource="cpu"})`, by, selector),
+			service: func(rm *models.ResourceMetrics, coreSeconds float64) { rm.CPULimitCores = coreSeconds / windowSeconds },
+		},
+		{
+			name:  "memory_limit",
+			kind:  integralQuery,
+			query: fmt.Sprintf(`sum by (%s) (kube_pod_container_resource_limits{%s,resource="memory"})`, by, selector),
+			service: func(rm *models.ResourceMetrics, byteSeconds float64) {
+				rm.MemoryLimitMB = byteSeconds / windowSeconds / bytesPerMB
+			},
+		},
+		{
+			name:    "replicas",
+			kind:    integralQuery,
+			query:   fmt.Sprintf(`sum by (service) (kube_pod_status_phase{%s,phase="Running"})`, selector),
+			service: func(rm *models.ResourceMetrics, podSeconds float64) { rm.Replicas = podSeconds / windowSeconds },
+		},
+	}
+}
+
+// zoneQueries returns the pod-seconds of every service per zone and region of
+// the pods' nodes, for the topology network model. Needs kube-state-metrics to
+// export the topology node labels (--metric-labels-allowlist).
+func zoneQueries(selector string) []*metricQuery {
+	return []*metricQuery{
+		{
+			name: "zones",
+			kind: integralQuery,
+			query: fmt.Sprintf(`sum by (service, zone, region) (kube_pod_info{%s} * on (node) group_left (zone, region) `+
+				`label_replace(label_replace(max by (node, label_topology_kubernetes_io_zone, label_topology_kubernetes_io_region) (kube_node_labels), `+
+				`"zone", "$1", "label_topology_kubernetes_io_zone", "(.+)"), "region", "$1", "label_topology_kubernetes_io_region", "(.+)"))`, selector),
+		},
+	}
+}
+
+// performanceQueries returns the per-endpoint request, error, and latency queries
+func performanceQueries(selector string, timeRange models.TimeRange) []*metricQuery {
+	window := promDuration(timeRange.Duration())
+	windowSeconds := timeRange.Duration().Seconds()
+	by := "service, endpoint, method"
+
+	quantile := func(q float64) string {
+		return fmt.Sprintf(`histogram_quantile(%.2f, sum by (%s, le) (increase(http_request_duration_seconds_bucket{%s}[%s])))`,
+			q, by, selector, window)
+	}
+
+	return []*metricQuery{
+		{
+			name:  "requests",
+			kind:  instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(http_requests_total{%s}[%s]))`, by, selector, window),
+			endpoint: func(em *models.EndpointMetrics, v float64) {
+				em.Performance.RequestCount = v
+				em.Performance.RequestRate = v / windowSeconds
+			},
+		},
+		{
+			name:  "errors",
+			kind:  instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(http_requests_total{%s,status=~"5.."}[%s]))`, by, selector, window),
+			endpoint: func(em *models.EndpointMetrics, v float64) {
+				em.Performance.ErrorCount = v
+				em.Performance.ErrorRate = v / windowSeconds
+			},
+		},
+		{
+			name:     "latency_p50",
+			kind:     instantQuery,
+			query:    quantile(0.50),
+			endpoint: func(em *models.EndpointMetrics, v float64) { em.Performance.LatencyP50 = seconds(v) },
+		},
+		{
+			name:     "latency_p95",
+			kind:     instantQuery,
+			query:    quantile(0.95),
+			endpoint: func(em *models.EndpointMetrics, v float64) { em.Performance.LatencyP95 = seconds(v) },
+		},
+		{
+			name:     "latency_p99",
+			kind:     instantQuery,
+			query:    quantile(0.99),
+			endpoint: func(em *models.EndpointMetrics, v float64) { em.Performance.LatencyP99 = seconds(v) },
+		},
+		{
+			name: "latency_avg",
+			kind: instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(http_request_duration_seconds_sum{%s}[%s])) / sum by (%s) (increase(http_request_duration_seconds_count{%s}[%s]))`,
+				by, selector, window, by, selector, window),
+			endpoint: func(em *models.EndpointMetrics, v float64) { em.Performance.LatencyAvg = seconds(v) },
+		},
+	}
+}
+
+// grpcQueries returns the per-method call, error, and latency queries for gRPC
+// endpoints, following the given metric convention
+func grpcQueries(selector string, timeRange models.TimeRange, conv rpcConvention) []*metricQuery {
+	window := promDuration(timeRange.Duration())
+	windowSeconds := timeRange.Duration().Seconds()
+	by := fmt.Sprintf("service, %s, %s", conv.serviceLabel, conv.methodLabel)
+
+	quantile := func(q float64) string {
+		return fmt.Sprintf(`histogram_quantile(%.2f, sum by (%s, le) (increase(%s_bucket{%s}[%s])))`,
+			q, by, conv.histogram, selector, window)
+	}
+	latency := func(set func(perf *models.PerformanceMetrics, d time.Duration)) func(*models.EndpointMetrics, float64) {
+		return func(em *models.EndpointMetrics, v float64) { set(em.Performance, seconds(v*conv.scale)) }
+	}
+
+	return []*metricQuery{
+		{
+			name:  "grpc_requests",
+			kind:  instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(%s{%s}[%s]))`, by, conv.handled, selector, window),
+			endpoint: func(em *models.EndpointMetrics, v float64) {
+				em.Performance.RequestCount = v
+				em.Performance.RequestRate = v / windowSeconds
+			},
+			match: conv.matches,
+		},
+		{
+			name:  "grpc_errors",
+			kind:  instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(%s{%s,%s}[%s]))`, by, conv.handled, selector, conv.errorMatcher(), window),
+			endpoint: func(em *models.EndpointMetrics, v float64) {
+				em.Performance.ErrorCount = v
+				em.Performance.ErrorRate = v / windowSeconds
+			},
+			match: conv.matches,
+		},
+		{
+			name:     "grpc_latency_p50",
+			kind:     instantQuery,
+			query:    quantile(0.50),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyP50 = d }),
+			match:    conv.matches,
+		},
+		{
+			name:     "grpc_latency_p95",
+			kind:     instantQuery,
+			query:    quantile(0.95),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyP95 = d }),
+			match:    conv.matches,
+		},
+		{
+			name:     "grpc_latency_p99",
+			kind:     instantQuery,
+			query:    quantile(0.99),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyP99 = d }),
+			match:    conv.matches,
+		},
+		{
+			name: "grpc_latency_avg",
+			kind: instantQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(%s_sum{%s}[%s])) / sum by (%s) (increase(%s_count{%s}[%s]))`,
+				by, conv.histogram, selector, window, by, conv.histogram, selector, window),
+			endpoint: latency(func(perf *models.PerformanceMetrics, d time.Duration) { perf.LatencyAvg = d }),
+			match:    conv.matches,
+		},
+	}
+}
+
+// resourceSeriesQueries returns the per-service CPU and memory usage per time
+// bucket, in core-hours and GB-hours. They share their names with the resource
+// queries so offline sources can evaluate them the same way.
+func resourceSeriesQueries(selector string, step time.Duration) []*metricQuery {
+	window := promDuration(step)
+
+	return []*metricQuery{
+		{
+			name:  "cpu",
+			kind:  bucketQuery,
+			query: fmt.Sprintf(`sum by (service) (increase(container_cpu_usage_seconds_total{%s}[%s]))`, selector, window),
+			scale: 1.0 / 3600,
+		},
+		{
+			name: "memory",
+			kind: bucketQuery,
+			query: fmt.Sprintf(`sum by (service) (avg_over_time(container_memory_usage_bytes{%s}[%s])) * %g`,
+				selector, window, step.Seconds()),
+			scale: 1.0 / bytesPerGB / 3600,
+		},
+	}
+}
+
+// performanceSeriesQueries returns the per-endpoint request and error counts and
+// average latency in seconds per time bucket
+func performanceSeriesQueries(selector string, step time.Duration) []*metricQuery {
+	window := promDuration(step)
+	by := "service, endpoint, method"
+
+	return []*metricQuery{
+		{
+			name:  "requests",
+			kind:  bucketQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(http_requests_total{%s}[%s]))`, by, selector, window),
+			scale: 1,
+		},
+		{
+			name:  "errors",
+			kind:  bucketQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(http_requests_total{%s,status=~"5.."}[%s]))`, by, selector, window),
+			scale: 1,
+		},
+		{
+			name: "latency_avg",
+			kind: bucketQuery,
+			query: fmt.Sprintf(`sum by (%s) (increase(http_request_duration_seconds_sum{%s}[%s])) / sum by (%s) (increase(http_request_duration_seconds_count{%s}[%s]))`,
+				by, selector, window, by, selector, window),
+			scale: 1,
+		},
+	}
+}
+
+// clusterQueries returns the node count and capacity queries used to price the
+// whole cluster, including capacity no service accounts for
+func clusterQueries(selector string) []*metricQuery {
+	return []*metricQuery{
+		{
+			name:    "node_hours",
+			kind:    integralQuery,
+			query:   fmt.Sprintf(`sum(kube_node_info{%s})`, selector),
+			cluster: func(cm *models.ClusterMetrics, nodeSeconds float64) { cm.NodeHours = nodeSeconds / 3600 },
+		},
+		{
+			name:    "cpu_capacity",
+			kind:    integralQuery,
+			query:   fmt.Sprintf(`sum(kube_node_status_capacity{%s})`, joinMatchers(selector, `resource="cpu"`)),
+			cluster: func(cm *models.ClusterMetrics, coreSeconds float64) { cm.CPUCapacityCoreHours = coreSeconds / 3600 },
+		},
+		{
+			name:  "memory_capacity",
+			kind:  integralQuery,
+			query: fmt.Sprintf(`sum(kube_node_status_capacity{%s})`, joinMatchers(selector, `resource="memory"`)),
+			cluster: func(cm *models.ClusterMetrics, byteSeconds float64) {
+				cm.MemoryCapacityGBHours = byteSeconds / bytesPerGB / 3600
+			},
+		},
+	}
+}
+
+// joinMatchers joins non-empty label matchers with commas
+func joinMatchers(matchers ...string) string {
+	nonEmpty := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		if m != "" {
+			nonEmpty = append(nonEmpty, m)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+// promDuration formats a duration as a PromQL range selector
+func promDuration(d time.Duration) string {
+	return model.Duration(d).String()
+}
+
+// seconds converts a float number of seconds to a time.Duration
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
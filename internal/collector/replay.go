@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+)
+
+// fixture is a recorded PromQL query and the raw Prometheus API response.
+// Evaluation times are not recorded, so a fixture replays for any time range
+// of the same duration.
+type fixture struct {
+	Endpoint string          `json:"endpoint"` // query or query_range
+	Query    string          `json:"query"`
+	Step     string          `json:"step,omitempty"`
+	Status   int             `json:"status"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// fixtureKey identifies a fixture by what determines its response
+func fixtureKey(endpoint, query, step string) string {
+	sum := sha256.Sum256([]byte(endpoint + "\x00" + query + "\x00" + step))
+	return endpoint + "-" + hex.EncodeToString(sum[:8])
+}
+
+// recordingRoundTripper saves every query and its response as a fixture
+type recordingRoundTripper struct {
+	dir  string
+	next http.RoundTripper
+}
+
+// newRecordingRoundTripper records the queries sent through next into dir
+func newRecordingRoundTripper(dir string, next http.RoundTripper) (*recordingRoundTripper, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating fixture directory: %w", err)
+	}
+	return &recordingRoundTripper{dir: dir, next: next}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := path.Base(req.URL.Path)
+	if endpoint != "query" && endpoint != "query_range" {
+		return rt.next.RoundTrip(req)
+	}
+
+	params := req.URL.Query()
+	if req.Body != nil {
+		// Requests must not be modified in place, see http.RoundTripper
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		form, err := url.ParseQuery(string(body))
+		if err == nil {
+			for name, values := range form {
+				params[name] = values
+			}
+		}
+	}
+
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !json.Valid(body) {
+		return resp, nil
+	}
+
+	f := &fixture{
+		Endpoint: endpoint,
+		Query:    params.Get("query"),
+		Step:     params.Get("step"),
+		Status:   resp.StatusCode,
+		Body:     body,
+	}
+	if err := rt.save(f); err != nil {
+		return nil, fmt.Errorf("error recording fixture: %w", err)
+	}
+
+	return resp, nil
+}
+
+// save writes a fixture to the recording directory
+func (rt *recordingRoundTripper) save(f *fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fixtureKey(f.Endpoint, f.Query, f.Step) + ".json"
+	return os.WriteFile(filepath.Join(rt.dir, name), data, 0600)
+}
+
+// ReplayServer is an in-process fake Prometheus API that answers queries from
+// recorded fixtures. Queries without a fixture get an empty result. Fixtures in a
+// subdirectory, such as those recorded by a federated member, are served under
+// the subdirectory's path, so every member replays its own recording.
+type ReplayServer struct {
+	fixtures map[string]*fixture
+	listener net.Listener
+	server   *http.Server
+	logger   *logrus.Logger
+}
+
+// NewReplayServer loads the fixtures in dir and its subdirectories and starts
+// serving them on a local port
+func NewReplayServer(dir string, logger *logrus.Logger) (*ReplayServer, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(file) == ".json" {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing fixtures: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", dir)
+	}
+
+	rs := &ReplayServer{
+		fixtures: make(map[string]*fixture, len(files)),
+		logger:   logger,
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading fixture %s: %w", file, err)
+		}
+
+		var f fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("error parsing fixture %s: %w", file, err)
+		}
+
+		prefix, err := filepath.Rel(dir, filepath.Dir(file))
+		if err != nil {
+			return nil, fmt.Errorf("error locating fixture %s: %w", file, err)
+		}
+		if prefix == "." {
+			prefix = ""
+		}
+		rs.fixtures[path.Join(filepath.ToSlash(prefix), fixtureKey(f.Endpoint, f.Query, f.Step))] = &f
+	}
+
+	rs.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error starting replay server: %w", err)
+	}
+	rs.server = &http.Server{Handler: rs}
+
+	go func() {
+		if err := rs.server.Serve(rs.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.WithError(err).Error("Replay server stopped")
+		}
+	}()
+
+	logger.Infof("Replaying %d fixtures from %s", len(rs.fixtures), dir)
+	return rs, nil
+}
+
+// URL returns the base URL of the replay server
+func (rs *ReplayServer) URL() string {
+	return "http://" + rs.listener.Addr().String()
+}
+
+// Configure points the configured metrics source at the replay server, keeping
+// its type: Prometheus and VictoriaMetrics replay the fixtures at the top of the
+// directory, and every federated member those in the subdirectory named after it.
+// Credentials are dropped, as fixtures need none.
+func (rs *ReplayServer) Configure(cfg *config.Config) {
+	cfg.Prometheus.URL = rs.URL()
+	cfg.Prometheus.BasicAuth = config.BasicAuthConfig{}
+	cfg.Prometheus.BearerToken = ""
+	cfg.Prometheus.BearerTokenFile = ""
+	cfg.Prometheus.TLS = config.TLSConfig{}
+	cfg.Prometheus.ProxyURL = ""
+	cfg.Prometheus.RecordDir = ""
+
+	cfg.MetricsSource.VictoriaMetrics = config.VictoriaMetricsConfig{}
+
+	for i := range cfg.MetricsSource.Federated {
+		member := &cfg.MetricsSource.Federated[i]
+		member.URL = rs.URL() + "/" + url.PathEscape(memberName(i, *member))
+		member.BearerTokenFile = ""
+	}
+}
+
+// Close stops the replay server
+func (rs *ReplayServer) Close() error {
+	return rs.server.Close()
+}
+
+// ServeHTTP answers /api/v1/query and /api/v1/query_range from the fixtures
+func (rs *ReplayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := path.Base(r.URL.Path)
+	if endpoint != "query" && endpoint != "query_range" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Requests for a member's fixtures are prefixed with its subdirectory
+	prefix := strings.Trim(strings.TrimSuffix(r.URL.Path, "/api/v1/"+endpoint), "/")
+	query, step := r.Form.Get("query"), r.Form.Get("step")
+	f, exists := rs.fixtures[path.Join(prefix, fixtureKey(endpoint, query, step))]
+	if !exists {
+		rs.logger.Debugf("No fixture for %s %s", endpoint, query)
+
+		resultType := "vector"
+		if endpoint == "query_range" {
+			resultType = "matrix"
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"%s","result":[]}}`, resultType)
+		return
+	}
+
+	w.WriteHeader(f.Status)
+	if _, err := w.Write(f.Body); err != nil {
+		rs.logger.WithError(err).Debug("Error writing fixture response")
+	}
+}
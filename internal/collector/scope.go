@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/microcost/microcost/pkg/config"
+)
+
+// namespaceLabel is the label holding the Kubernetes namespace of a series
+const namespaceLabel = "namespace"
+
+// scope restricts collection to a set of namespaces and clusters. An empty list
+// matches everything.
+type scope struct {
+	namespaces []string
+	clusters   []string
+}
+
+// newScope creates a scope from the configuration
+func newScope(cfg *config.ScopeConfig) scope {
+	return scope{
+		namespaces: cfg.Namespaces,
+		clusters:   cfg.Clusters,
+	}
+}
+
+// selector returns additional PromQL label matchers for the scope, each with a
+// leading comma so it can be appended to a service selector
+func (s scope) selector() string {
+	return labelMatcher(namespaceLabel, s.namespaces) + s.clusterSelector()
+}
+
+// clusterSelector returns the cluster matcher only, for cluster-wide metrics
+// such as node capacity that carry no namespace
+func (s scope) clusterSelector() string {
+	return labelMatcher(clusterLabel, s.clusters)
+}
+
+// matches reports whether a series falls within the scope
+func (s scope) matches(metric model.Metric) bool {
+	return matchesAny(metric, namespaceLabel, s.namespaces) && s.matchesCluster(metric)
+}
+
+// matchesCluster reports whether a series falls within the scope's clusters
+func (s scope) matchesCluster(metric model.Metric) bool {
+	return matchesAny(metric, clusterLabel, s.clusters)
+}
+
+// dimensions returns the scope as dimension labels; multiple values are comma-separated
+func (s scope) dimensions() map[string]string {
+	dims := make(map[string]string)
+	if len(s.namespaces) > 0 {
+		dims[namespaceLabel] = strings.Join(s.namespaces, ",")
+	}
+	if len(s.clusters) > 0 {
+		dims[clusterLabel] = strings.Join(s.clusters, ",")
+	}
+	return dims
+}
+
+// labelMatcher builds a regex matcher for any of the values, or nothing if there are none
+func labelMatcher(label string, values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	escaped := make([]string, 0, len(values))
+	for _, v := range values {
+		// Backslashes from QuoteMeta must themselves be escaped inside a PromQL string
+		escaped = append(escaped, strings.ReplaceAll(regexp.QuoteMeta(v), `\`, `\\`))
+	}
+	sort.Strings(escaped)
+
+	return fmt.Sprintf(`,%s=~"%s"`, label, strings.Join(escaped, "|"))
+}
+
+// matchesAny reports whether the label of metric has one of the values
+func matchesAny(metric model.Metric, label string, values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	return contains(values, string(metric[model.LabelName(label)]))
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
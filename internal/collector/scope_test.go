@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestScopeSelector(t *testing.T) {
+	tests := []struct {
+		scope    scope
+		expected string
+	}{
+		{scope{}, ``},
+		{scope{namespaces: []string{"prod"}}, `,namespace=~"prod"`},
+		{scope{namespaces: []string{"prod", "canary"}, clusters: []string{"eu.1"}}, `,namespace=~"canary|prod",cluster=~"eu\\.1"`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.scope.selector(); got != tt.expected {
+			t.Errorf("Expected selector %s, got %s", tt.expected, got)
+		}
+	}
+}
+
+func TestSplitSourceByNamespace(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "metrics.csv", `timestamp,metric,labels,value
+2024-01-01T00:00:00Z,container_cpu_usage_seconds_total,service=checkout;namespace=prod;pod=a,0
+2024-01-01T01:00:00Z,container_cpu_usage_seconds_total,service=checkout;namespace=prod;pod=a,7200
+2024-01-01T00:00:00Z,container_cpu_usage_seconds_total,service=checkout;namespace=staging;pod=a,0
+2024-01-01T01:00:00Z,container_cpu_usage_seconds_total,service=checkout;namespace=staging;pod=a,3600
+2024-01-01T00:00:00Z,container_cpu_usage_seconds_total,service=checkout;namespace=dev;pod=a,0
+2024-01-01T01:00:00Z,container_cpu_usage_seconds_total,service=checkout;namespace=dev;pod=a,36000
+`)
+
+	cfg := config.DefaultConfig()
+	cfg.MetricsSource.Type = "file"
+	cfg.MetricsSource.File.Paths = []string{path}
+	cfg.MetricsSource.Scope = config.ScopeConfig{Namespaces: []string{"prod", "staging"}, SplitBy: "namespace"}
+
+	source, err := NewMetricsSource(cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("NewMetricsSource failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err := source.CollectMetrics(context.Background(), newTestServices(), models.TimeRange{Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	// dev is out of scope
+	if total := snapshot.Services["checkout"].Aggregate.CPUCoreHours; math.Abs(total-3) > 1e-9 {
+		t.Errorf("Expected 3 core-hours across prod and staging, got %f", total)
+	}
+
+	if len(snapshot.Environments) != 2 {
+		t.Fatalf("Expected 2 environments, got %d", len(snapshot.Environments))
+	}
+
+	staging := snapshot.Environments["staging"].Services["checkout"]
+	if math.Abs(staging.Aggregate.CPUCoreHours-1) > 1e-9 {
+		t.Errorf("Expected 1 core-hour in staging, got %f", staging.Aggregate.CPUCoreHours)
+	}
+
+	if staging.Dimensions["namespace"] != "staging" {
+		t.Errorf("Expected staging dimension, got %v", staging.Dimensions)
+	}
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// seriesValue is the reduced value of a single series in a query result
+type seriesValue struct {
+	labels model.Metric
+	value  float64
+}
+
+// instantValues returns the value of each series in an instant query result
+func instantValues(value model.Value) []seriesValue {
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return nil
+	}
+
+	values := make([]seriesValue, 0, len(vector))
+	for _, sample := range vector {
+		// histogram_quantile and empty ratios yield NaN for windows without traffic
+		if math.IsNaN(float64(sample.Value)) || math.IsInf(float64(sample.Value), 0) {
+			continue
+		}
+		values = append(values, seriesValue{labels: sample.Metric, value: float64(sample.Value)})
+	}
+
+	return values
+}
+
+// seriesIntegrals integrates each series of a range query result over time using
+// the trapezoidal rule. Gaps longer than twice the step (e.g. a pod that was not
+// running) are not interpolated across.
+func seriesIntegrals(value model.Value, step time.Duration) []seriesValue {
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil
+	}
+
+	maxGap := 2 * step.Seconds()
+	integrals := make([]seriesValue, 0, len(matrix))
+	for _, stream := range matrix {
+		total := 0.0
+		for i := 1; i < len(stream.Values); i++ {
+			prev, cur := stream.Values[i-1], stream.Values[i]
+			dt := cur.Timestamp.Sub(prev.Timestamp).Seconds()
+			if dt <= 0 || (maxGap > 0 && dt > maxGap) {
+				continue
+			}
+			total += (float64(prev.Value) + float64(cur.Value)) / 2 * dt
+		}
+		integrals = append(integrals, seriesValue{labels: stream.Metric, value: total})
+	}
+
+	return integrals
+}
+
+// seriesCount returns the number of series in a query result
+func seriesCount(value model.Value) int {
+	switch v := value.(type) {
+	case model.Vector:
+		return len(v)
+	case model.Matrix:
+		return len(v)
+	default:
+		return 0
+	}
+}
+
+// labelMap converts Prometheus labels into a plain string map
+func labelMap(metric model.Metric) map[string]string {
+	labels := make(map[string]string, len(metric))
+	for name, value := range metric {
+		labels[string(name)] = string(value)
+	}
+	return labels
+}
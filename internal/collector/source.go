@@ -0,0 +1,267 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// MetricsSource produces a metrics snapshot for a set of services
+type MetricsSource interface {
+	// Name returns a short identifier for logging
+	Name() string
+	// CollectMetrics collects metrics for all services over the time range
+	CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error)
+}
+
+// NewMetricsSource creates the metrics source selected in the configuration,
+// restricted to the configured scope and enriched with CPU profiles if configured
+func NewMetricsSource(cfg *config.Config, logger *logrus.Logger) (MetricsSource, error) {
+	sc := newScope(&cfg.MetricsSource.Scope)
+
+	var (
+		source MetricsSource
+		err    error
+	)
+	switch cfg.MetricsSource.Scope.SplitBy {
+	case "namespace":
+		source, err = newSplitSource(cfg, sc, namespaceLabel, sc.namespaces, logger)
+	case "cluster":
+		source, err = newSplitSource(cfg, sc, clusterLabel, sc.clusters, logger)
+	default:
+		source, err = newMetricsSource(cfg, sc, logger)
+	}
+	if err != nil || len(cfg.MetricsSource.Profiles.Paths) == 0 {
+		return source, err
+	}
+
+	return NewProfiledSource(source, &cfg.MetricsSource.Profiles, logger)
+}
+
+// newMetricsSource creates a single metrics source restricted to a scope
+func newMetricsSource(cfg *config.Config, sc scope, logger *logrus.Logger) (MetricsSource, error) {
+	rpc, err := newRPCConvention(cfg.MetricsSource.GRPCMetrics)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := newEdgeConvention(cfg.MetricsSource.EdgeMetrics)
+	if err != nil {
+		return nil, err
+	}
+	mesh, err := newMeshConvention(cfg.Analysis.Mesh.Type)
+	if err != nil {
+		return nil, err
+	}
+	// Only the topology network model prices traffic by zone
+	zones := cfg.CostModel.Network.Model == "topology"
+
+	switch cfg.MetricsSource.Type {
+	case "", "prometheus":
+		pc, err := NewPrometheusCollector(&cfg.Prometheus, logger)
+		if err != nil {
+			return nil, err
+		}
+		pc.scope = sc
+		pc.resolution = cfg.MetricsSource.Resolution
+		pc.rpc = rpc
+		pc.edges = edges
+		pc.mesh = mesh
+		pc.zones = zones
+		return pc, nil
+	case "federated":
+		fc, err := NewFederatedCollector(&cfg.Prometheus, cfg.MetricsSource.Federated, logger)
+		if err != nil {
+			return nil, err
+		}
+		fc.setScope(sc)
+		fc.setResolution(cfg.MetricsSource.Resolution)
+		fc.setRPCConvention(rpc)
+		fc.setEdgeConvention(edges)
+		fc.setMeshConvention(mesh)
+		fc.setZones(zones)
+		return fc, nil
+	case "victoriametrics":
+		pc, err := NewVictoriaMetricsCollector(&cfg.Prometheus, &cfg.MetricsSource.VictoriaMetrics, logger)
+		if err != nil {
+			return nil, err
+		}
+		pc.scope = sc
+		pc.resolution = cfg.MetricsSource.Resolution
+		pc.rpc = rpc
+		pc.edges = edges
+		pc.mesh = mesh
+		pc.zones = zones
+		return pc, nil
+	case "file":
+		fs, err := NewFileSource(&cfg.MetricsSource.File, logger)
+		if err != nil {
+			return nil, err
+		}
+		fs.scope = sc
+		fs.resolution = cfg.MetricsSource.Resolution
+		fs.rpc = rpc
+		fs.edges = edges
+		fs.mesh = mesh
+		fs.zones = zones
+		return fs, nil
+	case "otlp":
+		ots, err := NewOTLPSource(&cfg.MetricsSource.OTLP, logger)
+		if err != nil {
+			return nil, err
+		}
+		// Ingested metrics always follow the OpenTelemetry gRPC convention
+		ots.store.scope = sc
+		ots.store.resolution = cfg.MetricsSource.Resolution
+		return ots, nil
+	default:
+		return nil, fmt.Errorf("unknown metrics source type: %s", cfg.MetricsSource.Type)
+	}
+}
+
+// newServiceMetricsIndex pre-creates an entry for every known endpoint so query
+// results can be fanned out. Container resources are only observable per service,
+// so they are kept on the service aggregate and split across endpoints later by
+// the cost engine.
+func newServiceMetricsIndex(services map[string]*models.Service, timeRange models.TimeRange) map[string]*models.ServiceMetrics {
+	serviceMetrics := make(map[string]*models.ServiceMetrics, len(services))
+	for serviceName, service := range services {
+		sm := &models.ServiceMetrics{
+			ServiceName: serviceName,
+			Endpoints:   make(map[string]*models.EndpointMetrics),
+			Aggregate:   &models.ResourceMetrics{Timestamp: time.Now()},
+			TimeRange:   timeRange,
+		}
+
+		for _, endpoint := range service.Endpoints {
+			key := fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)
+			sm.Endpoints[key] = &models.EndpointMetrics{
+				Service:     serviceName,
+				Endpoint:    endpoint.Path,
+				Method:      endpoint.Method,
+				Type:        endpoint.Type,
+				Performance: &models.PerformanceMetrics{Timestamp: time.Now()},
+				TimeRange:   timeRange,
+			}
+		}
+		serviceMetrics[serviceName] = sm
+	}
+
+	return serviceMetrics
+}
+
+// applyServiceValues sums a per-service metric across its series, assigns the total
+// to the service aggregate and records each series' contribution
+func applyServiceValues(mq *metricQuery, values []seriesValue, serviceMetrics map[string]*models.ServiceMetrics) {
+	totals := make(map[string]float64)
+	for _, series := range values {
+		serviceName := string(series.labels["service"])
+		sm, exists := serviceMetrics[serviceName]
+		if !exists {
+			continue
+		}
+
+		totals[serviceName] += series.value
+		addSeries(sm, mq.name, series)
+	}
+
+	for serviceName, total := range totals {
+		mq.service(serviceMetrics[serviceName].Aggregate, total)
+	}
+}
+
+// applyZoneValues records the pod-seconds of every service per zone and region
+// in its per-series breakdown, where the topology network model reads them
+func applyZoneValues(mq *metricQuery, values []seriesValue, serviceMetrics map[string]*models.ServiceMetrics) {
+	for _, series := range values {
+		if sm, exists := serviceMetrics[string(series.labels["service"])]; exists {
+			addSeries(sm, mq.name, series)
+		}
+	}
+}
+
+// addSeries records the contribution of a series to a service metric
+func addSeries(sm *models.ServiceMetrics, name string, series seriesValue) {
+	if sm.Series == nil {
+		sm.Series = make(map[string][]models.SeriesValue)
+	}
+	sm.Series[name] = append(sm.Series[name], models.SeriesValue{
+		Labels: labelMap(series.labels),
+		Value:  series.value,
+	})
+}
+
+// applyEndpointValues assigns a per-endpoint metric to the matching endpoints
+func applyEndpointValues(mq *metricQuery, values []seriesValue, serviceMetrics map[string]*models.ServiceMetrics) {
+	for _, series := range values {
+		sm, exists := serviceMetrics[string(series.labels["service"])]
+		if !exists {
+			continue
+		}
+
+		for _, em := range sm.Endpoints {
+			if mq.matchesEndpoint(em, series.labels) {
+				mq.endpoint(em, series.value)
+			}
+		}
+	}
+}
+
+// applyClusterValues sums a cluster-wide metric across its series and assigns it
+// to the cluster metrics. Nothing is assigned when the query returned no series.
+func applyClusterValues(mq *metricQuery, values []seriesValue, cluster *models.ClusterMetrics) {
+	if len(values) == 0 {
+		return
+	}
+
+	total := 0.0
+	for _, series := range values {
+		total += series.value
+	}
+	mq.cluster(cluster, total)
+}
+
+// clusterOrNil returns nil when no cluster metrics were collected
+func clusterOrNil(cluster *models.ClusterMetrics) *models.ClusterMetrics {
+	if *cluster == (models.ClusterMetrics{}) {
+		return nil
+	}
+	return cluster
+}
+
+// applyDimensions records the collection scope on the snapshot and its services
+func applyDimensions(snapshot *models.MetricsSnapshot, dims map[string]string) {
+	if len(dims) == 0 {
+		return
+	}
+
+	snapshot.Dimensions = dims
+	for _, sm := range snapshot.Services {
+		sm.Dimensions = dims
+	}
+}
+
+// statusKey names a query in the snapshot status; time series queries share their
+// metric names with the totals, so they are suffixed
+func statusKey(mq *metricQuery) string {
+	if mq.kind == bucketQuery {
+		return mq.name + "_series"
+	}
+	return mq.name
+}
+
+// queryStatus describes the outcome of a query that returned the given number of series
+func queryStatus(series int, err error) models.MetricStatus {
+	switch {
+	case err != nil:
+		return models.MetricStatus{State: models.MetricError, Error: err.Error()}
+	case series == 0:
+		return models.MetricStatus{State: models.MetricEmpty}
+	default:
+		return models.MetricStatus{State: models.MetricOK, Series: series}
+	}
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// SplitSource collects each namespace or cluster of a scope separately, so
+// costs can be broken down by environment. The resulting snapshot holds the
+// sum of all environments plus one snapshot per environment.
+type SplitSource struct {
+	label   string
+	values  []string
+	sources map[string]MetricsSource
+	scope   scope
+	logger  *logrus.Logger
+}
+
+// newSplitSource creates one metrics source per value of the split label
+func newSplitSource(cfg *config.Config, sc scope, label string, values []string, logger *logrus.Logger) (*SplitSource, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("splitting by %s requires a list of %ss", label, label)
+	}
+
+	ss := &SplitSource{
+		label:   label,
+		values:  values,
+		sources: make(map[string]MetricsSource, len(values)),
+		scope:   sc,
+		logger:  logger,
+	}
+
+	// OTLP metrics are received and decoded once and evaluated per environment
+	var shared *OTLPSource
+	if cfg.MetricsSource.Type == "otlp" {
+		source, err := newMetricsSource(cfg, sc, logger)
+		if err != nil {
+			return nil, err
+		}
+		shared = source.(*OTLPSource)
+	}
+
+	for _, value := range values {
+		envScope := sc
+		if label == namespaceLabel {
+			envScope.namespaces = []string{value}
+		} else {
+			envScope.clusters = []string{value}
+		}
+
+		if shared != nil {
+			ss.sources[value] = shared.withScope(envScope)
+			continue
+		}
+
+		source, err := newMetricsSource(cfg, envScope, logger)
+		if err != nil {
+			return nil, fmt.Errorf("error creating metrics source for %s %s: %w", label, value, err)
+		}
+		ss.sources[value] = source
+	}
+
+	return ss, nil
+}
+
+// Name returns the name of the metrics source
+func (ss *SplitSource) Name() string {
+	return fmt.Sprintf("split by %s", ss.label)
+}
+
+// CollectMetrics collects metrics for every environment and sums them
+func (ss *SplitSource) CollectMetrics(ctx context.Context, services map[string]*models.Service, timeRange models.TimeRange) (*models.MetricsSnapshot, error) {
+	total := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+	total.Environments = make(map[string]*models.MetricsSnapshot, len(ss.values))
+
+	for _, value := range ss.values {
+		ss.logger.Infof("Collecting metrics for %s %s...", ss.label, value)
+
+		snapshot, err := ss.sources[value].CollectMetrics(ctx, services, timeRange)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting metrics for %s %s: %w", ss.label, value, err)
+		}
+
+		total.TimeRange = snapshot.TimeRange
+		total.Environments[value] = snapshot
+		mergeSnapshot(total, snapshot, ss.label, value)
+
+		// Node metrics carry no namespace, so every namespace reports the whole cluster
+		if ss.label == namespaceLabel && snapshot.Cluster != nil {
+			cluster := *snapshot.Cluster
+			total.Cluster = &cluster
+		}
+	}
+
+	applyDimensions(total, ss.scope.dimensions())
+	return total, nil
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// seriesPoints is one series of a bucket query result, with a point per bucket
+type seriesPoints struct {
+	labels model.Metric
+	points []models.TimePoint
+}
+
+// timeBuckets splits a time range into consecutive buckets of the given step.
+// A trailing partial bucket is dropped so every bucket covers the same duration.
+func timeBuckets(timeRange models.TimeRange, step time.Duration) []models.TimeRange {
+	if step <= 0 {
+		return nil
+	}
+
+	buckets := make([]models.TimeRange, 0)
+	for start := timeRange.Start; !start.Add(step).After(timeRange.End); start = start.Add(step) {
+		buckets = append(buckets, models.TimeRange{Start: start, End: start.Add(step)})
+	}
+	return buckets
+}
+
+// matrixPoints converts a bucket query result into points stamped with the start
+// of their bucket, scaled to time series units
+func matrixPoints(value model.Value, step time.Duration, scale float64) []seriesPoints {
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil
+	}
+
+	series := make([]seriesPoints, 0, len(matrix))
+	for _, stream := range matrix {
+		sp := seriesPoints{labels: stream.Metric}
+		for _, sample := range stream.Values {
+			v := float64(sample.Value)
+			// Ratios yield NaN for buckets without traffic
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			sp.points = append(sp.points, models.TimePoint{
+				Timestamp: sample.Timestamp.Time().Add(-step).UTC(),
+				Value:     v * scale,
+			})
+		}
+		series = append(series, sp)
+	}
+
+	return series
+}
+
+// bucketPoints collects the values of a scalar evaluation for every bucket into
+// one series of points per label set
+func bucketPoints(buckets []models.TimeRange, scale float64, evaluate func(models.TimeRange) []seriesValue) []seriesPoints {
+	index := make(map[model.Fingerprint]*seriesPoints)
+	order := make([]model.Fingerprint, 0)
+
+	for _, bucket := range buckets {
+		for _, sv := range evaluate(bucket) {
+			fp := sv.labels.Fingerprint()
+			if index[fp] == nil {
+				index[fp] = &seriesPoints{labels: sv.labels}
+				order = append(order, fp)
+			}
+			index[fp].points = append(index[fp].points, models.TimePoint{
+				Timestamp: bucket.Start.UTC(),
+				Value:     sv.value * scale,
+			})
+		}
+	}
+
+	series := make([]seriesPoints, 0, len(order))
+	for _, fp := range order {
+		series = append(series, *index[fp])
+	}
+	return series
+}
+
+// applyServiceSeries sums a per-service time series across its series (e.g. pods)
+// and stores it on the service
+func applyServiceSeries(mq *metricQuery, series []seriesPoints, serviceMetrics map[string]*models.ServiceMetrics) {
+	for _, sp := range series {
+		sm, exists := serviceMetrics[string(sp.labels["service"])]
+		if !exists {
+			continue
+		}
+
+		if sm.TimeSeries == nil {
+			sm.TimeSeries = make(models.TimeSeries)
+		}
+		sm.TimeSeries[mq.name] = sumPoints(sm.TimeSeries[mq.name], sp.points)
+	}
+}
+
+// applyEndpointSeries stores a per-endpoint time series on the matching endpoints
+func applyEndpointSeries(mq *metricQuery, series []seriesPoints, serviceMetrics map[string]*models.ServiceMetrics) {
+	for _, sp := range series {
+		sm, exists := serviceMetrics[string(sp.labels["service"])]
+		if !exists {
+			continue
+		}
+
+		for _, em := range sm.Endpoints {
+			if !mq.matchesEndpoint(em, sp.labels) {
+				continue
+			}
+			if em.TimeSeries == nil {
+				em.TimeSeries = make(models.TimeSeries)
+			}
+			em.TimeSeries[mq.name] = append([]models.TimePoint(nil), sp.points...)
+		}
+	}
+}
+
+// sumPoints adds the points of b to a, matching them by timestamp
+func sumPoints(a, b []models.TimePoint) []models.TimePoint {
+	sums := make(map[int64]*models.TimePoint, len(a)+len(b))
+	for _, points := range [][]models.TimePoint{a, b} {
+		for _, p := range points {
+			key := p.Timestamp.UnixNano()
+			if sums[key] == nil {
+				sums[key] = &models.TimePoint{Timestamp: p.Timestamp}
+			}
+			sums[key].Value += p.Value
+		}
+	}
+
+	result := make([]models.TimePoint, 0, len(sums))
+	for _, p := range sums {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result
+}
+
+// mergeTimeSeries adds the time series of src to dst and returns the result.
+// Average latencies are weighted by the request counts of each bucket.
+func mergeTimeSeries(dst, src models.TimeSeries) models.TimeSeries {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(models.TimeSeries, len(src))
+	}
+
+	if latency, ok := src["latency_avg"]; ok {
+		dst["latency_avg"] = weightedPoints(dst["latency_avg"], dst["requests"], latency, src["requests"])
+	}
+	for metric, points := range src {
+		if metric == "latency_avg" {
+			continue
+		}
+		dst[metric] = sumPoints(dst[metric], points)
+	}
+
+	return dst
+}
+
+// weightedPoints averages two series point by point, weighting each by the
+// matching point of its weight series
+func weightedPoints(a, aWeights, b, bWeights []models.TimePoint) []models.TimePoint {
+	weightOf := func(weights []models.TimePoint) map[int64]float64 {
+		index := make(map[int64]float64, len(weights))
+		for _, w := range weights {
+			index[w.Timestamp.UnixNano()] = w.Value
+		}
+		return index
+	}
+
+	type accumulator struct {
+		timestamp time.Time
+		sum       float64
+		weight    float64
+	}
+	acc := make(map[int64]*accumulator)
+	for _, side := range []struct {
+		points  []models.TimePoint
+		weights map[int64]float64
+	}{{a, weightOf(aWeights)}, {b, weightOf(bWeights)}} {
+		for _, p := range side.points {
+			key := p.Timestamp.UnixNano()
+			if acc[key] == nil {
+				acc[key] = &accumulator{timestamp: p.Timestamp}
+			}
+			acc[key].sum += p.Value * side.weights[key]
+			acc[key].weight += side.weights[key]
+		}
+	}
+
+	result := make([]models.TimePoint, 0, len(acc))
+	for _, a := range acc {
+		if a.weight == 0 {
+			continue
+		}
+		result = append(result, models.TimePoint{Timestamp: a.timestamp, Value: a.sum / a.weight})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result
+}
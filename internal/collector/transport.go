@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/microcost/microcost/pkg/config"
+)
+
+// tenantHeader is the tenant header used by Thanos, Mimir and Cortex
+const tenantHeader = "X-Scope-OrgID"
+
+// authRoundTripper adds authentication and custom headers to every request
+type authRoundTripper struct {
+	config *config.PrometheusConfig
+	next   http.RoundTripper
+}
+
+// newRoundTripper builds the HTTP transport used to reach Prometheus
+func newRoundTripper(cfg *config.PrometheusConfig) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(&cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var rt http.RoundTripper = &authRoundTripper{
+		config: cfg,
+		next:   transport,
+	}
+
+	if cfg.RecordDir != "" {
+		return newRecordingRoundTripper(cfg.RecordDir, rt)
+	}
+	return rt, nil
+}
+
+// newTLSConfig builds a TLS configuration with an optional custom CA and client certificate
+func newTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // #nosec G402 -- explicit opt-in
+	}
+
+	if cfg.CAFile != "" {
+		caCert, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA file: %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests must not be modified in place, see http.RoundTripper
+	req = req.Clone(req.Context())
+
+	for name, value := range rt.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if rt.config.TenantID != "" {
+		req.Header.Set(tenantHeader, rt.config.TenantID)
+	}
+
+	if rt.config.BasicAuth.Username != "" {
+		password, err := secret(rt.config.BasicAuth.Password, rt.config.BasicAuth.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading basic auth password: %w", err)
+		}
+		req.SetBasicAuth(rt.config.BasicAuth.Username, password)
+	}
+
+	token, err := secret(rt.config.BearerToken, rt.config.BearerTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading bearer token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return rt.next.RoundTrip(req)
+}
+
+// secret returns the inline value, or the contents of file if set. Files are
+// re-read on every request so rotated credentials are picked up.
+func secret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
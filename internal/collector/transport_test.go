@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microcost/microcost/pkg/config"
+)
+
+func TestRoundTripperAddsTenantAndBearerToken(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	cfg := &config.PrometheusConfig{
+		BearerTokenFile: tokenFile,
+		TenantID:        "team-a",
+		Headers:         map[string]string{"X-Custom": "value"},
+	}
+
+	rt, err := newRoundTripper(cfg)
+	if err != nil {
+		t.Fatalf("newRoundTripper failed: %v", err)
+	}
+
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got.Get("Authorization") != "Bearer secret-token" {
+		t.Errorf("Expected bearer token from file, got '%s'", got.Get("Authorization"))
+	}
+
+	if got.Get(tenantHeader) != "team-a" {
+		t.Errorf("Expected tenant header 'team-a', got '%s'", got.Get(tenantHeader))
+	}
+
+	if got.Get("X-Custom") != "value" {
+		t.Errorf("Expected custom header 'value', got '%s'", got.Get("X-Custom"))
+	}
+}
+
+func TestRoundTripperBasicAuth(t *testing.T) {
+	var user, pass string
+	var ok bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok = r.BasicAuth()
+	}))
+	defer server.Close()
+
+	cfg := &config.PrometheusConfig{
+		BasicAuth: config.BasicAuthConfig{Username: "admin", Password: "hunter2"},
+	}
+
+	rt, err := newRoundTripper(cfg)
+	if err != nil {
+		t.Fatalf("newRoundTripper failed: %v", err)
+	}
+
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if !ok || user != "admin" || pass != "hunter2" {
+		t.Errorf("Expected basic auth admin/hunter2, got %s/%s (set: %v)", user, pass, ok)
+	}
+}
+
+func TestNewTLSConfigInvalidCA(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	if _, err := newTLSConfig(&config.TLSConfig{CAFile: caFile}); err == nil {
+		t.Error("Expected error for CA file without certificates")
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/pkg/config"
+)
+
+// NewVictoriaMetricsCollector creates a collector for VictoriaMetrics, which serves
+// the Prometheus query API. For the cluster version the account ID selects the
+// tenant path on vmselect. Timeouts, retries, auth and TLS are taken from the
+// prometheus section.
+func NewVictoriaMetricsCollector(promCfg *config.PrometheusConfig, vmCfg *config.VictoriaMetricsConfig, logger *logrus.Logger) (*PrometheusCollector, error) {
+	cfg := *promCfg
+	if vmCfg.URL != "" {
+		cfg.URL = vmCfg.URL
+	}
+
+	if vmCfg.AccountID != "" {
+		cfg.URL = fmt.Sprintf("%s/select/%s/prometheus", strings.TrimSuffix(cfg.URL, "/"), vmCfg.AccountID)
+	}
+
+	pc, err := NewPrometheusCollector(&cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	pc.name = "victoriametrics"
+
+	return pc, nil
+}
@@ -0,0 +1,140 @@
+package costengine
+
+import (
+	"strings"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// Allocator splits service-level resource usage across the service's endpoints
+type Allocator struct {
+	method        models.AllocationMethod
+	customWeights map[string]map[string]float64
+}
+
+// requestShares splits by share of requests, the fallback of profile allocation
+var requestShares = &Allocator{method: models.AllocationRequestShare}
+
+// NewAllocator creates a new resource allocator
+func NewAllocator(cfg *config.AllocationConfig) *Allocator {
+	method := models.AllocationMethod(cfg.Method)
+	switch method {
+	case models.AllocationRequestShare, models.AllocationRequestSeconds, models.AllocationCustom, models.AllocationProfile:
+	default:
+		method = models.AllocationRequestShare
+	}
+
+	return &Allocator{
+		method:        method,
+		customWeights: cfg.CustomWeights,
+	}
+}
+
+// Method returns the allocation method in use
+func (a *Allocator) Method() models.AllocationMethod {
+	return a.method
+}
+
+// Shares returns each endpoint's fraction of the service's resources, keyed like
+// ServiceMetrics.Endpoints. Shares sum to 1; when no endpoint has any weight the
+// resources are split evenly so that no usage is lost. With profile allocation
+// these are the CPU shares, falling back to request shares for services without
+// profiled endpoints.
+func (a *Allocator) Shares(sm *models.ServiceMetrics) map[string]float64 {
+	shares := make(map[string]float64, len(sm.Endpoints))
+	if len(sm.Endpoints) == 0 {
+		return shares
+	}
+
+	total := 0.0
+	for key, em := range sm.Endpoints {
+		w := a.weight(sm.ServiceName, key, em)
+		shares[key] = w
+		total += w
+	}
+
+	if total == 0 && a.method == models.AllocationProfile {
+		return requestShares.Shares(sm)
+	}
+
+	for key := range shares {
+		if total > 0 {
+			shares[key] /= total
+		} else {
+			shares[key] = 1.0 / float64(len(shares))
+		}
+	}
+
+	return shares
+}
+
+// Allocate returns the resources attributable to each endpoint of the service
+func (a *Allocator) Allocate(sm *models.ServiceMetrics) map[string]*models.ResourceMetrics {
+	allocated := make(map[string]*models.ResourceMetrics, len(sm.Endpoints))
+	if sm.Aggregate == nil {
+		return allocated
+	}
+
+	for key, share := range a.Shares(sm) {
+		allocated[key] = scaleResources(sm.Aggregate, share)
+	}
+
+	// Profiles only measure CPU, so everything else follows the requests
+	if a.method == models.AllocationProfile {
+		for key, share := range requestShares.Shares(sm) {
+			cpuCores, cpuCoreHours := allocated[key].CPUCores, allocated[key].CPUCoreHours
+			allocated[key] = scaleResources(sm.Aggregate, share)
+			allocated[key].CPUCores = cpuCores
+			allocated[key].CPUCoreHours = cpuCoreHours
+		}
+	}
+
+	return allocated
+}
+
+// weight returns the unnormalised allocation weight of a single endpoint
+func (a *Allocator) weight(service, key string, em *models.EndpointMetrics) float64 {
+	switch a.method {
+	case models.AllocationCustom:
+		// Viper lower-cases map keys, so match case-insensitively
+		for svc, weights := range a.customWeights {
+			if !strings.EqualFold(svc, service) {
+				continue
+			}
+			for k, w := range weights {
+				if strings.EqualFold(k, key) {
+					return w
+				}
+			}
+		}
+		return 0
+	case models.AllocationProfile:
+		return em.ProfileCPUSeconds
+	case models.AllocationRequestSeconds:
+		if em.Performance == nil {
+			return 0
+		}
+		return em.Performance.RequestRate * em.Performance.LatencyAvg.Seconds()
+	default:
+		if em.Performance == nil {
+			return 0
+		}
+		return em.Performance.RequestRate
+	}
+}
+
+// scaleResources returns a copy of rm with every quantity multiplied by factor
+func scaleResources(rm *models.ResourceMetrics, factor float64) *models.ResourceMetrics {
+	return &models.ResourceMetrics{
+		CPUCores:      rm.CPUCores * factor,
+		CPUCoreHours:  rm.CPUCoreHours * factor,
+		MemoryMB:      rm.MemoryMB * factor,
+		MemoryGBHours: rm.MemoryGBHours * factor,
+		NetworkInMB:   rm.NetworkInMB * factor,
+		NetworkOutMB:  rm.NetworkOutMB * factor,
+		DiskReadMB:    rm.DiskReadMB * factor,
+		DiskWriteMB:   rm.DiskWriteMB * factor,
+		Timestamp:     rm.Timestamp,
+	}
+}
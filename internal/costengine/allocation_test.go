@@ -0,0 +1,142 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func newTestServiceMetrics() *models.ServiceMetrics {
+	return &models.ServiceMetrics{
+		ServiceName: "checkout",
+		Aggregate: &models.ResourceMetrics{
+			CPUCores:    2.0,
+			MemoryMB:    1024.0,
+			NetworkInMB: 100.0,
+		},
+		Endpoints: map[string]*models.EndpointMetrics{
+			"/checkout:POST": {
+				Performance: &models.PerformanceMetrics{RequestRate: 10, LatencyAvg: 300 * time.Millisecond},
+			},
+			"/cart:GET": {
+				Performance: &models.PerformanceMetrics{RequestRate: 30, LatencyAvg: 10 * time.Millisecond},
+			},
+		},
+	}
+}
+
+func TestAllocatorRequestShare(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{Method: "request_share"})
+
+	shares := allocator.Shares(newTestServiceMetrics())
+
+	if math.Abs(shares["/checkout:POST"]-0.25) > 1e-9 {
+		t.Errorf("Expected checkout share 0.25, got %f", shares["/checkout:POST"])
+	}
+
+	if math.Abs(shares["/cart:GET"]-0.75) > 1e-9 {
+		t.Errorf("Expected cart share 0.75, got %f", shares["/cart:GET"])
+	}
+}
+
+func TestAllocatorRequestSeconds(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{Method: "request_seconds"})
+
+	shares := allocator.Shares(newTestServiceMetrics())
+
+	// checkout: 10 * 0.3 = 3 request-seconds, cart: 30 * 0.01 = 0.3 request-seconds
+	expected := 3.0 / 3.3
+	if math.Abs(shares["/checkout:POST"]-expected) > 1e-9 {
+		t.Errorf("Expected checkout share %f, got %f", expected, shares["/checkout:POST"])
+	}
+}
+
+func TestAllocatorCustomWeights(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{
+		Method: "custom",
+		CustomWeights: map[string]map[string]float64{
+			// Keys are lower-cased as viper would load them
+			"checkout": {"/checkout:post": 3, "/cart:get": 1},
+		},
+	})
+
+	shares := allocator.Shares(newTestServiceMetrics())
+
+	if math.Abs(shares["/checkout:POST"]-0.75) > 1e-9 {
+		t.Errorf("Expected checkout share 0.75, got %f", shares["/checkout:POST"])
+	}
+}
+
+func TestAllocatorEvenSplitWithoutTraffic(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{Method: "request_share"})
+
+	sm := newTestServiceMetrics()
+	for _, em := range sm.Endpoints {
+		em.Performance.RequestRate = 0
+	}
+
+	shares := allocator.Shares(sm)
+
+	for key, share := range shares {
+		if share != 0.5 {
+			t.Errorf("Expected even share 0.5 for %s, got %f", key, share)
+		}
+	}
+}
+
+func TestAllocateDoesNotDuplicateResources(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{Method: "request_share"})
+
+	sm := newTestServiceMetrics()
+	allocated := allocator.Allocate(sm)
+
+	totalCPU := 0.0
+	totalMemory := 0.0
+	for _, rm := range allocated {
+		totalCPU += rm.CPUCores
+		totalMemory += rm.MemoryMB
+	}
+
+	if math.Abs(totalCPU-sm.Aggregate.CPUCores) > 1e-9 {
+		t.Errorf("Expected allocated CPU to sum to %f, got %f", sm.Aggregate.CPUCores, totalCPU)
+	}
+
+	if math.Abs(totalMemory-sm.Aggregate.MemoryMB) > 1e-9 {
+		t.Errorf("Expected allocated memory to sum to %f, got %f", sm.Aggregate.MemoryMB, totalMemory)
+	}
+}
+
+func TestNewAllocatorDefaultsUnknownMethod(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{Method: "bogus"})
+
+	if allocator.Method() != models.AllocationRequestShare {
+		t.Errorf("Expected default method %s, got %s", models.AllocationRequestShare, allocator.Method())
+	}
+}
+
+func TestAllocatorProfile(t *testing.T) {
+	allocator := NewAllocator(&config.AllocationConfig{Method: "profile"})
+
+	sm := newTestServiceMetrics()
+	sm.Endpoints["/checkout:POST"].ProfileCPUSeconds = 9
+	sm.Endpoints["/cart:GET"].ProfileCPUSeconds = 1
+
+	allocated := allocator.Allocate(sm)
+
+	// CPU follows the profiles, memory the requests
+	if math.Abs(allocated["/checkout:POST"].CPUCores-1.8) > 1e-9 {
+		t.Errorf("Expected checkout CPU 1.8 cores, got %f", allocated["/checkout:POST"].CPUCores)
+	}
+	if math.Abs(allocated["/checkout:POST"].MemoryMB-256) > 1e-9 {
+		t.Errorf("Expected checkout memory 256 MB, got %f", allocated["/checkout:POST"].MemoryMB)
+	}
+
+	// Without profiles everything follows the requests
+	shares := allocator.Shares(newTestServiceMetrics())
+	if math.Abs(shares["/cart:GET"]-0.75) > 1e-9 {
+		t.Errorf("Expected cart share 0.75, got %f", shares["/cart:GET"])
+	}
+}
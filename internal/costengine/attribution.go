@@ -0,0 +1,72 @@
+package costengine
+
+import (
+	"fmt"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// parseAttributionMode returns the configured attribution mode, full by default
+func parseAttributionMode(mode string) models.AttributionMode {
+	if models.AttributionMode(mode) == models.AttributionTrafficShare {
+		return models.AttributionTrafficShare
+	}
+	return models.AttributionFull
+}
+
+// endpointCostOf returns the cost of the endpoint of a node, or nil for endpoints
+// the analyzer did not find
+func endpointCostOf(report *models.CostReport, node *graph.Node) *models.EndpointCost {
+	sc, exists := report.Services[node.Service]
+	if !exists {
+		return nil
+	}
+	return sc.Endpoints[fmt.Sprintf("%s:%s", node.Endpoint, node.Method)]
+}
+
+// trafficShareGraph returns a copy of the endpoint graph whose edge weights are
+// the share of the callee's traffic each edge carries: the calls per request times
+// the caller's requests, over the callee's requests. Callees that saw fewer
+// requests than their callers account for are divided among the callers alone,
+// so the shares entering an endpoint never add up to more than one.
+func trafficShareGraph(g *graph.Graph, report *models.CostReport) *graph.Graph {
+	requests := func(node *graph.Node) float64 {
+		if ec := endpointCostOf(report, node); ec != nil {
+			return ec.RequestCount
+		}
+		return 0
+	}
+
+	shares := graph.NewGraph()
+	for _, node := range g.GetAllNodes() {
+		shares.AddNode(node.ID, node.Service, node.Endpoint, node.Method, node.Data)
+	}
+
+	traffic := make(map[string]float64)
+	for _, edge := range g.GetAllEdges() {
+		traffic[edge.To.ID] += edge.Weight * requests(edge.From)
+	}
+
+	for _, edge := range g.GetAllEdges() {
+		share := 0.0
+		if total := max(requests(edge.To), traffic[edge.To.ID]); total > 0 {
+			share = edge.Weight * requests(edge.From) / total
+		}
+		from, _ := shares.GetNode(edge.From.ID)
+		to, _ := shares.GetNode(edge.To.ID)
+		shares.AddEdge(from, to, share, edge.Data)
+	}
+
+	return shares
+}
+
+// attributedShares returns the share of every called endpoint's traffic that
+// comes from other endpoints, keyed by node ID
+func attributedShares(shares *graph.Graph) map[string]float64 {
+	attributed := make(map[string]float64)
+	for _, edge := range shares.GetAllEdges() {
+		attributed[edge.To.ID] += edge.Weight
+	}
+	return attributed
+}
@@ -0,0 +1,131 @@
+package costengine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// Biller determines the CPU and memory a service is charged for
+type Biller struct {
+	mode models.BillingMode
+}
+
+// NewBiller creates a biller for the given billing mode, defaulting to usage
+func NewBiller(mode string) *Biller {
+	switch models.BillingMode(mode) {
+	case models.BillingRequest, models.BillingMaxRequestUsage:
+		return &Biller{mode: models.BillingMode(mode)}
+	default:
+		return &Biller{mode: models.BillingUsage}
+	}
+}
+
+// Mode returns the billing mode in use
+func (b *Biller) Mode() models.BillingMode {
+	return b.mode
+}
+
+// Billed returns the service's resources with CPU and memory replaced by the
+// billed quantities. Services without request data are billed for usage.
+func (b *Biller) Billed(sm *models.ServiceMetrics) *models.ResourceMetrics {
+	return billedResources(sm, b.mode)
+}
+
+// Reserved returns the service's resources billed as max(request, usage) per pod,
+// i.e. the capacity the service occupies whether or not it uses it
+func (b *Biller) Reserved(sm *models.ServiceMetrics) *models.ResourceMetrics {
+	return billedResources(sm, models.BillingMaxRequestUsage)
+}
+
+// billedResources applies a billing mode to the service aggregate
+func billedResources(sm *models.ServiceMetrics, mode models.BillingMode) *models.ResourceMetrics {
+	billed := *sm.Aggregate
+	durationHours := sm.TimeRange.Duration().Hours()
+
+	usedCPU := coreHours(sm.Aggregate, durationHours)
+	usedMemory := gbHours(sm.Aggregate, durationHours)
+
+	switch mode {
+	case models.BillingRequest:
+		if sm.Aggregate.CPURequestCoreHours > 0 {
+			billed.CPUCoreHours = sm.Aggregate.CPURequestCoreHours
+		}
+		if sm.Aggregate.MemoryRequestGBHours > 0 {
+			billed.MemoryGBHours = sm.Aggregate.MemoryRequestGBHours
+		}
+	case models.BillingMaxRequestUsage:
+		billed.CPUCoreHours = maxPerPod(sm.Series["cpu"], sm.Series["cpu_request"], usedCPU, sm.Aggregate.CPURequestCoreHours, 3600)
+		billed.MemoryGBHours = maxPerPod(sm.Series["memory"], sm.Series["memory_request"], usedMemory, sm.Aggregate.MemoryRequestGBHours, 3600*bytesPerGB)
+	default:
+		return &billed
+	}
+
+	// Keep the averages consistent with the billed totals
+	if durationHours > 0 {
+		billed.CPUCores = billed.CPUCoreHours / durationHours
+		billed.MemoryMB = billed.MemoryGBHours * 1024 / durationHours
+	}
+
+	return &billed
+}
+
+// bytesPerGB converts byte-seconds series values to GB-seconds
+const bytesPerGB = 1024 * 1024 * 1024
+
+// maxPerPod sums max(request, usage) over the pods of a service. Series values
+// are divided by scale to convert them to the unit of the totals. Without a
+// per-pod breakdown the service totals are compared instead.
+func maxPerPod(usage, requests []models.SeriesValue, usageTotal, requestTotal, scale float64) float64 {
+	if len(usage) == 0 || len(requests) == 0 {
+		return math.Max(usageTotal, requestTotal)
+	}
+
+	pods := make(map[string]*[2]float64)
+	add := func(series []models.SeriesValue, i int) {
+		for _, sv := range series {
+			key := seriesKey(sv.Labels)
+			if pods[key] == nil {
+				pods[key] = &[2]float64{}
+			}
+			pods[key][i] += sv.Value / scale
+		}
+	}
+	add(usage, 0)
+	add(requests, 1)
+
+	total := 0.0
+	for _, pod := range pods {
+		total += math.Max(pod[0], pod[1])
+	}
+	return total
+}
+
+// seriesKey returns a stable identifier for a label set
+func seriesKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// coreHours returns the CPU core-hours of rm, preferring the exact total
+func coreHours(rm *models.ResourceMetrics, durationHours float64) float64 {
+	if rm.CPUCoreHours > 0 {
+		return rm.CPUCoreHours
+	}
+	return rm.CPUCores * durationHours
+}
+
+// gbHours returns the memory GB-hours of rm, preferring the exact total
+func gbHours(rm *models.ResourceMetrics, durationHours float64) float64 {
+	if rm.MemoryGBHours > 0 {
+		return rm.MemoryGBHours
+	}
+	return rm.MemoryMB / 1024 * durationHours
+}
@@ -0,0 +1,69 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func newTestReservedServiceMetrics() *models.ServiceMetrics {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pod := func(name string, value float64) models.SeriesValue {
+		return models.SeriesValue{Labels: map[string]string{"service": "checkout", "pod": name}, Value: value}
+	}
+
+	return &models.ServiceMetrics{
+		ServiceName: "checkout",
+		TimeRange:   models.TimeRange{Start: start, End: start.Add(time.Hour)},
+		Aggregate: &models.ResourceMetrics{
+			CPUCoreHours:        1.5,
+			CPURequestCoreHours: 2.0,
+		},
+		Series: map[string][]models.SeriesValue{
+			// Core-seconds: pod a uses 0.25 of its 1 core request, pod b bursts to 1.25
+			"cpu":         {pod("a", 0.25*3600), pod("b", 1.25*3600)},
+			"cpu_request": {pod("a", 3600), pod("b", 3600)},
+		},
+	}
+}
+
+func TestBillerModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected float64
+	}{
+		{"usage", 1.5},
+		{"request", 2.0},
+		// Per pod: max(0.25, 1) + max(1.25, 1)
+		{"max", 2.25},
+	}
+
+	for _, tt := range tests {
+		billed := NewBiller(tt.mode).Billed(newTestReservedServiceMetrics())
+
+		if math.Abs(billed.CPUCoreHours-tt.expected) > 1e-9 {
+			t.Errorf("Expected %s billing of %f core-hours, got %f", tt.mode, tt.expected, billed.CPUCoreHours)
+		}
+	}
+}
+
+func TestBillerFallsBackToUsageWithoutRequests(t *testing.T) {
+	sm := newTestReservedServiceMetrics()
+	sm.Aggregate.CPURequestCoreHours = 0
+	sm.Series = nil
+
+	for _, mode := range []string{"request", "max"} {
+		billed := NewBiller(mode).Billed(sm)
+		if billed.CPUCoreHours != 1.5 {
+			t.Errorf("Expected %s billing to fall back to usage 1.5, got %f", mode, billed.CPUCoreHours)
+		}
+	}
+}
+
+func TestNewBillerDefaultsToUsage(t *testing.T) {
+	if mode := NewBiller("").Mode(); mode != models.BillingUsage {
+		t.Errorf("Expected default billing mode %s, got %s", models.BillingUsage, mode)
+	}
+}
@@ -11,14 +11,19 @@ import (
 
 // Calculator calculates costs for services and endpoints
 type Calculator struct {
-	config    *config.CostModelConfig
-	logger    *logrus.Logger
-	costModel *models.CostModel
-	graph     *graph.Graph
+	config        *config.CostModelConfig
+	logger        *logrus.Logger
+	costModel     *models.CostModel
+	serviceModels map[string]*models.CostModel // services priced on their own compute
+	allocator     *Allocator
+	biller        *Biller
+	attribution   models.AttributionMode
+	graph         *graph.Graph
 }
 
-// NewCalculator creates a new cost calculator
-func NewCalculator(cfg *config.CostModelConfig, g *graph.Graph, logger *logrus.Logger) *Calculator {
+// NewCalculator creates a new cost calculator. It fails if the configured
+// compute cannot be priced from the provider's catalog.
+func NewCalculator(cfg *config.CostModelConfig, g *graph.Graph, logger *logrus.Logger) (*Calculator, error) {
 	costModel := &models.CostModel{
 		CPUCostPerCoreHour:  cfg.CPUCostPerCoreHour,
 		MemoryCostPerGBHour: cfg.MemoryCostPerGBHour,
@@ -29,12 +34,19 @@ func NewCalculator(cfg *config.CostModelConfig, g *graph.Graph, logger *logrus.L
 		Region:              cfg.Region,
 	}
 
-	return &Calculator{
-		config:    cfg,
-		logger:    logger,
-		costModel: costModel,
-		graph:     g,
+	c := &Calculator{
+		config:      cfg,
+		logger:      logger,
+		costModel:   costModel,
+		allocator:   NewAllocator(&cfg.Allocation),
+		biller:      NewBiller(cfg.BillingMode),
+		attribution: parseAttributionMode(cfg.Attribution),
+		graph:       g,
 	}
+	if err := c.loadPricing(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 // CalculateCosts calculates costs for all services and endpoints
@@ -42,69 +54,96 @@ func (c *Calculator) CalculateCosts(callGraph *models.CallGraph, metricsSnapshot
 	c.logger.Info("Calculating costs...")
 
 	report := models.NewCostReport(c.costModel, timeRange)
+	report.AllocationMethod = c.allocator.Method()
+	report.BillingMode = c.biller.Mode()
+	report.AttributionMode = c.attribution
 
 	// Calculate duration in hours for cost calculation
 	durationHours := timeRange.End.Sub(timeRange.Start).Hours()
 
-	// Calculate costs for each service
+	// Serverless services are billed for invocations, less a free tier they share
+	serverless := c.serverlessUsages(metricsSnapshot, durationHours)
+	free := c.freeTier(serverless, durationHours)
+
+	// Calculate direct costs for each service, keeping the network traffic of
+	// every endpoint by node ID for the topology network model
+	traffic := make(map[string]*models.ResourceMetrics)
 	for serviceName, service := range callGraph.Services {
+		computeModel := c.computeModel(serviceName)
 		serviceCost := &models.ServiceCost{
 			ServiceName: serviceName,
 			Endpoints:   make(map[string]*models.EndpointCost),
+			CostModel:   c.serviceModels[serviceName],
+		}
+		if computeModel != models.ComputeContainer {
+			serviceCost.ComputeModel = computeModel
 		}
 
-		// Get service metrics
+		// Get service metrics and split the billed service resources across endpoints
 		serviceMetrics, _ := metricsSnapshot.GetServiceMetrics(serviceName)
+		var allocated map[string]*models.ResourceMetrics
+		var shares map[string]float64
+		if serviceMetrics != nil && serviceMetrics.Aggregate != nil {
+			billed := *serviceMetrics
+			billed.Aggregate = c.biller.Billed(serviceMetrics)
+			allocated = c.allocator.Allocate(&billed)
+			shares = c.allocator.Shares(serviceMetrics)
+			if computeModel == models.ComputeContainer {
+				serviceCost.IdleCost = c.calculateIdleCost(serviceMetrics, durationHours)
+			}
+		}
 
 		// Calculate costs for each endpoint
 		for _, endpoint := range service.Endpoints {
-			endpointCost := c.calculateEndpointCost(endpoint, serviceMetrics, durationHours)
+			endpointCost := c.calculateEndpointCost(endpoint, serviceMetrics, allocated, durationHours)
+			endpointCost.AllocationShare = shares[fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)]
 
 			key := fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)
+			if serviceMetrics != nil {
+				if resource := endpointResource(key, serviceMetrics, allocated); resource != nil {
+					traffic[fmt.Sprintf("%s:%s", serviceName, key)] = resource
+				}
+			}
 			serviceCost.Endpoints[key] = endpointCost
 			serviceCost.DirectCost += endpointCost.DirectCost
 		}
 
-		// Calculate attributed costs (downstream dependencies)
-		for _, endpoint := range service.Endpoints {
-			key := fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)
-			endpointCost := serviceCost.Endpoints[key]
+		switch computeModel {
+		case models.ComputeServerless:
+			c.priceServerless(serviceCost, serverless[serviceName], free, durationHours)
+		case models.ComputeFixedMonthly:
+			c.priceFixedMonthly(serviceCost, durationHours)
+		}
 
-			downstreamCosts := c.calculateDownstreamCosts(endpoint, callGraph, serviceCost.Endpoints, 0, make(map[string]bool))
-			endpointCost.DownstreamCosts = downstreamCosts
+		report.Services[serviceName] = serviceCost
+	}
 
-			// Sum up downstream costs
-			downstreamTotal := 0.0
-			for _, dc := range downstreamCosts {
-				downstreamTotal += dc.Cost
-			}
+	// Price data transfer by where it goes
+	if c.config.Network.Model == "topology" {
+		c.priceNetwork(c.endpointGraph(callGraph), metricsSnapshot, report, traffic)
+	}
 
-			endpointCost.TotalCost = endpointCost.DirectCost + downstreamTotal
-			if endpointCost.CostBreakdown != nil {
-				endpointCost.CostBreakdown.DownstreamTotal = downstreamTotal
-				endpointCost.CostBreakdown.Total = endpointCost.TotalCost
-			}
+	// Distribute cluster cost that no service accounts for
+	if clusterCost, ok := c.clusterCost(metricsSnapshot, durationHours); ok {
+		c.distributeSharedOverhead(report, clusterCost)
+	}
 
-			// Calculate cost per request
-			if endpointCost.RequestCount > 0 {
-				endpointCost.CostPerRequest = endpointCost.TotalCost / endpointCost.RequestCount
-			}
-		}
+	// Turn list prices into what is paid after spot, commitment and enterprise discounts
+	c.applyDiscounts(report, durationHours)
 
-		// Calculate total service cost
-		serviceCost.TotalCost = serviceCost.DirectCost
-		for _, ec := range serviceCost.Endpoints {
-			downstreamTotal := 0.0
-			for _, dc := range ec.DownstreamCosts {
-				downstreamTotal += dc.Cost
-			}
-			serviceCost.AttributedCost += downstreamTotal
-		}
-		serviceCost.TotalCost += serviceCost.AttributedCost
+	// Calculate attributed costs (downstream dependencies) and totals
+	c.calculateAttributedCosts(callGraph, report)
+	report.CalculateTotalCost()
 
-		report.AddServiceCost(serviceCost)
+	// Break costs down by environment when metrics were collected per namespace or cluster
+	report.Dimensions = metricsSnapshot.Dimensions
+	if len(metricsSnapshot.Environments) > 0 {
+		report.Environments = c.calculateEnvironmentCosts(callGraph, metricsSnapshot.Environments, timeRange)
 	}
 
+	// Spread direct costs over time buckets when the snapshot has time series
+	report.TimeSeries = c.calculateCostTimeSeries(metricsSnapshot, report)
+
 	// Find top costly endpoints
 	report.TopCostly = c.findTopCostlyEndpoints(report, 10)
 
@@ -115,8 +154,47 @@ func (c *Calculator) CalculateCosts(callGraph *models.CallGraph, metricsSnapshot
 	return report, nil
 }
 
-// calculateEndpointCost calculates the direct cost for an endpoint
-func (c *Calculator) calculateEndpointCost(endpoint *models.Endpoint, serviceMetrics *models.ServiceMetrics, durationHours float64) *models.EndpointCost {
+// calculateEnvironmentCosts calculates a cost summary for each environment snapshot.
+// Shared overhead and commitments of fixed core-hours are properties of the whole
+// cluster and are left out.
+func (c *Calculator) calculateEnvironmentCosts(callGraph *models.CallGraph, environments map[string]*models.MetricsSnapshot, timeRange models.TimeRange) map[string]*models.EnvironmentCost {
+	cfg := *c.config
+	cfg.SharedOverhead.Source = "none"
+	cfg.Discounts.Commitments = make([]config.CommitmentConfig, 0, len(c.config.Discounts.Commitments))
+	for _, commitment := range c.config.Discounts.Commitments {
+		if commitment.CoreHours == 0 {
+			cfg.Discounts.Commitments = append(cfg.Discounts.Commitments, commitment)
+		}
+	}
+	envCalculator := *c
+	envCalculator.config = &cfg
+
+	costs := make(map[string]*models.EnvironmentCost, len(environments))
+	for name, snapshot := range environments {
+		envReport, err := envCalculator.CalculateCosts(callGraph, snapshot, timeRange)
+		if err != nil {
+			c.logger.WithError(err).Warnf("Error calculating costs for environment %s", name)
+			continue
+		}
+
+		envCost := &models.EnvironmentCost{
+			Dimensions: snapshot.Dimensions,
+			TotalCost:  envReport.TotalCost,
+			Services:   make(map[string]float64, len(envReport.Services)),
+		}
+		for serviceName, sc := range envReport.Services {
+			envCost.Services[serviceName] = sc.TotalCost
+		}
+		costs[name] = envCost
+	}
+
+	return costs
+}
+
+// calculateEndpointCost calculates the direct cost for an endpoint. Resources come from
+// the endpoint's allocated share of the service; snapshots without a service aggregate
+// fall back to the resources recorded on the endpoint itself.
+func (c *Calculator) calculateEndpointCost(endpoint *models.Endpoint, serviceMetrics *models.ServiceMetrics, allocated map[string]*models.ResourceMetrics, durationHours float64) *models.EndpointCost {
 	ec := &models.EndpointCost{
 		Service:  endpoint.Service.Name,
 		Endpoint: endpoint.Path,
@@ -129,15 +207,20 @@ func (c *Calculator) calculateEndpointCost(endpoint *models.Endpoint, serviceMet
 
 	key := fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)
 	endpointMetrics, exists := serviceMetrics.Endpoints[key]
-	if !exists || endpointMetrics.Resource == nil {
+	if !exists {
+		return ec
+	}
+
+	resource := endpointResource(key, serviceMetrics, allocated)
+	if resource == nil {
 		return ec
 	}
 
 	// Calculate cost breakdown
 	costBreakdown := models.NewCostBreakdown(
-		endpointMetrics.Resource,
+		resource,
 		endpointMetrics.Performance,
-		c.costModel,
+		c.modelFor(endpoint.Service.Name),
 		durationHours,
 	)
 
@@ -146,70 +229,116 @@ func (c *Calculator) calculateEndpointCost(endpoint *models.Endpoint, serviceMet
 
 	// Store request count for cost per request calculation
 	if endpointMetrics.Performance != nil {
-		ec.RequestCount = endpointMetrics.Performance.RequestRate * durationHours * 3600
+		ec.RequestCount = endpointMetrics.Performance.TotalRequests(durationHours)
 	}
 
 	return ec
 }
 
-// calculateDownstreamCosts recursively calculates costs from downstream dependencies
-func (c *Calculator) calculateDownstreamCosts(endpoint *models.Endpoint, callGraph *models.CallGraph, endpointCosts map[string]*models.EndpointCost, depth int, visited map[string]bool) []models.DownstreamCost {
-	maxDepth := 10 // Prevent infinite recursion
-	if depth > maxDepth {
-		return nil
+// endpointResource returns the resources of an endpoint: its allocated share of the
+// service, or the resources recorded on the endpoint without a service aggregate
+func endpointResource(key string, serviceMetrics *models.ServiceMetrics, allocated map[string]*models.ResourceMetrics) *models.ResourceMetrics {
+	if allocated != nil {
+		return allocated[key]
+	}
+	if em, exists := serviceMetrics.Endpoints[key]; exists {
+		return em.Resource
 	}
+	return nil
+}
 
-	downstreamCosts := make([]models.DownstreamCost, 0)
+// calculateIdleCost returns the cost of CPU and memory a service reserves through
+// resource requests but does not use
+func (c *Calculator) calculateIdleCost(serviceMetrics *models.ServiceMetrics, durationHours float64) float64 {
+	model := c.modelFor(serviceMetrics.ServiceName)
+	reserved := models.NewCostBreakdown(c.biller.Reserved(serviceMetrics), nil, model, durationHours)
+	used := models.NewCostBreakdown(serviceMetrics.Aggregate, nil, model, durationHours)
 
-	// Find dependencies for this endpoint
-	for _, dep := range callGraph.Dependencies {
-		if dep.FromService == endpoint.Service.Name && dep.FromEndpoint == endpoint.Path {
-			// Check if we've already visited this dependency (cycle detection)
-			depKey := fmt.Sprintf("%s:%s", dep.ToService, dep.ToEndpoint)
-			if visited[depKey] {
-				c.logger.Warnf("Circular dependency detected: %s", depKey)
-				continue
-			}
+	idle := (reserved.CPUCost + reserved.MemoryCost) - (used.CPUCost + used.MemoryCost)
+	if idle < 0 {
+		return 0
+	}
+	return idle
+}
 
-			// Find the cost of the downstream endpoint
-			targetKey := fmt.Sprintf("%s:%s", dep.ToEndpoint, "GET") // Simplified
-			var targetCost float64
+// endpointGraph returns the endpoint graph of the calculator, or builds it from
+// the call graph when the calculator was given none
+func (c *Calculator) endpointGraph(callGraph *models.CallGraph) *graph.Graph {
+	if c.graph == nil || c.graph.NodeCount() == 0 {
+		return graph.FromCallGraph(callGraph)
+	}
+	return c.graph
+}
 
-			if ec, exists := endpointCosts[targetKey]; exists {
-				targetCost = ec.DirectCost
-			}
+// calculateAttributedCosts adds the cost of downstream endpoints to every endpoint
+// and service. Downstream calls are propagated once over the endpoint graph,
+// which is built from the call graph when the calculator was given none. In
+// traffic_share mode traffic shares are propagated the same way, and the part of
+// a called endpoint's total that no caller accounts for is reported as unattributed.
+func (c *Calculator) calculateAttributedCosts(callGraph *models.CallGraph, report *models.CostReport) {
+	g := c.endpointGraph(callGraph)
+	calls := c.propagateCalls(g)
+
+	var shares map[string]downstreamCalls
+	var attributed map[string]float64
+	if c.attribution == models.AttributionTrafficShare {
+		shareGraph := trafficShareGraph(g, report)
+		shares = c.propagateCalls(shareGraph)
+		attributed = attributedShares(shareGraph)
+	}
 
-			// Apply weight (calls per request)
-			weightedCost := targetCost * dep.Weight
+	for serviceName, service := range callGraph.Services {
+		serviceCost := report.Services[serviceName]
 
-			dc := models.DownstreamCost{
-				Service:         dep.ToService,
-				Endpoint:        dep.ToEndpoint,
-				Cost:            weightedCost,
-				CallsPerRequest: dep.Weight,
-				Depth:           depth + 1,
-			}
+		for _, endpoint := range service.Endpoints {
+			key := fmt.Sprintf("%s:%s", endpoint.Path, endpoint.Method)
+			endpointCost := serviceCost.Endpoints[key]
 
-			downstreamCosts = append(downstreamCosts, dc)
+			node, exists := g.GetNode(fmt.Sprintf("%s:%s", serviceName, key))
+			if exists {
+				var nodeShares downstreamCalls
+				if shares != nil {
+					nodeShares = shares[node.ID]
+				}
+				endpointCost.DownstreamCosts = downstreamCosts(g, node, calls[node.ID], nodeShares, report)
+			}
 
-			// Recursively calculate downstream costs of the dependency
-			if targetService, exists := callGraph.GetService(dep.ToService); exists {
-				if targetEndpoint, epExists := targetService.GetEndpoint(dep.ToEndpoint, "GET"); epExists {
-					visited[depKey] = true
-					nestedCosts := c.calculateDownstreamCosts(targetEndpoint, callGraph, endpointCosts, depth+1, visited)
-					delete(visited, depKey)
+			// Sum up downstream costs
+			downstreamTotal := 0.0
+			for _, dc := range endpointCost.DownstreamCosts {
+				downstreamTotal += dc.Cost
+			}
 
-					// Add nested costs (scaled by weight)
-					for _, nc := range nestedCosts {
-						nc.Cost *= dep.Weight
-						downstreamCosts = append(downstreamCosts, nc)
-					}
+			endpointCost.TotalCost = endpointCost.DirectCost + downstreamTotal
+			if exists && attributed != nil {
+				if share, called := attributed[node.ID]; called {
+					endpointCost.UnattributedCost = max(endpointCost.TotalCost*(1-share), 0)
 				}
 			}
+			if endpointCost.CostBreakdown != nil {
+				endpointCost.CostBreakdown.DownstreamTotal = downstreamTotal
+				endpointCost.CostBreakdown.Total = endpointCost.TotalCost
+			}
+
+			// Calculate cost per request
+			if endpointCost.RequestCount > 0 {
+				endpointCost.CostPerRequest = endpointCost.TotalCost / endpointCost.RequestCount
+			}
 		}
-	}
 
-	return downstreamCosts
+		// Calculate total service cost
+		serviceCost.TotalCost = serviceCost.DirectCost
+		for _, ec := range serviceCost.Endpoints {
+			downstreamTotal := 0.0
+			for _, dc := range ec.DownstreamCosts {
+				downstreamTotal += dc.Cost
+			}
+			serviceCost.AttributedCost += downstreamTotal
+			serviceCost.UnattributedCost += ec.UnattributedCost
+		}
+		serviceCost.TotalCost += serviceCost.AttributedCost
+		report.UnattributedCost += serviceCost.UnattributedCost
+	}
 }
 
 // findTopCostlyEndpoints finds the most expensive endpoints
@@ -264,6 +393,15 @@ func (c *Calculator) generateRecommendations(report *models.CostReport) []string
 		}
 	}
 
+	// Check for services that reserve much more than they use
+	for _, serviceCost := range report.Services {
+		if serviceCost.IdleCost > 0 && serviceCost.IdleCost > serviceCost.DirectCost*0.5 {
+			recommendations = append(recommendations,
+				fmt.Sprintf("%s has $%.4f of requested but unused CPU and memory - consider lowering its resource requests",
+					serviceCost.ServiceName, serviceCost.IdleCost))
+		}
+	}
+
 	return recommendations
 }
 
@@ -0,0 +1,239 @@
+package costengine
+
+import (
+	"math"
+	"time"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// serverlessUsage is what the invocations of a serverless endpoint are billed for
+type serverlessUsage struct {
+	invocations          float64
+	instanceSeconds      float64 // billed duration of the invocations
+	gbSeconds            float64 // on-demand duration at the configured memory
+	provisionedGBSeconds float64 // duration served by provisioned instances
+	vcpuSeconds          float64
+}
+
+// freeTierShare is the fraction of serverless usage the free tier covers
+type freeTierShare struct {
+	requests    float64
+	gbSeconds   float64
+	vcpuSeconds float64
+}
+
+// computeModel returns the compute model of a service
+func (c *Calculator) computeModel(service string) models.ComputeModel {
+	switch model := models.ComputeModel(c.config.ComputeModels.Services[service].Model); model {
+	case models.ComputeServerless, models.ComputeFixedMonthly:
+		return model
+	default:
+		return models.ComputeContainer
+	}
+}
+
+// serverlessUsages returns the billed usage of the endpoints of every serverless
+// service, keyed by service and "path:method"
+func (c *Calculator) serverlessUsages(snapshot *models.MetricsSnapshot, durationHours float64) map[string]map[string]*serverlessUsage {
+	usages := make(map[string]map[string]*serverlessUsage)
+	for service, cm := range c.config.ComputeModels.Services {
+		if c.computeModel(service) != models.ComputeServerless {
+			continue
+		}
+		if sm, exists := snapshot.GetServiceMetrics(service); exists {
+			usages[service] = endpointServerlessUsage(cm, sm, durationHours)
+		}
+	}
+	return usages
+}
+
+// endpointServerlessUsage derives the invocations and billed duration of every
+// endpoint from its requests and average latency. Durations are rounded up to the
+// billing granularity and shared by concurrent requests; provisioned instances
+// serve the invocations up to their capacity.
+func endpointServerlessUsage(cm config.ComputeModelConfig, sm *models.ServiceMetrics, durationHours float64) map[string]*serverlessUsage {
+	concurrency := cm.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	granularity := cm.BillingGranularityMs
+	if granularity == 0 {
+		granularity = 1
+	}
+
+	usage := make(map[string]*serverlessUsage, len(sm.Endpoints))
+	total := 0.0
+	for key, em := range sm.Endpoints {
+		if em.Performance == nil {
+			continue
+		}
+		invocations := em.Performance.TotalRequests(durationHours)
+		ms := float64(em.Performance.LatencyAvg) / float64(time.Millisecond)
+		billedMs := math.Ceil(ms/granularity) * granularity
+
+		u := &serverlessUsage{
+			invocations:     invocations,
+			instanceSeconds: invocations * billedMs / 1000 / concurrency,
+		}
+		usage[key] = u
+		total += u.instanceSeconds
+	}
+
+	covered := 0.0
+	if capacity := cm.ProvisionedConcurrency * durationHours * 3600; total > 0 {
+		covered = min(capacity/total, 1)
+	}
+	memoryGB := cm.MemoryMB / 1024
+	for _, u := range usage {
+		u.gbSeconds = u.instanceSeconds * (1 - covered) * memoryGB
+		u.provisionedGBSeconds = u.instanceSeconds * covered * memoryGB
+		u.vcpuSeconds = u.instanceSeconds * cm.CPUs
+	}
+
+	return usage
+}
+
+// freeTier returns the share of on-demand serverless usage covered by the free
+// tier, prorated to the time range and shared by all serverless services
+func (c *Calculator) freeTier(usages map[string]map[string]*serverlessUsage, durationHours float64) freeTierShare {
+	tier := c.config.ComputeModels.FreeTier
+	months := durationHours / hoursPerMonth
+
+	var requests, gbSeconds, vcpuSeconds float64
+	for _, endpoints := range usages {
+		for _, u := range endpoints {
+			requests += u.invocations
+			gbSeconds += u.gbSeconds
+			vcpuSeconds += u.vcpuSeconds
+		}
+	}
+
+	share := func(free, used float64) float64 {
+		if used == 0 {
+			return 0
+		}
+		return min(free*months/used, 1)
+	}
+	return freeTierShare{
+		requests:    share(tier.Requests, requests),
+		gbSeconds:   share(tier.GBSeconds, gbSeconds),
+		vcpuSeconds: share(tier.VCPUSeconds, vcpuSeconds),
+	}
+}
+
+// priceServerless replaces the compute and request costs of a serverless service's
+// endpoints with the price of their invocations and billed duration, after the free
+// tier. Provisioned concurrency is charged for the whole time range and split by
+// the endpoints' share of duration.
+func (c *Calculator) priceServerless(serviceCost *models.ServiceCost, usage map[string]*serverlessUsage, free freeTierShare, durationHours float64) {
+	cm := c.config.ComputeModels.Services[serviceCost.ServiceName]
+	model := c.modelFor(serviceCost.ServiceName)
+
+	gbSecond := orDefault(cm.GBSecondCost, model.MemoryCostPerGBHour/3600)
+	vcpuSecond := orDefault(cm.VCPUSecondCost, model.CPUCostPerCoreHour/3600)
+	invocation := orDefault(cm.InvocationCost, model.RequestCost)
+	provisionedDuration := orDefault(cm.ProvisionedDurationCost, gbSecond)
+	provisionedCost := cm.ProvisionedConcurrency * durationHours * 3600 * cm.MemoryMB / 1024 *
+		orDefault(cm.ProvisionedGBSecondCost, gbSecond)
+
+	totalSeconds := 0.0
+	for _, u := range usage {
+		totalSeconds += u.instanceSeconds
+	}
+
+	serviceCost.DirectCost = 0
+	for key, ec := range serviceCost.Endpoints {
+		cb := endpointBreakdown(ec, model, durationHours)
+		u, exists := usage[key]
+		if !exists {
+			u = &serverlessUsage{}
+		}
+
+		share := 1 / float64(len(serviceCost.Endpoints))
+		if totalSeconds > 0 {
+			share = u.instanceSeconds / totalSeconds
+		}
+		provisioned := provisionedCost * share
+
+		cb.MemoryCost = u.gbSeconds*(1-free.gbSeconds)*gbSecond + u.provisionedGBSeconds*provisionedDuration + provisioned
+		cb.CPUCost = u.vcpuSeconds * (1 - free.vcpuSeconds) * vcpuSecond
+		cb.RequestCost = u.invocations * (1 - free.requests) * invocation
+
+		cb.Details["invocations"] = u.invocations
+		cb.Details["gb_seconds"] = u.gbSeconds + u.provisionedGBSeconds
+		if u.vcpuSeconds > 0 {
+			cb.Details["vcpu_seconds"] = u.vcpuSeconds
+		}
+		if provisioned > 0 {
+			cb.Details["provisioned_concurrency"] = provisioned
+		}
+		if savings := u.gbSeconds*free.gbSeconds*gbSecond + u.vcpuSeconds*free.vcpuSeconds*vcpuSecond +
+			u.invocations*free.requests*invocation; savings > 0 {
+			cb.Details["free_tier_savings"] = savings
+		}
+
+		cb.Total = cb.CPUCost + cb.MemoryCost + cb.NetworkCost + cb.DiskCost + cb.RequestCost
+		ec.DirectCost = cb.Total
+		if ec.RequestCount == 0 {
+			ec.RequestCount = u.invocations
+		}
+		serviceCost.DirectCost += ec.DirectCost
+	}
+}
+
+// priceFixedMonthly replaces the compute cost of a fixed-price service's endpoints
+// with its monthly cost over the time range, split by the endpoints' allocation
+// shares or evenly without traffic
+func (c *Calculator) priceFixedMonthly(serviceCost *models.ServiceCost, durationHours float64) {
+	cm := c.config.ComputeModels.Services[serviceCost.ServiceName]
+	model := c.modelFor(serviceCost.ServiceName)
+	cost := cm.MonthlyCost * durationHours / hoursPerMonth
+
+	if len(serviceCost.Endpoints) == 0 {
+		c.logger.Warnf("Service %s has no endpoints to carry its fixed monthly cost", serviceCost.ServiceName)
+		return
+	}
+
+	totalShare := 0.0
+	for _, ec := range serviceCost.Endpoints {
+		totalShare += ec.AllocationShare
+	}
+
+	serviceCost.DirectCost = 0
+	for _, ec := range serviceCost.Endpoints {
+		cb := endpointBreakdown(ec, model, durationHours)
+		share := 1 / float64(len(serviceCost.Endpoints))
+		if totalShare > 0 {
+			share = ec.AllocationShare / totalShare
+		}
+
+		cb.CPUCost = 0
+		cb.MemoryCost = 0
+		cb.FixedCost = cost * share
+		cb.Total = cb.NetworkCost + cb.DiskCost + cb.RequestCost + cb.FixedCost
+		ec.DirectCost = cb.Total
+		serviceCost.DirectCost += ec.DirectCost
+	}
+}
+
+// endpointBreakdown returns the cost breakdown of an endpoint, creating an empty
+// one for endpoints without resource metrics
+func endpointBreakdown(ec *models.EndpointCost, model *models.CostModel, durationHours float64) *models.CostBreakdown {
+	if ec.CostBreakdown == nil {
+		ec.CostBreakdown = models.NewCostBreakdown(nil, nil, model, durationHours)
+	}
+	if ec.CostBreakdown.Details == nil {
+		ec.CostBreakdown.Details = make(map[string]float64)
+	}
+	return ec.CostBreakdown
+}
+
+// orDefault returns price, or fallback when price is not set
+func orDefault(price, fallback float64) float64 {
+	if price > 0 {
+		return price
+	}
+	return fallback
+}
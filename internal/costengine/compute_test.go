@@ -0,0 +1,109 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestComputeModels(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeRange := models.TimeRange{Start: start, End: start.Add(time.Hour)}
+
+	callGraph := models.NewCallGraph()
+	snapshot := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+	for _, name := range []string{"fn", "erp", "web"} {
+		service := &models.Service{Name: name}
+		service.AddEndpoint(&models.Endpoint{Path: "/a", Method: "GET"})
+		service.AddEndpoint(&models.Endpoint{Path: "/b", Method: "GET"})
+		callGraph.AddService(service)
+
+		// 3600 requests of 100ms on /a, 10800 of 200ms on /b
+		snapshot.AddServiceMetrics(&models.ServiceMetrics{
+			ServiceName: name,
+			TimeRange:   timeRange,
+			Aggregate:   &models.ResourceMetrics{CPUCoreHours: 2},
+			Endpoints: map[string]*models.EndpointMetrics{
+				"/a:GET": {Performance: &models.PerformanceMetrics{RequestRate: 1, LatencyAvg: 100 * time.Millisecond}},
+				"/b:GET": {Performance: &models.PerformanceMetrics{RequestRate: 3, LatencyAvg: 200 * time.Millisecond}},
+			},
+		})
+	}
+
+	cfg := config.CostModelConfig{
+		Provider:           "custom",
+		CPUCostPerCoreHour: 1,
+		ComputeModels: config.ComputeModelsConfig{
+			Services: map[string]config.ComputeModelConfig{
+				"fn": {
+					Model:                   "serverless",
+					MemoryMB:                2048,
+					GBSecondCost:            0.00001,
+					InvocationCost:          0.0000002,
+					ProvisionedConcurrency:  0.35,
+					ProvisionedGBSecondCost: 0.000004,
+					ProvisionedDurationCost: 0.000008,
+				},
+				"erp": {Model: "fixed_monthly", MonthlyCost: 730},
+			},
+			// Prorated to the hour, half of the on-demand GB-seconds and requests
+			FreeTier: config.FreeTierConfig{Requests: 730 * 7200, GBSeconds: 730 * 1260},
+		},
+	}
+	calculator, err := NewCalculator(&cfg, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+
+	report, err := calculator.CalculateCosts(callGraph, snapshot, timeRange)
+	if err != nil {
+		t.Fatalf("CalculateCosts failed: %v", err)
+	}
+
+	// 2520 instance-seconds, 1260 of them on provisioned instances, at 2 GB
+	provisioned := 0.35 * 3600 * 2 * 0.000004
+	fnA := 360*0.5*0.00001 + 360*0.000008 + provisioned*360/2520 + 3600*0.5*0.0000002
+	fnB := 2160*0.5*0.00001 + 2160*0.000008 + provisioned*2160/2520 + 10800*0.5*0.0000002
+
+	tests := []struct {
+		service      string
+		computeModel models.ComputeModel
+		endpoints    map[string]float64
+	}{
+		{"fn", models.ComputeServerless, map[string]float64{"/a:GET": fnA, "/b:GET": fnB}},
+		{"erp", models.ComputeFixedMonthly, map[string]float64{"/a:GET": 0.25, "/b:GET": 0.75}},
+		{"web", "", map[string]float64{"/a:GET": 0.5, "/b:GET": 1.5}},
+	}
+
+	for _, tt := range tests {
+		sc := report.Services[tt.service]
+		if sc.ComputeModel != tt.computeModel {
+			t.Errorf("Expected %s compute model %q, got %q", tt.service, tt.computeModel, sc.ComputeModel)
+		}
+
+		total := 0.0
+		for key, expected := range tt.endpoints {
+			if got := sc.Endpoints[key].DirectCost; math.Abs(got-expected) > 1e-9 {
+				t.Errorf("Expected %s %s direct cost %f, got %f", tt.service, key, expected, got)
+			}
+			total += expected
+		}
+		if math.Abs(sc.DirectCost-total) > 1e-9 {
+			t.Errorf("Expected %s direct cost %f, got %f", tt.service, total, sc.DirectCost)
+		}
+	}
+
+	cb := report.Services["fn"].Endpoints["/b:GET"].CostBreakdown
+	if cb.Details["invocations"] != 10800 || math.Abs(cb.Details["gb_seconds"]-4320) > 1e-9 {
+		t.Errorf("Expected 10800 invocations and 4320 GB-seconds, got %v", cb.Details)
+	}
+	if report.Services["erp"].IdleCost != 0 || report.Services["erp"].Endpoints["/a:GET"].CostBreakdown.CPUCost != 0 {
+		t.Error("Expected no CPU or idle cost for the fixed-price service")
+	}
+}
@@ -0,0 +1,196 @@
+package costengine
+
+import (
+	"sort"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// computeSavings is what spot capacity and commitments save on the compute (CPU,
+// memory and shared overhead) of a service, per dollar of list compute cost
+type computeSavings struct {
+	spot       float64
+	commitment float64
+}
+
+// applyDiscounts turns the list-price direct costs of the report into effective
+// costs. Spot capacity is priced at the spot discount; commitments then cover the
+// remaining on-demand compute in the configured order, and the enterprise discount
+// applies to every cost after them. List and effective costs are kept side by side.
+func (c *Calculator) applyDiscounts(report *models.CostReport, durationHours float64) {
+	cfg := &c.config.Discounts
+	if !cfg.Enabled() {
+		return
+	}
+
+	savings := c.computeSavings(report, durationHours)
+	enterprise := cfg.Enterprise / 100
+
+	for name, serviceCost := range report.Services {
+		s := savings[name]
+		computeFactor := (1 - s.spot - s.commitment) * (1 - enterprise)
+
+		serviceCost.ListCost = serviceCost.DirectCost
+		for _, ec := range serviceCost.Endpoints {
+			cb := ec.CostBreakdown
+			if cb == nil {
+				continue
+			}
+			compute := cb.CPUCost + cb.MemoryCost + cb.SharedOverhead
+			other := cb.NetworkCost + cb.DiskCost + cb.RequestCost + cb.FixedCost
+			cb.ListCost = ec.DirectCost
+			if cb.Details == nil {
+				cb.Details = make(map[string]float64)
+			}
+
+			cb.Details["spot_savings"] = compute * s.spot
+			cb.Details["commitment_savings"] = compute * s.commitment
+			cb.Details["enterprise_savings"] = (compute*(1-s.spot-s.commitment) + other) * enterprise
+
+			cb.CPUCost *= computeFactor
+			cb.MemoryCost *= computeFactor
+			cb.SharedOverhead *= computeFactor
+			cb.NetworkCost *= 1 - enterprise
+			cb.DiskCost *= 1 - enterprise
+			cb.RequestCost *= 1 - enterprise
+			cb.FixedCost *= 1 - enterprise
+
+			cb.Total = cb.CPUCost + cb.MemoryCost + cb.NetworkCost + cb.DiskCost + cb.RequestCost + cb.SharedOverhead + cb.FixedCost
+			cb.EffectiveCost = cb.Total
+			serviceCost.DirectCost -= ec.DirectCost - cb.Total
+			ec.DirectCost = cb.Total
+		}
+		serviceCost.IdleCost *= computeFactor
+		serviceCost.SharedOverhead *= computeFactor
+		report.ListCost += serviceCost.ListCost
+	}
+}
+
+// computeSavings returns the spot and commitment savings of every service
+func (c *Calculator) computeSavings(report *models.CostReport, durationHours float64) map[string]computeSavings {
+	cfg := &c.config.Discounts
+
+	// Visit services in a stable order so shared commitments split reproducibly
+	names := make([]string, 0, len(report.Services))
+	for name := range report.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listCompute := make(map[string]float64, len(names))
+	allOnDemand := make(map[string]float64, len(names))
+	onDemand := make(map[string]float64, len(names))  // on-demand compute cost not yet covered
+	coreHours := make(map[string]float64, len(names)) // on-demand core-hours not yet covered
+	savings := make(map[string]computeSavings, len(names))
+
+	for _, name := range names {
+		var compute, cpu float64
+		for _, ec := range report.Services[name].Endpoints {
+			if cb := ec.CostBreakdown; cb != nil {
+				compute += cb.CPUCost + cb.MemoryCost + cb.SharedOverhead
+				cpu += cb.CPUCost
+			}
+		}
+		if compute == 0 {
+			continue
+		}
+		listCompute[name] = compute
+
+		spot, discount := spotShare(cfg, name)
+		s := savings[name]
+		s.spot = spot * discount
+		savings[name] = s
+
+		allOnDemand[name] = compute * (1 - spot)
+		onDemand[name] = allOnDemand[name]
+		if rate := c.modelFor(name).CPUCostPerCoreHour; rate > 0 {
+			coreHours[name] = cpu / rate * (1 - spot)
+		}
+	}
+
+	for _, commitment := range cfg.Commitments {
+		covered := commitmentServices(commitment, names)
+		discount := commitment.Discount / 100
+
+		// A fixed number of core-hours covers the same fraction of every service
+		fraction := commitment.Coverage / 100
+		if commitment.CoreHours > 0 {
+			available := 0.0
+			for _, name := range covered {
+				available += coreHours[name]
+			}
+			if available == 0 {
+				continue
+			}
+			committed := commitment.CoreHours * durationHours
+			fraction = min(committed/available, 1)
+			if committed > available {
+				c.logger.Infof("Commitment %s covers %.0f core-hours but only %.0f on-demand core-hours remain, %.0f%% is unused",
+					commitment.Name, committed, available, (committed-available)/committed*100)
+			}
+		}
+
+		for _, name := range covered {
+			if listCompute[name] == 0 {
+				continue
+			}
+			amount := onDemand[name] * fraction
+			if commitment.Coverage > 0 {
+				// Coverage is a share of all on-demand compute, up to what is left
+				amount = min(allOnDemand[name]*fraction, onDemand[name])
+			}
+
+			s := savings[name]
+			s.commitment += amount / listCompute[name] * discount
+			savings[name] = s
+
+			if onDemand[name] > 0 {
+				coreHours[name] *= 1 - amount/onDemand[name]
+			}
+			onDemand[name] -= amount
+		}
+	}
+
+	return savings
+}
+
+// spotShare returns the fraction of a service's compute on spot and the spot
+// discount, from the service's own setting or the node pool it runs on
+func spotShare(cfg *config.DiscountsConfig, service string) (float64, float64) {
+	if spot, exists := cfg.Spot[service]; exists {
+		return spot / 100, cfg.SpotDiscount / 100
+	}
+
+	for _, pool := range cfg.NodePools {
+		for _, name := range pool.Services {
+			if name != service {
+				continue
+			}
+			discount := pool.Discount
+			if discount == 0 {
+				discount = cfg.SpotDiscount
+			}
+			return pool.Spot / 100, discount / 100
+		}
+	}
+	return 0, 0
+}
+
+// commitmentServices returns the services a commitment covers
+func commitmentServices(commitment config.CommitmentConfig, names []string) []string {
+	if len(commitment.Services) == 0 {
+		return names
+	}
+
+	covered := make([]string, 0, len(commitment.Services))
+	for _, name := range names {
+		for _, service := range commitment.Services {
+			if service == name {
+				covered = append(covered, name)
+				break
+			}
+		}
+	}
+	return covered
+}
@@ -0,0 +1,96 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// newDiscountFixture returns a report of services with one endpoint each costing
+// $60 CPU (60 core-hours at $1), $40 memory and $10 requests at list prices
+func newDiscountFixture(services ...string) *models.CostReport {
+	report := models.NewCostReport(&models.CostModel{}, models.TimeRange{})
+	for _, name := range services {
+		cb := &models.CostBreakdown{CPUCost: 60, MemoryCost: 40, RequestCost: 10, Total: 110, Details: make(map[string]float64)}
+		report.Services[name] = &models.ServiceCost{
+			ServiceName: name,
+			DirectCost:  110,
+			Endpoints: map[string]*models.EndpointCost{
+				"/:GET": {Service: name, Endpoint: "/", Method: "GET", DirectCost: 110, CostBreakdown: cb},
+			},
+		}
+	}
+	return report
+}
+
+func TestApplyDiscounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		discounts config.DiscountsConfig
+		expected  map[string]float64 // effective direct cost per service
+	}{
+		{
+			// a: half on spot at 60% off, half of the on-demand rest covered at 30% off
+			name: "spot, coverage and enterprise",
+			discounts: config.DiscountsConfig{
+				Enterprise:   10,
+				SpotDiscount: 60,
+				Spot:         map[string]float64{"a": 50},
+				Commitments:  []config.CommitmentConfig{{Name: "savings plan", Coverage: 50, Discount: 30}},
+			},
+			expected: map[string]float64{"a": 100*0.625*0.9 + 9, "b": 100*0.85*0.9 + 9},
+		},
+		{
+			// 30 core-hours cover a quarter of the 120 on-demand core-hours
+			name: "fixed core-hours",
+			discounts: config.DiscountsConfig{
+				Commitments: []config.CommitmentConfig{{Name: "reserved", CoreHours: 30, Discount: 40}},
+			},
+			expected: map[string]float64{"a": 90 + 10, "b": 90 + 10},
+		},
+		{
+			name: "node pool",
+			discounts: config.DiscountsConfig{
+				SpotDiscount: 70,
+				NodePools:    map[string]config.NodePoolConfig{"batch": {Spot: 100, Discount: 50, Services: []string{"b"}}},
+			},
+			expected: map[string]float64{"a": 110, "b": 50 + 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.CostModelConfig{CPUCostPerCoreHour: 1, Discounts: tt.discounts}
+			calculator, err := NewCalculator(cfg, graph.NewGraph(), logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create calculator: %v", err)
+			}
+			report := newDiscountFixture("a", "b")
+			calculator.applyDiscounts(report, 1)
+
+			for service, expected := range tt.expected {
+				sc := report.Services[service]
+				cb := sc.Endpoints["/:GET"].CostBreakdown
+				if math.Abs(sc.DirectCost-expected) > 1e-9 || math.Abs(cb.EffectiveCost-expected) > 1e-9 {
+					t.Errorf("Expected %s effective cost %f, got %f (breakdown %f)", service, expected, sc.DirectCost, cb.EffectiveCost)
+				}
+				if sc.ListCost != 110 || cb.ListCost != 110 {
+					t.Errorf("Expected %s list cost 110, got %f (breakdown %f)", service, sc.ListCost, cb.ListCost)
+				}
+
+				saved := cb.Details["spot_savings"] + cb.Details["commitment_savings"] + cb.Details["enterprise_savings"]
+				if math.Abs(cb.ListCost-saved-cb.EffectiveCost) > 1e-9 {
+					t.Errorf("Expected %s savings %f to explain the discount, got %f", service, cb.ListCost-cb.EffectiveCost, saved)
+				}
+			}
+			if report.ListCost != 220 {
+				t.Errorf("Expected report list cost 220, got %f", report.ListCost)
+			}
+		})
+	}
+}
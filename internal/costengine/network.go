@@ -0,0 +1,203 @@
+package costengine
+
+import (
+	"fmt"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// bytesPerMB converts the network traffic of resource metrics to bytes
+const bytesPerMB = 1024 * 1024
+
+// placement is where the pods of a service run: a region and the share of pods
+// in each zone
+type placement struct {
+	region string
+	zones  map[string]float64
+}
+
+// edgeBytes is the data transferred by one call along a dependency edge
+type edgeBytes struct {
+	request  float64 // sent by the caller
+	response float64 // sent by the callee
+}
+
+// transfer is the data transfer cost of an endpoint by destination
+type transfer struct {
+	intraZone   float64
+	crossZone   float64
+	crossRegion float64
+}
+
+// priceNetwork prices the data transfer of every endpoint under the topology
+// network model. Each dependency edge carries the caller's requests times the
+// calls per request, priced by the zones and regions of caller and callee and
+// charged to the calling endpoint. Ingress is free; bytes an endpoint sends that
+// no edge accounts for leave the cloud and are priced as egress.
+func (c *Calculator) priceNetwork(g *graph.Graph, snapshot *models.MetricsSnapshot, report *models.CostReport, traffic map[string]*models.ResourceMetrics) {
+	cfg := c.config.Network
+	placements := c.placements(snapshot)
+
+	internal := make(map[string]float64) // bytes sent to other endpoints, by node ID
+	transfers := make(map[string]*transfer)
+	for _, edge := range g.GetAllEdges() {
+		caller := endpointCostOf(report, edge.From)
+		if caller == nil {
+			continue
+		}
+		calls := caller.RequestCount * edge.Weight
+		if calls == 0 {
+			continue
+		}
+
+		b := c.edgeBytes(edge, report, traffic)
+		internal[edge.From.ID] += calls * b.request
+		internal[edge.To.ID] += calls * b.response
+		gb := calls * (b.request + b.response) / bytesPerGB
+
+		t, exists := transfers[edge.From.ID]
+		if !exists {
+			t = &transfer{}
+			transfers[edge.From.ID] = t
+		}
+		from, to := placements[edge.From.Service], placements[edge.To.Service]
+		if from != nil && to != nil && from.region != to.region {
+			t.crossRegion += gb * cfg.CrossRegionCostPerGB
+			continue
+		}
+		same := sameZoneShare(from, to)
+		t.intraZone += gb * same * cfg.IntraZoneCostPerGB
+		t.crossZone += gb * (1 - same) * cfg.CrossZoneCostPerGB
+	}
+
+	for serviceName, serviceCost := range report.Services {
+		model := c.modelFor(serviceName)
+		egressRate := orDefault(cfg.EgressCostPerGB, model.NetworkCostPerGB)
+
+		for key, ec := range serviceCost.Endpoints {
+			id := fmt.Sprintf("%s:%s", serviceName, key)
+			egress := 0.0
+			if resource, exists := traffic[id]; exists {
+				egress = max(resource.NetworkOutMB*bytesPerMB-internal[id], 0) / bytesPerGB * egressRate
+			}
+			t, exists := transfers[id]
+			if !exists {
+				t = &transfer{}
+			}
+			if ec.CostBreakdown == nil && egress == 0 && !exists {
+				continue
+			}
+
+			cb := endpointBreakdown(ec, model, 0)
+			before := cb.NetworkCost
+			cb.NetworkCost = egress + t.intraZone + t.crossZone + t.crossRegion
+			setDetail(cb, "egress", egress)
+			setDetail(cb, "intra_zone_transfer", t.intraZone)
+			setDetail(cb, "cross_zone_transfer", t.crossZone)
+			setDetail(cb, "cross_region_transfer", t.crossRegion)
+
+			cb.Total += cb.NetworkCost - before
+			ec.DirectCost += cb.NetworkCost - before
+			serviceCost.DirectCost += cb.NetworkCost - before
+		}
+	}
+}
+
+// placements returns the placement of every service: configured topology, or
+// the zones of its pods in the metrics and the region most of its pod-seconds
+// run in. Services without either are left out, and their transfers are priced
+// as within a zone.
+func (c *Calculator) placements(snapshot *models.MetricsSnapshot) map[string]*placement {
+	placements := make(map[string]*placement)
+
+	for name, sm := range snapshot.Services {
+		p := &placement{region: c.costModel.Region, zones: make(map[string]float64)}
+		regions := make(map[string]float64)
+		total := 0.0
+		for _, sv := range sm.Series["zones"] {
+			if sv.Labels["zone"] == "" || sv.Value <= 0 {
+				continue
+			}
+			p.zones[sv.Labels["zone"]] += sv.Value
+			if region := sv.Labels["region"]; region != "" {
+				regions[region] += sv.Value
+			}
+			total += sv.Value
+		}
+		if total == 0 {
+			continue
+		}
+
+		// Ties go to the first region by name, so the placement is reproducible
+		dominant := 0.0
+		for region, podSeconds := range regions {
+			if podSeconds > dominant || podSeconds == dominant && region < p.region {
+				p.region, dominant = region, podSeconds
+			}
+		}
+		for zone := range p.zones {
+			p.zones[zone] /= total
+		}
+		placements[name] = p
+	}
+
+	for name, topology := range c.config.Network.Topology {
+		p := &placement{region: topology.Region, zones: make(map[string]float64, len(topology.Zones))}
+		if p.region == "" {
+			p.region = c.costModel.Region
+		}
+		for _, zone := range topology.Zones {
+			p.zones[zone] += 1 / float64(len(topology.Zones))
+		}
+		placements[name] = p
+	}
+
+	return placements
+}
+
+// sameZoneShare returns the share of calls between two services that stay within
+// a zone, when calls are spread over the callee's pods regardless of zone. Calls
+// of services with an unknown placement are counted as within a zone.
+func sameZoneShare(from, to *placement) float64 {
+	if from == nil || to == nil || len(from.zones) == 0 || len(to.zones) == 0 {
+		return 1
+	}
+
+	same := 0.0
+	for zone, share := range from.zones {
+		same += share * to.zones[zone]
+	}
+	return same
+}
+
+// edgeBytes returns the bytes transferred per call along an edge: measured on the
+// dependency, configured for the pair of services, or estimated from the callee
+// endpoint's network traffic per request it served
+func (c *Calculator) edgeBytes(edge *graph.Edge, report *models.CostReport, traffic map[string]*models.ResourceMetrics) edgeBytes {
+	if dep := edge.Data; dep != nil && (dep.RequestBytes > 0 || dep.ResponseBytes > 0) {
+		return edgeBytes{request: dep.RequestBytes, response: dep.ResponseBytes}
+	}
+	if cfg, exists := c.config.Network.Edges[edge.From.Service+"->"+edge.To.Service]; exists {
+		return edgeBytes{request: cfg.RequestBytes, response: cfg.ResponseBytes}
+	}
+
+	callee := endpointCostOf(report, edge.To)
+	resource, exists := traffic[edge.To.ID]
+	if callee == nil || !exists || callee.RequestCount == 0 {
+		return edgeBytes{}
+	}
+	return edgeBytes{
+		request:  resource.NetworkInMB * bytesPerMB / callee.RequestCount,
+		response: resource.NetworkOutMB * bytesPerMB / callee.RequestCount,
+	}
+}
+
+// setDetail records a non-zero cost in a breakdown's details
+func setDetail(cb *models.CostBreakdown, name string, value float64) {
+	if value > 0 {
+		cb.Details[name] = value
+	} else {
+		delete(cb.Details, name)
+	}
+}
@@ -0,0 +1,148 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestPriceNetwork(t *testing.T) {
+	// web calls api twice per request, api calls db once
+	callGraph, report := newPropagationFixture(
+		[]string{"web", "api", "db"},
+		[][3]interface{}{{"web", "api", 2.0}, {"api", "db", 1.0}},
+	)
+	report.Services["web"].Endpoints["/:GET"].RequestCount = 1024
+	report.Services["api"].Endpoints["/:GET"].RequestCount = 2048
+	report.Services["db"].Endpoints["/:GET"].RequestCount = 2048
+
+	// Flat network cost of web, replaced by the topology model
+	report.Services["web"].Endpoints["/:GET"].CostBreakdown = &models.CostBreakdown{NetworkCost: 0.5, Total: 1.5}
+	report.Services["web"].Endpoints["/:GET"].DirectCost = 1.5
+	report.Services["web"].DirectCost = 1.5
+
+	traffic := map[string]*models.ResourceMetrics{
+		"web:/:GET": {NetworkInMB: 1 << 20, NetworkOutMB: 3072}, // ingress is free
+		"api:/:GET": {NetworkOutMB: 3072},
+		"db:/:GET":  {NetworkInMB: 1024},
+	}
+
+	// db runs in another region, known only from its pods' node labels
+	snapshot := models.NewMetricsSnapshot(report.TimeRange.Start, report.TimeRange.End)
+	snapshot.AddServiceMetrics(&models.ServiceMetrics{
+		ServiceName: "db",
+		Series: map[string][]models.SeriesValue{
+			"zones": {{Labels: map[string]string{"zone": "eu-west-1a", "region": "eu-west-1"}, Value: 3600}},
+		},
+	})
+
+	cfg := config.CostModelConfig{
+		Provider:         "custom",
+		Region:           "us-east-1",
+		NetworkCostPerGB: 0.09,
+		Network: config.NetworkConfig{
+			Model:                "topology",
+			IntraZoneCostPerGB:   0.01,
+			CrossZoneCostPerGB:   0.02,
+			CrossRegionCostPerGB: 0.05,
+			Topology: map[string]config.TopologyConfig{
+				"web": {Zones: []string{"us-east-1a"}},
+				"api": {Zones: []string{"us-east-1a", "us-east-1b"}},
+			},
+			// 2048 calls of 512 KiB requests and 1 MiB responses: 1 GB and 2 GB
+			Edges: map[string]config.EdgeConfig{"web->api": {RequestBytes: 512 << 10, ResponseBytes: 1 << 20}},
+		},
+	}
+	calculator, err := NewCalculator(&cfg, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+	calculator.priceNetwork(graph.FromCallGraph(callGraph), snapshot, report, traffic)
+
+	tests := []struct {
+		service string
+		network float64
+		details map[string]float64
+	}{
+		{
+			// 2 GB of its 3 GB out leave the cloud, half of the 3 GB to api crosses zones
+			service: "web",
+			network: 2*0.09 + 1.5*0.01 + 1.5*0.02,
+			details: map[string]float64{"egress": 0.18, "intra_zone_transfer": 0.015, "cross_zone_transfer": 0.03},
+		},
+		{
+			// its 3 GB out are the responses to web and the requests to db, estimated
+			// at 0.5 MiB per call from db's traffic
+			service: "api",
+			network: 0.05,
+			details: map[string]float64{"cross_region_transfer": 0.05},
+		},
+		{service: "db"},
+	}
+
+	for _, tt := range tests {
+		ec := report.Services[tt.service].Endpoints["/:GET"]
+		if ec.CostBreakdown == nil {
+			if tt.network != 0 {
+				t.Errorf("Expected %s network cost %f, got no breakdown", tt.service, tt.network)
+			}
+			continue
+		}
+		if math.Abs(ec.CostBreakdown.NetworkCost-tt.network) > 1e-9 {
+			t.Errorf("Expected %s network cost %f, got %f", tt.service, tt.network, ec.CostBreakdown.NetworkCost)
+		}
+		if math.Abs(ec.DirectCost-(1+tt.network)) > 1e-9 || math.Abs(report.Services[tt.service].DirectCost-(1+tt.network)) > 1e-9 {
+			t.Errorf("Expected %s direct cost %f, got %f", tt.service, 1+tt.network, ec.DirectCost)
+		}
+		if len(ec.CostBreakdown.Details) != len(tt.details) {
+			t.Errorf("Expected %s details %v, got %v", tt.service, tt.details, ec.CostBreakdown.Details)
+		}
+		for name, expected := range tt.details {
+			if got := ec.CostBreakdown.Details[name]; math.Abs(got-expected) > 1e-9 {
+				t.Errorf("Expected %s %s %f, got %f", tt.service, name, expected, got)
+			}
+		}
+	}
+}
+
+func TestPlacementsDominantRegion(t *testing.T) {
+	zone := func(zone, region string, podSeconds float64) models.SeriesValue {
+		return models.SeriesValue{Labels: map[string]string{"zone": zone, "region": region}, Value: podSeconds}
+	}
+
+	// Most of db's pods run in us-east-1, whatever order the series come in
+	snapshot := models.NewMetricsSnapshot(time.Time{}, time.Time{})
+	snapshot.AddServiceMetrics(&models.ServiceMetrics{
+		ServiceName: "db",
+		Series: map[string][]models.SeriesValue{
+			"zones": {
+				zone("us-east-1a", "us-east-1", 3000),
+				zone("us-east-1b", "us-east-1", 1000),
+				zone("eu-west-1a", "eu-west-1", 1000),
+			},
+		},
+	})
+
+	cfg := config.CostModelConfig{Provider: "custom", Region: "ap-south-1"}
+	calculator, err := NewCalculator(&cfg, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+
+	p := calculator.placements(snapshot)["db"]
+	if p == nil {
+		t.Fatal("Expected a placement for db")
+	}
+	if p.region != "us-east-1" {
+		t.Errorf("Expected region us-east-1, got %s", p.region)
+	}
+	if math.Abs(p.zones["us-east-1a"]-0.6) > 1e-9 || math.Abs(p.zones["eu-west-1a"]-0.2) > 1e-9 {
+		t.Errorf("Expected zone shares by pod-seconds, got %v", p.zones)
+	}
+}
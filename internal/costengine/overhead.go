@@ -0,0 +1,114 @@
+package costengine
+
+import (
+	"sort"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// hoursPerMonth is the average number of hours in a month, as used by cloud pricing
+const hoursPerMonth = 730
+
+// clusterCost returns the total cost of the cluster over the time range. It is
+// false when shared overhead is disabled or the node metrics it needs are missing.
+func (c *Calculator) clusterCost(snapshot *models.MetricsSnapshot, durationHours float64) (float64, bool) {
+	cfg := c.config.SharedOverhead
+
+	switch cfg.Source {
+	case "monthly":
+		return cfg.MonthlyCost * durationHours / hoursPerMonth, true
+	case "nodes":
+		if snapshot.Cluster == nil {
+			c.logger.Warn("No node metrics in snapshot, skipping shared overhead")
+			return 0, false
+		}
+		if cfg.NodeCostPerHour > 0 {
+			return snapshot.Cluster.NodeHours * cfg.NodeCostPerHour, true
+		}
+		return snapshot.Cluster.CPUCapacityCoreHours*c.costModel.CPUCostPerCoreHour +
+			snapshot.Cluster.MemoryCapacityGBHours*c.costModel.MemoryCostPerGBHour, true
+	default:
+		return 0, false
+	}
+}
+
+// distributeSharedOverhead spreads the part of the cluster cost not used by any
+// service across services, either proportionally to their CPU and memory cost or
+// evenly. Within a service, overhead follows the endpoints' allocation shares.
+// Serverless and fixed-price services do not run on the cluster and get none.
+func (c *Calculator) distributeSharedOverhead(report *models.CostReport, clusterCost float64) {
+	report.ClusterCost = clusterCost
+
+	// Visit services in a stable order so rounding is reproducible
+	names := make([]string, 0, len(report.Services))
+	for name, serviceCost := range report.Services {
+		if serviceCost.ComputeModel == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	weights := make(map[string]float64, len(names))
+	allocated := 0.0
+	for _, name := range names {
+		for _, ec := range report.Services[name].Endpoints {
+			if ec.CostBreakdown != nil {
+				weights[name] += ec.CostBreakdown.CPUCost + ec.CostBreakdown.MemoryCost
+			}
+		}
+		allocated += weights[name]
+	}
+
+	overhead := clusterCost - allocated
+	if overhead <= 0 {
+		c.logger.Warnf("Cluster cost $%.2f does not exceed allocated compute cost $%.2f, no shared overhead", clusterCost, allocated)
+		return
+	}
+	report.SharedOverhead = overhead
+
+	if c.config.SharedOverhead.Distribution == "even" || allocated == 0 {
+		for _, name := range names {
+			weights[name] = 1
+		}
+	}
+
+	totalWeight := 0.0
+	for _, name := range names {
+		totalWeight += weights[name]
+	}
+	if totalWeight == 0 {
+		return
+	}
+
+	for _, name := range names {
+		serviceCost := report.Services[name]
+		serviceOverhead := overhead * weights[name] / totalWeight
+		serviceCost.SharedOverhead = serviceOverhead
+		serviceCost.DirectCost += serviceOverhead
+
+		even := !hasAllocationShares(serviceCost)
+		for _, ec := range serviceCost.Endpoints {
+			share := ec.AllocationShare
+			if even {
+				share = 1 / float64(len(serviceCost.Endpoints))
+			}
+
+			if ec.CostBreakdown == nil {
+				ec.CostBreakdown = &models.CostBreakdown{Details: make(map[string]float64)}
+			}
+			ec.CostBreakdown.SharedOverhead = serviceOverhead * share
+			ec.CostBreakdown.Total += ec.CostBreakdown.SharedOverhead
+			ec.DirectCost += ec.CostBreakdown.SharedOverhead
+		}
+	}
+}
+
+// hasAllocationShares reports whether any endpoint of the service received a share
+func hasAllocationShares(serviceCost *models.ServiceCost) bool {
+	for _, ec := range serviceCost.Endpoints {
+		if ec.AllocationShare > 0 {
+			return true
+		}
+	}
+	return false
+}
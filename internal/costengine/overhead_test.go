@@ -0,0 +1,114 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// newOverheadFixture returns two services using 1 and 3 core-hours at $1 per core-hour
+func newOverheadFixture() (*models.CallGraph, *models.MetricsSnapshot, models.TimeRange) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeRange := models.TimeRange{Start: start, End: start.Add(time.Hour)}
+
+	callGraph := models.NewCallGraph()
+	snapshot := models.NewMetricsSnapshot(timeRange.Start, timeRange.End)
+
+	for name, cpu := range map[string]float64{"small": 1, "large": 3} {
+		service := &models.Service{Name: name}
+		service.AddEndpoint(&models.Endpoint{Path: "/a", Method: "GET"})
+		service.AddEndpoint(&models.Endpoint{Path: "/b", Method: "GET"})
+		callGraph.AddService(service)
+
+		snapshot.AddServiceMetrics(&models.ServiceMetrics{
+			ServiceName: name,
+			TimeRange:   timeRange,
+			Aggregate:   &models.ResourceMetrics{CPUCoreHours: cpu},
+			Endpoints: map[string]*models.EndpointMetrics{
+				"/a:GET": {Performance: &models.PerformanceMetrics{RequestRate: 1}},
+				"/b:GET": {Performance: &models.PerformanceMetrics{RequestRate: 3}},
+			},
+		})
+	}
+	snapshot.Cluster = &models.ClusterMetrics{NodeHours: 2}
+
+	return callGraph, snapshot, timeRange
+}
+
+func newOverheadCalculator(t *testing.T, overhead config.SharedOverheadConfig) *Calculator {
+	t.Helper()
+
+	cfg := config.CostModelConfig{
+		Provider:           "custom",
+		CPUCostPerCoreHour: 1.0,
+		SharedOverhead:     overhead,
+	}
+	calculator, err := NewCalculator(&cfg, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+	return calculator
+}
+
+func TestSharedOverheadProportional(t *testing.T) {
+	// Two nodes at $5 per hour: $10 cluster cost, $4 used by services, $6 overhead
+	calculator := newOverheadCalculator(t, config.SharedOverheadConfig{Source: "nodes", NodeCostPerHour: 5, Distribution: "proportional"})
+
+	report, err := calculator.CalculateCosts(newOverheadFixture())
+	if err != nil {
+		t.Fatalf("CalculateCosts failed: %v", err)
+	}
+
+	if math.Abs(report.SharedOverhead-6) > 1e-9 {
+		t.Errorf("Expected shared overhead $6, got $%f", report.SharedOverhead)
+	}
+
+	if math.Abs(report.TotalCost-10) > 1e-9 {
+		t.Errorf("Expected report total to reconcile with cluster cost $10, got $%f", report.TotalCost)
+	}
+
+	if large := report.Services["large"].SharedOverhead; math.Abs(large-4.5) > 1e-9 {
+		t.Errorf("Expected large service overhead $4.5, got $%f", large)
+	}
+
+	// Endpoint /b serves 3 of 4 requests
+	ec := report.Services["large"].Endpoints["/b:GET"]
+	if math.Abs(ec.CostBreakdown.SharedOverhead-4.5*0.75) > 1e-9 {
+		t.Errorf("Expected endpoint overhead $%f, got $%f", 4.5*0.75, ec.CostBreakdown.SharedOverhead)
+	}
+}
+
+func TestSharedOverheadEven(t *testing.T) {
+	// $7300 per month is $10 per hour
+	calculator := newOverheadCalculator(t, config.SharedOverheadConfig{Source: "monthly", MonthlyCost: 7300, Distribution: "even"})
+
+	report, err := calculator.CalculateCosts(newOverheadFixture())
+	if err != nil {
+		t.Fatalf("CalculateCosts failed: %v", err)
+	}
+
+	for name, sc := range report.Services {
+		if math.Abs(sc.SharedOverhead-3) > 1e-9 {
+			t.Errorf("Expected %s overhead $3, got $%f", name, sc.SharedOverhead)
+		}
+	}
+}
+
+func TestSharedOverheadDisabled(t *testing.T) {
+	calculator := newOverheadCalculator(t, config.SharedOverheadConfig{Source: "none"})
+
+	report, err := calculator.CalculateCosts(newOverheadFixture())
+	if err != nil {
+		t.Fatalf("CalculateCosts failed: %v", err)
+	}
+
+	if report.SharedOverhead != 0 || math.Abs(report.TotalCost-4) > 1e-9 {
+		t.Errorf("Expected no overhead and total $4, got overhead $%f and total $%f", report.SharedOverhead, report.TotalCost)
+	}
+}
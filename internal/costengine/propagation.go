@@ -0,0 +1,287 @@
+package costengine
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// downstreamCalls holds the expected number of calls one request to an endpoint
+// causes to every endpoint below it, directly or through other endpoints, keyed
+// by node ID. An endpoint on a cycle can appear in its own calls.
+type downstreamCalls map[string]float64
+
+// propagateCalls computes the downstream calls of every node of the graph in a
+// single pass. Components are visited in reverse topological order, so the calls
+// of every callee are known and reused when its callers are visited. Calls within
+// a cycle are solved as a linear system; when they grow without bound, each
+// endpoint of the cycle is counted once per request instead.
+func (c *Calculator) propagateCalls(g *graph.Graph) map[string]downstreamCalls {
+	calls := make(map[string]downstreamCalls, g.NodeCount())
+
+	for _, component := range g.StronglyConnectedComponents() {
+		if len(component) == 1 && !hasSelfLoop(g, component[0]) {
+			node := component[0]
+			dc := make(downstreamCalls)
+			for _, edge := range g.GetOutgoingEdges(node) {
+				dc.addCallee(edge, calls[edge.To.ID])
+			}
+			calls[node.ID] = dc
+			continue
+		}
+
+		c.solveCycle(g, component, calls)
+	}
+
+	return calls
+}
+
+// addCallee adds the calls made through one edge: the callee itself and
+// everything it calls, per call of the callee
+func (dc downstreamCalls) addCallee(edge *graph.Edge, calleeCalls downstreamCalls) {
+	dc[edge.To.ID] += edge.Weight
+	for id, n := range calleeCalls {
+		dc[id] += edge.Weight * n
+	}
+}
+
+// solveCycle computes the downstream calls of the endpoints of a strongly
+// connected component. With W the calls between its members and E the calls
+// leaving it, the calls C satisfy C = W(I + C) + E, so C = (I - W)^-1 (W + E).
+// The inverse is non-negative exactly when the calls converge.
+func (c *Calculator) solveCycle(g *graph.Graph, component []*graph.Node, calls map[string]downstreamCalls) {
+	n := len(component)
+	position := make(map[string]int, n)
+	for i, node := range component {
+		position[node.ID] = i
+	}
+
+	// Right-hand side W + E, one row per member and one column per callee
+	columns := make(map[string]int)
+	columnIDs := make([]string, 0)
+	column := func(id string) int {
+		if col, exists := columns[id]; exists {
+			return col
+		}
+		columns[id] = len(columnIDs)
+		columnIDs = append(columnIDs, id)
+		return columns[id]
+	}
+	for _, node := range component {
+		column(node.ID)
+	}
+
+	w := make([][]float64, n)
+	rhs := make([]map[int]float64, n)
+	for i, node := range component {
+		w[i] = make([]float64, n)
+		rhs[i] = make(map[int]float64)
+		for _, edge := range g.GetOutgoingEdges(node) {
+			if j, inside := position[edge.To.ID]; inside {
+				w[i][j] += edge.Weight
+				rhs[i][column(edge.To.ID)] += edge.Weight
+				continue
+			}
+			external := make(downstreamCalls)
+			external.addCallee(edge, calls[edge.To.ID])
+			for id, v := range external {
+				rhs[i][column(id)] += v
+			}
+		}
+	}
+
+	inverse, ok := invertIdentityMinus(w)
+	if !ok {
+		c.logger.Warnf("Calls in the cycle through %s grow without bound, counting each endpoint of the cycle once per request",
+			componentName(component))
+		countCycleOnce(component, rhs, columnIDs, position, calls)
+		return
+	}
+
+	for i, node := range component {
+		dc := make(downstreamCalls)
+		for k := 0; k < n; k++ {
+			if inverse[i][k] == 0 {
+				continue
+			}
+			for col, v := range rhs[k] {
+				dc[columnIDs[col]] += inverse[i][k] * v
+			}
+		}
+		calls[node.ID] = dc
+	}
+}
+
+// countCycleOnce gives every member of a divergent cycle one call to each other
+// member, to itself if it calls itself, and the calls all members make outside
+func countCycleOnce(component []*graph.Node, rhs []map[int]float64, columnIDs []string, position map[string]int, calls map[string]downstreamCalls) {
+	external := make(downstreamCalls)
+	for i := range component {
+		for col, v := range rhs[i] {
+			if _, inside := position[columnIDs[col]]; !inside {
+				external[columnIDs[col]] += v
+			}
+		}
+	}
+
+	for i, node := range component {
+		dc := make(downstreamCalls, len(component)+len(external))
+		for _, member := range component {
+			if member.ID != node.ID || rhs[i][position[node.ID]] > 0 {
+				dc[member.ID] = 1
+			}
+		}
+		for id, v := range external {
+			dc[id] = v
+		}
+		calls[node.ID] = dc
+	}
+}
+
+// invertIdentityMinus returns (I - w)^-1 by Gauss-Jordan elimination. It fails
+// when the matrix is singular or the inverse has negative entries, i.e. when
+// the series I + w + w² + ... diverges.
+func invertIdentityMinus(w [][]float64) ([][]float64, bool) {
+	n := len(w)
+	a := make([][]float64, n)
+	inv := make([][]float64, n)
+	for i := range w {
+		a[i] = make([]float64, n)
+		inv[i] = make([]float64, n)
+		for j := range w[i] {
+			a[i][j] = -w[i][j]
+		}
+		a[i][i]++
+		inv[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		p := a[col][col]
+		for j := 0; j < n; j++ {
+			a[col][j] /= p
+			inv[col][j] /= p
+		}
+		for row := 0; row < n; row++ {
+			if row == col || a[row][col] == 0 {
+				continue
+			}
+			f := a[row][col]
+			for j := 0; j < n; j++ {
+				a[row][j] -= f * a[col][j]
+				inv[row][j] -= f * inv[col][j]
+			}
+		}
+	}
+
+	for i := range inv {
+		for j := range inv[i] {
+			if inv[i][j] < -1e-9 {
+				return nil, false
+			}
+			inv[i][j] = math.Max(inv[i][j], 0)
+		}
+	}
+	return inv, true
+}
+
+// hasSelfLoop reports whether a node calls itself
+func hasSelfLoop(g *graph.Graph, node *graph.Node) bool {
+	for _, edge := range g.GetOutgoingEdges(node) {
+		if edge.To.ID == node.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// componentName lists the endpoints of a component for logging
+func componentName(component []*graph.Node) string {
+	ids := make([]string, 0, len(component))
+	for _, node := range component {
+		ids = append(ids, node.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ", ")
+}
+
+// callDepths returns the number of hops from a node to every node it reaches,
+// including the node itself if it is on a cycle
+func callDepths(g *graph.Graph, start *graph.Node) map[string]int {
+	depths := make(map[string]int)
+	queue := []*graph.Node{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.GetOutgoingEdges(node) {
+			if _, seen := depths[edge.To.ID]; !seen {
+				depths[edge.To.ID] = depths[node.ID] + 1
+				queue = append(queue, edge.To)
+			}
+		}
+	}
+	return depths
+}
+
+// downstreamCosts lists the cost every downstream endpoint adds to a node: its
+// direct cost times the calls one request of the node makes to it or, given
+// traffic shares, times the share of its traffic the node accounts for. Each
+// endpoint is listed once, at the depth of its shortest call chain.
+func downstreamCosts(g *graph.Graph, node *graph.Node, calls, shares downstreamCalls, report *models.CostReport) []models.DownstreamCost {
+	costs := make([]models.DownstreamCost, 0, len(calls))
+	if len(calls) == 0 {
+		return costs
+	}
+
+	depths := callDepths(g, node)
+	for id, n := range calls {
+		target, _ := g.GetNode(id)
+
+		var direct float64
+		if ec := endpointCostOf(report, target); ec != nil {
+			direct = ec.DirectCost
+		}
+
+		cost := models.DownstreamCost{
+			Service:         target.Service,
+			Endpoint:        target.Endpoint,
+			Method:          target.Method,
+			Cost:            direct * n,
+			CallsPerRequest: n,
+			Depth:           depths[id],
+		}
+		if shares != nil {
+			cost.Share = shares[id]
+			cost.Cost = direct * shares[id]
+		}
+		costs = append(costs, cost)
+	}
+
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Depth != costs[j].Depth {
+			return costs[i].Depth < costs[j].Depth
+		}
+		if costs[i].Service != costs[j].Service {
+			return costs[i].Service < costs[j].Service
+		}
+		if costs[i].Endpoint != costs[j].Endpoint {
+			return costs[i].Endpoint < costs[j].Endpoint
+		}
+		return costs[i].Method < costs[j].Method
+	})
+	return costs
+}
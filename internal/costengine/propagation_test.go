@@ -0,0 +1,256 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// newPropagationFixture returns a call graph of services with a single GET /
+// endpoint costing $1 each, and a report holding those direct costs
+func newPropagationFixture(services []string, deps [][3]interface{}) (*models.CallGraph, *models.CostReport) {
+	callGraph := models.NewCallGraph()
+	report := models.NewCostReport(&models.CostModel{}, models.TimeRange{})
+
+	for _, name := range services {
+		service := &models.Service{Name: name}
+		service.AddEndpoint(&models.Endpoint{Path: "/", Method: "GET"})
+		callGraph.AddService(service)
+
+		report.Services[name] = &models.ServiceCost{
+			ServiceName: name,
+			DirectCost:  1,
+			Endpoints: map[string]*models.EndpointCost{
+				"/:GET": {Service: name, Endpoint: "/", Method: "GET", DirectCost: 1},
+			},
+		}
+	}
+
+	for _, dep := range deps {
+		callGraph.AddDependency(&models.Dependency{
+			FromService:  dep[0].(string),
+			FromEndpoint: "/",
+			ToService:    dep[1].(string),
+			ToEndpoint:   "/",
+			Weight:       dep[2].(float64),
+		})
+	}
+
+	return callGraph, report
+}
+
+func TestCalculateAttributedCosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []string
+		deps     [][3]interface{}
+		expected map[string]float64 // total cost per service
+	}{
+		{
+			name:     "chain",
+			services: []string{"a", "b", "c"},
+			deps:     [][3]interface{}{{"a", "b", 2.0}, {"b", "c", 3.0}},
+			expected: map[string]float64{"a": 1 + 2 + 6, "b": 1 + 3, "c": 1},
+		},
+		{
+			// d is reached through b and c, so a calls it twice per request
+			name:     "diamond",
+			services: []string{"a", "b", "c", "d"},
+			deps:     [][3]interface{}{{"a", "b", 1.0}, {"a", "c", 1.0}, {"b", "d", 1.0}, {"c", "d", 1.0}},
+			expected: map[string]float64{"a": 5, "b": 2, "c": 2, "d": 1},
+		},
+		{
+			// total(a) = 1 + 0.5 total(b) + total(c), total(b) = 1 + 0.5 total(a)
+			name:     "convergent cycle",
+			services: []string{"a", "b", "c"},
+			deps:     [][3]interface{}{{"a", "b", 0.5}, {"b", "a", 0.5}, {"a", "c", 1.0}},
+			expected: map[string]float64{"a": 10.0 / 3, "b": 8.0 / 3, "c": 1},
+		},
+		{
+			// every call to a causes two more, so each endpoint is counted once
+			name:     "divergent cycle",
+			services: []string{"a", "b", "c"},
+			deps:     [][3]interface{}{{"a", "b", 1.0}, {"b", "a", 2.0}, {"b", "c", 1.0}},
+			expected: map[string]float64{"a": 3, "b": 3, "c": 1},
+		},
+		{
+			name:     "self loop",
+			services: []string{"a"},
+			deps:     [][3]interface{}{{"a", "a", 0.5}},
+			expected: map[string]float64{"a": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callGraph, report := newPropagationFixture(tt.services, tt.deps)
+			calculator, err := NewCalculator(&config.CostModelConfig{}, graph.NewGraph(), logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create calculator: %v", err)
+			}
+			calculator.calculateAttributedCosts(callGraph, report)
+
+			for service, expected := range tt.expected {
+				got := report.Services[service].Endpoints["/:GET"].TotalCost
+				if math.Abs(got-expected) > 1e-9 {
+					t.Errorf("Expected %s total %f, got %f", service, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDownstreamCostsListEachEndpointOnce(t *testing.T) {
+	callGraph, report := newPropagationFixture(
+		[]string{"a", "b", "c", "d"},
+		[][3]interface{}{{"a", "b", 1.0}, {"a", "c", 1.0}, {"b", "d", 1.0}, {"c", "d", 1.0}},
+	)
+	calculator, err := NewCalculator(&config.CostModelConfig{}, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+	calculator.calculateAttributedCosts(callGraph, report)
+
+	downstream := report.Services["a"].Endpoints["/:GET"].DownstreamCosts
+	if len(downstream) != 3 {
+		t.Fatalf("Expected 3 downstream endpoints, got %d", len(downstream))
+	}
+
+	d := downstream[2]
+	if d.Service != "d" || d.CallsPerRequest != 2 || d.Depth != 2 {
+		t.Errorf("Expected d at depth 2 with 2 calls per request, got %s at depth %d with %f",
+			d.Service, d.Depth, d.CallsPerRequest)
+	}
+}
+
+func TestTrafficShareAttribution(t *testing.T) {
+	// inventory serves 200 calls from checkout, 50 from search and 50 from outside
+	callGraph, report := newPropagationFixture(
+		[]string{"checkout", "search", "inventory", "db"},
+		[][3]interface{}{{"checkout", "inventory", 2.0}, {"search", "inventory", 1.0}, {"inventory", "db", 1.0}},
+	)
+	requests := map[string]float64{"checkout": 100, "search": 50, "inventory": 300, "db": 300}
+	for service, n := range requests {
+		report.Services[service].Endpoints["/:GET"].RequestCount = n
+	}
+
+	calculator, err := NewCalculator(&config.CostModelConfig{Attribution: "traffic_share"}, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+	calculator.calculateAttributedCosts(callGraph, report)
+
+	tests := []struct {
+		service      string
+		total        float64
+		unattributed float64
+	}{
+		{"checkout", 1 + 2.0/3*2, 0},
+		{"search", 1 + 1.0/6*2, 0},
+		{"inventory", 2, 2.0 / 6},
+		{"db", 1, 0},
+	}
+	for _, tt := range tests {
+		ec := report.Services[tt.service].Endpoints["/:GET"]
+		if math.Abs(ec.TotalCost-tt.total) > 1e-9 {
+			t.Errorf("Expected %s total %f, got %f", tt.service, tt.total, ec.TotalCost)
+		}
+		if math.Abs(ec.UnattributedCost-tt.unattributed) > 1e-9 {
+			t.Errorf("Expected %s unattributed %f, got %f", tt.service, tt.unattributed, ec.UnattributedCost)
+		}
+	}
+
+	// Entry endpoints and the unattributed remainder add up to the direct costs
+	entries := report.Services["checkout"].TotalCost + report.Services["search"].TotalCost
+	if math.Abs(entries+report.UnattributedCost-4) > 1e-9 {
+		t.Errorf("Expected attributed and unattributed costs to sum to 4, got %f", entries+report.UnattributedCost)
+	}
+
+	// The report total counts every direct cost once
+	report.AttributionMode = models.AttributionTrafficShare
+	report.CalculateTotalCost()
+	if math.Abs(report.TotalCost-4) > 1e-9 {
+		t.Errorf("Expected report total 4, got %f", report.TotalCost)
+	}
+
+	db := report.Services["checkout"].Endpoints["/:GET"].DownstreamCosts[1]
+	if db.Service != "db" || math.Abs(db.Share-2.0/3) > 1e-9 || db.CallsPerRequest != 2 {
+		t.Errorf("Expected checkout to account for 2/3 of db at 2 calls per request, got %s share %f calls %f",
+			db.Service, db.Share, db.CallsPerRequest)
+	}
+}
+
+func TestDownstreamCostsResolveCalleeEndpoints(t *testing.T) {
+	// checkout has an /items endpoint of its own, which must not be mistaken for
+	// inventory's
+	endpoints := map[string][]struct {
+		path, method string
+		cost         float64
+	}{
+		"checkout":  {{"/checkout", "POST", 1}, {"/items", "GET", 5}},
+		"inventory": {{"/items", "GET", 2}, {"/items", "POST", 7}},
+	}
+
+	callGraph := models.NewCallGraph()
+	report := models.NewCostReport(&models.CostModel{}, models.TimeRange{})
+	for name, eps := range endpoints {
+		service := &models.Service{Name: name}
+		serviceCost := &models.ServiceCost{ServiceName: name, Endpoints: make(map[string]*models.EndpointCost)}
+		for _, ep := range eps {
+			service.AddEndpoint(&models.Endpoint{Path: ep.path, Method: ep.method})
+			serviceCost.Endpoints[ep.path+":"+ep.method] = &models.EndpointCost{
+				Service: name, Endpoint: ep.path, Method: ep.method, DirectCost: ep.cost,
+			}
+			serviceCost.DirectCost += ep.cost
+		}
+		callGraph.AddService(service)
+		report.Services[name] = serviceCost
+	}
+
+	callGraph.AddDependency(&models.Dependency{
+		FromService: "checkout", FromEndpoint: "/checkout",
+		ToService: "inventory", ToEndpoint: "/items", ToMethod: "post", Weight: 1,
+	})
+	callGraph.AddDependency(&models.Dependency{
+		FromService: "checkout", FromEndpoint: "/checkout",
+		ToService: "inventory", ToEndpoint: "/items", Weight: 2,
+	})
+
+	calculator, err := NewCalculator(&config.CostModelConfig{}, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+	calculator.calculateAttributedCosts(callGraph, report)
+
+	ec := report.Services["checkout"].Endpoints["/checkout:POST"]
+	if ec.TotalCost != 1+7+2*2 {
+		t.Errorf("Expected total 12, got %f", ec.TotalCost)
+	}
+
+	tests := []struct {
+		method string
+		cost   float64
+	}{
+		{"GET", 4},
+		{"POST", 7},
+	}
+	if len(ec.DownstreamCosts) != len(tests) {
+		t.Fatalf("Expected %d downstream endpoints, got %d", len(tests), len(ec.DownstreamCosts))
+	}
+	for i, tt := range tests {
+		dc := ec.DownstreamCosts[i]
+		if dc.Service != "inventory" || dc.Method != tt.method || dc.Cost != tt.cost {
+			t.Errorf("Expected inventory /items %s costing %f, got %s %s %s costing %f",
+				tt.method, tt.cost, dc.Service, dc.Endpoint, dc.Method, dc.Cost)
+		}
+	}
+
+	if got := report.Services["checkout"].Endpoints["/items:GET"].TotalCost; got != 5 {
+		t.Errorf("Expected checkout's own /items to keep its direct cost 5, got %f", got)
+	}
+}
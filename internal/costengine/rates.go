@@ -0,0 +1,61 @@
+package costengine
+
+import (
+	"fmt"
+
+	"github.com/microcost/microcost/internal/pricing"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// loadPricing derives the cost model of all services, and of the services with
+// their own compute, from the provider's price catalog. Compute that is
+// configured but cannot be priced is an error rather than a silent fallback, as
+// is a service on a per-invocation offering without a serverless compute model.
+func (c *Calculator) loadPricing() error {
+	cfg := c.config.Pricing
+	if cfg.Compute == "" && len(cfg.Services) == 0 {
+		return nil
+	}
+
+	catalog, err := pricing.LoadCatalog(c.costModel.Provider, cfg.CatalogDir)
+	if err != nil {
+		return fmt.Errorf("error loading price catalog: %w", err)
+	}
+	c.logger.Debugf("Using %s price catalog of %s", catalog.Provider, catalog.Updated)
+
+	if cfg.Compute != "" {
+		model, err := catalog.Rates(c.costModel, cfg.Compute)
+		if err != nil {
+			return fmt.Errorf("error pricing compute %s: %w", cfg.Compute, err)
+		}
+		c.costModel = model
+
+		if pricing.InvocationPriced(cfg.Compute) {
+			c.logger.Warnf("Compute %s is billed per invocation: services without a serverless compute model are priced at its duration rates for all the time they run", cfg.Compute)
+		}
+	}
+
+	c.serviceModels = make(map[string]*models.CostModel, len(cfg.Services))
+	for service, compute := range cfg.Services {
+		if pricing.InvocationPriced(compute) && c.computeModel(service) != models.ComputeServerless {
+			return fmt.Errorf("compute %s of %s is billed per invocation and needs a serverless compute model", compute, service)
+		}
+
+		model, err := catalog.Rates(c.costModel, compute)
+		if err != nil {
+			return fmt.Errorf("error pricing compute %s of %s: %w", compute, service, err)
+		}
+		c.logger.Debugf("Pricing %s on %s at $%.4f per core-hour and $%.4f per GB-hour",
+			service, compute, model.CPUCostPerCoreHour, model.MemoryCostPerGBHour)
+		c.serviceModels[service] = model
+	}
+	return nil
+}
+
+// modelFor returns the cost model a service is priced with
+func (c *Calculator) modelFor(service string) *models.CostModel {
+	if model, exists := c.serviceModels[service]; exists {
+		return model
+	}
+	return c.costModel
+}
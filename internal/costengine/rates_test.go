@@ -0,0 +1,75 @@
+package costengine
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/microcost/microcost/internal/graph"
+	"github.com/microcost/microcost/pkg/config"
+)
+
+func TestServicePricing(t *testing.T) {
+	cfg := config.DefaultConfig().CostModel
+	cfg.Pricing.Services = map[string]string{
+		"checkout": "m6i.large",
+		"search":   "fargate",
+		"resize":   "lambda",
+	}
+	cfg.ComputeModels.Services = map[string]config.ComputeModelConfig{
+		"resize": {Model: "serverless", MemoryMB: 512},
+	}
+
+	calculator, err := NewCalculator(&cfg, graph.NewGraph(), logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
+
+	checkout := calculator.modelFor("checkout")
+	if checkout.Compute != "m6i.large" || checkout.CPUCostPerCoreHour == cfg.CPUCostPerCoreHour {
+		t.Errorf("Expected checkout priced on m6i.large, got %+v", checkout)
+	}
+	// 2 cores and 8 GB at the derived rates make up the instance price
+	if hourly := 2*checkout.CPUCostPerCoreHour + 8*checkout.MemoryCostPerGBHour; hourly < 0.0959 || hourly > 0.0961 {
+		t.Errorf("Expected derived rates to add up to $0.096 per hour, got %f", hourly)
+	}
+
+	if search := calculator.modelFor("search"); search.CPUCostPerCoreHour != 0.04048 {
+		t.Errorf("Expected fargate vCPU-hour price for search, got %f", search.CPUCostPerCoreHour)
+	}
+
+	if resize := calculator.modelFor("resize"); resize.MemoryCostPerGBHour != 0.06 {
+		t.Errorf("Expected lambda GB-hour price for resize, got %f", resize.MemoryCostPerGBHour)
+	}
+
+	// Services without compute keep the configured rates
+	if model := calculator.modelFor("catalog"); model.CPUCostPerCoreHour != cfg.CPUCostPerCoreHour {
+		t.Errorf("Expected catalog at the configured rate, got %f", model.CPUCostPerCoreHour)
+	}
+}
+
+func TestUnpricedCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		pricing  config.PricingConfig
+	}{
+		{"compute without prices", "aws", config.PricingConfig{Compute: "m1.small"}},
+		{"service compute without prices", "aws", config.PricingConfig{Services: map[string]string{"legacy": "m1.small"}}},
+		{"provider without catalog", "custom", config.PricingConfig{Compute: "m6i.large"}},
+		// Lambda duration prices would apply to every hour the container runs
+		{"invocation-priced compute of a container", "aws", config.PricingConfig{Services: map[string]string{"resize": "lambda"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig().CostModel
+			cfg.Provider = tt.provider
+			cfg.Pricing = tt.pricing
+
+			if _, err := NewCalculator(&cfg, graph.NewGraph(), logrus.New()); err == nil {
+				t.Error("Expected an error for compute that cannot be priced")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package costengine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// calculateCostTimeSeries spreads each service's direct cost over the time buckets
+// of the snapshot, following the usage cost of its CPU, memory and requests in each
+// bucket. The buckets therefore add up to the direct costs of the report. Services
+// without time series are spread evenly.
+func (c *Calculator) calculateCostTimeSeries(snapshot *models.MetricsSnapshot, report *models.CostReport) []*models.CostBucket {
+	if snapshot.Resolution <= 0 {
+		return nil
+	}
+
+	starts := bucketStarts(snapshot)
+	if len(starts) == 0 {
+		return nil
+	}
+
+	buckets := make([]*models.CostBucket, len(starts))
+	index := make(map[int64]*models.CostBucket, len(starts))
+	for i, start := range starts {
+		buckets[i] = &models.CostBucket{
+			Start:    start,
+			End:      start.Add(snapshot.Resolution),
+			Services: make(map[string]float64),
+		}
+		index[start.UnixNano()] = buckets[i]
+	}
+
+	for name, serviceCost := range report.Services {
+		weights := make(map[int64]float64, len(starts))
+		if sm, exists := snapshot.GetServiceMetrics(name); exists {
+			weights = c.usageCostByBucket(sm)
+		}
+
+		total := 0.0
+		for _, w := range weights {
+			total += w
+		}
+
+		for key, bucket := range index {
+			share := 1 / float64(len(starts))
+			if total > 0 {
+				share = weights[key] / total
+			}
+			cost := serviceCost.DirectCost * share
+			bucket.Services[name] = cost
+			bucket.TotalCost += cost
+		}
+	}
+
+	return buckets
+}
+
+// usageCostByBucket prices the CPU, memory and requests of a service in each bucket.
+// Fixed-price services cost the same in every bucket and get no weights.
+func (c *Calculator) usageCostByBucket(sm *models.ServiceMetrics) map[int64]float64 {
+	weights := make(map[int64]float64)
+	if c.computeModel(sm.ServiceName) == models.ComputeFixedMonthly {
+		return weights
+	}
+	add := func(points []models.TimePoint, price float64) {
+		for _, p := range points {
+			weights[p.Timestamp.UnixNano()] += p.Value * price
+		}
+	}
+
+	model := c.modelFor(sm.ServiceName)
+	add(sm.TimeSeries["cpu"], model.CPUCostPerCoreHour)
+	add(sm.TimeSeries["memory"], model.MemoryCostPerGBHour)
+	for _, em := range sm.Endpoints {
+		add(em.TimeSeries["requests"], model.RequestCost)
+	}
+
+	return weights
+}
+
+// bucketStarts returns the start of every bucket present in any time series, in order
+func bucketStarts(snapshot *models.MetricsSnapshot) []time.Time {
+	seen := make(map[int64]time.Time)
+	collect := func(series models.TimeSeries) {
+		for _, points := range series {
+			for _, p := range points {
+				seen[p.Timestamp.UnixNano()] = p.Timestamp
+			}
+		}
+	}
+
+	for _, sm := range snapshot.Services {
+		collect(sm.TimeSeries)
+		for _, em := range sm.Endpoints {
+			collect(em.TimeSeries)
+		}
+	}
+
+	starts := make([]time.Time, 0, len(seen))
+	for _, start := range seen {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
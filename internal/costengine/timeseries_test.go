@@ -0,0 +1,61 @@
+package costengine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/microcost/microcost/pkg/config"
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestCostTimeSeries(t *testing.T) {
+	calculator := newOverheadCalculator(t, config.SharedOverheadConfig{Source: "none"})
+	callGraph, snapshot, timeRange := newOverheadFixture()
+
+	// The large service uses 1 core-hour in the first half hour and 2 in the second;
+	// the small service has no time series and is spread evenly
+	start := timeRange.Start
+	snapshot.Resolution = 30 * time.Minute
+	snapshot.Services["large"].TimeSeries = models.TimeSeries{
+		"cpu": {
+			{Timestamp: start, Value: 1},
+			{Timestamp: start.Add(30 * time.Minute), Value: 2},
+		},
+	}
+
+	report, err := calculator.CalculateCosts(callGraph, snapshot, timeRange)
+	if err != nil {
+		t.Fatalf("CalculateCosts failed: %v", err)
+	}
+
+	if len(report.TimeSeries) != 2 {
+		t.Fatalf("Expected 2 cost buckets, got %d", len(report.TimeSeries))
+	}
+
+	tests := []struct {
+		bucket int
+		large  float64
+		small  float64
+	}{
+		{0, 1, 0.5},
+		{1, 2, 0.5},
+	}
+
+	for _, tt := range tests {
+		bucket := report.TimeSeries[tt.bucket]
+		if math.Abs(bucket.Services["large"]-tt.large) > 1e-9 {
+			t.Errorf("Expected large cost $%f in bucket %d, got $%f", tt.large, tt.bucket, bucket.Services["large"])
+		}
+		if math.Abs(bucket.Services["small"]-tt.small) > 1e-9 {
+			t.Errorf("Expected small cost $%f in bucket %d, got $%f", tt.small, tt.bucket, bucket.Services["small"])
+		}
+		if math.Abs(bucket.TotalCost-tt.large-tt.small) > 1e-9 {
+			t.Errorf("Expected bucket %d total $%f, got $%f", tt.bucket, tt.large+tt.small, bucket.TotalCost)
+		}
+	}
+
+	if end := report.TimeSeries[1].End; !end.Equal(timeRange.End) {
+		t.Errorf("Expected last bucket to end at %s, got %s", timeRange.End, end)
+	}
+}
@@ -2,14 +2,17 @@ package graph
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/microcost/microcost/pkg/models"
 )
 
 // Graph represents a directed graph structure
 type Graph struct {
-	nodes map[string]*Node
-	edges []*Edge
+	nodes    map[string]*Node
+	edges    []*Edge
+	outgoing map[string][]*Edge // edges by source node ID
 }
 
 // Node represents a vertex in the graph
@@ -32,11 +35,87 @@ type Edge struct {
 // NewGraph creates a new empty graph
 func NewGraph() *Graph {
 	return &Graph{
-		nodes: make(map[string]*Node),
-		edges: make([]*Edge, 0),
+		nodes:    make(map[string]*Node),
+		edges:    make([]*Edge, 0),
+		outgoing: make(map[string][]*Edge),
 	}
 }
 
+// FromCallGraph builds the endpoint graph of a call graph, with one node per
+// endpoint (ID service:path:method) and one edge per dependency. A dependency
+// leaves the caller's endpoints with its path (and method, if known) and enters
+// the callee's endpoint with its path and method. Without a method it enters the
+// callee's GET endpoint with the path, or else the first one. Endpoints the
+// analyzer did not find become nodes without data.
+func FromCallGraph(cg *models.CallGraph) *Graph {
+	g := NewGraph()
+
+	for _, service := range cg.Services {
+		for _, endpoint := range service.Endpoints {
+			g.AddNode(endpointNodeID(service.Name, endpoint.Path, endpoint.Method), service.Name, endpoint.Path, endpoint.Method, endpoint)
+		}
+	}
+
+	for _, dep := range cg.Dependencies {
+		fromNodes := make([]*Node, 0, 1)
+		for _, endpoint := range matchEndpoints(cg, dep.FromService, dep.FromEndpoint, dep.FromMethod) {
+			fromNodes = append(fromNodes, g.nodes[endpointNodeID(dep.FromService, endpoint.Path, endpoint.Method)])
+		}
+		if len(fromNodes) == 0 {
+			fromNodes = append(fromNodes, g.addVirtualNode(dep.FromService, dep.FromEndpoint, dep.FromMethod))
+		}
+
+		var toNode *Node
+		callees := matchEndpoints(cg, dep.ToService, dep.ToEndpoint, dep.ToMethod)
+		for _, endpoint := range callees {
+			if toNode == nil || endpoint.Method == "GET" {
+				toNode = g.nodes[endpointNodeID(dep.ToService, endpoint.Path, endpoint.Method)]
+			}
+		}
+		if toNode == nil {
+			toNode = g.addVirtualNode(dep.ToService, dep.ToEndpoint, dep.ToMethod)
+		}
+
+		for _, fromNode := range fromNodes {
+			g.AddEdge(fromNode, toNode, dep.Weight, dep)
+		}
+	}
+
+	return g
+}
+
+// endpointNodeID returns the node ID of an endpoint
+func endpointNodeID(service, path, method string) string {
+	return fmt.Sprintf("%s:%s:%s", service, path, method)
+}
+
+// matchEndpoints returns the endpoints of a service with a path and, if given,
+// method
+func matchEndpoints(cg *models.CallGraph, serviceName, path, method string) []*models.Endpoint {
+	service, exists := cg.GetService(serviceName)
+	if !exists {
+		return nil
+	}
+
+	endpoints := make([]*models.Endpoint, 0, 1)
+	for _, endpoint := range service.Endpoints {
+		if endpoint.Path == path && (method == "" || strings.EqualFold(endpoint.Method, method)) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// addVirtualNode adds a node for an endpoint the analyzer did not find, GET
+// unless the method is known
+func (g *Graph) addVirtualNode(service, path, method string) *Node {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = "GET"
+	}
+	return g.AddNode(endpointNodeID(service, path, method), service, path, method, nil)
+}
+
 // AddNode adds a node to the graph
 func (g *Graph) AddNode(id, service, endpoint, method string, data interface{}) *Node {
 	if node, exists := g.nodes[id]; exists {
@@ -63,6 +142,7 @@ func (g *Graph) AddEdge(from, to *Node, weight float64, dep *models.Dependency)
 		Data:   dep,
 	}
 	g.edges = append(g.edges, edge)
+	g.outgoing[from.ID] = append(g.outgoing[from.ID], edge)
 	return edge
 }
 
@@ -74,13 +154,7 @@ func (g *Graph) GetNode(id string) (*Node, bool) {
 
 // GetOutgoingEdges returns all edges originating from a node
 func (g *Graph) GetOutgoingEdges(node *Node) []*Edge {
-	edges := make([]*Edge, 0)
-	for _, edge := range g.edges {
-		if edge.From.ID == node.ID {
-			edges = append(edges, edge)
-		}
-	}
-	return edges
+	return append(make([]*Edge, 0, len(g.outgoing[node.ID])), g.outgoing[node.ID]...)
 }
 
 // GetIncomingEdges returns all edges pointing to a node
@@ -169,6 +243,65 @@ func (g *Graph) TopologicalSort() ([]*Node, error) {
 	return sorted, nil
 }
 
+// StronglyConnectedComponents returns the strongly connected components of the
+// graph in reverse topological order: every edge leaving a component points into
+// a component listed before it. Nodes on no cycle form components of their own.
+func (g *Graph) StronglyConnectedComponents() [][]*Node {
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Tarjan's algorithm, which emits each component after all components reachable from it
+	index := make(map[string]int, len(g.nodes))
+	lowLink := make(map[string]int, len(g.nodes))
+	onStack := make(map[string]bool, len(g.nodes))
+	stack := make([]*Node, 0)
+	components := make([][]*Node, 0)
+
+	var visit func(node *Node)
+	visit = func(node *Node) {
+		index[node.ID] = len(index)
+		lowLink[node.ID] = index[node.ID]
+		stack = append(stack, node)
+		onStack[node.ID] = true
+
+		for _, edge := range g.outgoing[node.ID] {
+			if _, visited := index[edge.To.ID]; !visited {
+				visit(edge.To)
+				lowLink[node.ID] = min(lowLink[node.ID], lowLink[edge.To.ID])
+			} else if onStack[edge.To.ID] {
+				lowLink[node.ID] = min(lowLink[node.ID], index[edge.To.ID])
+			}
+		}
+
+		if lowLink[node.ID] != index[node.ID] {
+			return
+		}
+
+		component := make([]*Node, 0, 1)
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top.ID] = false
+			component = append(component, top)
+			if top.ID == node.ID {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+
+	for _, id := range ids {
+		if _, visited := index[id]; !visited {
+			visit(g.nodes[id])
+		}
+	}
+
+	return components
+}
+
 // FindAllPaths finds all paths from start to end node
 func (g *Graph) FindAllPaths(startID, endID string, maxDepth int) [][]*Node {
 	start, exists := g.GetNode(startID)
@@ -1,7 +1,11 @@
 package graph
 
 import (
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/microcost/microcost/pkg/models"
 )
 
 func TestNewGraph(t *testing.T) {
@@ -222,6 +226,131 @@ func TestTopologicalSortWithCycle(t *testing.T) {
 	}
 }
 
+func TestStronglyConnectedComponents(t *testing.T) {
+	g := NewGraph()
+
+	entry := g.AddNode("entry", "gateway", "/", "GET", nil)
+	a := g.AddNode("a", "orders", "/orders", "GET", nil)
+	b := g.AddNode("b", "payments", "/pay", "POST", nil)
+	leaf := g.AddNode("leaf", "ledger", "/entries", "POST", nil)
+
+	g.AddEdge(entry, a, 1.0, nil)
+	g.AddEdge(a, b, 1.0, nil)
+	g.AddEdge(b, a, 0.5, nil)
+	g.AddEdge(b, leaf, 1.0, nil)
+
+	components := g.StronglyConnectedComponents()
+
+	if len(components) != 3 {
+		t.Fatalf("Expected 3 components, got %d", len(components))
+	}
+
+	// Callees come before their callers
+	position := make(map[string]int)
+	for i, component := range components {
+		for _, node := range component {
+			position[node.ID] = i
+		}
+	}
+
+	if position["a"] != position["b"] {
+		t.Error("a and b should share a component")
+	}
+
+	if position["leaf"] >= position["a"] || position["a"] >= position["entry"] {
+		t.Errorf("Expected reverse topological order, got leaf=%d cycle=%d entry=%d",
+			position["leaf"], position["a"], position["entry"])
+	}
+}
+
+func TestFromCallGraph(t *testing.T) {
+	cg := models.NewCallGraph()
+
+	checkout := &models.Service{Name: "checkout"}
+	checkout.AddEndpoint(&models.Endpoint{Path: "/checkout", Method: "POST"})
+	cg.AddService(checkout)
+
+	inventory := &models.Service{Name: "inventory"}
+	inventory.AddEndpoint(&models.Endpoint{Path: "/stock", Method: "GET"})
+	cg.AddService(inventory)
+
+	cg.AddDependency(&models.Dependency{
+		FromService:  "checkout",
+		FromEndpoint: "/checkout",
+		ToService:    "inventory",
+		ToEndpoint:   "/stock",
+		Weight:       2,
+	})
+
+	g := FromCallGraph(cg)
+
+	if g.NodeCount() != 2 {
+		t.Errorf("Expected 2 nodes, got %d", g.NodeCount())
+	}
+
+	from, exists := g.GetNode("checkout:/checkout:POST")
+	if !exists {
+		t.Fatal("Caller node not found")
+	}
+
+	edges := g.GetOutgoingEdges(from)
+	if len(edges) != 1 || edges[0].To.ID != "inventory:/stock:GET" || edges[0].Weight != 2 {
+		t.Errorf("Expected one edge to inventory:/stock:GET with weight 2, got %v", edges)
+	}
+}
+
+func TestFromCallGraphMethods(t *testing.T) {
+	cg := models.NewCallGraph()
+
+	orders := &models.Service{Name: "orders"}
+	orders.AddEndpoint(&models.Endpoint{Path: "/orders", Method: "GET"})
+	orders.AddEndpoint(&models.Endpoint{Path: "/orders", Method: "POST"})
+	cg.AddService(orders)
+
+	payments := &models.Service{Name: "payments"}
+	payments.AddEndpoint(&models.Endpoint{Path: "/charge", Method: "POST"})
+	cg.AddService(payments)
+
+	tests := []struct {
+		dep      *models.Dependency
+		expected []string // edges as from -> to
+	}{
+		{
+			// the only endpoint with the path, whatever its method
+			dep:      &models.Dependency{FromService: "orders", FromEndpoint: "/orders", FromMethod: "POST", ToService: "payments", ToEndpoint: "/charge"},
+			expected: []string{"orders:/orders:POST -> payments:/charge:POST"},
+		},
+		{
+			// every caller endpoint with the path, to the callee's GET endpoint
+			dep:      &models.Dependency{FromService: "payments", FromEndpoint: "/charge", ToService: "orders", ToEndpoint: "/orders"},
+			expected: []string{"payments:/charge:POST -> orders:/orders:GET"},
+		},
+		{
+			dep:      &models.Dependency{FromService: "payments", FromEndpoint: "/charge", ToService: "orders", ToEndpoint: "/orders", ToMethod: "POST"},
+			expected: []string{"payments:/charge:POST -> orders:/orders:POST"},
+		},
+		{
+			dep:      &models.Dependency{FromService: "orders", FromEndpoint: "/orders", ToService: "shipping", ToEndpoint: "/ship", ToMethod: "put"},
+			expected: []string{"orders:/orders:GET -> shipping:/ship:PUT", "orders:/orders:POST -> shipping:/ship:PUT"},
+		},
+	}
+
+	for _, tt := range tests {
+		cg.Dependencies = []*models.Dependency{tt.dep}
+		g := FromCallGraph(cg)
+
+		edges := make([]string, 0)
+		for _, edge := range g.GetAllEdges() {
+			edges = append(edges, edge.From.ID+" -> "+edge.To.ID)
+		}
+		sort.Strings(edges)
+
+		if strings.Join(edges, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("Expected edges %v, got %v", tt.expected, edges)
+		}
+	}
+}
+
 func TestFindAllPaths(t *testing.T) {
 	g := NewGraph()
 
@@ -0,0 +1,90 @@
+package pricing
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// awsOffer is the part of a Price List API offer file the catalog uses
+type awsOffer struct {
+	Products map[string]struct {
+		ProductFamily string            `json:"productFamily"`
+		Attributes    map[string]string `json:"attributes"`
+	} `json:"products"`
+	Terms struct {
+		OnDemand map[string]map[string]struct {
+			PriceDimensions map[string]struct {
+				BeginRange   string            `json:"beginRange"`
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// onDemandPrice returns the USD on-demand price of a SKU, from the first tier of
+// tiered prices
+func (o *awsOffer) onDemandPrice(sku string) (float64, bool) {
+	for _, term := range o.Terms.OnDemand[sku] {
+		for _, dim := range term.PriceDimensions {
+			if dim.BeginRange != "" && dim.BeginRange != "0" {
+				continue
+			}
+			price, err := parsePrice(dim.PricePerUnit["USD"])
+			return price, err == nil
+		}
+	}
+	return 0, false
+}
+
+// updateAWS applies an offer file: shared-tenancy Linux EC2 instances, x86 Fargate
+// vCPU and memory, and x86 Lambda compute and requests
+func (c *Catalog) updateAWS(data []byte) (int, error) {
+	var offer awsOffer
+	if err := json.Unmarshal(data, &offer); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for sku, product := range offer.Products {
+		attrs := product.Attributes
+		region := attrs["regionCode"]
+		if region == "" {
+			continue
+		}
+		price, ok := offer.onDemandPrice(sku)
+		if !ok {
+			continue
+		}
+
+		usage := attrs["usagetype"]
+		switch {
+		case product.ProductFamily == "Compute Instance":
+			if attrs["operatingSystem"] != "Linux" || attrs["tenancy"] != "Shared" ||
+				attrs["preInstalledSw"] != "NA" || attrs["capacitystatus"] != "Used" {
+				continue
+			}
+			vcpus, err := parsePrice(attrs["vcpu"])
+			if err != nil {
+				continue
+			}
+			memory, err := parsePrice(strings.TrimSuffix(strings.ReplaceAll(attrs["memory"], ",", ""), " GiB"))
+			if err != nil {
+				continue
+			}
+			c.setInstance(region, attrs["instanceType"], vcpus, memory, price)
+		case strings.HasSuffix(usage, "Fargate-vCPU-Hours:perCPU"):
+			c.serverless(region, "fargate").VCPUHour = price
+		case strings.HasSuffix(usage, "Fargate-GB-Hours"):
+			c.serverless(region, "fargate").GBHour = price
+		case strings.HasSuffix(usage, "Lambda-GB-Second"):
+			c.serverless(region, "lambda").GBHour = price * 3600
+		case attrs["servicecode"] == "AWSLambda" && (usage == "Request" || strings.HasSuffix(usage, "-Request")):
+			c.serverless(region, "lambda").Request = price
+		default:
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
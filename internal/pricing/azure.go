@@ -0,0 +1,50 @@
+package pricing
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// azureRetailPrices is the part of a Retail Prices API response the catalog uses
+type azureRetailPrices struct {
+	Items []struct {
+		ServiceName   string  `json:"serviceName"`
+		Type          string  `json:"type"`
+		ArmRegionName string  `json:"armRegionName"`
+		ArmSkuName    string  `json:"armSkuName"`
+		SkuName       string  `json:"skuName"`
+		ProductName   string  `json:"productName"`
+		UnitOfMeasure string  `json:"unitOfMeasure"`
+		RetailPrice   float64 `json:"retailPrice"`
+	} `json:"Items"`
+}
+
+// updateAzure applies a Retail Prices API response: pay-as-you-go Linux prices of
+// the VM sizes the catalog knows. Responses are paged; each page is a file.
+func (c *Catalog) updateAzure(data []byte) (int, error) {
+	var prices azureRetailPrices
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return 0, err
+	}
+
+	shapes := c.shapes()
+	n := 0
+	for _, item := range prices.Items {
+		if item.ServiceName != "Virtual Machines" || item.Type != "Consumption" || item.UnitOfMeasure != "1 Hour" {
+			continue
+		}
+		if strings.Contains(item.ProductName, "Windows") ||
+			strings.Contains(item.SkuName, "Spot") || strings.Contains(item.SkuName, "Low Priority") {
+			continue
+		}
+
+		shape, known := shapes[item.ArmSkuName]
+		if !known {
+			continue
+		}
+		c.setInstance(item.ArmRegionName, item.ArmSkuName, shape.VCPUs, shape.MemoryGB, item.RetailPrice)
+		n++
+	}
+
+	return n, nil
+}
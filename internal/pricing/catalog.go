@@ -0,0 +1,199 @@
+package pricing
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+// bundled holds the price tables shipped with the binary, one file per provider
+//
+//go:embed data/*.json
+var bundled embed.FS
+
+// Providers lists the providers with a price catalog
+var Providers = []string{"aws", "azure", "gcp"}
+
+// Catalog holds on-demand Linux prices of a provider's compute offerings per region
+type Catalog struct {
+	Provider string `json:"provider"`
+	Currency string `json:"currency"`
+	Updated  string `json:"updated"` // date the prices were taken from the provider's price list
+
+	// CPUMemoryRatio is the price of a vCPU-hour relative to a GB-hour, taken from
+	// the provider's per-resource prices. It splits instance prices into rates.
+	CPUMemoryRatio float64 `json:"cpu_memory_ratio"`
+
+	Regions map[string]*RegionPrices `json:"regions"`
+}
+
+// RegionPrices holds the prices of one region
+type RegionPrices struct {
+	Instances  map[string]*InstancePrice   `json:"instances,omitempty"`  // by instance or machine type
+	Serverless map[string]*ServerlessPrice `json:"serverless,omitempty"` // fargate, cloud_run, lambda
+}
+
+// InstancePrice is the shape and hourly price of a VM instance type
+type InstancePrice struct {
+	VCPUs    float64 `json:"vcpus"`
+	MemoryGB float64 `json:"memory_gb"`
+	Hourly   float64 `json:"hourly"`
+}
+
+// ServerlessPrice holds the unit prices of a serverless compute offering
+type ServerlessPrice struct {
+	VCPUHour float64 `json:"vcpu_hour,omitempty"`
+	GBHour   float64 `json:"gb_hour,omitempty"`
+	Request  float64 `json:"request,omitempty"`
+}
+
+// LoadCatalog returns the catalog of a provider from dir when it holds one,
+// otherwise the bundled catalog
+func LoadCatalog(provider, dir string) (*Catalog, error) {
+	name := strings.ToLower(provider) + ".json"
+
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return parseCatalog(data)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("error reading price catalog: %w", err)
+		}
+	}
+
+	data, err := bundled.ReadFile("data/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("no price catalog for provider %s (available: %s)", provider, strings.Join(Providers, ", "))
+	}
+	return parseCatalog(data)
+}
+
+// parseCatalog decodes a catalog file
+func parseCatalog(data []byte) (*Catalog, error) {
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("error parsing price catalog: %w", err)
+	}
+	if catalog.Regions == nil {
+		catalog.Regions = make(map[string]*RegionPrices)
+	}
+	return &catalog, nil
+}
+
+// Save writes the catalog to <dir>/<provider>.json, where LoadCatalog finds it
+func (c *Catalog) Save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("error creating catalog directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding price catalog: %w", err)
+	}
+
+	path := filepath.Join(dir, c.Provider+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return "", fmt.Errorf("error writing price catalog: %w", err)
+	}
+	return path, nil
+}
+
+// region returns the prices of a region, adding it when missing
+func (c *Catalog) region(name string) *RegionPrices {
+	rp, exists := c.Regions[name]
+	if !exists {
+		rp = &RegionPrices{}
+		c.Regions[name] = rp
+	}
+	return rp
+}
+
+// Rates returns the cost model with the CPU, memory and request rates of a compute
+// offering in the region of the base model: the unit prices of a serverless
+// offering, or an instance price split into per-core and per-GB rates by the
+// catalog's CPU to memory price ratio. Other rates are kept.
+func (c *Catalog) Rates(base *models.CostModel, compute string) (*models.CostModel, error) {
+	rp, exists := c.Regions[base.Region]
+	if !exists {
+		return nil, fmt.Errorf("no %s prices for region %s", c.Provider, base.Region)
+	}
+
+	model := *base
+	model.Compute = compute
+
+	if sp := lookup(rp.Serverless, compute); sp != nil {
+		model.CPUCostPerCoreHour = sp.VCPUHour
+		model.MemoryCostPerGBHour = sp.GBHour
+		if sp.Request > 0 {
+			model.RequestCost = sp.Request
+		}
+		return &model, nil
+	}
+
+	ip := lookup(rp.Instances, compute)
+	if ip == nil {
+		return nil, fmt.Errorf("no %s prices for %s in region %s", c.Provider, compute, base.Region)
+	}
+
+	ratio := c.CPUMemoryRatio
+	if ratio <= 0 {
+		ratio = defaultCPUMemoryRatio
+	}
+	perGB := ip.Hourly / (ratio*ip.VCPUs + ip.MemoryGB)
+	model.CPUCostPerCoreHour = ratio * perGB
+	model.MemoryCostPerGBHour = perGB
+	return &model, nil
+}
+
+// invocationPriced lists the serverless offerings billed per invocation and its
+// duration rather than for the time instances run
+var invocationPriced = map[string]bool{"lambda": true, "cloud_run": true, "cloud_functions": true}
+
+// InvocationPriced reports whether a compute offering is billed per invocation
+// and its duration, which only the serverless compute model prices correctly
+func InvocationPriced(compute string) bool {
+	return invocationPriced[strings.ToLower(compute)]
+}
+
+// defaultCPUMemoryRatio is used for catalogs that do not set a ratio
+const defaultCPUMemoryRatio = 8.0
+
+// lookup finds a price by name, ignoring case when there is no exact match
+func lookup[T any](prices map[string]*T, name string) *T {
+	if p, exists := prices[name]; exists {
+		return p
+	}
+	for n, p := range prices {
+		if strings.EqualFold(n, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Offerings lists the instance types and serverless offerings of a region
+func (c *Catalog) Offerings(region string) []string {
+	rp, exists := c.Regions[region]
+	if !exists {
+		return nil
+	}
+
+	names := make([]string, 0, len(rp.Instances)+len(rp.Serverless))
+	for name := range rp.Instances {
+		names = append(names, name)
+	}
+	for name := range rp.Serverless {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
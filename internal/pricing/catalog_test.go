@@ -0,0 +1,101 @@
+package pricing
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/microcost/microcost/pkg/models"
+)
+
+func TestBundledCatalogs(t *testing.T) {
+	for _, provider := range Providers {
+		catalog, err := LoadCatalog(provider, "")
+		if err != nil {
+			t.Fatalf("LoadCatalog(%s) failed: %v", provider, err)
+		}
+		if catalog.Provider != provider || len(catalog.Regions) == 0 {
+			t.Errorf("Expected %s catalog with regions, got %s with %d", provider, catalog.Provider, len(catalog.Regions))
+		}
+	}
+
+	if _, err := LoadCatalog("custom", ""); err == nil {
+		t.Error("Expected error for provider without catalog")
+	}
+}
+
+func TestRates(t *testing.T) {
+	catalog := &Catalog{
+		Provider:       "aws",
+		CPUMemoryRatio: 8,
+		Regions: map[string]*RegionPrices{
+			"us-east-1": {
+				Instances:  map[string]*InstancePrice{"m6i.large": {VCPUs: 2, MemoryGB: 8, Hourly: 0.096}},
+				Serverless: map[string]*ServerlessPrice{"lambda": {GBHour: 0.06, Request: 2e-7}},
+			},
+		},
+	}
+	base := &models.CostModel{Provider: "aws", Region: "us-east-1", NetworkCostPerGB: 0.09, RequestCost: 1e-6}
+
+	tests := []struct {
+		compute string
+		cpu     float64
+		memory  float64
+		request float64
+	}{
+		// 0.096 = 2 x 8g + 8 x g
+		{"m6i.large", 0.032, 0.004, 1e-6},
+		{"M6I.Large", 0.032, 0.004, 1e-6},
+		{"lambda", 0, 0.06, 2e-7},
+	}
+
+	for _, tt := range tests {
+		model, err := catalog.Rates(base, tt.compute)
+		if err != nil {
+			t.Fatalf("Rates(%s) failed: %v", tt.compute, err)
+		}
+		if math.Abs(model.CPUCostPerCoreHour-tt.cpu) > 1e-9 || math.Abs(model.MemoryCostPerGBHour-tt.memory) > 1e-9 {
+			t.Errorf("%s: expected %f per core-hour and %f per GB-hour, got %f and %f",
+				tt.compute, tt.cpu, tt.memory, model.CPUCostPerCoreHour, model.MemoryCostPerGBHour)
+		}
+		if model.RequestCost != tt.request || model.NetworkCostPerGB != 0.09 || model.Compute != tt.compute {
+			t.Errorf("%s: unexpected cost model %+v", tt.compute, model)
+		}
+	}
+
+	if _, err := catalog.Rates(base, "m6i.metal"); err == nil {
+		t.Error("Expected error for unknown instance type")
+	}
+	if _, err := catalog.Rates(&models.CostModel{Region: "eu-west-1"}, "m6i.large"); err == nil {
+		t.Error("Expected error for region without prices")
+	}
+}
+
+func TestLoadCatalogFromDir(t *testing.T) {
+	dir := t.TempDir()
+	catalog, err := LoadCatalog("aws", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog.Updated = "2030-01-01"
+	if _, err := catalog.Save(dir); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadCatalog("aws", dir)
+	if err != nil {
+		t.Fatalf("LoadCatalog failed: %v", err)
+	}
+	if loaded.Updated != "2030-01-01" {
+		t.Errorf("Expected catalog from directory, got prices of %s", loaded.Updated)
+	}
+
+	// Providers without a catalog in the directory use the bundled one
+	if _, err := os.Stat(filepath.Join(dir, "gcp.json")); !os.IsNotExist(err) {
+		t.Fatal("Expected no gcp catalog in directory")
+	}
+	if _, err := LoadCatalog("gcp", dir); err != nil {
+		t.Errorf("Expected bundled gcp catalog, got %v", err)
+	}
+}
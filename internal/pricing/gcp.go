@@ -0,0 +1,123 @@
+package pricing
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gcpSKUs is the part of a Cloud Billing Catalog API SKU list the catalog uses
+type gcpSKUs struct {
+	SKUs []struct {
+		Description string `json:"description"`
+		Category    struct {
+			ServiceDisplayName string `json:"serviceDisplayName"`
+			UsageType          string `json:"usageType"`
+		} `json:"category"`
+		ServiceRegions []string `json:"serviceRegions"`
+		PricingInfo    []struct {
+			PricingExpression struct {
+				UsageUnit   string `json:"usageUnit"`
+				TieredRates []struct {
+					UnitPrice struct {
+						Units string `json:"units"`
+						Nanos int64  `json:"nanos"`
+					} `json:"unitPrice"`
+				} `json:"tieredRates"`
+			} `json:"pricingExpression"`
+		} `json:"pricingInfo"`
+	} `json:"skus"`
+}
+
+// gcpInstanceSKU matches the per-vCPU and per-GB SKUs of a machine family, e.g.
+// "N2 Instance Core running in Americas" or "N2D AMD Instance Ram running in EMEA"
+var gcpInstanceSKU = regexp.MustCompile(`^(\w+)(?: AMD)? Instance (Core|Ram) running in`)
+
+// gcpComputeOptimizedSKU matches the SKUs of the C2 family, which are named differently
+var gcpComputeOptimizedSKU = regexp.MustCompile(`^Compute optimized (Core|Ram) running in`)
+
+// updateGCP applies a SKU list: on-demand vCPU and memory prices of machine
+// families, from which the price of every machine type the catalog knows is
+// recomputed, and Cloud Run CPU, memory and request prices
+func (c *Catalog) updateGCP(data []byte) (int, error) {
+	var list gcpSKUs
+	if err := json.Unmarshal(data, &list); err != nil {
+		return 0, err
+	}
+
+	// family -> region -> [core, ram] hourly price
+	families := make(map[string]map[string]*[2]float64)
+	n := 0
+
+	for _, sku := range list.SKUs {
+		if sku.Category.UsageType != "OnDemand" || len(sku.PricingInfo) == 0 {
+			continue
+		}
+		expr := sku.PricingInfo[0].PricingExpression
+		price := 0.0
+		for _, rate := range expr.TieredRates {
+			units, _ := strconv.ParseFloat(rate.UnitPrice.Units, 64)
+			if p := units + float64(rate.UnitPrice.Nanos)/1e9; p > 0 {
+				price = p
+				break
+			}
+		}
+		if strings.HasSuffix(expr.UsageUnit, ".s") || expr.UsageUnit == "s" {
+			price *= 3600
+		}
+
+		if sku.Category.ServiceDisplayName == "Cloud Run" {
+			for _, region := range sku.ServiceRegions {
+				switch sku.Description {
+				case "CPU Allocation Time":
+					c.serverless(region, "cloud_run").VCPUHour = price
+				case "Memory Allocation Time":
+					c.serverless(region, "cloud_run").GBHour = price
+				case "Requests":
+					c.serverless(region, "cloud_run").Request = price
+				default:
+					continue
+				}
+				n++
+			}
+			continue
+		}
+
+		family, resource := "", ""
+		if m := gcpInstanceSKU.FindStringSubmatch(sku.Description); m != nil {
+			family, resource = strings.ToLower(m[1]), m[2]
+		} else if m := gcpComputeOptimizedSKU.FindStringSubmatch(sku.Description); m != nil {
+			family, resource = "c2", m[1]
+		} else {
+			continue
+		}
+
+		if families[family] == nil {
+			families[family] = make(map[string]*[2]float64)
+		}
+		for _, region := range sku.ServiceRegions {
+			if families[family][region] == nil {
+				families[family][region] = &[2]float64{}
+			}
+			if resource == "Core" {
+				families[family][region][0] = price
+			} else {
+				families[family][region][1] = price
+			}
+		}
+	}
+
+	for name, shape := range c.shapes() {
+		family, _, _ := strings.Cut(name, "-")
+		for region, rates := range families[family] {
+			if rates[0] == 0 || rates[1] == 0 {
+				continue
+			}
+			c.setInstance(region, name, shape.VCPUs, shape.MemoryGB, shape.VCPUs*rates[0]+shape.MemoryGB*rates[1])
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package pricing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Update applies the prices of a vendor price-list file to the catalog and returns
+// the number of prices it set. The file format follows the catalog's provider:
+//   - aws: a Price List API offer file (AmazonEC2, AmazonECS or AWSLambda)
+//   - gcp: a Cloud Billing Catalog API SKU list (Compute Engine or Cloud Run)
+//   - azure: a Retail Prices API response
+//
+// Offers without a shape in the price list (GCP and Azure machine types) are only
+// priced when the catalog already knows their shape.
+func (c *Catalog) Update(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading price list: %w", err)
+	}
+
+	var n int
+	switch c.Provider {
+	case "aws":
+		n, err = c.updateAWS(data)
+	case "gcp":
+		n, err = c.updateGCP(data)
+	case "azure":
+		n, err = c.updateAzure(data)
+	default:
+		return 0, fmt.Errorf("price lists of provider %s are not supported", c.Provider)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error parsing price list %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// shapes returns the shape of every instance type the catalog knows, in any region
+func (c *Catalog) shapes() map[string]InstancePrice {
+	shapes := make(map[string]InstancePrice)
+	for _, rp := range c.Regions {
+		for name, ip := range rp.Instances {
+			shapes[name] = InstancePrice{VCPUs: ip.VCPUs, MemoryGB: ip.MemoryGB}
+		}
+	}
+	return shapes
+}
+
+// setInstance sets the hourly price of an instance type in a region
+func (c *Catalog) setInstance(region, name string, vcpus, memoryGB, hourly float64) {
+	rp := c.region(region)
+	if rp.Instances == nil {
+		rp.Instances = make(map[string]*InstancePrice)
+	}
+	rp.Instances[name] = &InstancePrice{VCPUs: vcpus, MemoryGB: memoryGB, Hourly: hourly}
+}
+
+// serverless returns the prices of a serverless offering in a region, adding it
+// when missing
+func (c *Catalog) serverless(region, name string) *ServerlessPrice {
+	rp := c.region(region)
+	if rp.Serverless == nil {
+		rp.Serverless = make(map[string]*ServerlessPrice)
+	}
+	sp, exists := rp.Serverless[name]
+	if !exists {
+		sp = &ServerlessPrice{}
+		rp.Serverless[name] = sp
+	}
+	return sp
+}
+
+// parsePrice parses a decimal price, treating an empty string as zero
+func parsePrice(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
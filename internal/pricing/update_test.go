@@ -0,0 +1,116 @@
+package pricing
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes a price list into dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpdateAWS(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "offer.json", `{
+  "products": {
+    "LINUX": {"productFamily": "Compute Instance", "attributes": {"regionCode": "ap-south-1", "instanceType": "m6i.large", "vcpu": "2", "memory": "8 GiB",
+      "operatingSystem": "Linux", "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used"}},
+    "WINDOWS": {"productFamily": "Compute Instance", "attributes": {"regionCode": "ap-south-1", "instanceType": "m6i.large", "vcpu": "2", "memory": "8 GiB",
+      "operatingSystem": "Windows", "tenancy": "Shared", "preInstalledSw": "NA", "capacitystatus": "Used"}},
+    "FARGATECPU": {"productFamily": "Compute", "attributes": {"regionCode": "ap-south-1", "usagetype": "APS3-Fargate-vCPU-Hours:perCPU"}},
+    "LAMBDA": {"productFamily": "Serverless", "attributes": {"regionCode": "ap-south-1", "servicecode": "AWSLambda", "usagetype": "APS3-Lambda-GB-Second"}}
+  },
+  "terms": {"OnDemand": {
+    "LINUX": {"LINUX.T": {"priceDimensions": {"LINUX.T.D": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0504000000"}}}}},
+    "WINDOWS": {"WINDOWS.T": {"priceDimensions": {"WINDOWS.T.D": {"unit": "Hrs", "pricePerUnit": {"USD": "0.1424000000"}}}}},
+    "FARGATECPU": {"FARGATECPU.T": {"priceDimensions": {"FARGATECPU.T.D": {"unit": "hours", "pricePerUnit": {"USD": "0.0404800000"}}}}},
+    "LAMBDA": {"LAMBDA.T": {"priceDimensions": {
+      "LAMBDA.T.1": {"beginRange": "0", "pricePerUnit": {"USD": "0.0000166667"}},
+      "LAMBDA.T.2": {"beginRange": "6000000000", "pricePerUnit": {"USD": "0.0000150000"}}
+    }}}
+  }}
+}`)
+
+	catalog := &Catalog{Provider: "aws", Regions: make(map[string]*RegionPrices)}
+	n, err := catalog.Update(path)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 prices, got %d", n)
+	}
+
+	region := catalog.Regions["ap-south-1"]
+	if ip := region.Instances["m6i.large"]; ip == nil || ip.Hourly != 0.0504 || ip.VCPUs != 2 || ip.MemoryGB != 8 {
+		t.Errorf("Expected Linux m6i.large at 0.0504 with 2 vCPUs and 8 GB, got %+v", ip)
+	}
+	if sp := region.Serverless["fargate"]; sp == nil || sp.VCPUHour != 0.04048 {
+		t.Errorf("Expected fargate vCPU-hour 0.04048, got %+v", sp)
+	}
+	if sp := region.Serverless["lambda"]; sp == nil || math.Abs(sp.GBHour-0.06) > 1e-6 {
+		t.Errorf("Expected lambda GB-hour 0.06 from the first tier, got %+v", sp)
+	}
+}
+
+func TestUpdateGCP(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "skus.json", `{"skus": [
+  {"description": "N2 Instance Core running in Americas", "category": {"serviceDisplayName": "Compute Engine", "usageType": "OnDemand"},
+   "serviceRegions": ["us-east1"], "pricingInfo": [{"pricingExpression": {"usageUnit": "h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 30000000}}]}}]},
+  {"description": "N2 Instance Ram running in Americas", "category": {"serviceDisplayName": "Compute Engine", "usageType": "OnDemand"},
+   "serviceRegions": ["us-east1"], "pricingInfo": [{"pricingExpression": {"usageUnit": "GiBy.h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 4000000}}]}}]},
+  {"description": "N2 Instance Core running in Americas", "category": {"serviceDisplayName": "Compute Engine", "usageType": "Preemptible"},
+   "serviceRegions": ["us-east1"], "pricingInfo": [{"pricingExpression": {"usageUnit": "h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 7000000}}]}}]},
+  {"description": "CPU Allocation Time", "category": {"serviceDisplayName": "Cloud Run", "usageType": "OnDemand"},
+   "serviceRegions": ["us-east1"], "pricingInfo": [{"pricingExpression": {"usageUnit": "s", "tieredRates": [
+     {"unitPrice": {"units": "0", "nanos": 0}}, {"unitPrice": {"units": "0", "nanos": 24000}}]}}]}
+]}`)
+
+	catalog := &Catalog{Provider: "gcp", Regions: map[string]*RegionPrices{
+		"us-central1": {Instances: map[string]*InstancePrice{"n2-standard-4": {VCPUs: 4, MemoryGB: 16, Hourly: 0.19}}},
+	}}
+	if _, err := catalog.Update(path); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	region := catalog.Regions["us-east1"]
+	if ip := region.Instances["n2-standard-4"]; ip == nil || math.Abs(ip.Hourly-(4*0.03+16*0.004)) > 1e-9 {
+		t.Errorf("Expected n2-standard-4 priced from on-demand core and ram prices, got %+v", ip)
+	}
+	if sp := region.Serverless["cloud_run"]; sp == nil || math.Abs(sp.VCPUHour-0.0864) > 1e-9 {
+		t.Errorf("Expected cloud_run vCPU-hour 0.0864 past the free tier, got %+v", sp)
+	}
+}
+
+func TestUpdateAzure(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "prices.json", `{"Items": [
+  {"serviceName": "Virtual Machines", "type": "Consumption", "armRegionName": "northeurope", "armSkuName": "Standard_D2s_v5",
+   "skuName": "D2s v5", "productName": "Virtual Machines Dsv5 Series", "unitOfMeasure": "1 Hour", "retailPrice": 0.104},
+  {"serviceName": "Virtual Machines", "type": "Consumption", "armRegionName": "northeurope", "armSkuName": "Standard_D2s_v5",
+   "skuName": "D2s v5 Spot", "productName": "Virtual Machines Dsv5 Series", "unitOfMeasure": "1 Hour", "retailPrice": 0.02},
+  {"serviceName": "Virtual Machines", "type": "Consumption", "armRegionName": "northeurope", "armSkuName": "Standard_D2s_v5",
+   "skuName": "D2s v5", "productName": "Virtual Machines Dsv5 Series Windows", "unitOfMeasure": "1 Hour", "retailPrice": 0.196},
+  {"serviceName": "Virtual Machines", "type": "Consumption", "armRegionName": "northeurope", "armSkuName": "Standard_Unknown",
+   "skuName": "Unknown", "productName": "Virtual Machines", "unitOfMeasure": "1 Hour", "retailPrice": 1}
+]}`)
+
+	catalog := &Catalog{Provider: "azure", Regions: map[string]*RegionPrices{
+		"eastus": {Instances: map[string]*InstancePrice{"Standard_D2s_v5": {VCPUs: 2, MemoryGB: 8, Hourly: 0.096}}},
+	}}
+	n, err := catalog.Update(path)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 price, got %d", n)
+	}
+	if ip := catalog.Regions["northeurope"].Instances["Standard_D2s_v5"]; ip == nil || ip.Hourly != 0.104 {
+		t.Errorf("Expected Linux pay-as-you-go price 0.104, got %+v", ip)
+	}
+}
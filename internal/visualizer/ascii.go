@@ -2,6 +2,7 @@ package visualizer
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -44,6 +45,18 @@ func (ar *ASCIIRenderer) RenderCostReport(report *models.CostReport) string {
 	sb.WriteString(ar.renderServiceBreakdown(report))
 	sb.WriteString("\n\n")
 
+	// Environment Breakdown
+	if len(report.Environments) > 0 {
+		sb.WriteString(ar.renderEnvironmentBreakdown(report))
+		sb.WriteString("\n\n")
+	}
+
+	// Cost Over Time
+	if len(report.TimeSeries) > 0 {
+		sb.WriteString(ar.renderCostOverTime(report))
+		sb.WriteString("\n\n")
+	}
+
 	// Recommendations
 	if len(report.Recommendations) > 0 {
 		sb.WriteString(ar.renderRecommendations(report))
@@ -73,10 +86,40 @@ func (ar *ASCIIRenderer) renderSummary(report *models.CostReport) string {
 	var sb strings.Builder
 
 	sb.WriteString(ar.styleLabel("Total Cost:") + " " + ar.styleCost(report.TotalCost) + "\n")
+	if report.ListCost > 0 {
+		effective := 0.0
+		for _, sc := range report.Services {
+			effective += sc.DirectCost
+		}
+		sb.WriteString(ar.styleLabel("Direct Cost:") + " " + ar.styleCost(effective) +
+			" (list " + ar.styleCost(report.ListCost) + fmt.Sprintf(", %.0f%% discount)\n", (1-effective/report.ListCost)*100))
+	}
 	sb.WriteString(ar.styleLabel("Time Range:") + " " + report.TimeRange.Start.Format("2006-01-02 15:04") +
 		" to " + report.TimeRange.End.Format("2006-01-02 15:04") + "\n")
 	sb.WriteString(ar.styleLabel("Services:") + fmt.Sprintf(" %d\n", len(report.Services)))
 	sb.WriteString(ar.styleLabel("Provider:") + " " + report.CostModel.Provider + " (" + report.CostModel.Region + ")\n")
+	if report.AllocationMethod != "" {
+		sb.WriteString(ar.styleLabel("Allocation:") + " " + string(report.AllocationMethod) + "\n")
+	}
+	if len(report.Dimensions) > 0 {
+		scope := make([]string, 0, len(report.Dimensions))
+		for name, value := range report.Dimensions {
+			scope = append(scope, name+"="+value)
+		}
+		sort.Strings(scope)
+		sb.WriteString(ar.styleLabel("Scope:") + " " + strings.Join(scope, " ") + "\n")
+	}
+	if report.BillingMode != "" {
+		sb.WriteString(ar.styleLabel("Billing:") + " " + string(report.BillingMode) + "\n")
+	}
+	if report.AttributionMode == models.AttributionTrafficShare {
+		sb.WriteString(ar.styleLabel("Attribution:") + " " + string(report.AttributionMode) + "\n")
+		sb.WriteString(ar.styleLabel("Unattributed:") + " " + ar.styleCost(report.UnattributedCost) + "\n")
+	}
+	if report.ClusterCost > 0 {
+		sb.WriteString(ar.styleLabel("Cluster Cost:") + " " + ar.styleCost(report.ClusterCost) + "\n")
+		sb.WriteString(ar.styleLabel("Shared Overhead:") + " " + ar.styleCost(report.SharedOverhead) + "\n")
+	}
 
 	return sb.String()
 }
@@ -127,8 +170,23 @@ func (ar *ASCIIRenderer) renderServiceBreakdown(report *models.CostReport) strin
 	for serviceName, sc := range report.Services {
 		sb.WriteString(ar.styleServiceName(serviceName) + "\n")
 		sb.WriteString(fmt.Sprintf("  Direct Cost: %s\n", ar.styleCost(sc.DirectCost)))
+		if sc.ComputeModel != "" {
+			sb.WriteString(fmt.Sprintf("  Compute Model: %s\n", sc.ComputeModel))
+		}
+		if sc.ListCost > 0 {
+			sb.WriteString(fmt.Sprintf("  List Cost: %s\n", ar.styleCost(sc.ListCost)))
+		}
 		sb.WriteString(fmt.Sprintf("  Attributed Cost: %s\n", ar.styleCost(sc.AttributedCost)))
 		sb.WriteString(fmt.Sprintf("  Total Cost: %s\n", ar.styleCost(sc.TotalCost)))
+		if sc.SharedOverhead > 0 {
+			sb.WriteString(fmt.Sprintf("  Shared Overhead: %s\n", ar.styleCost(sc.SharedOverhead)))
+		}
+		if sc.UnattributedCost > 0 {
+			sb.WriteString(fmt.Sprintf("  Unattributed Cost: %s\n", ar.styleCost(sc.UnattributedCost)))
+		}
+		if sc.IdleCost > 0 {
+			sb.WriteString(fmt.Sprintf("  Idle (Over-provisioned): %s\n", ar.styleCost(sc.IdleCost)))
+		}
 		sb.WriteString(fmt.Sprintf("  Endpoints: %d\n", len(sc.Endpoints)))
 
 		// Show top 3 endpoints for this service
@@ -146,6 +204,67 @@ func (ar *ASCIIRenderer) renderServiceBreakdown(report *models.CostReport) strin
 	return sb.String()
 }
 
+// renderEnvironmentBreakdown renders the total cost of each environment
+func (ar *ASCIIRenderer) renderEnvironmentBreakdown(report *models.CostReport) string {
+	var sb strings.Builder
+	sb.WriteString(ar.renderSubHeader("Environment Breakdown") + "\n\n")
+
+	names := make([]string, 0, len(report.Environments))
+	for name := range report.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tableStr := &strings.Builder{}
+	table := tablewriter.NewWriter(tableStr)
+	table.SetHeader([]string{"Environment", "Services", "Total Cost"})
+	table.SetBorder(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, name := range names {
+		env := report.Environments[name]
+		table.Append([]string{
+			name,
+			fmt.Sprintf("%d", len(env.Services)),
+			fmt.Sprintf("$%.4f", env.TotalCost),
+		})
+	}
+
+	table.Render()
+	sb.WriteString(tableStr.String())
+
+	return sb.String()
+}
+
+// renderCostOverTime renders the cost of each time bucket as a bar chart and
+// highlights the most expensive bucket
+func (ar *ASCIIRenderer) renderCostOverTime(report *models.CostReport) string {
+	var sb strings.Builder
+	sb.WriteString(ar.renderSubHeader("Cost Over Time") + "\n\n")
+
+	const barWidth = 40
+	peak := report.TimeSeries[0]
+	for _, bucket := range report.TimeSeries {
+		if bucket.TotalCost > peak.TotalCost {
+			peak = bucket
+		}
+	}
+
+	for _, bucket := range report.TimeSeries {
+		bar := 0
+		if peak.TotalCost > 0 {
+			bar = int(bucket.TotalCost / peak.TotalCost * barWidth)
+		}
+		sb.WriteString(fmt.Sprintf("%s  %-*s %s\n",
+			bucket.Start.Format("2006-01-02 15:04"), barWidth, strings.Repeat("█", bar), ar.styleCost(bucket.TotalCost)))
+	}
+
+	sb.WriteString(fmt.Sprintf("\n%s %s - %s (%s)\n", ar.styleLabel("Peak:"),
+		peak.Start.Format("2006-01-02 15:04"), peak.End.Format("15:04"), ar.styleCost(peak.TotalCost)))
+
+	return sb.String()
+}
+
 // renderRecommendations renders optimization recommendations
 func (ar *ASCIIRenderer) renderRecommendations(report *models.CostReport) string {
 	var sb strings.Builder
@@ -289,7 +408,86 @@ func (ar *ASCIIRenderer) renderTreeNode(sb *strings.Builder, cg *models.CallGrap
 			newPrefix = prefix + "  │  "
 		}
 
-		sb.WriteString(fmt.Sprintf("%s (%s, weight: %.1f)\n", dep.ToEndpoint, dep.CallType, dep.Weight))
+		weight := fmt.Sprintf("weight: %.1f", dep.Weight)
+		if dep.Measured {
+			weight += " measured"
+		}
+		sb.WriteString(fmt.Sprintf("%s (%s, %s)\n", dep.ToEndpoint, dep.CallType, weight))
 		ar.renderTreeNode(sb, cg, dep.ToService, newPrefix, visited, depth+1, maxDepth)
 	}
 }
+
+// RenderReconciliation renders the comparison of modelled costs with a billing export
+func (ar *ASCIIRenderer) RenderReconciliation(rec *models.BillReconciliation) string {
+	var sb strings.Builder
+
+	sb.WriteString(ar.renderHeader("BILL RECONCILIATION"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString(ar.styleLabel("Billing Export:") + " " + rec.Format + " (tag: " + rec.Tag + ")\n")
+	sb.WriteString(ar.styleLabel("Time Range:") + " " + rec.TimeRange.Start.Format("2006-01-02 15:04") +
+		" to " + rec.TimeRange.End.Format("2006-01-02 15:04") + "\n")
+	sb.WriteString(ar.styleLabel("Modelled Cost:") + " " + ar.styleCost(rec.ModelledCost) + "\n")
+	sb.WriteString(ar.styleLabel("Billed Cost:") + " " + ar.styleCost(rec.BilledCost) + "\n")
+	sb.WriteString(ar.styleLabel("Variance:") + fmt.Sprintf(" %+.4f (%+.1f%%)\n", rec.Variance, rec.VariancePercent))
+	sb.WriteString(ar.styleLabel("Untagged:") + " " + ar.styleCost(rec.UntaggedCost) + "\n")
+	if rec.UnmodelledCost > 0 {
+		sb.WriteString(ar.styleLabel("Not Modelled:") + " " + ar.styleCost(rec.UnmodelledCost) + "\n")
+	}
+	sb.WriteString("\n")
+
+	sb.WriteString(ar.renderSubHeader("Service Variance") + "\n\n")
+	tableStr := &strings.Builder{}
+	table := tablewriter.NewWriter(tableStr)
+	table.SetHeader([]string{"Service", "Modelled", "Billed", "Variance", "Variance %", ""})
+	table.SetBorder(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, sv := range rec.Services {
+		flag, variancePercent := "", fmt.Sprintf("%+.1f%%", sv.VariancePercent)
+		if sv.BilledCost == 0 {
+			flag, variancePercent = "not in bill", "-"
+		} else if sv.OutOfTolerance {
+			flag = fmt.Sprintf("> %.0f%%", rec.Tolerance)
+		}
+		table.Append([]string{
+			sv.Service,
+			fmt.Sprintf("$%.4f", sv.ModelledCost),
+			fmt.Sprintf("$%.4f", sv.BilledCost),
+			fmt.Sprintf("%+.4f", sv.Variance),
+			variancePercent,
+			flag,
+		})
+	}
+	table.Render()
+	sb.WriteString(tableStr.String())
+
+	if len(rec.Unmodelled) > 0 {
+		names := make([]string, 0, len(rec.Unmodelled))
+		for name := range rec.Unmodelled {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString("\n" + ar.renderSubHeader("Billed But Not Modelled") + "\n\n")
+		for _, name := range names {
+			sb.WriteString(fmt.Sprintf("  %-30s %s\n", name, ar.styleCost(rec.Unmodelled[name])))
+		}
+	}
+
+	if cal := rec.Calibration; cal != nil {
+		sb.WriteString("\n" + ar.renderSubHeader("Calibrated Rates") + "\n\n")
+		sb.WriteString(fmt.Sprintf("Rates scaled by %.4f so the modelled cost of billed services matches the bill:\n\n", cal.Factor))
+		if cal.FixedCost > 0 {
+			sb.WriteString(fmt.Sprintf("Fixed-price and serverless compute of %s is left out, as it does not follow the rates.\n\n", ar.styleCost(cal.FixedCost)))
+		}
+		sb.WriteString("cost_model:\n")
+		sb.WriteString(fmt.Sprintf("  cpu_cost_per_core_hour: %g\n", cal.CostModel.CPUCostPerCoreHour))
+		sb.WriteString(fmt.Sprintf("  memory_cost_per_gb_hour: %g\n", cal.CostModel.MemoryCostPerGBHour))
+		sb.WriteString(fmt.Sprintf("  network_cost_per_gb: %g\n", cal.CostModel.NetworkCostPerGB))
+		sb.WriteString(fmt.Sprintf("  disk_cost_per_gb_hour: %g\n", cal.CostModel.DiskCostPerGBHour))
+		sb.WriteString(fmt.Sprintf("  request_cost: %g\n", cal.CostModel.RequestCost))
+	}
+
+	return sb.String()
+}
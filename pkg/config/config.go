@@ -10,23 +10,37 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Analysis   AnalysisConfig   `mapstructure:"analysis"`
-	Prometheus PrometheusConfig `mapstructure:"prometheus"`
-	CostModel  CostModelConfig  `mapstructure:"cost_model"`
-	AWS        AWSConfig        `mapstructure:"aws"`
-	Output     OutputConfig     `mapstructure:"output"`
-	Server     ServerConfig     `mapstructure:"server"`
-	Logging    LoggingConfig    `mapstructure:"logging"`
+	Analysis      AnalysisConfig      `mapstructure:"analysis"`
+	Prometheus    PrometheusConfig    `mapstructure:"prometheus"`
+	MetricsSource MetricsSourceConfig `mapstructure:"metrics_source"`
+	CostModel     CostModelConfig     `mapstructure:"cost_model"`
+	Reconcile     ReconcileConfig     `mapstructure:"reconcile"`
+	AWS           AWSConfig           `mapstructure:"aws"`
+	Output        OutputConfig        `mapstructure:"output"`
+	Server        ServerConfig        `mapstructure:"server"`
+	Logging       LoggingConfig       `mapstructure:"logging"`
 }
 
 // AnalysisConfig contains static analysis settings
 type AnalysisConfig struct {
-	Paths           []string `mapstructure:"paths"`
-	Excludes        []string `mapstructure:"excludes"`
-	IncludeTests    bool     `mapstructure:"include_tests"`
-	FollowImports   bool     `mapstructure:"follow_imports"`
-	MaxDepth        int      `mapstructure:"max_depth"`
-	ServicePatterns []string `mapstructure:"service_patterns"`
+	Paths           []string   `mapstructure:"paths"`
+	Excludes        []string   `mapstructure:"excludes"`
+	IncludeTests    bool       `mapstructure:"include_tests"`
+	FollowImports   bool       `mapstructure:"follow_imports"`
+	MaxDepth        int        `mapstructure:"max_depth"`
+	ServicePatterns []string   `mapstructure:"service_patterns"`
+	Source          string     `mapstructure:"source"` // code, mesh
+	Mesh            MeshConfig `mapstructure:"mesh"`
+}
+
+// MeshConfig builds the call graph from service mesh telemetry instead of code.
+// Every workload that sends or receives traffic becomes a service with a single
+// endpoint, and every pair of workloads that talk a dependency weighted by the
+// measured calls per request.
+type MeshConfig struct {
+	Type     string        `mapstructure:"type"`      // istio, linkerd
+	Window   time.Duration `mapstructure:"window"`    // traffic looked at, ending now
+	MinCalls float64       `mapstructure:"min_calls"` // edges with fewer calls in the window are left out
 }
 
 // PrometheusConfig contains Prometheus connection settings
@@ -36,17 +50,239 @@ type PrometheusConfig struct {
 	QueryInterval  time.Duration     `mapstructure:"query_interval"`
 	LookbackWindow time.Duration     `mapstructure:"lookback_window"`
 	CustomQueries  map[string]string `mapstructure:"custom_queries"`
+	MaxConcurrency int               `mapstructure:"max_concurrency"` // parallel PromQL queries
+	MaxRetries     int               `mapstructure:"max_retries"`     // retries per failed query
+	RetryBackoff   time.Duration     `mapstructure:"retry_backoff"`   // initial delay between retries
+
+	BasicAuth       BasicAuthConfig   `mapstructure:"basic_auth"`
+	BearerToken     string            `mapstructure:"bearer_token"`
+	BearerTokenFile string            `mapstructure:"bearer_token_file"`
+	TLS             TLSConfig         `mapstructure:"tls"`
+	TenantID        string            `mapstructure:"tenant_id"` // sent as X-Scope-OrgID (Thanos, Mimir, Cortex)
+	Headers         map[string]string `mapstructure:"headers"`
+	ProxyURL        string            `mapstructure:"proxy_url"`
+	RecordDir       string            `mapstructure:"record_dir"` // save every query and response as replay fixtures
+}
+
+// BasicAuthConfig contains HTTP basic authentication credentials
+type BasicAuthConfig struct {
+	Username     string `mapstructure:"username"`
+	Password     string `mapstructure:"password"`
+	PasswordFile string `mapstructure:"password_file"`
+}
+
+// TLSConfig contains TLS settings for outgoing connections
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"` // client certificate for mTLS
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// MetricsSourceConfig selects and configures the backend metrics are collected from
+type MetricsSourceConfig struct {
+	Type            string                  `mapstructure:"type"` // prometheus, federated, victoriametrics, file, otlp
+	Federated       []FederatedMemberConfig `mapstructure:"federated"`
+	VictoriaMetrics VictoriaMetricsConfig   `mapstructure:"victoriametrics"`
+	File            FileSourceConfig        `mapstructure:"file"`
+	OTLP            OTLPSourceConfig        `mapstructure:"otlp"`
+	Profiles        ProfilesConfig          `mapstructure:"profiles"`
+	Scope           ScopeConfig             `mapstructure:"scope"`
+	Resolution      time.Duration           `mapstructure:"resolution"`   // time series bucket size, 0 to disable
+	GRPCMetrics     string                  `mapstructure:"grpc_metrics"` // go-grpc-prometheus, otel
+	EdgeMetrics     string                  `mapstructure:"edge_metrics"` // none, http_client, istio, linkerd
+}
+
+// ScopeConfig restricts collection to namespaces and clusters, e.g. to keep
+// staging traffic out of production costs
+type ScopeConfig struct {
+	Namespaces []string `mapstructure:"namespaces"`
+	Clusters   []string `mapstructure:"clusters"`
+	SplitBy    string   `mapstructure:"split_by"` // namespace, cluster: collect each listed value as its own environment
+}
+
+// FederatedMemberConfig describes one Prometheus instance in a federated source.
+// Settings not given here are inherited from the prometheus section.
+type FederatedMemberConfig struct {
+	Name            string `mapstructure:"name"` // usually the cluster name
+	URL             string `mapstructure:"url"`
+	TenantID        string `mapstructure:"tenant_id"`
+	BearerTokenFile string `mapstructure:"bearer_token_file"`
+}
+
+// VictoriaMetricsConfig contains VictoriaMetrics connection settings.
+// Settings not given here are inherited from the prometheus section.
+type VictoriaMetricsConfig struct {
+	URL       string `mapstructure:"url"`
+	AccountID string `mapstructure:"account_id"` // cluster version tenant, e.g. "0" or "0:1"
+}
+
+// FileSourceConfig contains settings for reading offline metrics snapshots
+type FileSourceConfig struct {
+	Paths  []string `mapstructure:"paths"`  // files or directories
+	Format string   `mapstructure:"format"` // auto, text, csv
+}
+
+// OTLPSourceConfig contains settings for ingesting OpenTelemetry metrics, either
+// from OTLP export files or by receiving OTLP/HTTP for a time window
+type OTLPSourceConfig struct {
+	Paths  []string      `mapstructure:"paths"`  // OTLP protobuf or JSON export files or directories
+	Listen string        `mapstructure:"listen"` // OTLP/HTTP receiver address, e.g. localhost:4318
+	Window time.Duration `mapstructure:"window"` // how long the receiver collects metrics
+}
+
+// ProfilesConfig contains settings for reading pprof CPU profiles whose samples
+// carry an endpoint label, used to split service CPU across endpoints
+type ProfilesConfig struct {
+	Paths         []string `mapstructure:"paths"`          // profile files, or directories with one subdirectory per service
+	EndpointLabel string   `mapstructure:"endpoint_label"` // pprof label naming the endpoint
 }
 
 // CostModelConfig contains cost calculation settings
 type CostModelConfig struct {
-	Provider            string  `mapstructure:"provider"`
-	Region              string  `mapstructure:"region"`
-	CPUCostPerCoreHour  float64 `mapstructure:"cpu_cost_per_core_hour"`
-	MemoryCostPerGBHour float64 `mapstructure:"memory_cost_per_gb_hour"`
-	NetworkCostPerGB    float64 `mapstructure:"network_cost_per_gb"`
-	DiskCostPerGBHour   float64 `mapstructure:"disk_cost_per_gb_hour"`
-	RequestCost         float64 `mapstructure:"request_cost"`
+	Provider            string               `mapstructure:"provider"`
+	Region              string               `mapstructure:"region"`
+	CPUCostPerCoreHour  float64              `mapstructure:"cpu_cost_per_core_hour"`
+	MemoryCostPerGBHour float64              `mapstructure:"memory_cost_per_gb_hour"`
+	NetworkCostPerGB    float64              `mapstructure:"network_cost_per_gb"`
+	DiskCostPerGBHour   float64              `mapstructure:"disk_cost_per_gb_hour"`
+	RequestCost         float64              `mapstructure:"request_cost"`
+	BillingMode         string               `mapstructure:"billing_mode"` // usage, request, max
+	Attribution         string               `mapstructure:"attribution"`  // full, traffic_share
+	Allocation          AllocationConfig     `mapstructure:"allocation"`
+	SharedOverhead      SharedOverheadConfig `mapstructure:"shared_overhead"`
+	Pricing             PricingConfig        `mapstructure:"pricing"`
+	Discounts           DiscountsConfig      `mapstructure:"discounts"`
+	ComputeModels       ComputeModelsConfig  `mapstructure:"compute_models"`
+	Network             NetworkConfig        `mapstructure:"network"`
+}
+
+// NetworkConfig controls how data transfer is priced. The flat model charges
+// network_cost_per_gb on all bytes received and sent. The topology model charges
+// nothing for ingress, prices each dependency edge by the zones and regions of
+// caller and callee, charged to the calling endpoint, and prices the remaining
+// bytes sent as egress.
+type NetworkConfig struct {
+	Model                string                    `mapstructure:"model"` // flat, topology
+	IntraZoneCostPerGB   float64                   `mapstructure:"intra_zone_cost_per_gb"`
+	CrossZoneCostPerGB   float64                   `mapstructure:"cross_zone_cost_per_gb"`   // both directions, e.g. $0.01 out + $0.01 in on AWS
+	CrossRegionCostPerGB float64                   `mapstructure:"cross_region_cost_per_gb"` // inter-region transfer
+	EgressCostPerGB      float64                   `mapstructure:"egress_cost_per_gb"`       // traffic leaving the cloud; network_cost_per_gb when unset
+	Topology             map[string]TopologyConfig `mapstructure:"topology"`                 // service -> placement, instead of the zones of its pods in the metrics
+	Edges                map[string]EdgeConfig     `mapstructure:"edges"`                    // "caller->callee" -> bytes per call, instead of estimates from the callee's traffic
+}
+
+// TopologyConfig places a service in a region and zones, its pods spread evenly
+type TopologyConfig struct {
+	Region string   `mapstructure:"region"` // cost_model.region when unset
+	Zones  []string `mapstructure:"zones"`
+}
+
+// EdgeConfig is the data transferred by one call between two services
+type EdgeConfig struct {
+	RequestBytes  float64 `mapstructure:"request_bytes"`
+	ResponseBytes float64 `mapstructure:"response_bytes"`
+}
+
+// ComputeModelsConfig selects how the compute of services is priced. Services not
+// listed run in containers and pay for the CPU and memory they use or request.
+type ComputeModelsConfig struct {
+	Services map[string]ComputeModelConfig `mapstructure:"services"`  // service -> compute model
+	FreeTier FreeTierConfig                `mapstructure:"free_tier"` // monthly serverless free tier, shared by all serverless services
+}
+
+// ComputeModelConfig describes the compute model of a service. Serverless prices
+// default to the service's rates: memory_cost_per_gb_hour and cpu_cost_per_core_hour
+// per hour of billed duration and request_cost per invocation.
+type ComputeModelConfig struct {
+	Model string `mapstructure:"model"` // container, serverless, fixed_monthly
+
+	// serverless (Lambda, Cloud Run, Cloud Functions)
+	MemoryMB                float64 `mapstructure:"memory_mb"`                  // configured memory of an instance
+	CPUs                    float64 `mapstructure:"cpus"`                       // vCPUs billed separately per instance (Cloud Run, Cloud Functions gen2); 0 when included in memory
+	Concurrency             float64 `mapstructure:"concurrency"`                // requests an instance serves at once; 1 when unset
+	BillingGranularityMs    float64 `mapstructure:"billing_granularity_ms"`     // durations are rounded up to this; 1 ms when unset
+	GBSecondCost            float64 `mapstructure:"gb_second_cost"`             // price per GB-second of duration
+	VCPUSecondCost          float64 `mapstructure:"vcpu_second_cost"`           // price per vCPU-second of duration
+	InvocationCost          float64 `mapstructure:"invocation_cost"`            // price per invocation
+	ProvisionedConcurrency  float64 `mapstructure:"provisioned_concurrency"`    // instances kept initialized
+	ProvisionedGBSecondCost float64 `mapstructure:"provisioned_gb_second_cost"` // price per GB-second provisioned; gb_second_cost when unset
+	ProvisionedDurationCost float64 `mapstructure:"provisioned_duration_cost"`  // price per GB-second of duration on provisioned instances; gb_second_cost when unset
+
+	// fixed_monthly (reserved VMs, managed services, licenses)
+	MonthlyCost float64 `mapstructure:"monthly_cost"`
+}
+
+// FreeTierConfig is the monthly free usage of serverless compute, e.g. 1M requests
+// and 400,000 GB-seconds on Lambda
+type FreeTierConfig struct {
+	Requests    float64 `mapstructure:"requests"`
+	GBSeconds   float64 `mapstructure:"gb_seconds"`
+	VCPUSeconds float64 `mapstructure:"vcpu_seconds"`
+}
+
+// DiscountsConfig turns list prices into the prices actually paid. Spot and
+// commitment discounts apply to CPU, memory and shared overhead; the enterprise
+// discount applies to everything after them. Percentages are 0-100.
+type DiscountsConfig struct {
+	Enterprise   float64                   `mapstructure:"enterprise"`    // percent off all prices (EDP, negotiated discount)
+	SpotDiscount float64                   `mapstructure:"spot_discount"` // percent off list prices for spot capacity
+	Spot         map[string]float64        `mapstructure:"spot"`          // service -> percent of its compute on spot
+	NodePools    map[string]NodePoolConfig `mapstructure:"node_pools"`
+	Commitments  []CommitmentConfig        `mapstructure:"commitments"`
+}
+
+// NodePoolConfig describes the spot capacity of a node pool and the services on it
+type NodePoolConfig struct {
+	Spot     float64  `mapstructure:"spot"`     // percent of the pool's capacity on spot
+	Discount float64  `mapstructure:"discount"` // percent off for spot in this pool; spot_discount when 0
+	Services []string `mapstructure:"services"`
+}
+
+// CommitmentConfig is a reserved instance, savings plan or committed use discount
+// covering on-demand compute, as a percentage or as a fixed number of core-hours
+type CommitmentConfig struct {
+	Name      string   `mapstructure:"name"`
+	Coverage  float64  `mapstructure:"coverage"`   // percent of on-demand compute covered
+	CoreHours float64  `mapstructure:"core_hours"` // core-hours covered per hour, shared by the services
+	Discount  float64  `mapstructure:"discount"`   // percent off list prices for covered compute
+	Services  []string `mapstructure:"services"`   // services covered; all when empty
+}
+
+// Enabled reports whether any discount is configured
+func (d *DiscountsConfig) Enabled() bool {
+	return d.Enterprise > 0 || len(d.Spot) > 0 || len(d.NodePools) > 0 || len(d.Commitments) > 0
+}
+
+// PricingConfig derives CPU, memory and request rates from the price catalog of
+// the provider and region, for the compute services run on
+type PricingConfig struct {
+	CatalogDir string            `mapstructure:"catalog_dir"` // catalogs written by "microcost pricing update"; bundled catalogs otherwise
+	Compute    string            `mapstructure:"compute"`     // instance type or serverless offering (fargate, cloud_run, lambda) of all services
+	Services   map[string]string `mapstructure:"services"`    // service -> compute, overriding compute
+}
+
+// SharedOverheadConfig controls how cluster cost not used by any service (idle
+// capacity, DaemonSets, system namespaces, the control plane) is distributed
+type SharedOverheadConfig struct {
+	Source          string  `mapstructure:"source"`             // none, monthly, nodes
+	MonthlyCost     float64 `mapstructure:"monthly_cost"`       // total cluster cost per month (source: monthly)
+	NodeCostPerHour float64 `mapstructure:"node_cost_per_hour"` // instance price (source: nodes); node capacity is priced at the CPU and memory rates when unset
+	Distribution    string  `mapstructure:"distribution"`       // proportional, even
+}
+
+// AllocationConfig controls how service-level resource usage is split across endpoints
+type AllocationConfig struct {
+	Method        string                        `mapstructure:"method"`         // request_share, request_seconds, custom, profile
+	CustomWeights map[string]map[string]float64 `mapstructure:"custom_weights"` // service -> "path:method" -> weight
+}
+
+// ReconcileConfig contains settings for comparing modelled costs with a billing export
+type ReconcileConfig struct {
+	Tag       string            `mapstructure:"tag"`       // cost allocation tag or label naming the service
+	Services  map[string]string `mapstructure:"services"`  // tag value -> service, where they differ
+	Tolerance float64           `mapstructure:"tolerance"` // percent variance above which a service is flagged
 }
 
 // AWSConfig contains AWS-specific settings
@@ -93,6 +329,11 @@ func DefaultConfig() *Config {
 			FollowImports:   true,
 			MaxDepth:        10,
 			ServicePatterns: []string{"*service*", "*handler*", "*controller*"},
+			Source:          "code",
+			Mesh: MeshConfig{
+				Type:   "istio",
+				Window: 24 * time.Hour,
+			},
 		},
 		Prometheus: PrometheusConfig{
 			URL:            "http://localhost:9090",
@@ -100,6 +341,23 @@ func DefaultConfig() *Config {
 			QueryInterval:  1 * time.Minute,
 			LookbackWindow: 1 * time.Hour,
 			CustomQueries:  make(map[string]string),
+			MaxConcurrency: 4,
+			MaxRetries:     2,
+			RetryBackoff:   500 * time.Millisecond,
+		},
+		MetricsSource: MetricsSourceConfig{
+			Type:        "prometheus",
+			GRPCMetrics: "go-grpc-prometheus",
+			EdgeMetrics: "none",
+			File: FileSourceConfig{
+				Format: "auto",
+			},
+			OTLP: OTLPSourceConfig{
+				Window: 5 * time.Minute,
+			},
+			Profiles: ProfilesConfig{
+				EndpointLabel: "endpoint",
+			},
 		},
 		CostModel: CostModelConfig{
 			Provider:            "aws",
@@ -109,6 +367,26 @@ func DefaultConfig() *Config {
 			NetworkCostPerGB:    0.09,
 			DiskCostPerGBHour:   0.10,
 			RequestCost:         0.0000002,
+			BillingMode:         "usage",
+			Attribution:         "full",
+			Allocation: AllocationConfig{
+				Method:        "request_share",
+				CustomWeights: make(map[string]map[string]float64),
+			},
+			SharedOverhead: SharedOverheadConfig{
+				Source:       "none",
+				Distribution: "proportional",
+			},
+			Network: NetworkConfig{
+				Model:                "flat",
+				CrossZoneCostPerGB:   0.02,
+				CrossRegionCostPerGB: 0.02,
+			},
+		},
+		Reconcile: ReconcileConfig{
+			Tag:       "service",
+			Services:  make(map[string]string),
+			Tolerance: 10,
 		},
 		AWS: AWSConfig{
 			Region:          "us-east-1",
@@ -176,24 +454,173 @@ func Load(configPath string) (*Config, error) {
 	if awsSecret := os.Getenv("AWS_SECRET_ACCESS_KEY"); awsSecret != "" {
 		cfg.AWS.SecretAccessKey = awsSecret
 	}
+	// A token from the environment replaces any credentials of the config file
+	if token := os.Getenv("MICROCOST_PROMETHEUS_BEARER_TOKEN"); token != "" {
+		cfg.Prometheus.BearerToken = token
+		cfg.Prometheus.BearerTokenFile = ""
+		cfg.Prometheus.BasicAuth = BasicAuthConfig{}
+	} else if password := os.Getenv("MICROCOST_PROMETHEUS_PASSWORD"); password != "" {
+		cfg.Prometheus.BasicAuth.Password = password
+	}
 
 	return cfg, nil
 }
 
+// queriesPrometheus reports whether the metrics source queries a Prometheus API
+func (c *Config) queriesPrometheus() bool {
+	switch c.MetricsSource.Type {
+	case "", "prometheus", "federated", "victoriametrics":
+		return true
+	}
+	return false
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
-	if len(c.Analysis.Paths) == 0 {
-		return fmt.Errorf("analysis paths cannot be empty")
+	switch c.Analysis.Source {
+	case "", "code":
+		if len(c.Analysis.Paths) == 0 {
+			return fmt.Errorf("analysis paths cannot be empty")
+		}
+	case "mesh":
+		switch c.Analysis.Mesh.Type {
+		case "istio", "linkerd":
+		default:
+			return fmt.Errorf("unknown mesh type: %s", c.Analysis.Mesh.Type)
+		}
+		if c.Analysis.Mesh.Window <= 0 {
+			return fmt.Errorf("mesh window must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown analysis source: %s", c.Analysis.Source)
 	}
 
-	if c.Prometheus.URL == "" {
+	// The file and OTLP sources never contact Prometheus, unless mesh analysis does
+	if c.Prometheus.URL == "" && (c.queriesPrometheus() || c.Analysis.Source == "mesh") {
 		return fmt.Errorf("prometheus URL is required")
 	}
 
+	switch c.MetricsSource.Type {
+	case "", "prometheus", "victoriametrics":
+	case "federated":
+		if len(c.MetricsSource.Federated) == 0 {
+			return fmt.Errorf("federated metrics source requires at least one instance")
+		}
+	case "file":
+		if len(c.MetricsSource.File.Paths) == 0 {
+			return fmt.Errorf("file metrics source requires at least one path")
+		}
+	case "otlp":
+		if len(c.MetricsSource.OTLP.Paths) == 0 && c.MetricsSource.OTLP.Listen == "" {
+			return fmt.Errorf("otlp metrics source requires paths or a listen address")
+		}
+		if c.MetricsSource.OTLP.Listen != "" && c.MetricsSource.OTLP.Window <= 0 {
+			return fmt.Errorf("otlp receiver window must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown metrics source type: %s", c.MetricsSource.Type)
+	}
+
+	switch c.MetricsSource.Scope.SplitBy {
+	case "":
+	case "namespace":
+		if len(c.MetricsSource.Scope.Namespaces) == 0 {
+			return fmt.Errorf("splitting by namespace requires a list of namespaces")
+		}
+	case "cluster":
+		if len(c.MetricsSource.Scope.Clusters) == 0 {
+			return fmt.Errorf("splitting by cluster requires a list of clusters")
+		}
+	default:
+		return fmt.Errorf("unknown scope split_by: %s", c.MetricsSource.Scope.SplitBy)
+	}
+
+	switch c.MetricsSource.GRPCMetrics {
+	case "", "go-grpc-prometheus", "otel":
+	default:
+		return fmt.Errorf("unknown grpc_metrics convention: %s", c.MetricsSource.GRPCMetrics)
+	}
+
+	switch c.MetricsSource.EdgeMetrics {
+	case "", "none", "http_client", "istio", "linkerd":
+	default:
+		return fmt.Errorf("unknown edge_metrics convention: %s", c.MetricsSource.EdgeMetrics)
+	}
+
+	if c.MetricsSource.Resolution < 0 {
+		return fmt.Errorf("metrics source resolution cannot be negative")
+	}
+
+	if c.Prometheus.BasicAuth.Username != "" && (c.Prometheus.BearerToken != "" || c.Prometheus.BearerTokenFile != "") {
+		return fmt.Errorf("prometheus basic auth and bearer token are mutually exclusive")
+	}
+
+	if (c.Prometheus.TLS.CertFile == "") != (c.Prometheus.TLS.KeyFile == "") {
+		return fmt.Errorf("prometheus TLS cert_file and key_file must be set together")
+	}
+
+	switch c.CostModel.BillingMode {
+	case "", "usage", "request", "max":
+	default:
+		return fmt.Errorf("unknown billing mode: %s", c.CostModel.BillingMode)
+	}
+
+	switch c.CostModel.Attribution {
+	case "", "full", "traffic_share":
+	default:
+		return fmt.Errorf("unknown attribution mode: %s", c.CostModel.Attribution)
+	}
+
+	switch c.CostModel.SharedOverhead.Source {
+	case "", "none", "nodes":
+	case "monthly":
+		if c.CostModel.SharedOverhead.MonthlyCost <= 0 {
+			return fmt.Errorf("shared overhead monthly_cost must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown shared overhead source: %s", c.CostModel.SharedOverhead.Source)
+	}
+
+	switch c.CostModel.SharedOverhead.Distribution {
+	case "", "proportional", "even":
+	default:
+		return fmt.Errorf("unknown shared overhead distribution: %s", c.CostModel.SharedOverhead.Distribution)
+	}
+
 	if c.CostModel.Provider == "" {
 		return fmt.Errorf("cost model provider is required")
 	}
 
+	if err := c.CostModel.Discounts.validate(); err != nil {
+		return err
+	}
+
+	if err := c.CostModel.ComputeModels.validate(); err != nil {
+		return err
+	}
+
+	switch c.CostModel.Network.Model {
+	case "", "flat", "topology":
+	default:
+		return fmt.Errorf("unknown network model: %s", c.CostModel.Network.Model)
+	}
+	if c.CostModel.Network.IntraZoneCostPerGB < 0 || c.CostModel.Network.CrossZoneCostPerGB < 0 ||
+		c.CostModel.Network.CrossRegionCostPerGB < 0 || c.CostModel.Network.EgressCostPerGB < 0 {
+		return fmt.Errorf("network transfer prices must not be negative")
+	}
+
+	if c.CostModel.Pricing.Compute != "" || len(c.CostModel.Pricing.Services) > 0 {
+		switch c.CostModel.Provider {
+		case "aws", "gcp", "azure":
+		default:
+			return fmt.Errorf("pricing catalogs are only available for aws, gcp and azure, not %s", c.CostModel.Provider)
+		}
+	}
+
+	if c.Reconcile.Tolerance < 0 {
+		return fmt.Errorf("reconcile tolerance must not be negative")
+	}
+
 	if c.Output.TopN < 1 {
 		c.Output.TopN = 10
 	}
@@ -205,6 +632,79 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validate checks that percentages are within 0-100 and every commitment has a
+// single kind of coverage
+func (d *DiscountsConfig) validate() error {
+	percent := func(name string, v float64) error {
+		if v < 0 || v > 100 {
+			return fmt.Errorf("%s must be a percentage between 0 and 100, got %g", name, v)
+		}
+		return nil
+	}
+
+	if err := percent("enterprise discount", d.Enterprise); err != nil {
+		return err
+	}
+	if err := percent("spot discount", d.SpotDiscount); err != nil {
+		return err
+	}
+	for service, spot := range d.Spot {
+		if err := percent("spot share of "+service, spot); err != nil {
+			return err
+		}
+	}
+	for name, pool := range d.NodePools {
+		if err := percent("spot share of node pool "+name, pool.Spot); err != nil {
+			return err
+		}
+		if err := percent("spot discount of node pool "+name, pool.Discount); err != nil {
+			return err
+		}
+	}
+	for i, commitment := range d.Commitments {
+		name := commitment.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if (commitment.Coverage > 0) == (commitment.CoreHours > 0) {
+			return fmt.Errorf("commitment %s needs either coverage or core_hours", name)
+		}
+		if commitment.CoreHours < 0 {
+			return fmt.Errorf("commitment %s has negative core_hours", name)
+		}
+		if err := percent("coverage of commitment "+name, commitment.Coverage); err != nil {
+			return err
+		}
+		if err := percent("discount of commitment "+name, commitment.Discount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the compute model of every service
+func (m *ComputeModelsConfig) validate() error {
+	for service, cm := range m.Services {
+		switch cm.Model {
+		case "", "container":
+		case "serverless":
+			if cm.MemoryMB <= 0 {
+				return fmt.Errorf("serverless service %s needs memory_mb", service)
+			}
+			if cm.CPUs < 0 || cm.Concurrency < 0 || cm.BillingGranularityMs < 0 || cm.ProvisionedConcurrency < 0 {
+				return fmt.Errorf("serverless service %s has negative settings", service)
+			}
+		case "fixed_monthly":
+			if cm.MonthlyCost <= 0 {
+				return fmt.Errorf("fixed_monthly service %s needs a positive monthly_cost", service)
+			}
+		default:
+			return fmt.Errorf("unknown compute model of %s: %s", service, cm.Model)
+		}
+	}
+	return nil
+}
+
 // Save saves the configuration to a file
 func (c *Config) Save(path string) error {
 	v := viper.New()
@@ -213,13 +713,15 @@ func (c *Config) Save(path string) error {
 
 	// Marshal config to map
 	cfg := map[string]interface{}{
-		"analysis":   c.Analysis,
-		"prometheus": c.Prometheus,
-		"cost_model": c.CostModel,
-		"aws":        c.AWS,
-		"output":     c.Output,
-		"server":     c.Server,
-		"logging":    c.Logging,
+		"analysis":       c.Analysis,
+		"prometheus":     c.Prometheus,
+		"metrics_source": c.MetricsSource,
+		"cost_model":     c.CostModel,
+		"reconcile":      c.Reconcile,
+		"aws":            c.AWS,
+		"output":         c.Output,
+		"server":         c.Server,
+		"logging":        c.Logging,
 	}
 
 	for key, value := range cfg {
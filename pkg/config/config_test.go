@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -68,6 +69,22 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "mesh analysis without paths",
+			modify: func(c *Config) {
+				c.Analysis.Source = "mesh"
+				c.Analysis.Paths = []string{}
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown mesh type",
+			modify: func(c *Config) {
+				c.Analysis.Source = "mesh"
+				c.Analysis.Mesh.Type = "consul"
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty prometheus URL",
 			modify: func(c *Config) {
@@ -75,6 +92,25 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "file source without prometheus URL",
+			modify: func(c *Config) {
+				c.Prometheus.URL = ""
+				c.MetricsSource.Type = "file"
+				c.MetricsSource.File.Paths = []string{"metrics.prom"}
+			},
+			wantErr: false,
+		},
+		{
+			name: "mesh analysis without prometheus URL",
+			modify: func(c *Config) {
+				c.Prometheus.URL = ""
+				c.MetricsSource.Type = "file"
+				c.MetricsSource.File.Paths = []string{"metrics.prom"}
+				c.Analysis.Source = "mesh"
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty cost provider",
 			modify: func(c *Config) {
@@ -82,6 +118,101 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "basic auth with bearer token",
+			modify: func(c *Config) {
+				c.Prometheus.BasicAuth.Username = "admin"
+				c.Prometheus.BearerToken = "token"
+			},
+			wantErr: true,
+		},
+		{
+			name: "client cert without key",
+			modify: func(c *Config) {
+				c.Prometheus.TLS.CertFile = "client.pem"
+			},
+			wantErr: true,
+		},
+		{
+			name: "otlp source without paths or listen address",
+			modify: func(c *Config) {
+				c.MetricsSource.Type = "otlp"
+			},
+			wantErr: true,
+		},
+		{
+			name: "otlp receiver without window",
+			modify: func(c *Config) {
+				c.MetricsSource.Type = "otlp"
+				c.MetricsSource.OTLP.Listen = "localhost:4318"
+				c.MetricsSource.OTLP.Window = 0
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown attribution mode",
+			modify: func(c *Config) {
+				c.CostModel.Attribution = "split"
+			},
+			wantErr: true,
+		},
+		{
+			name: "pricing catalog for custom provider",
+			modify: func(c *Config) {
+				c.CostModel.Provider = "custom"
+				c.CostModel.Pricing.Compute = "m6i.large"
+			},
+			wantErr: true,
+		},
+		{
+			name: "commitment with coverage and core-hours",
+			modify: func(c *Config) {
+				c.CostModel.Discounts.Commitments = []CommitmentConfig{{Coverage: 50, CoreHours: 16, Discount: 30}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "spot share above 100 percent",
+			modify: func(c *Config) {
+				c.CostModel.Discounts.Spot = map[string]float64{"search": 150}
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative reconcile tolerance",
+			modify: func(c *Config) {
+				c.Reconcile.Tolerance = -5
+			},
+			wantErr: true,
+		},
+		{
+			name: "serverless service without memory",
+			modify: func(c *Config) {
+				c.CostModel.ComputeModels.Services = map[string]ComputeModelConfig{"thumbnailer": {Model: "serverless"}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown compute model",
+			modify: func(c *Config) {
+				c.CostModel.ComputeModels.Services = map[string]ComputeModelConfig{"thumbnailer": {Model: "vm"}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown network model",
+			modify: func(c *Config) {
+				c.CostModel.Network.Model = "mesh"
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown edge metrics convention",
+			modify: func(c *Config) {
+				c.MetricsSource.EdgeMetrics = "zipkin"
+			},
+			wantErr: true,
+		},
 		{
 			name: "negative TopN",
 			modify: func(c *Config) {
@@ -163,3 +294,34 @@ func TestEnvironmentVariableOverride(t *testing.T) {
 		t.Errorf("Expected AWS secret 'test-secret-456', got '%s'", cfg.AWS.SecretAccessKey)
 	}
 }
+
+func TestEnvironmentBearerTokenReplacesBasicAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `prometheus:
+  url: "http://prometheus:9090"
+  basic_auth:
+    username: "admin"
+    password: "secret"
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	os.Setenv("MICROCOST_PROMETHEUS_BEARER_TOKEN", "token-123")
+	defer os.Unsetenv("MICROCOST_PROMETHEUS_BEARER_TOKEN")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the environment token to replace basic auth, got %v", err)
+	}
+
+	if cfg.Prometheus.BearerToken != "token-123" {
+		t.Errorf("Expected bearer token 'token-123', got '%s'", cfg.Prometheus.BearerToken)
+	}
+	if cfg.Prometheus.BasicAuth.Username != "" || cfg.Prometheus.BasicAuth.Password != "" {
+		t.Errorf("Expected basic auth to be cleared, got %+v", cfg.Prometheus.BasicAuth)
+	}
+}
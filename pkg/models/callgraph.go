@@ -0,0 +1,238 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CallGraphVersion is the version of the call graph file format written by this
+// build. Files without a version predate versioning and are read as version 1.
+const CallGraphVersion = 1
+
+// LoadCallGraph reads a call graph from a JSON or YAML file, links back-references
+// and validates it
+func LoadCallGraph(path string) (*CallGraph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading call graph: %w", err)
+	}
+
+	cg, err := ParseCallGraph(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading call graph %s: %w", path, err)
+	}
+
+	return cg, nil
+}
+
+// ParseCallGraph decodes a call graph from JSON or YAML. The format is detected
+// from the content, so a YAML graph may be stored under any file name.
+func ParseCallGraph(data []byte) (*CallGraph, error) {
+	var cg CallGraph
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &cg); err != nil {
+			return nil, fmt.Errorf("error decoding JSON: %w", err)
+		}
+	} else if err := yaml.Unmarshal(data, &cg); err != nil {
+		return nil, fmt.Errorf("error decoding YAML: %w", err)
+	}
+
+	if cg.Version == 0 {
+		cg.Version = 1
+	}
+	if cg.Version > CallGraphVersion {
+		return nil, fmt.Errorf("unsupported call graph version %d (this build reads up to %d)", cg.Version, CallGraphVersion)
+	}
+
+	cg.Link()
+
+	if err := cg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cg, nil
+}
+
+// Link restores state that is not serialized: nil collections are initialized,
+// service names are filled in from their map keys and every endpoint points
+// back to its service
+func (cg *CallGraph) Link() {
+	if cg.Services == nil {
+		cg.Services = make(map[string]*Service)
+	}
+	if cg.Dependencies == nil {
+		cg.Dependencies = make([]*Dependency, 0)
+	}
+	if cg.Metadata == nil {
+		cg.Metadata = make(map[string]string)
+	}
+
+	for name, service := range cg.Services {
+		if service == nil {
+			continue
+		}
+		if service.Name == "" {
+			service.Name = name
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint != nil {
+				endpoint.Service = service
+			}
+		}
+	}
+}
+
+// Validate checks that the call graph is internally consistent. Dependencies may
+// point to services outside the graph (e.g. third-party APIs), but must originate
+// from a known service.
+func (cg *CallGraph) Validate() error {
+	for name, service := range cg.Services {
+		if service == nil {
+			return fmt.Errorf("service %s is empty", name)
+		}
+		if service.Name != name {
+			return fmt.Errorf("service %s is stored under key %s", service.Name, name)
+		}
+
+		for i, endpoint := range service.Endpoints {
+			if endpoint == nil || endpoint.Path == "" || endpoint.Method == "" {
+				return fmt.Errorf("service %s: endpoint %d must have a path and method", name, i)
+			}
+		}
+	}
+
+	for i, dep := range cg.Dependencies {
+		if dep == nil {
+			return fmt.Errorf("dependency %d is empty", i)
+		}
+		if dep.FromService == "" || dep.ToService == "" {
+			return fmt.Errorf("dependency %d must have a source and target service", i)
+		}
+		if _, exists := cg.Services[dep.FromService]; !exists {
+			return fmt.Errorf("dependency %d: unknown source service %s", i, dep.FromService)
+		}
+		if dep.Weight < 0 {
+			return fmt.Errorf("dependency %d: weight must not be negative", i)
+		}
+	}
+
+	return nil
+}
+
+// ApplyEdgeMetrics replaces the static weights of dependencies with the calls per
+// request measured between their services, and records the bytes per call. The
+// calls of an edge are spread over the dependencies it matches in proportion to
+// their static weight times the requests of the calling endpoint; weights are
+// left alone where the callers' requests are not known. A dependency matching
+// several edges, such as the GET and POST calls to one path, sums their calls and
+// bytes. It returns the measured edges that match no dependency.
+func (cg *CallGraph) ApplyEdgeMetrics(snapshot *MetricsSnapshot) []*EdgeMetrics {
+	hours := snapshot.TimeRange.Duration().Hours()
+	unmatched := make([]*EdgeMetrics, 0)
+
+	// measured sums the edges matching a dependency
+	type measured struct {
+		requests      float64 // of the calling endpoint
+		calls         float64 // share of the calls of the edges
+		known         bool    // whether any edge could be shared by requests
+		edgeCalls     float64
+		requestBytes  float64
+		responseBytes float64
+	}
+	byDep := make(map[*Dependency]*measured)
+
+	for _, em := range snapshot.Edges {
+		if em.Calls <= 0 {
+			continue
+		}
+
+		deps := make([]*Dependency, 0, 1)
+		for _, dep := range cg.Dependencies {
+			if dep.FromService == em.From && dep.ToService == em.To &&
+				(em.Endpoint == "" || dep.ToEndpoint == em.Endpoint) &&
+				(em.Method == "" || dep.ToMethod == "" || strings.EqualFold(dep.ToMethod, em.Method)) {
+				deps = append(deps, dep)
+			}
+		}
+		if len(deps) == 0 {
+			unmatched = append(unmatched, em)
+			continue
+		}
+
+		expected, total := 0.0, 0.0
+		for _, dep := range deps {
+			m, exists := byDep[dep]
+			if !exists {
+				m = &measured{requests: callerRequests(snapshot, dep, hours)}
+				byDep[dep] = m
+			}
+			expected += dep.Weight * m.requests
+			total += m.requests
+		}
+
+		for _, dep := range deps {
+			m := byDep[dep]
+			switch {
+			case expected > 0:
+				m.calls += em.Calls * dep.Weight * m.requests / expected
+				m.known = true
+			case total > 0:
+				m.calls += em.Calls * m.requests / total
+				m.known = true
+			}
+			m.edgeCalls += em.Calls
+			m.requestBytes += em.RequestBytes
+			m.responseBytes += em.ResponseBytes
+		}
+	}
+
+	for _, dep := range cg.Dependencies {
+		m, exists := byDep[dep]
+		if !exists {
+			continue
+		}
+		if m.known && m.requests > 0 {
+			dep.Weight = m.calls / m.requests
+			dep.Measured = true
+		}
+		dep.RequestBytes = m.requestBytes / m.edgeCalls
+		dep.ResponseBytes = m.responseBytes / m.edgeCalls
+	}
+
+	return unmatched
+}
+
+// callerRequests returns the requests served by the calling endpoint of a
+// dependency, or by the whole calling service when the endpoint is not known
+func callerRequests(snapshot *MetricsSnapshot, dep *Dependency, hours float64) float64 {
+	sm, exists := snapshot.Services[dep.FromService]
+	if !exists {
+		return 0
+	}
+
+	total, endpoint := 0.0, 0.0
+	found := false
+	for _, em := range sm.Endpoints {
+		if em.Performance == nil {
+			continue
+		}
+		requests := em.Performance.TotalRequests(hours)
+		total += requests
+		if dep.FromEndpoint != "" && em.Endpoint == dep.FromEndpoint &&
+			(dep.FromMethod == "" || strings.EqualFold(em.Method, dep.FromMethod)) {
+			endpoint += requests
+			found = true
+		}
+	}
+
+	if found {
+		return endpoint
+	}
+	return total
+}
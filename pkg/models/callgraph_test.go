@@ -0,0 +1,182 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func newTestCallGraph() *CallGraph {
+	cg := NewCallGraph()
+
+	service := &Service{Name: "orders"}
+	service.AddEndpoint(&Endpoint{Path: "/orders", Method: "POST"})
+	cg.AddService(service)
+
+	cg.AddDependency(&Dependency{
+		ID:          "dep1",
+		FromService: "orders",
+		ToService:   "payments",
+		ToEndpoint:  "/charge",
+		CallType:    "http",
+		Weight:      1.0,
+	})
+
+	return cg
+}
+
+func TestParseCallGraphRestoresBackReferences(t *testing.T) {
+	encoders := map[string]func(interface{}) ([]byte, error){
+		"json": func(v interface{}) ([]byte, error) { return json.MarshalIndent(v, "", "  ") },
+		"yaml": yaml.Marshal,
+	}
+
+	for format, encode := range encoders {
+		data, err := encode(newTestCallGraph())
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %v", format, err)
+		}
+
+		cg, err := ParseCallGraph(data)
+		if err != nil {
+			t.Fatalf("%s: ParseCallGraph failed: %v", format, err)
+		}
+
+		service, exists := cg.GetService("orders")
+		if !exists {
+			t.Fatalf("%s: service not found after decoding", format)
+		}
+
+		endpoint, exists := service.GetEndpoint("/orders", "POST")
+		if !exists {
+			t.Fatalf("%s: endpoint not found after decoding", format)
+		}
+
+		if endpoint.Service != service {
+			t.Errorf("%s: endpoint back-reference not restored", format)
+		}
+
+		if cg.Version != CallGraphVersion {
+			t.Errorf("%s: expected version %d, got %d", format, CallGraphVersion, cg.Version)
+		}
+	}
+}
+
+func TestParseCallGraphUnversioned(t *testing.T) {
+	cg, err := ParseCallGraph([]byte(`{"services": {"orders": {"endpoints": [{"path": "/orders", "method": "GET"}]}}}`))
+	if err != nil {
+		t.Fatalf("ParseCallGraph failed: %v", err)
+	}
+
+	if cg.Version != 1 {
+		t.Errorf("Expected unversioned graph to be read as version 1, got %d", cg.Version)
+	}
+
+	if cg.Services["orders"].Name != "orders" {
+		t.Errorf("Expected service name to be filled in from key, got '%s'", cg.Services["orders"].Name)
+	}
+}
+
+func TestParseCallGraphInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		error string
+	}{
+		{"future version", `{"version": 99}`, "unsupported call graph version"},
+		{"malformed", `{"services": [`, "error decoding JSON"},
+		{"key mismatch", `{"services": {"a": {"name": "b"}}}`, "stored under key"},
+		{"endpoint without method", `{"services": {"a": {"endpoints": [{"path": "/x"}]}}}`, "must have a path and method"},
+		{"unknown source", `{"dependencies": [{"from_service": "a", "to_service": "b"}]}`, "unknown source service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCallGraph([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("Expected error containing '%s', got %v", tt.error, err)
+			}
+		})
+	}
+}
+
+func TestApplyEdgeMetrics(t *testing.T) {
+	cg := newTestCallGraph()
+	refund := &Dependency{FromService: "orders", FromEndpoint: "/refunds", ToService: "payments", ToEndpoint: "/refund", Weight: 1}
+	cg.AddDependency(refund)
+	cg.Services["orders"].AddEndpoint(&Endpoint{Path: "/refunds", Method: "POST"})
+
+	snapshot := NewMetricsSnapshot(time.Unix(0, 0), time.Unix(3600, 0))
+	snapshot.AddServiceMetrics(&ServiceMetrics{
+		ServiceName: "orders",
+		Endpoints: map[string]*EndpointMetrics{
+			"/orders:POST":  {Endpoint: "/orders", Method: "POST", Performance: &PerformanceMetrics{RequestCount: 300}},
+			"/refunds:POST": {Endpoint: "/refunds", Method: "POST", Performance: &PerformanceMetrics{RequestCount: 100}},
+		},
+	})
+
+	// Charges and refunds are measured together since the metrics carry no endpoint
+	*snapshot.Edge("orders", "payments", "", "") = EdgeMetrics{
+		From: "orders", To: "payments", Calls: 800, RequestBytes: 80000, ResponseBytes: 400000,
+	}
+	snapshot.Edge("orders", "search", "", "").Calls = 50
+
+	unmatched := cg.ApplyEdgeMetrics(snapshot)
+
+	if len(unmatched) != 1 || unmatched[0].To != "search" {
+		t.Errorf("Expected the edge to search unmatched, got %v", unmatched)
+	}
+
+	// 400 requests of the whole service and 100 of /refunds, scaled to 800 calls
+	charge := cg.Dependencies[0]
+	if charge.Weight != 1.6 || refund.Weight != 1.6 {
+		t.Errorf("Expected weights 1.6, got %f and %f", charge.Weight, refund.Weight)
+	}
+	if !charge.Measured || charge.RequestBytes != 100 || charge.ResponseBytes != 500 {
+		t.Errorf("Expected measured 100 and 500 bytes per call, got %+v", charge)
+	}
+
+	// Applying the same metrics again leaves the weights as they are
+	cg.ApplyEdgeMetrics(snapshot)
+	if charge.Weight != 1.6 {
+		t.Errorf("Expected weight 1.6 after applying twice, got %f", charge.Weight)
+	}
+}
+
+func TestApplyEdgeMetricsSumsEdgesOfDependency(t *testing.T) {
+	cg := NewCallGraph()
+	items := &Dependency{FromService: "frontend", ToService: "cart", ToEndpoint: "/items", Weight: 1}
+	cg.AddDependency(items)
+
+	snapshot := NewMetricsSnapshot(time.Unix(0, 0), time.Unix(3600, 0))
+	snapshot.AddServiceMetrics(&ServiceMetrics{
+		ServiceName: "frontend",
+		Endpoints: map[string]*EndpointMetrics{
+			"/:GET": {Endpoint: "/", Method: "GET", Performance: &PerformanceMetrics{RequestCount: 100}},
+		},
+	})
+
+	// The dependency has no method, so it matches both the GET and POST calls
+	*snapshot.Edge("frontend", "cart", "/items", "GET") = EdgeMetrics{
+		From: "frontend", To: "cart", Endpoint: "/items", Method: "GET", Calls: 100, RequestBytes: 1000, ResponseBytes: 10000,
+	}
+	*snapshot.Edge("frontend", "cart", "/items", "POST") = EdgeMetrics{
+		From: "frontend", To: "cart", Endpoint: "/items", Method: "POST", Calls: 50, RequestBytes: 2000, ResponseBytes: 20000,
+	}
+
+	if unmatched := cg.ApplyEdgeMetrics(snapshot); len(unmatched) != 0 {
+		t.Errorf("Expected all edges matched, got %v", unmatched)
+	}
+
+	// 150 calls for 100 requests, and the bytes of both edges per call
+	if math.Abs(items.Weight-1.5) > 1e-9 || !items.Measured {
+		t.Errorf("Expected measured weight 1.5, got %f (measured %v)", items.Weight, items.Measured)
+	}
+	if math.Abs(items.RequestBytes-20) > 1e-9 || math.Abs(items.ResponseBytes-200) > 1e-9 {
+		t.Errorf("Expected 20 and 200 bytes per call, got %f and %f", items.RequestBytes, items.ResponseBytes)
+	}
+}
@@ -2,6 +2,59 @@ package models
 
 import "time"
 
+// AllocationMethod describes how service-level resource usage is split across endpoints
+type AllocationMethod string
+
+const (
+	// AllocationRequestShare splits resources by each endpoint's share of requests
+	AllocationRequestShare AllocationMethod = "request_share"
+	// AllocationRequestSeconds splits resources by requests weighted by average latency
+	AllocationRequestSeconds AllocationMethod = "request_seconds"
+	// AllocationCustom splits resources by configured per-endpoint weights
+	AllocationCustom AllocationMethod = "custom"
+	// AllocationProfile splits CPU by the CPU time profiles sampled per endpoint
+	// and other resources by share of requests
+	AllocationProfile AllocationMethod = "profile"
+)
+
+// AttributionMode describes how the cost of a downstream endpoint is attributed to its callers
+type AttributionMode string
+
+const (
+	// AttributionFull adds the full direct cost of a downstream endpoint, times the
+	// calls per request, to every caller
+	AttributionFull AttributionMode = "full"
+	// AttributionTrafficShare splits the cost of a downstream endpoint among its
+	// callers by the share of its traffic each generates; the rest stays unattributed
+	AttributionTrafficShare AttributionMode = "traffic_share"
+)
+
+// BillingMode describes which resource quantity a service is charged for
+type BillingMode string
+
+const (
+	// BillingUsage charges for measured CPU and memory usage
+	BillingUsage BillingMode = "usage"
+	// BillingRequest charges for requested CPU and memory
+	BillingRequest BillingMode = "request"
+	// BillingMaxRequestUsage charges each pod for the larger of its requests and usage,
+	// which matches what the pod occupies on a node
+	BillingMaxRequestUsage BillingMode = "max"
+)
+
+// ComputeModel describes how the compute of a service is priced
+type ComputeModel string
+
+const (
+	// ComputeContainer prices the CPU and memory a service uses or requests per hour
+	ComputeContainer ComputeModel = "container"
+	// ComputeServerless prices invocations and their duration at the configured
+	// memory size (Lambda, Cloud Run, Cloud Functions)
+	ComputeServerless ComputeModel = "serverless"
+	// ComputeFixedMonthly prices a service at a fixed monthly cost, whatever its usage
+	ComputeFixedMonthly ComputeModel = "fixed_monthly"
+)
+
 // CostModel represents pricing for different resource types
 type CostModel struct {
 	CPUCostPerCoreHour  float64 `json:"cpu_cost_per_core_hour" yaml:"cpu_cost_per_core_hour"`
@@ -11,6 +64,7 @@ type CostModel struct {
 	RequestCost         float64 `json:"request_cost" yaml:"request_cost"`
 	Provider            string  `json:"provider" yaml:"provider"`
 	Region              string  `json:"region" yaml:"region"`
+	Compute             string  `json:"compute,omitempty" yaml:"compute,omitempty"` // instance type or serverless offering the rates come from
 }
 
 // EndpointCost represents the cost breakdown for a single endpoint
@@ -23,16 +77,23 @@ type EndpointCost struct {
 	TotalCost       float64          `json:"total_cost" yaml:"total_cost"`
 	CostPerRequest  float64          `json:"cost_per_request" yaml:"cost_per_request"`
 	RequestCount    float64          `json:"request_count" yaml:"request_count"`
+	AllocationShare float64          `json:"allocation_share" yaml:"allocation_share"` // fraction of service resources
 	CostBreakdown   *CostBreakdown   `json:"cost_breakdown" yaml:"cost_breakdown"`
+
+	// UnattributedCost is the part of the total cost of a called endpoint not
+	// attributed to any calling endpoint, e.g. for external traffic (traffic_share only)
+	UnattributedCost float64 `json:"unattributed_cost,omitempty" yaml:"unattributed_cost,omitempty"`
 }
 
 // DownstreamCost represents cost attributed from a downstream service
 type DownstreamCost struct {
 	Service         string  `json:"service" yaml:"service"`
 	Endpoint        string  `json:"endpoint" yaml:"endpoint"`
+	Method          string  `json:"method,omitempty" yaml:"method,omitempty"`
 	Cost            float64 `json:"cost" yaml:"cost"`
 	CallsPerRequest float64 `json:"calls_per_request" yaml:"calls_per_request"`
-	Depth           int     `json:"depth" yaml:"depth"` // depth in call chain
+	Depth           int     `json:"depth" yaml:"depth"`                     // depth in call chain
+	Share           float64 `json:"share,omitempty" yaml:"share,omitempty"` // fraction of the endpoint's direct cost attributed (traffic_share only)
 }
 
 // CostBreakdown represents detailed cost attribution
@@ -42,29 +103,69 @@ type CostBreakdown struct {
 	NetworkCost     float64            `json:"network_cost" yaml:"network_cost"`
 	DiskCost        float64            `json:"disk_cost" yaml:"disk_cost"`
 	RequestCost     float64            `json:"request_cost" yaml:"request_cost"`
+	SharedOverhead  float64            `json:"shared_overhead,omitempty" yaml:"shared_overhead,omitempty"` // share of unallocated cluster cost
+	FixedCost       float64            `json:"fixed_cost,omitempty" yaml:"fixed_cost,omitempty"`           // share of a fixed monthly cost
 	DownstreamTotal float64            `json:"downstream_total" yaml:"downstream_total"`
 	Total           float64            `json:"total" yaml:"total"`
 	Details         map[string]float64 `json:"details,omitempty" yaml:"details,omitempty"`
+
+	// ListCost and EffectiveCost are the direct cost at list prices and after
+	// discounts; the components above are effective. Set when discounts are configured.
+	ListCost      float64 `json:"list_cost,omitempty" yaml:"list_cost,omitempty"`
+	EffectiveCost float64 `json:"effective_cost,omitempty" yaml:"effective_cost,omitempty"`
 }
 
 // ServiceCost aggregates costs for all endpoints in a service
 type ServiceCost struct {
-	ServiceName    string                   `json:"service_name" yaml:"service_name"`
-	Endpoints      map[string]*EndpointCost `json:"endpoints" yaml:"endpoints"`
-	TotalCost      float64                  `json:"total_cost" yaml:"total_cost"`
-	DirectCost     float64                  `json:"direct_cost" yaml:"direct_cost"`
-	AttributedCost float64                  `json:"attributed_cost" yaml:"attributed_cost"`
+	ServiceName      string                   `json:"service_name" yaml:"service_name"`
+	Endpoints        map[string]*EndpointCost `json:"endpoints" yaml:"endpoints"`
+	TotalCost        float64                  `json:"total_cost" yaml:"total_cost"`
+	DirectCost       float64                  `json:"direct_cost" yaml:"direct_cost"`
+	AttributedCost   float64                  `json:"attributed_cost" yaml:"attributed_cost"`
+	UnattributedCost float64                  `json:"unattributed_cost,omitempty" yaml:"unattributed_cost,omitempty"` // sum of endpoint unattributed costs
+	IdleCost         float64                  `json:"idle_cost,omitempty" yaml:"idle_cost,omitempty"`                 // requested but unused CPU and memory
+	SharedOverhead   float64                  `json:"shared_overhead,omitempty" yaml:"shared_overhead,omitempty"`     // included in direct cost
+	CostModel        *CostModel               `json:"cost_model,omitempty" yaml:"cost_model,omitempty"`               // rates of a service on its own compute
+	ListCost         float64                  `json:"list_cost,omitempty" yaml:"list_cost,omitempty"`                 // direct cost at list prices
+	ComputeModel     ComputeModel             `json:"compute_model,omitempty" yaml:"compute_model,omitempty"`         // set when not container
 }
 
 // CostReport represents the complete cost analysis
 type CostReport struct {
-	Services        map[string]*ServiceCost `json:"services" yaml:"services"`
-	TotalCost       float64                 `json:"total_cost" yaml:"total_cost"`
-	GeneratedAt     time.Time               `json:"generated_at" yaml:"generated_at"`
-	TimeRange       TimeRange               `json:"time_range" yaml:"time_range"`
-	CostModel       *CostModel              `json:"cost_model" yaml:"cost_model"`
-	TopCostly       []*EndpointCost         `json:"top_costly,omitempty" yaml:"top_costly,omitempty"`
-	Recommendations []string                `json:"recommendations,omitempty" yaml:"recommendations,omitempty"`
+	Services         map[string]*ServiceCost     `json:"services" yaml:"services"`
+	TotalCost        float64                     `json:"total_cost" yaml:"total_cost"`
+	GeneratedAt      time.Time                   `json:"generated_at" yaml:"generated_at"`
+	TimeRange        TimeRange                   `json:"time_range" yaml:"time_range"`
+	CostModel        *CostModel                  `json:"cost_model" yaml:"cost_model"`
+	AllocationMethod AllocationMethod            `json:"allocation_method" yaml:"allocation_method"`
+	BillingMode      BillingMode                 `json:"billing_mode" yaml:"billing_mode"`
+	AttributionMode  AttributionMode             `json:"attribution_mode,omitempty" yaml:"attribution_mode,omitempty"`
+	UnattributedCost float64                     `json:"unattributed_cost,omitempty" yaml:"unattributed_cost,omitempty"` // downstream cost no caller accounts for
+	ListCost         float64                     `json:"list_cost,omitempty" yaml:"list_cost,omitempty"`                 // direct cost at list prices, when discounts are configured
+	ClusterCost      float64                     `json:"cluster_cost,omitempty" yaml:"cluster_cost,omitempty"`
+	SharedOverhead   float64                     `json:"shared_overhead,omitempty" yaml:"shared_overhead,omitempty"` // cluster cost not used by any service
+	Dimensions       map[string]string           `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	Environments     map[string]*EnvironmentCost `json:"environments,omitempty" yaml:"environments,omitempty"`
+	TimeSeries       []*CostBucket               `json:"time_series,omitempty" yaml:"time_series,omitempty"`
+	TopCostly        []*EndpointCost             `json:"top_costly,omitempty" yaml:"top_costly,omitempty"`
+	Recommendations  []string                    `json:"recommendations,omitempty" yaml:"recommendations,omitempty"`
+}
+
+// CostBucket is the direct cost incurred during one time bucket. Each service's
+// direct cost is spread over the buckets following its resource usage and traffic.
+type CostBucket struct {
+	Start     time.Time          `json:"start" yaml:"start"`
+	End       time.Time          `json:"end" yaml:"end"`
+	TotalCost float64            `json:"total_cost" yaml:"total_cost"`
+	Services  map[string]float64 `json:"services" yaml:"services"`
+}
+
+// EnvironmentCost summarizes the cost of one namespace or cluster. Shared
+// overhead is not included in the breakdown.
+type EnvironmentCost struct {
+	Dimensions map[string]string  `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	TotalCost  float64            `json:"total_cost" yaml:"total_cost"`
+	Services   map[string]float64 `json:"services" yaml:"services"` // service -> total cost
 }
 
 // NewCostReport creates a new cost report
@@ -88,11 +189,17 @@ func (cr *CostReport) AddServiceCost(sc *ServiceCost) {
 	cr.TotalCost += sc.TotalCost
 }
 
-// CalculateTotalCost recalculates the total cost
+// CalculateTotalCost recalculates the total cost. With traffic-share attribution
+// the cost of a called service is already part of its callers' totals, so the
+// total is the sum of direct costs: entry endpoints plus the unattributed remainder.
 func (cr *CostReport) CalculateTotalCost() {
 	total := 0.0
 	for _, sc := range cr.Services {
-		total += sc.TotalCost
+		if cr.AttributionMode == AttributionTrafficShare {
+			total += sc.DirectCost
+		} else {
+			total += sc.TotalCost
+		}
 	}
 	cr.TotalCost = total
 }
@@ -104,14 +211,24 @@ func NewCostBreakdown(metrics *ResourceMetrics, perfMetrics *PerformanceMetrics,
 	}
 
 	if metrics != nil && model != nil {
-		cb.CPUCost = metrics.CPUCores * model.CPUCostPerCoreHour * durationHours
-		cb.MemoryCost = (metrics.MemoryMB / 1024.0) * model.MemoryCostPerGBHour * durationHours
+		// Prefer exact totals over averages extrapolated across the duration
+		cpuCoreHours := metrics.CPUCores * durationHours
+		if metrics.CPUCoreHours > 0 {
+			cpuCoreHours = metrics.CPUCoreHours
+		}
+		memoryGBHours := (metrics.MemoryMB / 1024.0) * durationHours
+		if metrics.MemoryGBHours > 0 {
+			memoryGBHours = metrics.MemoryGBHours
+		}
+
+		cb.CPUCost = cpuCoreHours * model.CPUCostPerCoreHour
+		cb.MemoryCost = memoryGBHours * model.MemoryCostPerGBHour
 		cb.NetworkCost = ((metrics.NetworkInMB + metrics.NetworkOutMB) / 1024.0) * model.NetworkCostPerGB
 		cb.DiskCost = ((metrics.DiskReadMB + metrics.DiskWriteMB) / 1024.0) * model.DiskCostPerGBHour * durationHours
 	}
 
 	if perfMetrics != nil && model != nil {
-		cb.RequestCost = perfMetrics.RequestRate * model.RequestCost * durationHours * 3600
+		cb.RequestCost = perfMetrics.TotalRequests(durationHours) * model.RequestCost
 	}
 
 	cb.Total = cb.CPUCost + cb.MemoryCost + cb.NetworkCost + cb.DiskCost + cb.RequestCost
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -78,6 +79,16 @@ func TestCalculateTotalCost(t *testing.T) {
 	if report.TotalCost != expectedTotal {
 		t.Errorf("Expected total cost %f, got %f", expectedTotal, report.TotalCost)
 	}
+
+	// With traffic-share attribution only direct costs add up
+	for i, sc := range services {
+		sc.DirectCost = float64(i + 1)
+	}
+	report.AttributionMode = AttributionTrafficShare
+	report.CalculateTotalCost()
+	if report.TotalCost != 6 {
+		t.Errorf("Expected traffic-share total cost 6, got %f", report.TotalCost)
+	}
 }
 
 func TestNewCostBreakdown(t *testing.T) {
@@ -183,3 +194,40 @@ func TestDownstreamCost(t *testing.T) {
 		t.Errorf("Expected depth 2, got %d", dc.Depth)
 	}
 }
+
+func TestNewCostBreakdownPrefersTotals(t *testing.T) {
+	metrics := &ResourceMetrics{
+		CPUCores:      2.0,
+		CPUCoreHours:  1.5, // measured total differs from the extrapolated average
+		MemoryMB:      2048.0,
+		MemoryGBHours: 3.0,
+	}
+
+	perfMetrics := &PerformanceMetrics{
+		RequestRate:  100.0,
+		RequestCount: 1000.0,
+	}
+
+	model := &CostModel{
+		CPUCostPerCoreHour:  0.05,
+		MemoryCostPerGBHour: 0.01,
+		RequestCost:         0.001,
+	}
+
+	breakdown := NewCostBreakdown(metrics, perfMetrics, model, 1.0)
+
+	// CPU cost: 1.5 core-hours * 0.05 = 0.075
+	if math.Abs(breakdown.CPUCost-0.075) > 1e-9 {
+		t.Errorf("Expected CPU cost 0.075, got %f", breakdown.CPUCost)
+	}
+
+	// Memory cost: 3 GB-hours * 0.01 = 0.03
+	if math.Abs(breakdown.MemoryCost-0.03) > 1e-9 {
+		t.Errorf("Expected memory cost 0.03, got %f", breakdown.MemoryCost)
+	}
+
+	// Request cost: 1000 requests * 0.001 = 1.0
+	if math.Abs(breakdown.RequestCost-1.0) > 1e-9 {
+		t.Errorf("Expected request cost 1.0, got %f", breakdown.RequestCost)
+	}
+}
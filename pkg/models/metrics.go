@@ -1,27 +1,54 @@
 package models
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
-// ResourceMetrics represents resource consumption data
+// ResourceMetrics represents resource consumption data. CPU and memory are
+// time-weighted averages over the time range; the *Hours fields carry the exact
+// totals when the source provides them. Network and disk are totals transferred.
+// Requests, limits and replicas describe what the service reserves, as reported
+// by kube-state-metrics.
 type ResourceMetrics struct {
-	CPUCores     float64   `json:"cpu_cores" yaml:"cpu_cores"`
-	MemoryMB     float64   `json:"memory_mb" yaml:"memory_mb"`
-	NetworkInMB  float64   `json:"network_in_mb" yaml:"network_in_mb"`
-	NetworkOutMB float64   `json:"network_out_mb" yaml:"network_out_mb"`
-	DiskReadMB   float64   `json:"disk_read_mb" yaml:"disk_read_mb"`
-	DiskWriteMB  float64   `json:"disk_write_mb" yaml:"disk_write_mb"`
-	Timestamp    time.Time `json:"timestamp" yaml:"timestamp"`
+	CPUCores             float64   `json:"cpu_cores" yaml:"cpu_cores"`
+	CPUCoreHours         float64   `json:"cpu_core_hours,omitempty" yaml:"cpu_core_hours,omitempty"`
+	MemoryMB             float64   `json:"memory_mb" yaml:"memory_mb"`
+	MemoryGBHours        float64   `json:"memory_gb_hours,omitempty" yaml:"memory_gb_hours,omitempty"`
+	NetworkInMB          float64   `json:"network_in_mb" yaml:"network_in_mb"`
+	NetworkOutMB         float64   `json:"network_out_mb" yaml:"network_out_mb"`
+	DiskReadMB           float64   `json:"disk_read_mb" yaml:"disk_read_mb"`
+	DiskWriteMB          float64   `json:"disk_write_mb" yaml:"disk_write_mb"`
+	CPURequestCores      float64   `json:"cpu_request_cores,omitempty" yaml:"cpu_request_cores,omitempty"`
+	CPURequestCoreHours  float64   `json:"cpu_request_core_hours,omitempty" yaml:"cpu_request_core_hours,omitempty"`
+	CPULimitCores        float64   `json:"cpu_limit_cores,omitempty" yaml:"cpu_limit_cores,omitempty"`
+	MemoryRequestMB      float64   `json:"memory_request_mb,omitempty" yaml:"memory_request_mb,omitempty"`
+	MemoryRequestGBHours float64   `json:"memory_request_gb_hours,omitempty" yaml:"memory_request_gb_hours,omitempty"`
+	MemoryLimitMB        float64   `json:"memory_limit_mb,omitempty" yaml:"memory_limit_mb,omitempty"`
+	Replicas             float64   `json:"replicas,omitempty" yaml:"replicas,omitempty"` // average running pods
+	Timestamp            time.Time `json:"timestamp" yaml:"timestamp"`
 }
 
 // PerformanceMetrics represents performance-related metrics
 type PerformanceMetrics struct {
-	RequestRate float64       `json:"request_rate" yaml:"request_rate"` // req/sec
-	ErrorRate   float64       `json:"error_rate" yaml:"error_rate"`     // errors/sec
-	LatencyAvg  time.Duration `json:"latency_avg" yaml:"latency_avg"`
-	LatencyP50  time.Duration `json:"latency_p50" yaml:"latency_p50"`
-	LatencyP95  time.Duration `json:"latency_p95" yaml:"latency_p95"`
-	LatencyP99  time.Duration `json:"latency_p99" yaml:"latency_p99"`
-	Timestamp   time.Time     `json:"timestamp" yaml:"timestamp"`
+	RequestRate  float64       `json:"request_rate" yaml:"request_rate"`                       // req/sec
+	RequestCount float64       `json:"request_count,omitempty" yaml:"request_count,omitempty"` // total requests in the time range
+	ErrorRate    float64       `json:"error_rate" yaml:"error_rate"`                           // errors/sec
+	ErrorCount   float64       `json:"error_count,omitempty" yaml:"error_count,omitempty"`     // total errors in the time range
+	LatencyAvg   time.Duration `json:"latency_avg" yaml:"latency_avg"`
+	LatencyP50   time.Duration `json:"latency_p50" yaml:"latency_p50"`
+	LatencyP95   time.Duration `json:"latency_p95" yaml:"latency_p95"`
+	LatencyP99   time.Duration `json:"latency_p99" yaml:"latency_p99"`
+	Timestamp    time.Time     `json:"timestamp" yaml:"timestamp"`
+}
+
+// TotalRequests returns the number of requests served over durationHours,
+// using the measured total when available
+func (pm *PerformanceMetrics) TotalRequests(durationHours float64) float64 {
+	if pm.RequestCount > 0 {
+		return pm.RequestCount
+	}
+	return pm.RequestRate * durationHours * 3600
 }
 
 // EndpointMetrics represents combined metrics for an endpoint
@@ -29,9 +56,14 @@ type EndpointMetrics struct {
 	Service     string              `json:"service" yaml:"service"`
 	Endpoint    string              `json:"endpoint" yaml:"endpoint"`
 	Method      string              `json:"method" yaml:"method"`
+	Type        string              `json:"type,omitempty" yaml:"type,omitempty"` // endpoint type, see Endpoint
 	Resource    *ResourceMetrics    `json:"resource" yaml:"resource"`
 	Performance *PerformanceMetrics `json:"performance" yaml:"performance"`
+	TimeSeries  TimeSeries          `json:"time_series,omitempty" yaml:"time_series,omitempty"` // requests, errors, latency_avg per bucket
 	TimeRange   TimeRange           `json:"time_range" yaml:"time_range"`
+
+	// ProfileCPUSeconds is the CPU time sampled by profiles under this endpoint's label
+	ProfileCPUSeconds float64 `json:"profile_cpu_seconds,omitempty" yaml:"profile_cpu_seconds,omitempty"`
 }
 
 // ServiceMetrics aggregates metrics for all endpoints in a service
@@ -39,20 +71,128 @@ type ServiceMetrics struct {
 	ServiceName string                      `json:"service_name" yaml:"service_name"`
 	Endpoints   map[string]*EndpointMetrics `json:"endpoints" yaml:"endpoints"`
 	Aggregate   *ResourceMetrics            `json:"aggregate" yaml:"aggregate"`
+	Series      map[string][]SeriesValue    `json:"series,omitempty" yaml:"series,omitempty"`           // per-series breakdown by metric name
+	Dimensions  map[string]string           `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`   // collection scope, e.g. namespace and cluster
+	TimeSeries  TimeSeries                  `json:"time_series,omitempty" yaml:"time_series,omitempty"` // cpu core-hours, memory GB-hours per bucket
 	TimeRange   TimeRange                   `json:"time_range" yaml:"time_range"`
+
+	// ProfileCPUSeconds is the CPU time sampled by profiles, with or without an endpoint label
+	ProfileCPUSeconds float64 `json:"profile_cpu_seconds,omitempty" yaml:"profile_cpu_seconds,omitempty"`
+}
+
+// SeriesValue is the contribution of a single source series (e.g. one pod) to a metric
+type SeriesValue struct {
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	Value  float64           `json:"value" yaml:"value"`
+}
+
+// TimePoint is the value of a metric over the time bucket starting at Timestamp
+type TimePoint struct {
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	Value     float64   `json:"value" yaml:"value"`
 }
 
+// TimeSeries holds downsampled points by metric name, ordered by time
+type TimeSeries map[string][]TimePoint
+
 // TimeRange represents a time window for metrics
 type TimeRange struct {
 	Start time.Time `json:"start" yaml:"start"`
 	End   time.Time `json:"end" yaml:"end"`
 }
 
+// Duration returns the length of the time range
+func (tr TimeRange) Duration() time.Duration {
+	return tr.End.Sub(tr.Start)
+}
+
+// ClusterMetrics represents node capacity paid for across the cluster, regardless
+// of which workloads use it
+type ClusterMetrics struct {
+	NodeHours             float64 `json:"node_hours" yaml:"node_hours"`
+	CPUCapacityCoreHours  float64 `json:"cpu_capacity_core_hours" yaml:"cpu_capacity_core_hours"`
+	MemoryCapacityGBHours float64 `json:"memory_capacity_gb_hours" yaml:"memory_capacity_gb_hours"`
+}
+
 // MetricsSnapshot represents a point-in-time snapshot of all metrics
 type MetricsSnapshot struct {
 	Services   map[string]*ServiceMetrics `json:"services" yaml:"services"`
+	Cluster    *ClusterMetrics            `json:"cluster,omitempty" yaml:"cluster,omitempty"`
 	CapturedAt time.Time                  `json:"captured_at" yaml:"captured_at"`
 	TimeRange  TimeRange                  `json:"time_range" yaml:"time_range"`
+	Dimensions map[string]string          `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	Resolution time.Duration              `json:"resolution,omitempty" yaml:"resolution,omitempty"` // time series bucket size
+	// Environments holds a separate snapshot per namespace or cluster when
+	// collection is split; the top-level metrics are their sum
+	Environments map[string]*MetricsSnapshot `json:"environments,omitempty" yaml:"environments,omitempty"`
+	// Status records the outcome of every metric query, by metric name
+	Status map[string]*MetricStatus `json:"status,omitempty" yaml:"status,omitempty"`
+	// Edges holds the traffic measured between services
+	Edges []*EdgeMetrics `json:"edges,omitempty" yaml:"edges,omitempty"`
+}
+
+// EdgeMetrics is the traffic measured on calls from one service to another, by
+// client-side or service mesh metrics. The called endpoint is only known when the
+// metrics carry it.
+type EdgeMetrics struct {
+	From          string  `json:"from" yaml:"from"`
+	To            string  `json:"to" yaml:"to"`
+	Endpoint      string  `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Method        string  `json:"method,omitempty" yaml:"method,omitempty"`
+	Calls         float64 `json:"calls" yaml:"calls"`                                       // total calls in the time range
+	RequestBytes  float64 `json:"request_bytes,omitempty" yaml:"request_bytes,omitempty"`   // total bytes sent by the caller
+	ResponseBytes float64 `json:"response_bytes,omitempty" yaml:"response_bytes,omitempty"` // total bytes sent by the callee
+}
+
+// MetricState is the outcome of collecting a metric
+type MetricState string
+
+const (
+	// MetricOK means the metric returned data
+	MetricOK MetricState = "ok"
+	// MetricEmpty means the query succeeded but matched no series
+	MetricEmpty MetricState = "empty"
+	// MetricError means the query failed
+	MetricError MetricState = "error"
+)
+
+// MetricStatus records how collection of a metric went
+type MetricStatus struct {
+	State  MetricState `json:"state" yaml:"state"`
+	Series int         `json:"series" yaml:"series"`
+	Error  string      `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Coverage counts the services and endpoints that received data
+type Coverage struct {
+	Services              int `json:"services" yaml:"services"`
+	ServicesWithCPU       int `json:"services_with_cpu" yaml:"services_with_cpu"`
+	ServicesWithMemory    int `json:"services_with_memory" yaml:"services_with_memory"`
+	Endpoints             int `json:"endpoints" yaml:"endpoints"`
+	EndpointsWithRequests int `json:"endpoints_with_requests" yaml:"endpoints_with_requests"`
+	EndpointsWithLatency  int `json:"endpoints_with_latency" yaml:"endpoints_with_latency"`
+}
+
+// Min returns the lowest coverage ratio, or 1 when there is nothing to cover
+func (c Coverage) Min() float64 {
+	ratio := func(covered, total int) float64 {
+		if total == 0 {
+			return 1
+		}
+		return float64(covered) / float64(total)
+	}
+
+	lowest := 1.0
+	for _, r := range []float64{
+		ratio(c.ServicesWithCPU, c.Services),
+		ratio(c.ServicesWithMemory, c.Services),
+		ratio(c.EndpointsWithRequests, c.Endpoints),
+	} {
+		if r < lowest {
+			lowest = r
+		}
+	}
+	return lowest
 }
 
 // NewMetricsSnapshot creates a new metrics snapshot
@@ -80,3 +220,81 @@ func (ms *MetricsSnapshot) GetServiceMetrics(serviceName string) (*ServiceMetric
 	sm, exists := ms.Services[serviceName]
 	return sm, exists
 }
+
+// Edge returns the metrics of the edge from one service to an endpoint of another,
+// adding an empty entry if there is none
+func (ms *MetricsSnapshot) Edge(from, to, endpoint, method string) *EdgeMetrics {
+	for _, em := range ms.Edges {
+		if em.From == from && em.To == to && em.Endpoint == endpoint && em.Method == method {
+			return em
+		}
+	}
+
+	em := &EdgeMetrics{From: from, To: to, Endpoint: endpoint, Method: method}
+	ms.Edges = append(ms.Edges, em)
+	return em
+}
+
+// RecordStatus merges the outcome of a metric query into the snapshot. Series
+// are summed; an error takes precedence over data, and data over an empty result.
+func (ms *MetricsSnapshot) RecordStatus(name string, status MetricStatus) {
+	if ms.Status == nil {
+		ms.Status = make(map[string]*MetricStatus)
+	}
+
+	existing, exists := ms.Status[name]
+	if !exists {
+		ms.Status[name] = &status
+		return
+	}
+
+	existing.Series += status.Series
+	switch {
+	case status.State == MetricError:
+		existing.State = MetricError
+		existing.Error = status.Error
+	case status.State == MetricOK && existing.State == MetricEmpty:
+		existing.State = MetricOK
+	}
+}
+
+// FailedMetrics returns the names of the metrics whose queries failed, sorted
+func (ms *MetricsSnapshot) FailedMetrics() []string {
+	failed := make([]string, 0)
+	for name, status := range ms.Status {
+		if status.State == MetricError {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// Coverage counts the services with CPU and memory data and the endpoints with
+// request and latency data
+func (ms *MetricsSnapshot) Coverage() Coverage {
+	var c Coverage
+	for _, sm := range ms.Services {
+		c.Services++
+		if sm.Aggregate != nil && sm.Aggregate.CPUCoreHours > 0 {
+			c.ServicesWithCPU++
+		}
+		if sm.Aggregate != nil && sm.Aggregate.MemoryGBHours > 0 {
+			c.ServicesWithMemory++
+		}
+
+		for _, em := range sm.Endpoints {
+			c.Endpoints++
+			if em.Performance == nil {
+				continue
+			}
+			if em.Performance.RequestCount > 0 || em.Performance.RequestRate > 0 {
+				c.EndpointsWithRequests++
+			}
+			if em.Performance.LatencyAvg > 0 || em.Performance.LatencyP50 > 0 {
+				c.EndpointsWithLatency++
+			}
+		}
+	}
+	return c
+}
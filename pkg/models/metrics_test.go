@@ -117,3 +117,78 @@ func TestEndpointMetrics(t *testing.T) {
 		t.Errorf("Expected request rate 50.0, got %f", em.Performance.RequestRate)
 	}
 }
+
+func TestTotalRequests(t *testing.T) {
+	pm := &PerformanceMetrics{RequestRate: 10.0}
+
+	// Without a measured total the rate is extrapolated over the duration
+	if total := pm.TotalRequests(1.0); total != 36000.0 {
+		t.Errorf("Expected 36000 requests, got %f", total)
+	}
+
+	pm.RequestCount = 35000.0
+	if total := pm.TotalRequests(1.0); total != 35000.0 {
+		t.Errorf("Expected measured total 35000, got %f", total)
+	}
+}
+
+func TestTimeRangeDuration(t *testing.T) {
+	start := time.Now()
+	tr := TimeRange{Start: start, End: start.Add(90 * time.Minute)}
+
+	if tr.Duration() != 90*time.Minute {
+		t.Errorf("Expected 90m, got %v", tr.Duration())
+	}
+}
+
+func TestRecordStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []MetricStatus
+		expected MetricState
+		series   int
+	}{
+		{"ok", []MetricStatus{{State: MetricOK, Series: 2}}, MetricOK, 2},
+		{"empty then ok", []MetricStatus{{State: MetricEmpty}, {State: MetricOK, Series: 1}}, MetricOK, 1},
+		{"ok then empty", []MetricStatus{{State: MetricOK, Series: 1}, {State: MetricEmpty}}, MetricOK, 1},
+		{"error wins", []MetricStatus{{State: MetricOK, Series: 3}, {State: MetricError, Error: "timeout"}}, MetricError, 3},
+	}
+
+	for _, tt := range tests {
+		snapshot := NewMetricsSnapshot(time.Now().Add(-1*time.Hour), time.Now())
+		for _, status := range tt.statuses {
+			snapshot.RecordStatus("cpu", status)
+		}
+
+		status := snapshot.Status["cpu"]
+		if status.State != tt.expected || status.Series != tt.series {
+			t.Errorf("%s: expected %s with %d series, got %s with %d", tt.name, tt.expected, tt.series, status.State, status.Series)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	snapshot := NewMetricsSnapshot(time.Now().Add(-1*time.Hour), time.Now())
+	snapshot.AddServiceMetrics(&ServiceMetrics{
+		ServiceName: "api",
+		Aggregate:   &ResourceMetrics{CPUCoreHours: 1, MemoryGBHours: 1},
+		Endpoints: map[string]*EndpointMetrics{
+			"/a:GET": {Performance: &PerformanceMetrics{RequestCount: 10}},
+			"/b:GET": {Performance: &PerformanceMetrics{}},
+		},
+	})
+	snapshot.AddServiceMetrics(&ServiceMetrics{
+		ServiceName: "worker",
+		Aggregate:   &ResourceMetrics{CPUCoreHours: 1},
+		Endpoints:   map[string]*EndpointMetrics{},
+	})
+
+	coverage := snapshot.Coverage()
+	if coverage.ServicesWithCPU != 2 || coverage.ServicesWithMemory != 1 || coverage.EndpointsWithRequests != 1 {
+		t.Errorf("Unexpected coverage: %+v", coverage)
+	}
+
+	if coverage.Min() != 0.5 {
+		t.Errorf("Expected minimum coverage 0.5, got %f", coverage.Min())
+	}
+}
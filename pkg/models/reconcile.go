@@ -0,0 +1,38 @@
+package models
+
+// BillReconciliation compares the modelled direct cost of services with the spend
+// a billing export attributes to them through a cost allocation tag or label
+type BillReconciliation struct {
+	Format          string             `json:"format" yaml:"format"` // aws_cur, gcp_billing
+	Tag             string             `json:"tag" yaml:"tag"`
+	Currency        string             `json:"currency,omitempty" yaml:"currency,omitempty"`
+	TimeRange       TimeRange          `json:"time_range" yaml:"time_range"`
+	ModelledCost    float64            `json:"modelled_cost" yaml:"modelled_cost"`       // direct cost of all services in the report
+	BilledCost      float64            `json:"billed_cost" yaml:"billed_cost"`           // billed cost of the services in the report
+	Variance        float64            `json:"variance" yaml:"variance"`                 // modelled minus billed
+	VariancePercent float64            `json:"variance_percent" yaml:"variance_percent"` // variance as a percentage of the billed cost
+	Tolerance       float64            `json:"tolerance" yaml:"tolerance"`               // percent variance above which a service is flagged
+	UntaggedCost    float64            `json:"untagged_cost" yaml:"untagged_cost"`       // billed cost without the tag
+	UnmodelledCost  float64            `json:"unmodelled_cost" yaml:"unmodelled_cost"`   // billed cost tagged with services not in the report
+	Unmodelled      map[string]float64 `json:"unmodelled,omitempty" yaml:"unmodelled,omitempty"`
+	Services        []*ServiceVariance `json:"services" yaml:"services"` // largest absolute variance first
+	Calibration     *Calibration       `json:"calibration,omitempty" yaml:"calibration,omitempty"`
+}
+
+// ServiceVariance is the difference between the modelled and billed cost of a service
+type ServiceVariance struct {
+	Service         string  `json:"service" yaml:"service"`
+	ModelledCost    float64 `json:"modelled_cost" yaml:"modelled_cost"`
+	BilledCost      float64 `json:"billed_cost" yaml:"billed_cost"`
+	Variance        float64 `json:"variance" yaml:"variance"`
+	VariancePercent float64 `json:"variance_percent" yaml:"variance_percent"`
+	OutOfTolerance  bool    `json:"out_of_tolerance" yaml:"out_of_tolerance"`
+}
+
+// Calibration holds unit rates scaled so that the modelled cost of the services
+// found in the bill matches their billed cost
+type Calibration struct {
+	Factor    float64    `json:"factor" yaml:"factor"`                             // billed over modelled cost, without fixed cost
+	FixedCost float64    `json:"fixed_cost,omitempty" yaml:"fixed_cost,omitempty"` // modelled cost that does not follow the rates
+	CostModel *CostModel `json:"cost_model" yaml:"cost_model"`
+}
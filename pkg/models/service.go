@@ -11,10 +11,23 @@ type Service struct {
 	Metadata     map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
-// Endpoint represents an API endpoint within a service
+// Endpoint types. An endpoint without a type is an HTTP endpoint. A mesh endpoint
+// stands for all traffic of a service discovered from service mesh telemetry.
+const (
+	EndpointHTTP = "http"
+	EndpointGRPC = "grpc"
+	EndpointMesh = "mesh"
+)
+
+// MeshEndpointPath is the path and method of the endpoint of a mesh service
+const MeshEndpointPath = "*"
+
+// Endpoint represents an API endpoint within a service. For gRPC endpoints the
+// path is the RPC method, optionally qualified as /package.Service/Method.
 type Endpoint struct {
 	Path          string           `json:"path" yaml:"path"`
 	Method        string           `json:"method" yaml:"method"`
+	Type          string           `json:"type,omitempty" yaml:"type,omitempty"` // http, grpc, mesh
 	Service       *Service         `json:"-" yaml:"-"`
 	Dependencies  []*Dependency    `json:"dependencies" yaml:"dependencies"`
 	DirectCost    float64          `json:"direct_cost" yaml:"direct_cost"`
@@ -28,16 +41,25 @@ type Dependency struct {
 	ID           string  `json:"id" yaml:"id"`
 	FromService  string  `json:"from_service" yaml:"from_service"`
 	FromEndpoint string  `json:"from_endpoint" yaml:"from_endpoint"`
+	FromMethod   string  `json:"from_method,omitempty" yaml:"from_method,omitempty"` // empty for every method of the path
 	ToService    string  `json:"to_service" yaml:"to_service"`
 	ToEndpoint   string  `json:"to_endpoint" yaml:"to_endpoint"`
-	CallType     string  `json:"call_type" yaml:"call_type"` // http, grpc, internal
-	Weight       float64 `json:"weight" yaml:"weight"`       // calls per parent call
+	ToMethod     string  `json:"to_method,omitempty" yaml:"to_method,omitempty"` // empty when not known
+	CallType     string  `json:"call_type" yaml:"call_type"`                     // http, grpc, internal
+	Weight       float64 `json:"weight" yaml:"weight"`                           // calls per parent call
 	DetectedAt   string  `json:"detected_at" yaml:"detected_at"`
 	LineNumber   int     `json:"line_number,omitempty" yaml:"line_number,omitempty"`
+
+	// Measured is set when the weight and bytes come from client-side or mesh
+	// metrics instead of the static analysis
+	Measured      bool    `json:"measured,omitempty" yaml:"measured,omitempty"`
+	RequestBytes  float64 `json:"request_bytes,omitempty" yaml:"request_bytes,omitempty"`   // bytes sent per call
+	ResponseBytes float64 `json:"response_bytes,omitempty" yaml:"response_bytes,omitempty"` // bytes received per call
 }
 
 // CallGraph represents the complete dependency graph of all services
 type CallGraph struct {
+	Version      int                 `json:"version" yaml:"version"`
 	Services     map[string]*Service `json:"services" yaml:"services"`
 	Dependencies []*Dependency       `json:"dependencies" yaml:"dependencies"`
 	GeneratedAt  time.Time           `json:"generated_at" yaml:"generated_at"`
@@ -47,6 +69,7 @@ type CallGraph struct {
 // NewCallGraph creates a new empty call graph
 func NewCallGraph() *CallGraph {
 	return &CallGraph{
+		Version:      CallGraphVersion,
 		Services:     make(map[string]*Service),
 		Dependencies: make([]*Dependency, 0),
 		GeneratedAt:  time.Now(),
@@ -83,6 +106,16 @@ func (s *Service) GetEndpoint(path, method string) (*Endpoint, bool) {
 	return nil, false
 }
 
+// IsGRPC reports whether the endpoint is a gRPC method
+func (e *Endpoint) IsGRPC() bool {
+	return e.Type == EndpointGRPC
+}
+
+// IsMesh reports whether the endpoint carries all traffic of a mesh service
+func (e *Endpoint) IsMesh() bool {
+	return e.Type == EndpointMesh
+}
+
 // AddEndpoint adds an endpoint to the service
 func (s *Service) AddEndpoint(endpoint *Endpoint) {
 	endpoint.Service = s
@@ -78,7 +78,10 @@ func TestEndToEndAnalysis(t *testing.T) {
 
 	// Step 3: Calculate costs
 	t.Log("Step 3: Calculating costs...")
-	calculator := costengine.NewCalculator(&cfg.CostModel, g, logger)
+	calculator, err := costengine.NewCalculator(&cfg.CostModel, g, logger)
+	if err != nil {
+		t.Fatalf("Failed to create calculator: %v", err)
+	}
 	costReport, err := calculator.CalculateCosts(callGraph, metricsSnapshot, timeRange)
 
 	if err != nil {